@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/actiontech/dtle/driver/mysql/base"
 	"github.com/actiontech/dtle/driver/mysql/mysqlconfig"
 	"github.com/actiontech/dtle/driver/oracle/config"
 
@@ -39,6 +40,8 @@ const (
 // @Param service_name query string false "database service_name"
 // @Param character_set query string false "database character set"
 // @Param is_password_encrypted query bool false "indecate that database password is encrypted or not"
+// @Param include_system query bool false "MySQL: list system schemas (mysql, sys, information_schema, performance_schema)"
+// @Param include_temporary query bool false "MySQL: list temporary tables of ALTER TABLE, gh-ost and pt-online-schema-change"
 // @Success 200 {object} models.ListSchemasRespV2
 // @Router /v2/database/schemas [get]
 func ListDatabaseSchemasV2(c echo.Context) error {
@@ -83,8 +86,11 @@ func listMySQLSchema(logger hclog.Logger, reqParam *models.ListDatabaseSchemasRe
 	defer db.Close()
 
 	logger.Info("get schemas and tables from mysql")
+	return listMySQLSchemaOfDB(db, reqParam.IncludeSystem, reqParam.IncludeTemporary)
+}
 
-	dbs, err := sql.ShowDatabases(db)
+func listMySQLSchemaOfDB(db *gosql.DB, includeSystem bool, includeTemporary bool) ([]*models.SchemaItem, error) {
+	dbs, err := sql.ShowDatabases(db, includeSystem)
 	if err != nil {
 		return nil, err
 	}
@@ -101,6 +107,9 @@ func listMySQLSchema(logger hclog.Logger, reqParam *models.ListDatabaseSchemasRe
 			if strings.ToLower(t.TableType) == "view" {
 				continue
 			}
+			if !includeTemporary && sql.IsTemporaryTable(t.TableName) {
+				continue
+			}
 			tb := &models.TableItem{
 				TableName: t.TableName,
 			}
@@ -347,3 +356,113 @@ func connectDatabase(reqParam *models.ConnectionReqV2) error {
 
 	return nil
 }
+
+// @Id SuggestParallelWorkersV2
+// @Description suggest ParallelWorkers and MaxOpenConns for applying to a MySQL target instance.
+// @Tags database
+// @Security ApiKeyAuth
+// @Param host query string true "database host"
+// @Param port query int true "database port"
+// @Param user query string true "database user"
+// @Param password query string true "database password"
+// @Param cpu_count query int false "cpu count of the database host. 0 means unknown"
+// @Param is_password_encrypted query bool false "indecate that database password is encrypted or not"
+// @Success 200 {object} models.SuggestParallelWorkersRespV2
+// @Router /v2/database/parallel_workers_suggestion [get]
+func SuggestParallelWorkersV2(c echo.Context) error {
+	logger := handler.NewLogger().Named("SuggestParallelWorkersV2")
+	reqParam := new(models.SuggestParallelWorkersReqV2)
+	if err := handler.BindAndValidate(logger, c, reqParam); err != nil {
+		return c.JSON(http.StatusInternalServerError, models.BuildBaseResp(err))
+	}
+
+	uri, err := buildMysqlUri(reqParam.Host, reqParam.User, reqParam.Password,
+		"", reqParam.Port, reqParam.IsPasswordEncrypted)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.BuildBaseResp(fmt.Errorf("build database Uri failed: %v", err)))
+	}
+	db, err := sql.CreateDB(uri)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.BuildBaseResp(err))
+	}
+	defer db.Close()
+
+	resp, err := suggestParallelWorkers(logger, db, reqParam.CpuCount)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.BuildBaseResp(fmt.Errorf("suggest ParallelWorkers failed: %v", err)))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func suggestParallelWorkers(logger hclog.Logger, db sql.QueryAble, cpuCount int) (*models.SuggestParallelWorkersRespV2, error) {
+	r, err := base.QueryParallelWorkersSuggestion(db, logger, cpuCount)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SuggestParallelWorkersRespV2{
+		ParallelWorkers: r.ParallelWorkers,
+		MaxOpenConns:    r.MaxOpenConns,
+		Reasons:         r.Reasons,
+		BaseResp:        models.BuildBaseResp(nil),
+	}, nil
+}
+
+// @Id CheckPrivilegesV2
+// @Description check privileges of a MySQL user for the role of extractor (src) or applier (dest).
+// @Tags database
+// @Security ApiKeyAuth
+// @Param host query string true "database host"
+// @Param port query int true "database port"
+// @Param user query string true "database user"
+// @Param password query string true "database password"
+// @Param role query string true "extractor or applier"
+// @Param set_gtid_next query bool false "applier: whether SetGtidNext is enabled"
+// @Param is_password_encrypted query bool false "indecate that database password is encrypted or not"
+// @Success 200 {object} models.CheckPrivilegesRespV2
+// @Router /v2/database/privileges [get]
+func CheckPrivilegesV2(c echo.Context) error {
+	logger := handler.NewLogger().Named("CheckPrivilegesV2")
+	reqParam := new(models.CheckPrivilegesReqV2)
+	if err := handler.BindAndValidate(logger, c, reqParam); err != nil {
+		return c.JSON(http.StatusInternalServerError, models.BuildBaseResp(err))
+	}
+
+	uri, err := buildMysqlUri(reqParam.Host, reqParam.User, reqParam.Password,
+		"", reqParam.Port, reqParam.IsPasswordEncrypted)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.BuildBaseResp(fmt.Errorf("build database Uri failed: %v", err)))
+	}
+	db, err := sql.CreateDB(uri)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.BuildBaseResp(err))
+	}
+	defer db.Close()
+
+	resp, err := checkPrivileges(logger, db, reqParam.Role, reqParam.SetGtidNext)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.BuildBaseResp(fmt.Errorf("check privileges failed: %v", err)))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func checkPrivileges(logger hclog.Logger, db sql.QueryAble, role string, setGtidNext bool) (*models.CheckPrivilegesRespV2, error) {
+	var r *base.GrantsCheckResult
+	var err error
+	switch role {
+	case "extractor":
+		r, err = base.CheckExtractorGrants(db, logger)
+	case "applier":
+		r, err = base.CheckApplierGrants(db, logger, setGtidNext)
+	default:
+		return nil, fmt.Errorf("unknown role %v", role)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &models.CheckPrivilegesRespV2{
+		Sufficient: r.Sufficient(),
+		Present:    r.Present,
+		Missing:    r.Missing,
+		BaseResp:   models.BuildBaseResp(nil),
+	}, nil
+}
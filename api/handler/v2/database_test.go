@@ -0,0 +1,148 @@
+package v2
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/actiontech/dtle/g"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestSuggestParallelWorkers(t *testing.T) {
+	tests := []struct {
+		name               string
+		maxConnections     int
+		usedConnections    int
+		cpuCount           int
+		wantWorkers        int
+		wantMaxOpenConnsLE int
+	}{
+		{name: "low max_connections", maxConnections: 20, usedConnections: 5, cpuCount: 0,
+			wantWorkers: 1, wantMaxOpenConnsLE: 20 - 5 - 10},
+		{name: "plenty of connections", maxConnections: 1000, usedConnections: 100, cpuCount: 0,
+			wantWorkers: 1000 - 100 - 200 - 10, wantMaxOpenConnsLE: 1000 - 100 - 200},
+		{name: "limited by cpu", maxConnections: 1000, usedConnections: 100, cpuCount: 4,
+			wantWorkers: 8, wantMaxOpenConnsLE: 18},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery("select @@version").WillReturnRows(sqlmock.NewRows(
+				[]string{"@@version", "@@time_zone", "@@lower_case_table_names", "@@net_write_timeout", "@@max_connections"}).
+				AddRow("5.7.32-log", "SYSTEM", 0, 60, tt.maxConnections))
+			mock.ExpectQuery("select count").WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).
+				AddRow(tt.usedConnections))
+
+			resp, err := suggestParallelWorkers(hclog.NewNullLogger(), db, tt.cpuCount)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.ParallelWorkers != tt.wantWorkers {
+				t.Errorf("ParallelWorkers = %v, want %v. reasons: %v", resp.ParallelWorkers, tt.wantWorkers, resp.Reasons)
+			}
+			if resp.MaxOpenConns > tt.wantMaxOpenConnsLE && resp.MaxOpenConns > resp.ParallelWorkers+1 {
+				t.Errorf("MaxOpenConns = %v, want <= %v", resp.MaxOpenConns, tt.wantMaxOpenConnsLE)
+			}
+			if len(resp.Reasons) == 0 {
+				t.Errorf("no reasons")
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCheckPrivilegesMissingReplicationSlave(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("show grants for current_user()").WillReturnRows(
+		sqlmock.NewRows([]string{"Grants for dtle@%"}).
+			AddRow("GRANT SELECT, REPLICATION CLIENT ON *.* TO `dtle`@`%`"))
+
+	resp, err := checkPrivileges(hclog.NewNullLogger(), db, "extractor", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Sufficient {
+		t.Errorf("expect insufficient privileges")
+	}
+	if !reflect.DeepEqual(resp.Missing, []string{"REPLICATION SLAVE"}) {
+		t.Errorf("missing %v, expect [REPLICATION SLAVE]", resp.Missing)
+	}
+	if !reflect.DeepEqual(resp.Present, []string{"REPLICATION CLIENT", "SELECT"}) {
+		t.Errorf("present %v, expect [REPLICATION CLIENT SELECT]", resp.Present)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListMySQLSchemaSystemSchemas(t *testing.T) {
+	if g.Logger == nil {
+		g.Logger = hclog.NewNullLogger()
+	}
+	list := func(includeSystem bool, includeTemporary bool) map[string][]string {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		schemas := []string{"db1", "mysql", "sys", "information_schema", "performance_schema"}
+		rows := sqlmock.NewRows([]string{"Database"})
+		for _, schema := range schemas {
+			rows.AddRow(schema)
+		}
+		mock.ExpectQuery("SHOW DATABASES").WillReturnRows(rows)
+		for _, schema := range schemas {
+			if !includeSystem && schema != "db1" {
+				continue
+			}
+			mock.ExpectQuery(regexp.QuoteMeta("SHOW FULL TABLES IN `" + schema + "`")).WillReturnRows(
+				sqlmock.NewRows([]string{"Tables_in_" + schema, "Table_type"}).
+					AddRow("t1", "BASE TABLE").
+					AddRow("_t1_gho", "BASE TABLE").
+					AddRow("#sql-1a2b_3", "BASE TABLE").
+					AddRow("v1", "VIEW"))
+		}
+
+		items, err := listMySQLSchemaOfDB(db, includeSystem, includeTemporary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		r := make(map[string][]string)
+		for _, item := range items {
+			r[item.SchemaName] = []string{}
+			for _, table := range item.Tables {
+				r[item.SchemaName] = append(r[item.SchemaName], table.TableName)
+			}
+		}
+		return r
+	}
+
+	if got := list(false, false); !reflect.DeepEqual(got, map[string][]string{"db1": {"t1"}}) {
+		t.Errorf("expect system schemas and temporary tables hidden by default, got %v", got)
+	}
+	got := list(true, true)
+	if len(got) != 5 {
+		t.Errorf("expect system schemas listed with include_system, got %v", got)
+	}
+	if !reflect.DeepEqual(got["db1"], []string{"t1", "_t1_gho", "#sql-1a2b_3"}) {
+		t.Errorf("expect temporary tables listed with include_temporary, got %v", got["db1"])
+	}
+}
@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sort"
 
 	"github.com/actiontech/dtle/g"
 
+	dtle "github.com/actiontech/dtle/driver"
+	"github.com/actiontech/dtle/driver/common"
+
 	"github.com/actiontech/dtle/api/handler"
 	"github.com/actiontech/dtle/api/models"
 	"github.com/labstack/echo/v4"
@@ -73,6 +77,119 @@ func GetTaskProgressV2(c echo.Context) error {
 	return c.JSON(http.StatusOK, &res)
 }
 
+// getJobStatistics returns statistics of tasks of the job running on this dtle, by task name.
+var getJobStatistics = func(jobId string) (map[string]*common.TaskStatistics, error) {
+	if dtle.AllocIdTaskNameToTaskHandler == nil {
+		return nil, nil
+	}
+	return dtle.AllocIdTaskNameToTaskHandler.GetJobStatistics(jobId)
+}
+
+// @Id GetJobStatsV2
+// @Description get live statistics of tasks of a job running on this dtle, for dashboards.
+// @Tags monitor
+// @Security ApiKeyAuth
+// @Param job_id query string true "job id"
+// @Success 200 {object} models.GetJobStatsRespV2
+// @Router /v2/job/stats [get]
+func GetJobStatsV2(c echo.Context) error {
+	logger := handler.NewLogger().Named("GetJobStatsV2")
+
+	reqParam := new(models.GetJobStatsReqV2)
+	if err := handler.BindAndValidate(logger, c, reqParam); err != nil {
+		return c.JSON(http.StatusInternalServerError, models.BuildBaseResp(err))
+	}
+
+	statsByTask, err := getJobStatistics(reqParam.JobId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.BuildBaseResp(fmt.Errorf("get stats of job %v failed: %v", reqParam.JobId, err)))
+	}
+
+	res := &models.GetJobStatsRespV2{
+		JobId:    reqParam.JobId,
+		Running:  len(statsByTask) > 0,
+		Tasks:    []*models.TaskStatsV2{},
+		BaseResp: models.BuildBaseResp(nil),
+	}
+	for taskName, stats := range statsByTask {
+		res.Tasks = append(res.Tasks, buildTaskStatsV2(taskName, stats))
+	}
+	sort.Slice(res.Tasks, func(i, j int) bool {
+		return res.Tasks[i].TaskName < res.Tasks[j].TaskName
+	})
+	return c.JSON(http.StatusOK, res)
+}
+
+// getJobSchemaCache returns the cached table definitions of tasks of the job running on this dtle, by task name.
+var getJobSchemaCache = func(jobId string) map[string]map[string]string {
+	if dtle.AllocIdTaskNameToTaskHandler == nil {
+		return nil
+	}
+	return dtle.AllocIdTaskNameToTaskHandler.GetJobSchemaCache(jobId)
+}
+
+// @Id GetJobSchemaCacheV2
+// @Description get table definitions cached by tasks of a job running on this dtle, for debugging.
+// @Tags monitor
+// @Security ApiKeyAuth
+// @Param job_id query string true "job id"
+// @Success 200 {object} models.GetJobSchemaCacheRespV2
+// @Router /v2/job/schema_cache [get]
+func GetJobSchemaCacheV2(c echo.Context) error {
+	logger := handler.NewLogger().Named("GetJobSchemaCacheV2")
+
+	reqParam := new(models.GetJobSchemaCacheReqV2)
+	if err := handler.BindAndValidate(logger, c, reqParam); err != nil {
+		return c.JSON(http.StatusInternalServerError, models.BuildBaseResp(err))
+	}
+
+	res := &models.GetJobSchemaCacheRespV2{
+		JobId:    reqParam.JobId,
+		Tasks:    []*models.TaskSchemaCacheV2{},
+		BaseResp: models.BuildBaseResp(nil),
+	}
+	for taskName, tables := range getJobSchemaCache(reqParam.JobId) {
+		res.Tasks = append(res.Tasks, &models.TaskSchemaCacheV2{TaskName: taskName, Tables: tables})
+	}
+	sort.Slice(res.Tasks, func(i, j int) bool {
+		return res.Tasks[i].TaskName < res.Tasks[j].TaskName
+	})
+	return c.JSON(http.StatusOK, res)
+}
+
+func buildTaskStatsV2(taskName string, stats *common.TaskStatistics) *models.TaskStatsV2 {
+	r := &models.TaskStatsV2{
+		TaskName:      taskName,
+		Stage:         stats.Stage,
+		ProgressPct:   stats.ProgressPct,
+		ETA:           stats.ETA,
+		Backlog:       stats.Backlog,
+		ExecRowCount:  stats.ExecMasterRowCount,
+		ExecTxCount:   stats.ExecMasterTxCount,
+		ReadRowCount:  stats.ReadMasterRowCount,
+		ReadTxCount:   stats.ReadMasterTxCount,
+		SkippedTables: stats.SkippedTables,
+		Timestamp:     stats.Timestamp,
+		Throughput:    &models.ThroughputStat{},
+		TableStats:    &models.TableStatsV2{},
+
+		ValidationWarnings: stats.ValidationWarnings,
+	}
+	if stats.DelayCount != nil {
+		r.DelaySeconds = stats.DelayCount.Time
+	}
+	if stats.ThroughputStat != nil {
+		r.Throughput.Num = stats.ThroughputStat.Num
+		r.Throughput.Time = stats.ThroughputStat.Time
+	}
+	if stats.TableStats != nil {
+		r.TableStats.InsertCount = stats.TableStats.InsertCount
+		r.TableStats.UpdateCount = stats.TableStats.UpdateCount
+		r.TableStats.DeleteCount = stats.TableStats.DelCount
+	}
+	return r
+}
+
 func getApiAddrFromAgentConfig(agentConfig map[string]interface{}) (ip, port string, err error) {
 	plugins, ok := agentConfig["Plugins"].([]interface{})
 	if !ok {
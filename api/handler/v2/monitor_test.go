@@ -0,0 +1,139 @@
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/api/handler"
+	"github.com/actiontech/dtle/api/models"
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/actiontech/dtle/g"
+	"github.com/hashicorp/go-hclog"
+	"github.com/labstack/echo/v4"
+)
+
+func TestGetJobStatsV2(t *testing.T) {
+	if g.Logger == nil {
+		g.Logger = hclog.NewNullLogger()
+	}
+	oldGetJobStatistics := getJobStatistics
+	defer func() { getJobStatistics = oldGetJobStatistics }()
+	getJobStatistics = func(jobId string) (map[string]*common.TaskStatistics, error) {
+		if jobId != "job1-migration" {
+			return nil, nil
+		}
+		return map[string]*common.TaskStatistics{
+			"src": {Stage: common.StageSendingData, ProgressPct: "42.0", ETA: "1m0s",
+				ReadMasterRowCount: 420, ThroughputStat: &common.ThroughputStat{Num: 100, Time: 10}},
+			"dest": {Stage: common.StageSlaveWaitingForWorkersToProcessQueue, ProgressPct: "40.0",
+				ExecMasterRowCount: 400, DelayCount: &common.DelayCount{Time: 3},
+				TableStats: &common.TableStats{InsertCount: 300, UpdateCount: 90, DelCount: 10}},
+		}, nil
+	}
+
+	getJobStats := func(jobId string) (map[string]interface{}, *models.GetJobStatsRespV2) {
+		e := echo.New()
+		e.Validator = handler.NewValidator()
+		req := httptest.NewRequest(http.MethodGet, "/v2/job/stats?job_id="+jobId, nil)
+		rec := httptest.NewRecorder()
+		if err := GetJobStatsV2(e.NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %v: %v", rec.Code, rec.Body.String())
+		}
+		raw := map[string]interface{}{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+			t.Fatal(err)
+		}
+		resp := &models.GetJobStatsRespV2{}
+		if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+			t.Fatal(err)
+		}
+		return raw, resp
+	}
+
+	raw, resp := getJobStats("job1-migration")
+	for _, key := range []string{"job_id", "running", "tasks", "message"} {
+		if _, ok := raw[key]; !ok {
+			t.Errorf("missing %v in %v", key, raw)
+		}
+	}
+	if !resp.Running || len(resp.Tasks) != 2 {
+		t.Fatalf("expect 2 running tasks, got %+v", resp)
+	}
+	dest, src := resp.Tasks[0], resp.Tasks[1]
+	if dest.TaskName != "dest" || src.TaskName != "src" {
+		t.Fatalf("tasks should be sorted by name, got %v %v", dest.TaskName, src.TaskName)
+	}
+	if dest.DelaySeconds != 3 || dest.ExecRowCount != 400 ||
+		!reflect.DeepEqual(dest.TableStats, &models.TableStatsV2{InsertCount: 300, UpdateCount: 90, DeleteCount: 10}) {
+		t.Errorf("unexpected dest stats %+v", dest)
+	}
+	if src.ProgressPct != "42.0" || src.ETA != "1m0s" || src.Throughput.Num != 100 || src.Throughput.Time != 10 {
+		t.Errorf("unexpected src stats %+v", src)
+	}
+	task := raw["tasks"].([]interface{})[0].(map[string]interface{})
+	for _, key := range []string{"task_name", "stage", "progress_pct", "eta", "delay_seconds", "throughput", "table_stats"} {
+		if _, ok := task[key]; !ok {
+			t.Errorf("missing %v in task %v", key, task)
+		}
+	}
+
+	// a stopped job
+	raw, resp = getJobStats("job2-migration")
+	if resp.Running || resp.JobId != "job2-migration" {
+		t.Errorf("expect a stopped job, got %+v", resp)
+	}
+	if tasks, ok := raw["tasks"].([]interface{}); !ok || len(tasks) != 0 {
+		t.Errorf("expect empty tasks, got %v", raw["tasks"])
+	}
+}
+
+func TestGetJobSchemaCacheV2(t *testing.T) {
+	if g.Logger == nil {
+		g.Logger = hclog.NewNullLogger()
+	}
+	oldGetJobSchemaCache := getJobSchemaCache
+	defer func() { getJobSchemaCache = oldGetJobSchemaCache }()
+	getJobSchemaCache = func(jobId string) map[string]map[string]string {
+		if jobId != "job1-migration" {
+			return nil
+		}
+		return map[string]map[string]string{
+			"src": {"db1.t1": "CREATE TABLE `t1` (`id` INT,`c2` BIGINT)"},
+		}
+	}
+
+	getCache := func(jobId string) *models.GetJobSchemaCacheRespV2 {
+		e := echo.New()
+		e.Validator = handler.NewValidator()
+		req := httptest.NewRequest(http.MethodGet, "/v2/job/schema_cache?job_id="+jobId, nil)
+		rec := httptest.NewRecorder()
+		if err := GetJobSchemaCacheV2(e.NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %v: %v", rec.Code, rec.Body.String())
+		}
+		resp := &models.GetJobSchemaCacheRespV2{}
+		if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := getCache("job1-migration")
+	expect := []*models.TaskSchemaCacheV2{
+		{TaskName: "src", Tables: map[string]string{"db1.t1": "CREATE TABLE `t1` (`id` INT,`c2` BIGINT)"}},
+	}
+	if resp.JobId != "job1-migration" || !reflect.DeepEqual(resp.Tasks, expect) {
+		t.Errorf("unexpected resp %+v", resp)
+	}
+	if resp = getCache("job2-migration"); resp.Tasks == nil || len(resp.Tasks) != 0 {
+		t.Errorf("expect empty tasks for a stopped job, got %+v", resp.Tasks)
+	}
+}
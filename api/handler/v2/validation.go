@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	mysql "github.com/actiontech/dtle/driver/mysql"
+	"github.com/actiontech/dtle/driver/mysql/base"
 
 	"github.com/actiontech/dtle/api/handler"
 	"github.com/actiontech/dtle/api/models"
@@ -100,6 +101,7 @@ func decryptMySQLPwd(apiSrcTask *models.SrcTaskConfig, apiDestTask *models.DestT
 func validateTaskConfig(apiSrcTask *models.SrcTaskConfig, apiDestTask *models.DestTaskConfig) ([]*models.MysqlTaskValidationReport, error) {
 	taskValidationRes := []*models.MysqlTaskValidationReport{}
 	srcTaskConfig := common.DtleTaskConfig{}
+	var srcTimeSettings *base.TimeSettings
 	// validate src task
 	if apiSrcTask.MysqlSrcTaskConfig != nil {
 		srcTaskMap := buildDatabaseSrcTaskConfigMap(apiSrcTask, apiDestTask, nil)
@@ -146,6 +148,12 @@ func validateTaskConfig(apiSrcTask *models.SrcTaskConfig, apiDestTask *models.De
 			validationRes.PrivilegesValidation.Error = err.Error()
 		}
 
+		if ts, err := srcTaskInspector.GetTimeSettings(); nil != err {
+			g.Logger.Warn("validateTaskConfig: cannot get time settings of source", "err", err)
+		} else {
+			srcTimeSettings = ts
+		}
+
 	endSrcTaskValidation:
 		taskValidationRes = append(taskValidationRes, validationRes)
 	}
@@ -181,9 +189,25 @@ func validateTaskConfig(apiSrcTask *models.SrcTaskConfig, apiDestTask *models.De
 			validationRes.PrivilegesValidation.Error = err.Error()
 		}
 
+		if srcTimeSettings != nil {
+			validationRes.TimeSettingsValidation = validateTimeSettings(srcTimeSettings, destTaskInspector)
+		}
+
 	endDestTaskValidation:
 		taskValidationRes = append(taskValidationRes, validationRes)
 	}
 
 	return taskValidationRes, nil
 }
+
+// validateTimeSettings compares TIMESTAMP/DATETIME related settings of the source and the target.
+func validateTimeSettings(src *base.TimeSettings, destTaskInspector *mysql.Applier) *models.TimeSettingsValidation {
+	r := &models.TimeSettingsValidation{Validated: true}
+	dst, err := destTaskInspector.GetTimeSettings()
+	if nil != err {
+		r.Error = err.Error()
+		return r
+	}
+	r.Warnings = base.CompareTimeSettings(src, dst)
+	return r
+}
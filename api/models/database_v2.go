@@ -9,6 +9,8 @@ type ListDatabaseSchemasReqV2 struct {
 	ServiceName         string `query:"service_name"`
 	CharacterSet        string `query:"character_set"`
 	IsPasswordEncrypted bool   `query:"is_password_encrypted"`
+	IncludeSystem       bool   `query:"include_system"`
+	IncludeTemporary    bool   `query:"include_temporary"`
 }
 
 type ListSchemasRespV2 struct {
@@ -56,3 +58,36 @@ type ConnectionReqV2 struct {
 type ConnectionRespV2 struct {
 	BaseResp
 }
+
+type SuggestParallelWorkersReqV2 struct {
+	Host                string `query:"host" validate:"required"`
+	Port                int    `query:"port" validate:"required"`
+	User                string `query:"user" validate:"required"`
+	Password            string `query:"password" validate:"required"`
+	CpuCount            int    `query:"cpu_count"`
+	IsPasswordEncrypted bool   `query:"is_password_encrypted"`
+}
+
+type SuggestParallelWorkersRespV2 struct {
+	ParallelWorkers int      `json:"parallel_workers"`
+	MaxOpenConns    int      `json:"max_open_conns"`
+	Reasons         []string `json:"reasons"`
+	BaseResp
+}
+
+type CheckPrivilegesReqV2 struct {
+	Host                string `query:"host" validate:"required"`
+	Port                int    `query:"port" validate:"required"`
+	User                string `query:"user" validate:"required"`
+	Password            string `query:"password" validate:"required"`
+	Role                string `query:"role" validate:"required,oneof=extractor applier"`
+	SetGtidNext         bool   `query:"set_gtid_next"`
+	IsPasswordEncrypted bool   `query:"is_password_encrypted"`
+}
+
+type CheckPrivilegesRespV2 struct {
+	Sufficient bool     `json:"sufficient"`
+	Present    []string `json:"present"`
+	Missing    []string `json:"missing"`
+	BaseResp
+}
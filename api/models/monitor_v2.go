@@ -64,3 +64,59 @@ type NatsMessageStatistics struct {
 	OutBytes   uint64 `json:"out_bytes"`
 	Reconnects uint64 `json:"reconnects"`
 }
+
+type GetJobStatsReqV2 struct {
+	JobId string `query:"job_id" validate:"required"`
+}
+
+type GetJobStatsRespV2 struct {
+	JobId string `json:"job_id"`
+	// false if no task of the job is running on this dtle
+	Running bool           `json:"running"`
+	Tasks   []*TaskStatsV2 `json:"tasks"`
+	BaseResp
+}
+
+type TaskStatsV2 struct {
+	TaskName    string `json:"task_name"`
+	Stage       string `json:"stage"`
+	ProgressPct string `json:"progress_pct"`
+	ETA         string `json:"eta"`
+	Backlog     string `json:"backlog"`
+	// replication lag
+	DelaySeconds  int64           `json:"delay_seconds"`
+	Throughput    *ThroughputStat `json:"throughput"`
+	ExecRowCount  int64           `json:"exec_row_count"`
+	ExecTxCount   int64           `json:"exec_tx_count"`
+	ReadRowCount  int64           `json:"read_row_count"`
+	ReadTxCount   int64           `json:"read_tx_count"`
+	TableStats    *TableStatsV2   `json:"table_stats"`
+	SkippedTables []string        `json:"skipped_tables"`
+	Timestamp     int64           `json:"timestamp"`
+	// src: warnings of validating tables, e.g. no valid unique key
+	ValidationWarnings []string `json:"validation_warnings"`
+}
+
+// TableStatsV2 counts rows of DML applied to the tables of the task.
+type TableStatsV2 struct {
+	InsertCount int64 `json:"insert_count"`
+	UpdateCount int64 `json:"update_count"`
+	DeleteCount int64 `json:"delete_count"`
+}
+
+type GetJobSchemaCacheReqV2 struct {
+	JobId string `query:"job_id" validate:"required"`
+}
+
+type GetJobSchemaCacheRespV2 struct {
+	JobId string               `json:"job_id"`
+	Tasks []*TaskSchemaCacheV2 `json:"tasks"`
+	BaseResp
+}
+
+// TaskSchemaCacheV2 is the cache of table definitions of a task, used to parse the binlog.
+type TaskSchemaCacheV2 struct {
+	TaskName string `json:"task_name"`
+	// "schema.table" => CREATE TABLE, with later ALTERs merged
+	Tables map[string]string `json:"tables"`
+}
@@ -24,6 +24,15 @@ type MysqlTaskValidationReport struct {
 	GtidModeValidation   *GtidModeValidation   `json:"gtid_mode_validation"`
 	ServerIdValidation   *ServerIDValidation   `json:"server_id_validation"`
 	BinlogValidation     *BinlogValidation     `json:"binlog_validation"`
+	// dest only. compares TIMESTAMP/DATETIME related settings with the source.
+	TimeSettingsValidation *TimeSettingsValidation `json:"time_settings_validation,omitempty"`
+}
+
+type TimeSettingsValidation struct {
+	Validated bool     `json:"validated"`
+	Warnings  []string `json:"warnings"`
+	// Error is a string version of any error that may have occured
+	Error string `json:"error"`
 }
 
 type BinlogValidation struct {
@@ -88,6 +88,8 @@ func SetupApiServer(logger g.LoggerType, driverConfig *dtle.DriverConfig) (err e
 	e.POST("/v2/log/level", v2.UpdateLogLevelV2)
 	v2Router.GET("/jobs/migration", v2.MigrationJobListV2)
 	v2Router.GET("/job/migration/detail", v2.GetMigrationJobDetailV2)
+	v2Router.GET("/job/stats", v2.GetJobStatsV2)
+	v2Router.GET("/job/schema_cache", v2.GetJobSchemaCacheV2)
 	v2Router.POST("/job/migration/create", v2.CreateMigrationJobV2)
 	v2Router.POST("/job/migration/update", v2.UpdateMigrationJobV2)
 	v2Router.POST("/job/migration/reverse", v2.ReverseMigrationJobV2)
@@ -119,6 +121,8 @@ func SetupApiServer(logger g.LoggerType, driverConfig *dtle.DriverConfig) (err e
 	v2Router.GET("/database/schemas", v2.ListDatabaseSchemasV2)
 	v2Router.GET("/database/columns", v2.ListDatabaseColumnsV2)
 	v2Router.GET("/database/instance_connection", v2.ConnectionV2)
+	v2Router.GET("/database/parallel_workers_suggestion", v2.SuggestParallelWorkersV2)
+	v2Router.GET("/database/privileges", v2.CheckPrivilegesV2)
 	v2Router.GET("/job/position", v2.GetJobPositionV2)
 	v2Router.GET("/user/list", v2.UserListV2)
 	v2Router.POST("/user/create", v2.CreateUserV2)
@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"sync/atomic"
+
 	"github.com/actiontech/dtle/g"
 	"github.com/go-mysql-org/go-mysql/replication"
 	parsercharset "github.com/pingcap/tidb/parser/charset"
@@ -51,6 +53,50 @@ type EntryContext struct {
 	Rows          int // for logging
 }
 
+// EntryGroup is the group of entries the source sends in one msg. A group is sent when it reaches
+// GroupMaxSize, GroupMaxRows or GroupMaxBytes, or after GroupTimeout.
+// Rows and Bytes can be read by other goroutines (Stats).
+type EntryGroup struct {
+	Size  int // sum of OriginalSize
+	rows  int64
+	bytes int64
+}
+
+// Add counts an entry added to the group.
+func (eg *EntryGroup) Add(entryCtx *EntryContext) {
+	eg.Size += entryCtx.OriginalSize
+	atomic.AddInt64(&eg.rows, int64(entryCtx.Entry.RowCount()))
+	atomic.AddInt64(&eg.bytes, int64(entryCtx.Entry.Size()))
+}
+
+func (eg *EntryGroup) Reset() {
+	eg.Size = 0
+	atomic.StoreInt64(&eg.rows, 0)
+	atomic.StoreInt64(&eg.bytes, 0)
+}
+
+func (eg *EntryGroup) Rows() int64 {
+	return atomic.LoadInt64(&eg.rows)
+}
+
+func (eg *EntryGroup) Bytes() int64 {
+	return atomic.LoadInt64(&eg.bytes)
+}
+
+// Full returns the limit the group reaches, or "" if it can take more entries.
+func (eg *EntryGroup) Full(cfg *DtleTaskConfig) string {
+	switch {
+	case cfg.GroupMaxRows > 0 && eg.Rows() >= cfg.GroupMaxRows:
+		return "GroupMaxRows"
+	case cfg.GroupMaxBytes > 0 && eg.Bytes() >= cfg.GroupMaxBytes:
+		return "GroupMaxBytes"
+	case eg.Size >= cfg.GroupMaxSize:
+		return "GroupMaxSize"
+	default:
+		return ""
+	}
+}
+
 func NewBinlogEntry() *DataEntry {
 	binlogEntry := &DataEntry{
 		Events:       make([]DataEvent, 0),
@@ -78,6 +124,14 @@ func (b *DataEntry) IsPartOfBigTx() bool {
 	return !(b.Index == 0 && b.Final)
 }
 
+// RowCount returns the number of rows of DML events. An update counts its before and after images.
+func (b *DataEntry) RowCount() (n int) {
+	for i := range b.Events {
+		n += len(b.Events[i].Rows)
+	}
+	return n
+}
+
 // Duplicate creates and returns a new binlog entry, with some of the attributes pre-assigned
 func (b *DataEntry) String() string {
 	return fmt.Sprintf("[BinlogEntry at %+v]", b.Coordinates)
@@ -90,11 +144,16 @@ const (
 	DeleteDML
 )
 
+// PartialUpdateRowsEvent is written with binlog_row_value_options=PARTIAL_JSON (MySQL 8.0).
+// It is not known by go-mysql.
+const PartialUpdateRowsEvent replication.EventType = 39
+
 func ToEventDML(eventType replication.EventType) int8 {
 	switch eventType {
 	case replication.WRITE_ROWS_EVENTv0, replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2:
 		return InsertDML
-	case replication.UPDATE_ROWS_EVENTv0, replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
+	case replication.UPDATE_ROWS_EVENTv0, replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2,
+		PartialUpdateRowsEvent:
 		return UpdateDML
 	case replication.DELETE_ROWS_EVENTv0, replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2:
 		return DeleteDML
@@ -148,25 +207,27 @@ func (b *DataEvent) String() string {
 }
 
 type ApplierTableItem struct {
-	Columns   *ColumnList
-	PsInsert0 []*sql.Stmt
-	PsInsert1 []*sql.Stmt
-	PsInsert2 []*sql.Stmt
-	PsInsert3 []*sql.Stmt
-	PsDelete  []*sql.Stmt
-	PsUpdate    []*sql.Stmt
-	ColumnMapTo []string
+	Columns      *ColumnList
+	PsInsert0    []*sql.Stmt
+	PsInsert1    []*sql.Stmt
+	PsInsert2    []*sql.Stmt
+	PsInsert3    []*sql.Stmt
+	PsDelete     []*sql.Stmt
+	PsSoftDelete []*sql.Stmt
+	PsUpdate     []*sql.Stmt
+	ColumnMapTo  []string
 }
 
 func NewApplierTableItem(parallelWorkers int) *ApplierTableItem {
 	return &ApplierTableItem{
-		Columns:   nil,
-		PsInsert0: make([]*sql.Stmt, parallelWorkers),
-		PsInsert1: make([]*sql.Stmt, parallelWorkers),
-		PsInsert2: make([]*sql.Stmt, parallelWorkers),
-		PsInsert3: make([]*sql.Stmt, parallelWorkers),
-		PsDelete:  make([]*sql.Stmt, parallelWorkers),
-		PsUpdate:  make([]*sql.Stmt, parallelWorkers),
+		Columns:      nil,
+		PsInsert0:    make([]*sql.Stmt, parallelWorkers),
+		PsInsert1:    make([]*sql.Stmt, parallelWorkers),
+		PsInsert2:    make([]*sql.Stmt, parallelWorkers),
+		PsInsert3:    make([]*sql.Stmt, parallelWorkers),
+		PsDelete:     make([]*sql.Stmt, parallelWorkers),
+		PsSoftDelete: make([]*sql.Stmt, parallelWorkers),
+		PsUpdate:     make([]*sql.Stmt, parallelWorkers),
 	}
 }
 func (ait *ApplierTableItem) Reset() {
@@ -184,6 +245,7 @@ func (ait *ApplierTableItem) Reset() {
 	closeStmts(ait.PsInsert2)
 	closeStmts(ait.PsInsert3)
 	closeStmts(ait.PsDelete)
+	closeStmts(ait.PsSoftDelete)
 	closeStmts(ait.PsUpdate)
 
 	ait.Columns = nil
@@ -60,3 +60,60 @@ func TestParseQueryEventFlags(t *testing.T) {
 		})
 	}
 }
+
+func TestEntryGroupFull(t *testing.T) {
+	cfg := &DtleTaskConfig{GroupMaxSize: 100, GroupMaxBytes: 1000}
+	newEntryCtx := func(nRows int) *EntryContext {
+		rows := make([][]interface{}, nRows)
+		for i := range rows {
+			rows[i] = []interface{}{int64(i), "0123456789012345678901234567890123456789"}
+		}
+		return &EntryContext{
+			Entry: &DataEntry{
+				Coordinates: &MySQLCoordinateTx{},
+				Events:      []DataEvent{{DML: InsertDML, Rows: rows}},
+			},
+			OriginalSize: 1,
+		}
+	}
+
+	group := &EntryGroup{}
+	n := 0
+	for group.Full(cfg) == "" {
+		group.Add(newEntryCtx(10))
+		n++
+		if n >= cfg.GroupMaxSize {
+			t.Fatalf("expect the group to reach GroupMaxBytes before GroupMaxSize")
+		}
+	}
+	if limit := group.Full(cfg); limit != "GroupMaxBytes" {
+		t.Errorf("limit %v, expect GroupMaxBytes", limit)
+	}
+	if group.Bytes() < cfg.GroupMaxBytes || group.Rows() != int64(10*n) || group.Size != n {
+		t.Errorf("unexpected group. bytes %v rows %v size %v", group.Bytes(), group.Rows(), group.Size)
+	}
+
+	group.Reset()
+	if group.Full(cfg) != "" || group.Rows() != 0 || group.Bytes() != 0 {
+		t.Errorf("expect an empty group after Reset")
+	}
+
+	cfg.GroupMaxRows = 15
+	group.Add(newEntryCtx(10))
+	group.Add(newEntryCtx(10))
+	if limit := group.Full(cfg); limit != "GroupMaxRows" {
+		t.Errorf("limit %v, expect GroupMaxRows", limit)
+	}
+
+	// without caps
+	group.Reset()
+	cfg = &DtleTaskConfig{GroupMaxSize: 2}
+	group.Add(newEntryCtx(1000))
+	if limit := group.Full(cfg); limit != "" {
+		t.Errorf("limit %v, expect none", limit)
+	}
+	group.Add(newEntryCtx(1))
+	if limit := group.Full(cfg); limit != "GroupMaxSize" {
+		t.Errorf("limit %v, expect GroupMaxSize", limit)
+	}
+}
@@ -0,0 +1,186 @@
+package common
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+const (
+	// the generated Marshal/Unmarshal of type.schema.gen.go
+	CodecGencode = "gencode"
+	CodecGob     = "gob"
+	CodecMsgpack = "msgpack"
+)
+
+// Codec serializes messages of data (DumpEntry, DumpStatResult and DataEntries) between src and dest
+// tasks. Messages are compressed after Marshal.
+type Codec interface {
+	Marshal(v GencodeType) ([]byte, error)
+	Unmarshal(data []byte, out GencodeType) error
+}
+
+var codecs = map[string]Codec{
+	CodecGencode: gencodeCodec{},
+	CodecGob:     gobCodec{},
+	CodecMsgpack: msgpackCodec{},
+}
+
+func init() {
+	// implementations of CoordinatesI and DumpCoordinates
+	for i, v := range []interface{}{&MySQLCoordinateTx{}, &OracleCoordinateTx{}, &MySQLCoordinates{},
+		&OracleCoordinates{}} {
+		gob.Register(v)
+		msgpack.RegisterExt(int8(i+1), v)
+	}
+}
+
+// SupportedCodecs returns names of codecs this version can decode. Put in ProtocolInfo.
+func SupportedCodecs() []string {
+	return []string{CodecGencode, CodecGob, CodecMsgpack}
+}
+
+// GetCodec returns the codec of the name. Empty for gencode.
+func GetCodec(name string) (Codec, error) {
+	if name == "" {
+		name = CodecGencode
+	}
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown MessageCodec %v. supported: %v", name, SupportedCodecs())
+	}
+	return codec, nil
+}
+
+// EncodeWith is Encode with the codec of the name.
+func EncodeWith(codecName string, v GencodeType) ([]byte, error) {
+	codec, err := GetCodec(codecName)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Compress(bs)
+}
+
+// DecodeWith is Decode with the codec of the name.
+func DecodeWith(codecName string, data []byte, out GencodeType) error {
+	codec, err := GetCodec(codecName)
+	if err != nil {
+		return err
+	}
+	msg, err := Decompress(data)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(msg, out)
+}
+
+type gencodeCodec struct{}
+
+// dumpEntryTailSize is the size of the fields appended to DumpEntry since protocol 0, encoded as
+// zero values: an empty ColumnTypes (1 byte) and Checksum (4 bytes).
+const dumpEntryTailSize = 5
+
+func (gencodeCodec) Marshal(v GencodeType) ([]byte, error) {
+	return v.Marshal(nil)
+}
+
+// Unmarshal decodes with the generated Unmarshal, which does not check bounds. A DumpEntry of an
+// older peer lacks the fields appended since, and is decoded with zero padding, leaving them zero.
+func (gencodeCodec) Unmarshal(data []byte, out GencodeType) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("gencode Unmarshal: malformed message of %v bytes. the peer task might run"+
+				" an incompatible dtle version: %v", len(data), r)
+		}
+	}()
+	tail := 0
+	if _, ok := out.(*DumpEntry); ok {
+		tail = dumpEntryTailSize
+		data = append(data[:len(data):len(data)], make([]byte, dumpEntryTailSize)...)
+	}
+	n, err := out.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	if size := uint64(len(data) - tail); n < size || n > uint64(len(data)) {
+		return fmt.Errorf("BinlogEntries.Unmarshal: not all consumed. data: %v, consumed: %v",
+			size, n)
+	}
+	return nil
+}
+
+type gobCodec struct{}
+
+// gobDumpEntry is DumpEntry for gob, which cannot encode nil (NULL) in ValuesX.
+type gobDumpEntry struct {
+	Entry  DumpEntry
+	Values [][][]byte
+	Nulls  [][]bool
+}
+
+func (gobCodec) Marshal(v GencodeType) ([]byte, error) {
+	var buf bytes.Buffer
+	var value interface{} = v
+	if entry, ok := v.(*DumpEntry); ok {
+		ge := &gobDumpEntry{Entry: *entry}
+		ge.Entry.ValuesX = nil
+		ge.Values = make([][][]byte, len(entry.ValuesX))
+		ge.Nulls = make([][]bool, len(entry.ValuesX))
+		for i, row := range entry.ValuesX {
+			ge.Values[i] = make([][]byte, len(row))
+			ge.Nulls[i] = make([]bool, len(row))
+			for j, col := range row {
+				if col == nil {
+					ge.Nulls[i][j] = true
+				} else {
+					ge.Values[i][j] = *col
+				}
+			}
+		}
+		value = ge
+	}
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, out GencodeType) error {
+	entry, ok := out.(*DumpEntry)
+	if !ok {
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(out)
+	}
+	ge := &gobDumpEntry{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(ge); err != nil {
+		return err
+	}
+	*entry = ge.Entry
+	entry.ValuesX = make([][]*[]byte, len(ge.Values))
+	for i, row := range ge.Values {
+		entry.ValuesX[i] = make([]*[]byte, len(row))
+		for j := range row {
+			if !ge.Nulls[i][j] {
+				// gob decodes an empty value as nil
+				col := append([]byte{}, row[j]...)
+				entry.ValuesX[i][j] = &col
+			}
+		}
+	}
+	return nil
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v GencodeType) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, out GencodeType) error {
+	return msgpack.Unmarshal(data, out)
+}
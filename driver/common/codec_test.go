@@ -0,0 +1,144 @@
+package common
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	bs := func(s string) *[]byte {
+		b := []byte(s)
+		return &b
+	}
+	entry := &DumpEntry{
+		SystemVariables: [][2]string{{"character_set_server", "utf8mb4"}},
+		SqlMode:         "SET @@session.sql_mode = ''",
+		TableName:       "t1",
+		TableSchema:     "db1",
+		TbSQL:           []string{"CREATE TABLE `db1`.`t1` (`id` INT, `v` VARCHAR(8))"},
+		ValuesX:         [][]*[]byte{{bs("1"), bs("a")}, {bs("2"), nil}, {bs("3"), bs("")}},
+		TotalCount:      3,
+		ColumnTypes:     []string{"int", "varchar(8)"},
+	}
+	entry.Checksum = entry.ComputeChecksum()
+	// nil and empty slices are the same
+	dump := func(e *DumpEntry) string {
+		values := ""
+		for _, row := range e.ValuesX {
+			for _, col := range row {
+				if col == nil {
+					values += "NULL,"
+				} else {
+					values += fmt.Sprintf("%q,", *col)
+				}
+			}
+			values += ";"
+		}
+		return fmt.Sprintf("%v %q %q %v.%v %q %v %v %x %v %v %v", e.SystemVariables, e.SqlMode, e.DbSQL,
+			e.TableSchema, e.TableName, e.TbSQL, values, e.TotalCount, e.Table, e.ColumnMapTo, e.ColumnTypes,
+			e.Checksum)
+	}
+	entries := &DataEntries{Entries: []*DataEntry{{
+		Coordinates: &MySQLCoordinateTx{LogFile: "bin.000001", LogPos: 4, GNO: 7},
+		Events: []DataEvent{{DatabaseName: "db1", TableName: "t1", DML: InsertDML,
+			Rows: [][]interface{}{{int64(1), "a", []byte("b"), nil}}}},
+	}}}
+	stat := &DumpStatResult{Coord: &MySQLCoordinates{LogFile: "bin.000001", LogPos: 4, GtidSet: "a:1-7"}}
+
+	for _, name := range SupportedCodecs() {
+		t.Run(name, func(t *testing.T) {
+			data, err := EncodeWith(name, entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotEntry := &DumpEntry{}
+			if err := DecodeWith(name, data, gotEntry); err != nil {
+				t.Fatal(err)
+			}
+			if dump(gotEntry) != dump(entry) {
+				t.Errorf("got %v\nwant %v", dump(gotEntry), dump(entry))
+			}
+			if err := gotEntry.VerifyChecksum(); err != nil {
+				t.Error(err)
+			}
+
+			data, err = EncodeWith(name, entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotEntries := &DataEntries{}
+			if err := DecodeWith(name, data, gotEntries); err != nil {
+				t.Fatal(err)
+			}
+			coord, ok := gotEntries.Entries[0].Coordinates.(*MySQLCoordinateTx)
+			if !ok || coord.GNO != 7 || coord.LogFile != "bin.000001" {
+				t.Errorf("unexpected coordinates %#v", gotEntries.Entries[0].Coordinates)
+			}
+			row := gotEntries.Entries[0].Events[0].Rows[0]
+			if len(row) != 4 || row[1] != "a" || string(row[2].([]byte)) != "b" || row[3] != nil {
+				t.Errorf("unexpected row %#v", row)
+			}
+
+			data, err = EncodeWith(name, stat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotStat := &DumpStatResult{}
+			if err := DecodeWith(name, data, gotStat); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotStat, stat) {
+				t.Errorf("got %#v want %#v", gotStat.Coord, stat.Coord)
+			}
+		})
+	}
+
+	// the default is the generated codec
+	data, err := Encode(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DecodeWith("", data, &DumpEntry{}); err != nil {
+		t.Errorf("expect the default codec to be gencode: %v", err)
+	}
+	if _, err := EncodeWith("protobuf", entry); err == nil || !strings.Contains(err.Error(), "unknown MessageCodec") {
+		t.Errorf("expect an unknown codec error, got %v", err)
+	}
+}
+
+func TestGencodeDumpEntryOfOlderPeer(t *testing.T) {
+	bs := []byte("1")
+	entry := &DumpEntry{TableSchema: "db1", TableName: "t1", ValuesX: [][]*[]byte{{&bs}}, TotalCount: 1}
+	data, err := entry.Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// protocol 0 has neither ColumnTypes nor Checksum. then ColumnTypes was appended before Checksum.
+	for _, n := range []int{dumpEntryTailSize, 4} {
+		old, err := Compress(data[:len(data)-n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := &DumpEntry{}
+		if err := Decode(old, got); err != nil {
+			t.Fatalf("decode without %v bytes: %v", n, err)
+		}
+		if got.TableName != "t1" || len(got.ValuesX) != 1 || got.ColumnTypes != nil || got.Checksum != 0 {
+			t.Errorf("decode without %v bytes: %#v", n, got)
+		}
+	}
+
+	// a truncated message is an error, not a panic
+	truncated, err := Compress(data[:len(data)/2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Decode(truncated, &DumpEntry{}); err == nil {
+		t.Errorf("expect an error decoding a truncated message")
+	}
+	if err := Decode(truncated, &DataEntries{}); err == nil {
+		t.Errorf("expect an error decoding a truncated message")
+	}
+}
@@ -132,7 +132,9 @@ type UniqueKey struct {
 	Columns         ColumnList
 	HasNullable     bool
 	IsAutoIncrement bool
-	LastMaxVals     []string
+	// MySQL 8 invisible index. not used by the optimizer.
+	IsInvisible bool
+	LastMaxVals []string
 }
 
 // IsPrimary checks if this unique key is primary
@@ -31,6 +31,11 @@ const (
 
 const (
 	DtleFlagCreateSchemaIfNotExists = 0x1
+	// set by the applier. the query is executed without being rewritten.
+	DtleFlagRawQuery = 0x2
+	// the event is from a PARTIAL_UPDATE_ROWS_EVENT. JSON values in the after images
+	// might be partial updates. See EncodeJSONDiffs.
+	DtleFlagPartialJSON = 0x4
 )
 
 const (
@@ -99,35 +104,25 @@ func Compress(bs []byte) (outBs []byte, err error) {
 	}
 	return buf.Bytes(), nil
 }
-func Encode(v GencodeType) ([]byte, error) {
-	bs, err := v.Marshal(nil)
-	if err != nil {
-		return nil, err
-	}
-
-	return Compress(bs)
-}
-
-func Decode(data []byte, out GencodeType) (err error) {
+func Decompress(data []byte) ([]byte, error) {
 	r, err := compress.NewReader(bytes.NewReader(data))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	msg, err := ioutil.ReadAll(r)
 	_ = r.Close()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return msg, nil
+}
 
-	n, err := out.Unmarshal(msg)
-	if err != nil {
-		return err
-	}
-	if n != uint64(len(msg)) {
-		return fmt.Errorf("BinlogEntries.Unmarshal: not all consumed. data: %v, consumed: %v",
-			len(msg), n)
-	}
-	return nil
+func Encode(v GencodeType) ([]byte, error) {
+	return EncodeWith(CodecGencode, v)
+}
+
+func Decode(data []byte, out GencodeType) (err error) {
+	return DecodeWith(CodecGencode, data, out)
 }
 func DecodeMaybeTable(data []byte) (*Table, error) {
 	if len(data) > 0 {
@@ -8,11 +8,17 @@ package common
 
 import (
 	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
 	"sync"
 
 	"github.com/actiontech/dtle/g"
 )
 
+// The reply to a full copy msg asking the source to send the chunk again.
+const FullChunkChecksumMismatch = "chunk_checksum_mismatch"
+
 type GetChunkDataFn func() (nRows int64, err error)
 type PrepareFn func() (err error)
 
@@ -105,3 +111,37 @@ func (d *Dumper) Close() error {
 	close(d.ShutdownCh)
 	return nil
 }
+
+// ComputeChecksum returns a CRC32 of the rows of the entry. It is never 0, which means no checksum.
+func (d *DumpEntry) ComputeChecksum() uint32 {
+	h := crc32.NewIEEE()
+	lenBuf := make([]byte, 4)
+	for _, row := range d.ValuesX {
+		for _, v := range row {
+			if v == nil {
+				// distinguish NULL from an empty value
+				_, _ = h.Write([]byte{0xff, 0xff, 0xff, 0xff})
+				continue
+			}
+			binary.LittleEndian.PutUint32(lenBuf, uint32(len(*v)))
+			_, _ = h.Write(lenBuf)
+			_, _ = h.Write(*v)
+		}
+	}
+	if sum := h.Sum32(); sum != 0 {
+		return sum
+	}
+	return 1
+}
+
+// VerifyChecksum checks the rows against the checksum from the source, if there is.
+func (d *DumpEntry) VerifyChecksum() error {
+	if d.Checksum == 0 {
+		return nil
+	}
+	if sum := d.ComputeChecksum(); sum != d.Checksum {
+		return fmt.Errorf("checksum mismatch for chunk of %v.%v. expect %v got %v",
+			d.TableSchema, d.TableName, d.Checksum, sum)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	uuid "github.com/satori/go.uuid"
+)
+
+// parseGtidIntervals parses a GTID set string into intervals of each UUID, in the order of the string.
+// Unlike mysql.ParseMysqlGTIDSet, the intervals are not normalized.
+func parseGtidIntervals(gtidStr string) (sids []string, intervals map[string][]mysql.Interval, err error) {
+	intervals = make(map[string][]mysql.Interval)
+	for _, s := range strings.Split(gtidStr, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		sep := strings.Split(s, ":")
+		if len(sep) < 2 {
+			return nil, nil, fmt.Errorf("invalid GTID format %v, must UUID:interval[:interval]", s)
+		}
+		sid, err := uuid.FromString(sep[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		key := sid.String()
+		if _, ok := intervals[key]; !ok {
+			sids = append(sids, key)
+		}
+		for _, p := range sep[1:] {
+			in, err := parseGtidInterval(p)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid GTID interval %v of %v", p, key)
+			}
+			intervals[key] = append(intervals[key], in)
+		}
+	}
+	return sids, intervals, nil
+}
+
+// parseGtidInterval parses "N" or "N-M" into [N, M+1).
+func parseGtidInterval(s string) (in mysql.Interval, err error) {
+	p := strings.Split(s, "-")
+	if len(p) > 2 {
+		return in, fmt.Errorf("invalid interval %v", s)
+	}
+	if in.Start, err = strconv.ParseInt(p[0], 10, 64); err != nil {
+		return in, err
+	}
+	in.Stop = in.Start + 1
+	if len(p) == 2 {
+		if in.Stop, err = strconv.ParseInt(p[1], 10, 64); err != nil {
+			return in, err
+		}
+		in.Stop += 1
+	}
+	if in.Start <= 0 || in.Stop <= in.Start {
+		return in, fmt.Errorf("invalid interval %v", s)
+	}
+	return in, nil
+}
+
+// GtidSetConflicts checks the GTID set gtidStr before it is merged into gtidSet, which can be nil.
+// It returns the conflicts, which suggest the transactions of a UUID come from more than one server:
+//   - intervals of a UUID in gtidStr overlapping each other or out of order.
+//   - intervals of gtidStr partially overlapping those of the same UUID in gtidSet. An interval
+//     containing or contained by an existing one is a resent range and not a conflict.
+func GtidSetConflicts(gtidSet *mysql.MysqlGTIDSet, gtidStr string) (conflicts []string, err error) {
+	sids, intervals, err := parseGtidIntervals(gtidStr)
+	if err != nil {
+		return nil, err
+	}
+	for _, sid := range sids {
+		ins := intervals[sid]
+		for k := 1; k < len(ins); k++ {
+			if ins[k].Start < ins[k-1].Stop {
+				conflicts = append(conflicts, fmt.Sprintf("%v:%v overlaps or precedes %v:%v",
+					sid, ins[k], sid, ins[k-1]))
+			}
+		}
+		if gtidSet == nil || gtidSet.Sets[sid] == nil {
+			continue
+		}
+		for _, in := range ins {
+			for _, ex := range gtidSet.Sets[sid].Intervals {
+				overlapped := in.Start < ex.Stop && ex.Start < in.Stop
+				contained := (in.Start >= ex.Start && in.Stop <= ex.Stop) || (ex.Start >= in.Start && ex.Stop <= in.Stop)
+				if overlapped && !contained {
+					conflicts = append(conflicts, fmt.Sprintf("%v:%v partially overlaps the existing %v:%v",
+						sid, in, sid, ex))
+				}
+			}
+		}
+	}
+	return conflicts, nil
+}
@@ -0,0 +1,56 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestGtidSetConflicts(t *testing.T) {
+	const sid1 = "7b2a3a4e-1c1d-11ee-8b2f-0242ac120002"
+	const sid2 = "8c3b4b5f-2d2e-11ee-9c30-0242ac120003"
+	gs, err := mysql.ParseMysqlGTIDSet(sid1 + ":1-100:200-300")
+	if err != nil {
+		t.Fatal(err)
+	}
+	executed := gs.(*mysql.MysqlGTIDSet)
+
+	for _, c := range []struct {
+		gtidStr  string
+		expected []string
+	}{
+		{"", nil},
+		{sid1 + ":1-300," + sid2 + ":1-5", nil},
+		{sid1 + ":50-60:101-150", nil},
+		{sid2 + ":1-10:11-20", nil},
+		{sid2 + ":1-10:5-20", []string{sid2 + ":5-20 overlaps or precedes " + sid2 + ":1-10"}},
+		{sid2 + ":30-40:1-10", []string{sid2 + ":1-10 overlaps or precedes " + sid2 + ":30-40"}},
+		{sid2 + ":1-10," + sid2 + ":8", []string{sid2 + ":8 overlaps or precedes " + sid2 + ":1-10"}},
+		{sid1 + ":90-110", []string{sid1 + ":90-110 partially overlaps the existing " + sid1 + ":1-100"}},
+		{sid1 + ":1-250", []string{sid1 + ":1-250 partially overlaps the existing " + sid1 + ":200-300"}},
+	} {
+		got, err := GtidSetConflicts(executed, c.gtidStr)
+		if err != nil {
+			t.Fatalf("%v: %v", c.gtidStr, err)
+		}
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%v: got %v, want %v", c.gtidStr, got, c.expected)
+		}
+	}
+
+	// without an executed set, only the intervals of gtidStr are checked
+	got, err := GtidSetConflicts(nil, sid1+":90-110:100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Errorf("got %v, want 1 conflict", got)
+	}
+
+	for _, gtidStr := range []string{"abc", sid1 + ":x", sid1 + ":10-5", sid1 + ":0", "not-a-uuid:1"} {
+		if _, err := GtidSetConflicts(nil, gtidStr); err == nil {
+			t.Errorf("%v: expect an error", gtidStr)
+		}
+	}
+}
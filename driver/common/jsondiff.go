@@ -0,0 +1,57 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JSONDiffOp is enum_json_diff_operation of MySQL.
+type JSONDiffOp int8
+
+const (
+	JSONDiffReplace JSONDiffOp = 0
+	JSONDiffInsert  JSONDiffOp = 1
+	JSONDiffRemove  JSONDiffOp = 2
+)
+
+// JSONDiff is a change of a partial JSON update.
+type JSONDiff struct {
+	Op   JSONDiffOp
+	Path string
+	// JSON text of the new value. Empty for JSONDiffRemove.
+	Value string
+}
+
+// A JSON document cannot start with \x00, so a full value will never be taken as diffs.
+const jsonDiffsPrefix = "\x00dtle-json-diffs:"
+
+// EncodeJSONDiffs encodes diffs as a row value. It goes with DtleFlagPartialJSON on the event.
+func EncodeJSONDiffs(diffs []JSONDiff) (string, error) {
+	bs, err := json.Marshal(diffs)
+	if err != nil {
+		return "", err
+	}
+	return jsonDiffsPrefix + string(bs), nil
+}
+
+// DecodeJSONDiffs returns the diffs if the row value is encoded by EncodeJSONDiffs.
+func DecodeJSONDiffs(value interface{}) (diffs []JSONDiff, ok bool, err error) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return nil, false, nil
+	}
+	if !strings.HasPrefix(s, jsonDiffsPrefix) {
+		return nil, false, nil
+	}
+	err = json.Unmarshal([]byte(s[len(jsonDiffsPrefix):]), &diffs)
+	if err != nil {
+		return nil, true, fmt.Errorf("bad JSON diffs: %v", err)
+	}
+	return diffs, true, nil
+}
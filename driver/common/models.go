@@ -85,4 +85,55 @@ type TaskStatistics struct {
 	MemoryStat         MemoryStat
 	HandledTxCount     TxCount
 	HandledQueryCount  QueryCount
+	// tables excluded from replication for failing validation. "schema.table: reason"
+	SkippedTables []string
+	// src: warnings of validating tables, e.g. no valid unique key. "schema.table: warning"
+	ValidationWarnings []string
+	// dest: mysql or mariadb
+	TargetFlavor string
+	// dest: number of DDL operations running on the target. See MaxConcurrentDDL.
+	ActiveDDLCount int64
+	// dest: tables with most DML events applied in the last 5 minutes of incremental replication
+	TopTables []TableActivity
+	// dest: tables with the longest total apply time of incremental replication
+	SlowestTables []TableApplyTime
+	// dest: DML events of tables not in ReplicateDoDb dropped by StrictTableFilter
+	DroppedEvents int64
+	// dest: acks to the source are paused for MaxBufferedBytes
+	BackpressureActive bool
+	// dest: apply is paused for TargetMaxThreadsRunning / TargetMaxThreadsConnected
+	TargetThrottled        bool
+	TargetThreadsRunning   int64
+	TargetThreadsConnected int64
+	// dest: with VerifyChunkChecksum, percentage of the source verified on the target.
+	// Full copy rows passing the checksum (relative to ReadMasterRowCount) times the coverage of
+	// the target GTID set, or of ReadMasterTxCount if there is none.
+	DataParityPct string
+	// dest: full copy batches split in halves on lock wait timeouts
+	LockTimeoutSplits int64
+	// dest: rows committed by full copy of each table, keyed by "schema.table" of the target
+	PerTableRowCount map[string]int64
+	// dest: MTS workers applying entries. Less than ParallelWorkers during WorkerRampUpMs.
+	EffectiveWorkers int
+	// src: rows and bytes of incremental entries grouped but not sent yet
+	OpenGroupRows  int64
+	OpenGroupBytes int64
+	// dest: with StrictFullThenIncr, incremental entries received before the full copy completed
+	IncrHeldForFullCopy int64
+}
+
+type TableActivity struct {
+	Schema        string
+	Table         string
+	RecentEvents  int64
+	TotalEvents   int64
+	LastEventTime int64 // unix seconds
+}
+
+type TableApplyTime struct {
+	Schema       string
+	Table        string
+	ApplyTimeUs  int64
+	Rows         int64
+	AvgRowTimeUs int64
 }
@@ -0,0 +1,36 @@
+package common
+
+import (
+	"strconv"
+	"time"
+)
+
+// ProgressStallDetector tells when ProgressPct of a task has not advanced for Timeout before reaching 100%.
+type ProgressStallDetector struct {
+	Timeout time.Duration
+
+	lastPct    float64
+	lastChange time.Time
+	alerted    bool
+}
+
+// Check takes ProgressPct of the latest stats. It returns true once for each stall.
+func (d *ProgressStallDetector) Check(progressPct string, now time.Time) bool {
+	pct, err := strconv.ParseFloat(progressPct, 64)
+	if err != nil || pct >= 100 {
+		// no progress reported, or finished
+		d.lastChange = time.Time{}
+		return false
+	}
+	if d.lastChange.IsZero() || pct > d.lastPct {
+		d.lastPct = pct
+		d.lastChange = now
+		d.alerted = false
+		return false
+	}
+	if d.alerted || now.Sub(d.lastChange) < d.Timeout {
+		return false
+	}
+	d.alerted = true
+	return true
+}
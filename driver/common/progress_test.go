@@ -0,0 +1,39 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressStallDetector(t *testing.T) {
+	d := &ProgressStallDetector{Timeout: time.Minute}
+	t0 := time.Now()
+	at := func(sec int) time.Time {
+		return t0.Add(time.Duration(sec) * time.Second)
+	}
+
+	if d.Check("10.0", at(0)) || d.Check("10.0", at(50)) {
+		t.Errorf("expect no stall within the timeout")
+	}
+	if !d.Check("10.0", at(60)) {
+		t.Errorf("expect a stall")
+	}
+	if d.Check("10.0", at(120)) {
+		t.Errorf("expect a stall to be reported only once")
+	}
+
+	// progress resets the timer
+	if d.Check("20.0", at(130)) || d.Check("20.0", at(180)) {
+		t.Errorf("expect no stall after progress")
+	}
+	if !d.Check("20.0", at(190)) {
+		t.Errorf("expect a stall again")
+	}
+
+	if d.Check("100.0", at(300)) || d.Check("100.0", at(400)) {
+		t.Errorf("expect no stall when finished")
+	}
+	if d.Check("", at(500)) {
+		t.Errorf("expect no stall without progress")
+	}
+}
@@ -3,6 +3,7 @@ package common
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,6 +23,38 @@ func init() {
 	consul.Register()
 }
 
+const (
+	storeRetryAttempts = 5
+	storeRetryDelay    = 500 * time.Millisecond
+	storeRetryMaxDelay = 8 * time.Second
+)
+
+// IsTransientStoreError tells whether a store error might go away by retrying, e.g. consul is unreachable
+// or restarting. Errors like a missing key or a bad value are permanent.
+func IsTransientStoreError(err error) bool {
+	if errors.Is(err, ErrNoConsul) || errors.Is(err, store.ErrNotReachable) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// consul server errors, e.g. "Unexpected response code: 500 (No cluster leader)"
+	return strings.Contains(err.Error(), "Unexpected response code: 5")
+}
+
+// Retry calls `op` until it succeeds, fails permanently, or retries with backoff are exhausted.
+func (sm *StoreManager) Retry(name string, stopCh <-chan struct{}, op func() error) error {
+	return RetryWithBackoff(storeRetryAttempts, storeRetryDelay, storeRetryMaxDelay, stopCh,
+		func(err error) bool {
+			if !IsTransientStoreError(err) {
+				return false
+			}
+			sm.logger.Warn("transient store error. retrying", "op", name, "err", err)
+			return true
+		}, op)
+}
+
 type StoreManager struct {
 	consulStore store.Store
 	logger      g.LoggerType
@@ -312,7 +345,7 @@ func (sm *StoreManager) GetJobInfo(jobId string) (*JobListItemV2, error) {
 		return &JobListItemV2{}, nil
 	}
 	if nil != err {
-		return nil, fmt.Errorf("get %v value from consul failed: %v", key, err)
+		return nil, fmt.Errorf("get %v value from consul failed: %w", key, err)
 	}
 	job := new(JobListItemV2)
 	err = json.Unmarshal(kp.Value, job)
@@ -426,7 +459,7 @@ func (sm *StoreManager) WatchTargetGtid(subject string, stopCh chan struct{}) (s
 	select {
 	case kv := <-ch:
 		if kv == nil {
-			return "", fmt.Errorf("WatchTargetGtid. got nil kv. might have been shutdown")
+			return "", errors.Wrap(ErrNoConsul, "WatchTargetGtid")
 		}
 		return string(kv.Value), nil
 	case <-stopCh:
@@ -669,6 +702,176 @@ func (sm *StoreManager) GetDumpProgress(jobName string) (int64, int64, error) {
 	return r[0], r[1], nil
 }
 
+const (
+	// bump when the format of ApplierState changes
+	ApplierStateVersion = 2
+	// the oldest dtle ApplierStateVersion able to read the state exported by this version
+	ApplierStateMinReaderVersion = 1
+)
+
+// names of QueueCheckpoint
+const (
+	QueueFull = "full"
+	QueueIncr = "incr"
+)
+
+// ApplierState is the full state of a dest task, exported to move a job between dtle versions
+// without copying again. Fields are only added, so that an older reader ignores the unknown ones.
+type ApplierState struct {
+	Version          int
+	MinReaderVersion int
+
+	Gtid                       string
+	BinlogFile                 string
+	BinlogPos                  uint32
+	OracleOldestUncommittedSCN int64
+	OracleCommittedSCN         int64
+	Stage                      string
+	DumpExecRows               int64
+	DumpTotalRows              int64
+	// tables written in full copy
+	CopiedTables []SchemaTable
+
+	// version 2
+
+	// the manifest: tables of the job known to the dest task
+	Tables []ApplierStateTable
+	// where the dest task is in each queue from the src task
+	Queues []QueueCheckpoint
+}
+
+// ApplierStateTable is a table in the manifest of ApplierState.
+type ApplierStateTable struct {
+	Schema      string
+	Table       string
+	ColumnMapTo []string
+	// rows written in full copy
+	Rows   int64
+	Copied bool
+}
+
+// QueueCheckpoint is the position of the dest task in a queue of entries from the src task.
+type QueueCheckpoint struct {
+	Name string
+	// entries received but not applied. The src task sends them again on resuming.
+	Pending int64
+	// GTID set of the applied entries. It is ahead of Gtid, which is saved periodically.
+	AppliedGtid string
+}
+
+// ResumeGtid returns the GTID set to resume from, preferring the checkpoint of the incr queue.
+func (s *ApplierState) ResumeGtid() string {
+	for _, q := range s.Queues {
+		if q.Name == QueueIncr && q.AppliedGtid != "" {
+			return q.AppliedGtid
+		}
+	}
+	return s.Gtid
+}
+
+func applierStateKey(jobName string) string {
+	return fmt.Sprintf("dtle/%v/ApplierState", jobName)
+}
+
+// ExportApplierState collects the positions of the job and stores them as a versioned blob,
+// along with the manifest and the queue checkpoints of the dest task.
+func (sm *StoreManager) ExportApplierState(jobName string, tables []ApplierStateTable, queues []QueueCheckpoint) (*ApplierState, error) {
+	state := &ApplierState{
+		Version:          ApplierStateVersion,
+		MinReaderVersion: ApplierStateMinReaderVersion,
+		Tables:           tables,
+		Queues:           queues,
+	}
+	for _, table := range tables {
+		if table.Copied {
+			state.CopiedTables = append(state.CopiedTables, SchemaTable{Schema: table.Schema, Table: table.Table})
+		}
+	}
+	var err error
+	if state.Gtid, err = sm.GetGtidForJob(jobName); err != nil {
+		return nil, errors.Wrap(err, "GetGtidForJob")
+	}
+	pos, err := sm.GetBinlogFilePosForJob(jobName)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetBinlogFilePosForJob")
+	}
+	state.BinlogFile, state.BinlogPos = pos.Name, pos.Pos
+	state.OracleOldestUncommittedSCN, state.OracleCommittedSCN, err = sm.GetOracleSCNPosForJob(jobName)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetOracleSCNPosForJob")
+	}
+	if state.Stage, err = sm.GetJobStage(jobName); err != nil {
+		return nil, errors.Wrap(err, "GetJobStage")
+	}
+	state.DumpExecRows, state.DumpTotalRows, err = sm.GetDumpProgress(jobName)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetDumpProgress")
+	}
+
+	bs, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	if err = sm.consulStore.Put(applierStateKey(jobName), bs, nil); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// ImportApplierState reads the blob stored by ExportApplierState (possibly by another dtle version)
+// and restores the positions of the job. The blob is deleted once imported, so that a later start
+// does not go back to it. Returns nil if there is no exported state.
+func (sm *StoreManager) ImportApplierState(jobName string) (*ApplierState, error) {
+	key := applierStateKey(jobName)
+	kv, err := sm.consulStore.Get(key)
+	if err == store.ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	state := &ApplierState{}
+	if err = json.Unmarshal(kv.Value, state); err != nil {
+		return nil, errors.Wrap(err, "unmarshal ApplierState")
+	}
+	if state.Version == 0 {
+		return nil, fmt.Errorf("bad ApplierState for %v: no version", jobName)
+	}
+	if state.MinReaderVersion > ApplierStateVersion {
+		return nil, fmt.Errorf("ApplierState for %v (version %v) requires version %v or later. current %v",
+			jobName, state.Version, state.MinReaderVersion, ApplierStateVersion)
+	}
+	// upgrade older versions here when the format changes.
+	if state.Version < 2 {
+		for _, st := range state.CopiedTables {
+			state.Tables = append(state.Tables, ApplierStateTable{Schema: st.Schema, Table: st.Table, Copied: true})
+		}
+	}
+
+	if err = sm.SaveGtidForJob(jobName, state.ResumeGtid()); err != nil {
+		return nil, errors.Wrap(err, "SaveGtidForJob")
+	}
+	if err = sm.SaveBinlogFilePosForJob(jobName, state.BinlogFile, int(state.BinlogPos)); err != nil {
+		return nil, errors.Wrap(err, "SaveBinlogFilePosForJob")
+	}
+	err = sm.SaveOracleSCNPos(jobName, state.OracleOldestUncommittedSCN, state.OracleCommittedSCN)
+	if err != nil {
+		return nil, errors.Wrap(err, "SaveOracleSCNPos")
+	}
+	if state.Stage != "" {
+		if err = sm.PutJobStage(jobName, state.Stage); err != nil {
+			return nil, errors.Wrap(err, "PutJobStage")
+		}
+	}
+	if err = sm.PutDumpProgress(jobName, state.DumpExecRows, state.DumpTotalRows); err != nil {
+		return nil, errors.Wrap(err, "PutDumpProgress")
+	}
+	if err = sm.consulStore.Delete(key); err != nil && err != store.ErrKeyNotFound {
+		return nil, errors.Wrap(err, "delete ApplierState")
+	}
+	return state, nil
+}
+
 // consul store item
 
 func NewDefaultRole(tenant string) *Role {
@@ -727,3 +930,117 @@ func NewJobStep(stepName string) JobStep {
 		JobCreateTime: time.Now().In(time.Local).Format(time.RFC3339),
 	}
 }
+
+const (
+	// bump when the serialization of data between src and dest tasks (e.g. DumpEntry, DataEntries) changes.
+	// 0: dtle without ProtocolInfo.
+	// 1: DumpEntry.ColumnTypes and DumpEntry.Checksum.
+	// 2: DtleFlagPartialJSON.
+	ProtocolVersion = 2
+	// the oldest ProtocolVersion of the peer task this version works with
+	ProtocolMinPeerVersion = 2
+)
+
+// ProtocolInfo is put by each task of a job for the peer task to check compatibility on start.
+type ProtocolInfo struct {
+	Version        int
+	MinPeerVersion int
+	DtleVersion    string
+	// MessageCodec supported. Empty for a dtle supporting gencode only.
+	Codecs []string
+}
+
+func CurrentProtocolInfo() ProtocolInfo {
+	return ProtocolInfo{
+		Version:        ProtocolVersion,
+		MinPeerVersion: ProtocolMinPeerVersion,
+		DtleVersion:    g.Version,
+		Codecs:         SupportedCodecs(),
+	}
+}
+
+// CheckProtocolCompatible returns a version mismatch error if the tasks cannot work together.
+func CheckProtocolCompatible(local ProtocolInfo, peer ProtocolInfo) error {
+	if peer.Version < local.MinPeerVersion || local.Version < peer.MinPeerVersion {
+		return fmt.Errorf("version mismatch: dtle %v (protocol %v) cannot work with the peer task "+
+			"of dtle %v (protocol %v). upgrade dtle of both src and dest",
+			local.DtleVersion, local.Version, peer.DtleVersion, peer.Version)
+	}
+	return nil
+}
+
+// PutProtocolInfo stores ProtocolInfo of this task. side is "src" or "dest".
+func (sm *StoreManager) PutProtocolInfo(jobName string, side string) error {
+	bs, err := json.Marshal(CurrentProtocolInfo())
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("dtle/%v/ProtocolInfo/%v", jobName, side)
+	return sm.consulStore.Put(key, bs, nil)
+}
+
+// CheckPeerProtocol checks ProtocolInfo put by the peer task on `peerSide`.
+// A peer of an older dtle does not put it, and is taken as protocol 0.
+func (sm *StoreManager) CheckPeerProtocol(jobName string, peerSide string) error {
+	key := fmt.Sprintf("dtle/%v/ProtocolInfo/%v", jobName, peerSide)
+	kv, err := sm.consulStore.Get(key)
+	if err == store.ErrKeyNotFound {
+		sm.logger.Warn("the peer task does not report its protocol version. take it as 0", "side", peerSide)
+		return CheckProtocolCompatible(CurrentProtocolInfo(), ProtocolInfo{DtleVersion: "unknown"})
+	} else if err != nil {
+		return err
+	}
+	peer := ProtocolInfo{}
+	if err = json.Unmarshal(kv.Value, &peer); err != nil {
+		return errors.Wrap(err, "unmarshal ProtocolInfo")
+	}
+	return CheckProtocolCompatible(CurrentProtocolInfo(), peer)
+}
+
+// CheckPeerCodec checks the peer task on `peerSide` supports the codec, as ProtocolInfo it put.
+// A peer of an older dtle supports gencode only.
+func (sm *StoreManager) CheckPeerCodec(jobName string, peerSide string, codec string) error {
+	if _, err := GetCodec(codec); err != nil {
+		return err
+	}
+	if codec == "" || codec == CodecGencode {
+		return nil
+	}
+	key := fmt.Sprintf("dtle/%v/ProtocolInfo/%v", jobName, peerSide)
+	kv, err := sm.consulStore.Get(key)
+	if err == store.ErrKeyNotFound {
+		return fmt.Errorf("MessageCodec %v: the peer task of an older dtle supports %v only", codec, CodecGencode)
+	} else if err != nil {
+		return err
+	}
+	peer := ProtocolInfo{}
+	if err = json.Unmarshal(kv.Value, &peer); err != nil {
+		return errors.Wrap(err, "unmarshal ProtocolInfo")
+	}
+	for _, c := range peer.Codecs {
+		if c == codec {
+			return nil
+		}
+	}
+	return fmt.Errorf("MessageCodec %v is not supported by the peer task of dtle %v. supported: %v",
+		codec, peer.DtleVersion, peer.Codecs)
+}
+
+// PutTableDDL saves `show create table` of a source table, for the dest task to create the table
+// when a DDL depends on it. See PrefetchDDLDependencies.
+func (sm *StoreManager) PutTableDDL(jobName string, schema string, table string, ddl string) error {
+	key := fmt.Sprintf("dtle/%v/TableDDL/%v/%v", jobName, schema, table)
+	return sm.consulStore.Put(key, []byte(ddl), nil)
+}
+
+// GetTableDDL returns the DDL saved by PutTableDDL. ok is false if it is not saved.
+func (sm *StoreManager) GetTableDDL(jobName string, schema string, table string) (ddl string, ok bool, err error) {
+	key := fmt.Sprintf("dtle/%v/TableDDL/%v/%v", jobName, schema, table)
+	kv, err := sm.consulStore.Get(key)
+	if err == store.ErrKeyNotFound {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return string(kv.Value), true, nil
+}
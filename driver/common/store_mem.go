@@ -0,0 +1,81 @@
+package common
+
+import (
+	"sync"
+
+	"github.com/actiontech/dtle/g"
+	"github.com/docker/libkv/store"
+)
+
+// MemStore is an in-memory store.Store counting reads and writes, for tests.
+// Only Get, Put, Delete and Watch are supported.
+type MemStore struct {
+	store.Store
+	mu   sync.Mutex
+	Kvs  map[string][]byte
+	Puts int
+	Gets int
+	// returned by the next Gets
+	GetErrs []error
+}
+
+func NewMemStore(kvs map[string][]byte) *MemStore {
+	if kvs == nil {
+		kvs = map[string][]byte{}
+	}
+	return &MemStore{Kvs: kvs}
+}
+
+// NewMemStoreManager returns a StoreManager on s, for tests.
+func NewMemStoreManager(s *MemStore, logger g.LoggerType) *StoreManager {
+	return &StoreManager{consulStore: s, logger: logger}
+}
+
+// Counts returns the number of Puts and Gets so far.
+func (s *MemStore) Counts() (puts int, gets int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Puts, s.Gets
+}
+
+func (s *MemStore) Put(key string, value []byte, options *store.WriteOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Kvs[key] = value
+	s.Puts++
+	return nil
+}
+
+func (s *MemStore) Get(key string) (*store.KVPair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Gets++
+	if len(s.GetErrs) > 0 {
+		err := s.GetErrs[0]
+		s.GetErrs = s.GetErrs[1:]
+		return nil, err
+	}
+	v, ok := s.Kvs[key]
+	if !ok {
+		return nil, store.ErrKeyNotFound
+	}
+	return &store.KVPair{Key: key, Value: v}, nil
+}
+
+func (s *MemStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.Kvs, key)
+	return nil
+}
+
+// Watch sends the current value only.
+func (s *MemStore) Watch(key string, stopCh <-chan struct{}) (<-chan *store.KVPair, error) {
+	kv, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *store.KVPair, 1)
+	ch <- kv
+	return ch, nil
+}
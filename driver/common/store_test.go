@@ -0,0 +1,166 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func newTestStoreManager() (*StoreManager, *MemStore) {
+	s := NewMemStore(nil)
+	return NewMemStoreManager(s, hclog.NewNullLogger()), s
+}
+
+func TestApplierStateExportImport(t *testing.T) {
+	job := "job1"
+	oldSM, oldStore := newTestStoreManager()
+	if err := oldSM.SaveGtidForJob(job, "acd7d195-06cd-11e9-928f-02000aba3e28:1-100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := oldSM.SaveBinlogFilePosForJob(job, "bin.000003", 1234); err != nil {
+		t.Fatal(err)
+	}
+	if err := oldSM.PutJobStage(job, "incr_copy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := oldSM.PutDumpProgress(job, 90, 100); err != nil {
+		t.Fatal(err)
+	}
+	tables := []ApplierStateTable{
+		{Schema: "a", Table: "t1", Rows: 60, Copied: true},
+		{Schema: "a", Table: "t2", Rows: 30, Copied: true},
+		{Schema: "a", Table: "t3", ColumnMapTo: []string{"id"}},
+	}
+	// applied entries not saved as Gtid yet
+	queues := []QueueCheckpoint{
+		{Name: QueueFull},
+		{Name: QueueIncr, Pending: 2, AppliedGtid: "acd7d195-06cd-11e9-928f-02000aba3e28:1-105"},
+	}
+	exported, err := oldSM.ExportApplierState(job, tables, queues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exported.CopiedTables, []SchemaTable{{Schema: "a", Table: "t1"}, {Schema: "a", Table: "t2"}}) {
+		t.Errorf("CopiedTables %v", exported.CopiedTables)
+	}
+
+	// resume on a new deployment having only the exported blob
+	newSM, newStore := newTestStoreManager()
+	newStore.Kvs["dtle/job1/ApplierState"] = oldStore.Kvs["dtle/job1/ApplierState"]
+	imported, err := newSM.ImportApplierState(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exported, imported) {
+		t.Errorf("imported %+v, expect %+v", imported, exported)
+	}
+	if gtid, _ := newSM.GetGtidForJob(job); gtid != "acd7d195-06cd-11e9-928f-02000aba3e28:1-105" {
+		t.Errorf("gtid %v, expect the checkpoint of the incr queue", gtid)
+	}
+	if pos, _ := newSM.GetBinlogFilePosForJob(job); pos.Name != "bin.000003" || pos.Pos != 1234 {
+		t.Errorf("binlog pos %v", pos)
+	}
+	if stage, _ := newSM.GetJobStage(job); stage != "incr_copy" {
+		t.Errorf("stage %v", stage)
+	}
+	if exec, total, _ := newSM.GetDumpProgress(job); exec != 90 || total != 100 {
+		t.Errorf("dump progress %v/%v", exec, total)
+	}
+	// the blob is consumed. a later start keeps the positions it has reached since.
+	if _, ok := newStore.Kvs["dtle/job1/ApplierState"]; ok {
+		t.Errorf("expect the imported state to be deleted")
+	}
+	if state, err := newSM.ImportApplierState(job); state != nil || err != nil {
+		t.Errorf("expect no state on importing again, got %v %v", state, err)
+	}
+
+	// version 1 has no manifest
+	newStore.Kvs["dtle/job1/ApplierState"] = []byte(`{"Version":1,"MinReaderVersion":1,"Gtid":"v1",` +
+		`"CopiedTables":[{"Schema":"a","Table":"t1"}]}`)
+	state, err := newSM.ImportApplierState(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.ResumeGtid() != "v1" ||
+		!reflect.DeepEqual(state.Tables, []ApplierStateTable{{Schema: "a", Table: "t1", Copied: true}}) {
+		t.Errorf("imported version 1 state %+v", state)
+	}
+
+	// a newer format which this version cannot read
+	newStore.Kvs["dtle/job1/ApplierState"] = []byte(`{"Version":4,"MinReaderVersion":3,"Gtid":"x"}`)
+	if _, err := newSM.ImportApplierState(job); err == nil || !strings.Contains(err.Error(), "requires version 3") {
+		t.Errorf("expect error for a newer state, got %v", err)
+	}
+	if _, ok := newStore.Kvs["dtle/job1/ApplierState"]; !ok {
+		t.Errorf("expect the state to be kept if it cannot be imported")
+	}
+	// a newer format with only added fields is readable
+	newStore.Kvs["dtle/job1/ApplierState"] = []byte(`{"Version":3,"MinReaderVersion":1,"Gtid":"y","NewField":1}`)
+	if state, err := newSM.ImportApplierState(job); err != nil || state.Gtid != "y" {
+		t.Errorf("expect a compatible newer state to be imported, got %v %v", state, err)
+	}
+
+	emptySM, _ := newTestStoreManager()
+	if state, err := emptySM.ImportApplierState(job); state != nil || err != nil {
+		t.Errorf("expect no state, got %v %v", state, err)
+	}
+}
+
+func TestCheckPeerProtocol(t *testing.T) {
+	sm, s := newTestStoreManager()
+	// a peer of an older dtle without ProtocolInfo sends DumpEntry of protocol 0
+	if err := sm.CheckPeerProtocol("job1", "src"); err == nil || !strings.Contains(err.Error(), "version mismatch") {
+		t.Errorf("expect a version mismatch error without ProtocolInfo, got %v", err)
+	}
+
+	if err := sm.PutProtocolInfo("job1", "src"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.CheckPeerProtocol("job1", "src"); err != nil {
+		t.Errorf("expect the same version to be compatible, got %v", err)
+	}
+
+	// the peer sends entries in a format this version cannot decode
+	s.Kvs["dtle/job1/ProtocolInfo/src"] = []byte(`{"Version":4,"MinPeerVersion":3,"DtleVersion":"9.9.9"}`)
+	err := sm.CheckPeerProtocol("job1", "src")
+	if err == nil || !strings.Contains(err.Error(), "version mismatch") || !strings.Contains(err.Error(), "9.9.9") {
+		t.Errorf("expect a version mismatch error, got %v", err)
+	}
+	// the peer is older than this version supports
+	local := ProtocolInfo{Version: 4, MinPeerVersion: 3, DtleVersion: "9.9.9"}
+	if err := CheckProtocolCompatible(local, CurrentProtocolInfo()); err == nil {
+		t.Errorf("expect a version mismatch error for an old peer")
+	}
+	// a newer peer still accepting this version
+	s.Kvs["dtle/job1/ProtocolInfo/src"] = []byte(`{"Version":3,"MinPeerVersion":2,"DtleVersion":"9.9.9"}`)
+	if err := sm.CheckPeerProtocol("job1", "src"); err != nil {
+		t.Errorf("expect a compatible newer peer, got %v", err)
+	}
+}
+
+func TestCheckPeerCodec(t *testing.T) {
+	sm, s := newTestStoreManager()
+	if err := sm.CheckPeerCodec("job1", "dest", CodecGencode); err != nil {
+		t.Errorf("expect gencode to be always supported, got %v", err)
+	}
+	// a peer of an older dtle supports gencode only
+	if err := sm.CheckPeerCodec("job1", "dest", CodecGob); err == nil {
+		t.Errorf("expect an error without ProtocolInfo")
+	}
+	if err := sm.CheckPeerCodec("job1", "dest", "protobuf"); err == nil {
+		t.Errorf("expect an error for an unknown codec")
+	}
+
+	if err := sm.PutProtocolInfo("job1", "dest"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.CheckPeerCodec("job1", "dest", CodecMsgpack); err != nil {
+		t.Errorf("expect msgpack to be supported, got %v", err)
+	}
+	s.Kvs["dtle/job1/ProtocolInfo/dest"] = []byte(`{"Version":1,"MinPeerVersion":1,"Codecs":["gencode"]}`)
+	if err := sm.CheckPeerCodec("job1", "dest", CodecGob); err == nil {
+		t.Errorf("expect an error for a codec the peer cannot decode")
+	}
+}
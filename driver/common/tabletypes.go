@@ -2,6 +2,7 @@ package common
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/actiontech/dtle/driver/mysql/mysqlconfig"
@@ -91,6 +92,34 @@ func IgnoreTbByReplicateIgnoreDb(replicateIgnoreDb []*DataSource, dbName, tbName
 	return false
 }
 
+// MatchReplicateDoDb tells whether the table is in replicateDoDb, by either the source or the renamed names.
+func MatchReplicateDoDb(replicateDoDb []*DataSource, schema, table string) bool {
+	matchName := func(name, value, regex, rename string) bool {
+		if value != "" && value == name || rename != "" && rename == name {
+			return true
+		}
+		if regex == "" {
+			return false
+		}
+		// a name renamed by a regex (e.g. "${1}_new") cannot be matched back
+		return strings.Contains(rename, "$") || regexp.MustCompile(regex).MatchString(name)
+	}
+	for _, doDb := range replicateDoDb {
+		if !matchName(schema, doDb.TableSchema, doDb.TableSchemaRegex, doDb.TableSchemaRename) {
+			continue
+		}
+		if len(doDb.Tables) == 0 {
+			return true
+		}
+		for _, doTb := range doDb.Tables {
+			if matchName(table, doTb.TableName, doTb.TableRegex, doTb.TableRename) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 type Table struct {
 	TableName         string
 	TableRegex        string
@@ -107,6 +136,10 @@ type Table struct {
 	ColumnMap            []int
 
 	TableType    string
+	// storage engine of the source table, e.g. InnoDB
+	TableEngine string
+	// the next AUTO_INCREMENT value of the source table. 0 if there is none.
+	AutoIncrement uint64
 
 	Where string // Call GetWhere() instead of directly accessing.
 }
@@ -10,6 +10,8 @@ import (
 
 const (
 	DefaultChannelBufferSize        = 32
+	DefaultFullBytesQueueSize       = 16
+	DefaultDumpEntryQueueSize       = 8
 	DefaultChunkSize                = 2000
 	DefaultNumWorkers               = 1
 	DefaultClusterID                = "dtle-nats"
@@ -22,6 +24,48 @@ const (
 	TaskTypeSrc     = "src"
 	TaskTypeDest    = "dest"
 	TaskTypeUnknown = "unknown"
+
+	NumericAttrMismatchWarn  = "warn"
+	NumericAttrMismatchFail  = "fail"
+	NumericAttrMismatchClamp = "clamp"
+
+	AutoIncrementOverflowWarn = "warn"
+	AutoIncrementOverflowFail = "fail"
+
+	OnEncodingErrorFail        = "fail"
+	OnEncodingErrorReplaceChar = "replace_char"
+	OnEncodingErrorSkipColumn  = "skip_column"
+
+	TargetEmptyCheckApproximate = "approximate"
+	TargetEmptyCheckExact       = "exact"
+
+	TableCopyOrderConfig     = "config_order"
+	TableCopyOrderSizeAsc    = "size_asc"
+	TableCopyOrderSizeDesc   = "size_desc"
+	TableCopyOrderFKTopology = "fk_topology"
+
+	OrphanRowsReport = "report"
+	OrphanRowsDelete = "delete"
+	OrphanRowsFail   = "fail"
+
+	OnUnparseableDDLFail     = "fail"
+	OnUnparseableDDLApplyRaw = "apply_raw"
+	OnUnparseableDDLSkip     = "skip"
+
+	OnGtidConflictWarn   = "warn"
+	OnGtidConflictFail   = "fail"
+	OnGtidConflictIgnore = "ignore"
+
+	StrictTableFilterOff      = "off"
+	StrictTableFilterLog      = "log"
+	StrictTableFilterWarnOnce = "warn_once"
+
+	OutputModeExec = "exec"
+	OutputModeFile = "file"
+
+	FullCopyConflictModeReplace      = "replace"
+	FullCopyConflictModeInsertIgnore = "insert-ignore"
+	FullCopyConflictModeUpsert       = "upsert"
 )
 
 func TaskTypeFromString(s string) string {
@@ -62,20 +106,194 @@ type DtleTaskConfig struct {
 	TwoWaySync           bool          `codec:"TwoWaySync"`
 	TwoWaySyncGtid       string        `codec:"TwoWaySyncGtid"`
 
-	ParallelWorkers       int  `codec:"ParallelWorkers"`
+	ParallelWorkers int `codec:"ParallelWorkers"`
+	// dest: start incremental apply with 1 worker and add workers evenly over this period, up to
+	// ParallelWorkers. 0 to start all workers at once.
+	WorkerRampUpMs        int  `codec:"WorkerRampUpMs"`
 	DependencyHistorySize int  `codec:"DependencyHistorySize"`
 	UseMySQLDependency    bool `codec:"UseMySQLDependency"`
 	ForeignKeyChecks      bool `codec:"ForeignKeyChecks"`
 	DumpEntryLimit        int  `codec:"DumpEntryLimit"`
-	SetGtidNext           bool `codec:"SetGtidNext"`
+	// src: send rows of a chunk while scanning it, in entries of DumpEntryLimit bytes.
+	// net_write_timeout of the scanning session is raised to a day, as the scan waits for the dest task.
+	StreamDumpEntry bool `codec:"StreamDumpEntry"`
+	// dest: never disable foreign_key_checks on the target, in full copy or incremental replication,
+	// to catch bad data early. Rows must then be applied in an order satisfying foreign keys.
+	KeepForeignKeyChecks bool `codec:"KeepForeignKeyChecks"`
+	// src: attach a checksum of rows to each full copy chunk.
+	// dest: verify the checksum and ask the source to send the chunk again on mismatch.
+	VerifyChunkChecksum bool `codec:"VerifyChunkChecksum"`
+	// dest: max bytes of full copy data queued in memory. 0 for unlimited.
+	FullApplyMemoryLimit int64 `codec:"FullApplyMemoryLimit"`
+	// dest: max bytes of full and incr data queued in memory. Acks to the source are delayed while
+	// it is exceeded. 0 for unlimited.
+	MaxBufferedBytes int64 `codec:"MaxBufferedBytes"`
+	// dest: connections to the target beyond ParallelWorkers, for full copy and queries of metadata.
+	// 0 for the default (10).
+	ApplierConnPoolHeadroom int `codec:"ApplierConnPoolHeadroom"`
+	// dest: max idle connections to the target. 0 for the default (2).
+	ApplierConnMaxIdle int `codec:"ApplierConnMaxIdle"`
+	// dest: connections to the target are closed and reopened after this period, to avoid using one
+	// closed by the server after idling. 0 for the default (300000ms).
+	ApplierConnMaxLifetimeMs int `codec:"ApplierConnMaxLifetimeMs"`
+	// dest: max attempts to reconnect to the nats server after a disconnection. 0 for the default (60),
+	// negative for unlimited. The task fails when attempts are exhausted.
+	NatsMaxReconnects int `codec:"NatsMaxReconnects"`
+	// dest: interval of attempts to reconnect to the nats server. 0 for the default (2000ms).
+	NatsReconnectWaitMs int `codec:"NatsReconnectWaitMs"`
+	// dest: retries of connecting and subscribing to the nats server on start, e.g. if it is not ready yet.
+	// Only transient errors are retried. 0 to fail at once.
+	NatsSubscribeRetries int `codec:"NatsSubscribeRetries"`
+	// dest: wait before the first retry, doubled for each following one up to 30s. 0 for the default (500ms).
+	NatsSubscribeRetryWaitMs int `codec:"NatsSubscribeRetryWaitMs"`
+	// dest: capacity of the queues of received full copy msgs and of decoded entries.
+	// 0 for the defaults (16 and 8).
+	FullBytesQueueSize int `codec:"FullBytesQueueSize"`
+	DumpEntryQueueSize int `codec:"DumpEntryQueueSize"`
+	// dest: capacity of the queues of received incremental msgs and of decoded entries.
+	// 0 for the defaults (ReplChanBufferSize and twice of it).
+	IncrBytesQueueSize   int `codec:"IncrBytesQueueSize"`
+	BinlogEntryQueueSize int `codec:"BinlogEntryQueueSize"`
+	// dest: abort and retry a transaction of full copy taking longer than this. 0 for no limit.
+	// SELECTs in the transaction are limited with MAX_EXECUTION_TIME on MySQL 5.7.8+.
+	TxTimeoutMs int `codec:"TxTimeoutMs"`
+	// dest: pause apply while Threads_running / Threads_connected of the target is above this. 0 for unlimited.
+	TargetMaxThreadsRunning   int64 `codec:"TargetMaxThreadsRunning"`
+	TargetMaxThreadsConnected int64 `codec:"TargetMaxThreadsConnected"`
+	// dest: interval of checking the thread status of the target. 0 for the default (1000ms).
+	TargetStatusIntervalMs int `codec:"TargetStatusIntervalMs"`
+	// dest: max bytes of an insert statement in full copy. 0 for the default (1MB).
+	// It should not exceed half of max_allowed_packet of the target.
+	ApplyBatchSizeBytes int64 `codec:"ApplyBatchSizeBytes"`
+	// dest: lower ApplyBatchSizeBytes to fit max_allowed_packet of the target instead of failing.
+	ClampApplyBatchSize bool `codec:"ClampApplyBatchSize"`
+	// dest: write full copy rows with multi-row `replace into ... values (?,...),(?,...)` and bound values
+	// instead of escaped literals.
+	ParameterizedBatchInsert bool `codec:"ParameterizedBatchInsert"`
+	// dest: write full copy rows with `LOAD DATA LOCAL INFILE`, taking precedence over
+	// ParameterizedBatchInsert. The target needs local_infile=ON. Upsert of FullCopyConflictMode is not supported.
+	LoadDataInsert bool `codec:"LoadDataInsert"`
+	// dest: value written for NULL with LoadDataInsert. Literal values are escaped, so `\N` (the default)
+	// is unambiguous. Another sentinel is turned into NULL with NULLIF, and a row having it as a value fails.
+	LoadDataNullSentinel string `codec:"LoadDataNullSentinel"`
+	// dest: how full copy writes rows conflicting with existing ones. replace (`replace into`),
+	// insert-ignore (`insert ignore into`, keeping the existing row) or upsert
+	// (`insert into ... on duplicate key update`, updating the existing row in place).
+	// replace deletes the existing row, which cascades to rows referencing it by foreign keys.
+	FullCopyConflictMode string `codec:"FullCopyConflictMode"`
+	// src: order of tables in full copy. config_order, size_asc, size_desc (by estimated rows)
+	// or fk_topology (parents before children). Empty for an arbitrary order.
+	TableCopyOrder string `codec:"TableCopyOrder"`
+	// dest: check rows referencing non-existing parents after full copy. report, delete or fail.
+	// Empty to skip the check.
+	OrphanRowsPolicy string `codec:"OrphanRowsPolicy"`
+	// dest: in full copy, send rows violating ENUM/SET domains or CHECK constraints of the target
+	// to the dead letter file instead of failing the whole entry.
+	ValidateRows bool `codec:"ValidateRows"`
+	// dest: in full copy, warn on rows of an entry sharing a unique key. The later row wins.
+	DetectDuplicateKeys bool `codec:"DetectDuplicateKeys"`
+	SetGtidNext         bool `codec:"SetGtidNext"`
+	// dest: fail full copy if a target table has rows. approximate or exact. Empty to skip the check.
+	// approximate consults INFORMATION_SCHEMA.TABLES.TABLE_ROWS first and reads the table only if it is non-zero.
+	TargetEmptyCheck string `codec:"TargetEmptyCheck"`
+	// dest: at most this number of DDL operations run at once on the target, shared by jobs of the target.
+	// 0 for unlimited.
+	MaxConcurrentDDL int `codec:"MaxConcurrentDDL"`
+	// dest: columns ("schema.table.column" of the target) to be encrypted on apply, as MySQL
+	// AES_ENCRYPT(value, ColumnEncryptionKey) does. Read them with AES_DECRYPT(column, key).
+	EncryptColumns      []string `codec:"EncryptColumns"`
+	ColumnEncryptionKey string   `codec:"ColumnEncryptionKey"`
+	// dest: character sets of values of columns ("schema.table.column" of the target), e.g. latin1,
+	// when they differ from what the source declares. Values are converted on full copy.
+	ColumnCharsets map[string]string `codec:"ColumnCharsets"`
+	// dest: a comment prepended to statements applying data, e.g. "/*+ route_to_master */" as a routing
+	// hint for a proxy in front of the target.
+	SqlCommentPrefix string `codec:"SqlCommentPrefix"`
+	// dest: isolation level of transactions applying data, e.g. READ-COMMITTED. Empty for the server default.
+	TxIsolationLevel string `codec:"TxIsolationLevel"`
+	// dest: exec or file. file writes full copy statements to OutputFile instead of executing them,
+	// for applying offline. Requires SkipIncrementalCopy. Rows are transformed as on exec, and the target
+	// is still read for definitions of existing tables.
+	OutputMode string `codec:"OutputMode"`
+	// dest: path of the file for OutputMode file. "-" for stdout.
+	OutputFile string `codec:"OutputFile"`
+	// dest: terminator of statements in OutputFile. A DELIMITER command is written if it is not ";".
+	OutputDelimiter string `codec:"OutputDelimiter"`
+	// dest: path of an append-only log of events applied by incremental replication, in the order
+	// of applying, as JSON lines with the GTID, type and table of each event. Empty to disable.
+	SequenceLogFile string `codec:"SequenceLogFile"`
+	// fail on start if the src and dest tasks run dtle versions which cannot work together.
+	// A peer of a dtle without ProtocolInfo is rejected.
+	ValidateProtocolVersion bool `codec:"ValidateProtocolVersion"`
+	// src: serialization of data sent to the dest task. gencode, gob or msgpack. The dest task uses
+	// the same one. The src task fails on start if the dest task does not support it.
+	MessageCodec string `codec:"MessageCodec"`
+	// src: send the group of incremental entries once its rows / bytes reach this, regardless of
+	// GroupMaxSize and GroupTimeout. 0 for unlimited.
+	GroupMaxRows  int64 `codec:"GroupMaxRows"`
+	GroupMaxBytes int64 `codec:"GroupMaxBytes"`
+	// dest: hold incremental entries received before the full copy completes, and apply them after it.
+	// Ignored for Oracle sources.
+	StrictFullThenIncr bool `codec:"StrictFullThenIncr"`
+	// retry the failed operation on transient errors within this period before failing the task. 0 to disable.
+	ErrorGracePeriodMs int `codec:"ErrorGracePeriodMs"`
+	// dest: overrides ErrorGracePeriodMs for transactions on the tables, keyed by "schema.table" of the target.
+	TableRetryPolicies map[string]*TableRetryPolicy `codec:"TableRetryPolicies"`
+	// dest: apply incr DELETE on the tables as an update of a column, keyed by "schema.table" of the target.
+	SoftDeleteTables map[string]*SoftDeletePolicy `codec:"SoftDeleteTables"`
+	// dest: route rows of incremental replication of a table to several target tables by the value of
+	// a column, keyed by "schema.table" of the source (after SchemaRenameMap).
+	FanOutTables map[string]*FanOutPolicy `codec:"FanOutTables"`
+	// dest: apply only rows matching the expression (syntax of Where of ReplicateDoDb, on target columns),
+	// keyed by "schema.table" of the target.
+	ApplyRowFilters map[string]string `codec:"ApplyRowFilters"`
+	// emit a task event if ProgressPct stays below 100 for this many seconds. 0 to disable.
+	ProgressStallTimeout int `codec:"ProgressStallTimeout"`
+	// map source schema name to target schema name. applied on the dest side.
+	SchemaRenameMap map[string]string `codec:"SchemaRenameMap"`
 
-	SkipCreateDbTable    bool                          `codec:"SkipCreateDbTable"`
-	SkipPrivilegeCheck   bool                          `codec:"SkipPrivilegeCheck"`
-	SkipIncrementalCopy  bool                          `codec:"SkipIncrementalCopy"`
+	SkipCreateDbTable   bool `codec:"SkipCreateDbTable"`
+	SkipPrivilegeCheck  bool `codec:"SkipPrivilegeCheck"`
+	SkipIncrementalCopy bool `codec:"SkipIncrementalCopy"`
+	// dest: create target databases of ReplicateDoDb missing on start.
+	AutoCreateDatabase bool `codec:"AutoCreateDatabase"`
+	// src: exclude tables failing validation from replication instead of failing the job.
+	SkipInvalidTables bool `codec:"SkipInvalidTables"`
+	// src: tables without a usable unique key fail validation.
+	RequireUniqueKey bool `codec:"RequireUniqueKey"`
+	// do not fail on source/target column types of different kinds
+	AllowIncompatibleColumnType bool `codec:"AllowIncompatibleColumnType"`
+	// warn, fail or clamp. on UNSIGNED/ZEROFILL differences between source and target columns
+	NumericAttrMismatch string `codec:"NumericAttrMismatch"`
+	// dest: warn or fail. when the AUTO_INCREMENT value of a source table exceeds the max of the
+	// target column. Values near the max are always warned.
+	AutoIncrementOverflow string `codec:"AutoIncrementOverflow"`
+	// dest: fail, replace_char or skip_column. checks values against the character sets of the target
+	// columns (e.g. a 4-byte character for utf8mb3). replace_char writes '?' for such characters.
+	// skip_column writes NULL for such values. Empty to leave it to the target and its sql_mode.
+	OnEncodingError string `codec:"OnEncodingError"`
+	// dest: add IF NOT EXISTS/IF EXISTS to CREATE/DROP DATABASE/TABLE, so that replaying them on restart
+	// does not fail.
+	IdempotentDDL bool `codec:"IdempotentDDL"`
+	// src: save DDL of FK parents of tables created or altered in incr replication.
+	// dest: create FK parents missing on the target with the saved DDL before such a DDL.
+	PrefetchDDLDependencies bool `codec:"PrefetchDDLDependencies"`
+	// dest: fail, apply_raw or skip. on DDL which cannot be parsed. apply_raw executes it as is
+	// (e.g. schemas are not renamed by SchemaRenameMap).
+	OnUnparseableDDL string `codec:"OnUnparseableDDL"`
+	// dest: warn, fail or ignore. on merging a GTID set whose intervals of a UUID overlap each other
+	// or partially overlap the executed ones, which suggests two masters with the same UUID.
+	OnGtidConflict string `codec:"OnGtidConflict"`
+	// dest: off, log or warn_once. drop DML events of tables not in ReplicateDoDb,
+	// logging each of them or only the first one of each table.
+	StrictTableFilter string `codec:"StrictTableFilter"`
+	// dest: drop transactions whose GTID has one of these source UUIDs, e.g. to avoid loops
+	// in multi-source topologies.
+	FilterBySourceUUID   []string                      `codec:"FilterBySourceUUID"`
 	SrcConnectionConfig  *mysqlconfig.ConnectionConfig `codec:"SrcConnectionConfig"`
 	DestConnectionConfig *mysqlconfig.ConnectionConfig `codec:"DestConnectionConfig"`
 	KafkaConfig          *KafkaConfig                  `codec:"KafkaConfig"`
-	DestType             string `codec:"DestType"`
+	DestType             string                        `codec:"DestType"`
 	// support oracle extractor/applier
 	SrcOracleConfig *config.OracleConfig `codec:"SrcOracleConfig"`
 }
@@ -87,6 +305,18 @@ func (d *DtleTaskConfig) SetDefaultForEmpty() {
 	if d.ReplChanBufferSize <= 0 {
 		d.ReplChanBufferSize = DefaultChannelBufferSize
 	}
+	if d.FullBytesQueueSize <= 0 {
+		d.FullBytesQueueSize = DefaultFullBytesQueueSize
+	}
+	if d.DumpEntryQueueSize <= 0 {
+		d.DumpEntryQueueSize = DefaultDumpEntryQueueSize
+	}
+	if d.IncrBytesQueueSize <= 0 {
+		d.IncrBytesQueueSize = int(d.ReplChanBufferSize)
+	}
+	if d.BinlogEntryQueueSize <= 0 {
+		d.BinlogEntryQueueSize = int(d.ReplChanBufferSize * 2)
+	}
 	if d.ParallelWorkers <= 0 {
 		d.ParallelWorkers = DefaultNumWorkers
 	}
@@ -96,6 +326,47 @@ func (d *DtleTaskConfig) SetDefaultForEmpty() {
 	if d.GroupTimeout == 0 {
 		d.GroupTimeout = DefaultSrcGroupTimeout
 	}
+	if d.NumericAttrMismatch == "" {
+		d.NumericAttrMismatch = NumericAttrMismatchWarn
+	}
+	if d.AutoIncrementOverflow == "" {
+		d.AutoIncrementOverflow = AutoIncrementOverflowFail
+	}
+	if d.OnUnparseableDDL == "" {
+		d.OnUnparseableDDL = OnUnparseableDDLApplyRaw
+	}
+	if d.OnGtidConflict == "" {
+		d.OnGtidConflict = OnGtidConflictWarn
+	}
+	if d.StrictTableFilter == "" {
+		d.StrictTableFilter = StrictTableFilterOff
+	}
+	if d.OutputMode == "" {
+		d.OutputMode = OutputModeExec
+	}
+	if d.OutputDelimiter == "" {
+		d.OutputDelimiter = ";"
+	}
+	if d.MessageCodec == "" {
+		d.MessageCodec = CodecGencode
+	}
+	if d.FullCopyConflictMode == "" {
+		d.FullCopyConflictMode = FullCopyConflictModeReplace
+	}
+	if d.LoadDataNullSentinel == "" {
+		d.LoadDataNullSentinel = `\N`
+	}
+	for _, p := range d.SoftDeleteTables {
+		if p == nil {
+			continue
+		}
+		if p.Column == "" {
+			p.Column = "deleted_at"
+		}
+		if p.Value == "" {
+			p.Value = "NOW()"
+		}
+	}
 
 	if d.KafkaConfig != nil {
 		if d.KafkaConfig.MessageGroupMaxSize == 0 {
@@ -155,3 +426,34 @@ type KafkaConfig struct {
 	TopicWithSchemaTable bool
 	SchemaChangeTopic    string
 }
+
+// TableRetryPolicy is how a transaction failed with a transient error (e.g. a deadlock) is retried.
+type TableRetryPolicy struct {
+	// retry this many times. 0 to use ErrorGracePeriodMs.
+	MaxRetries int
+	// delay before the first retry. 0 for the default (200ms).
+	RetryIntervalMs int
+	// the delay doubles on each retry up to this. 0 for a fixed delay.
+	MaxRetryIntervalMs int
+}
+
+// FanOutPolicy is how rows of a table are routed to target tables. The target tables have the
+// columns of the source table. DDL and full copy of the table are not routed.
+type FanOutPolicy struct {
+	// the routing column
+	Column string
+	// value of Column to target tables, each as "schema.table"
+	Routes map[string][]string
+	// target tables of rows matching no route. empty to skip such rows.
+	Default []string
+}
+
+// SoftDeletePolicy is how an incr DELETE is applied as `update ... set Column = Value`.
+type SoftDeletePolicy struct {
+	// the column marking a row deleted. default "deleted_at".
+	Column string
+	// an SQL expression set to Column. default "NOW()".
+	Value string
+	// an extra predicate the row must match, e.g. "deleted_at is null". empty for none.
+	Where string
+}
@@ -23,6 +23,8 @@ type DumpEntry struct {
 	TotalCount      int64
 	Table           []byte
 	ColumnMapTo     []string
+	ColumnTypes     []string
+	Checksum        uint32
 }
 
 func (d *DumpEntry) Size() (s uint64) {
@@ -277,7 +279,42 @@ func (d *DumpEntry) Size() (s uint64) {
 		}
 
 	}
-	s += 8
+	{
+		l := uint64(len(d.ColumnTypes))
+
+		{
+
+			t := l
+			for t >= 0x80 {
+				t >>= 7
+				s++
+			}
+			s++
+
+		}
+
+		for k0 := range d.ColumnTypes {
+
+			{
+				l := uint64(len(d.ColumnTypes[k0]))
+
+				{
+
+					t := l
+					for t >= 0x80 {
+						t >>= 7
+						s++
+					}
+					s++
+
+				}
+				s += l
+			}
+
+		}
+
+	}
+	s += 12
 	return
 }
 func (d *DumpEntry) Marshal(buf []byte) ([]byte, error) {
@@ -603,7 +640,58 @@ func (d *DumpEntry) Marshal(buf []byte) ([]byte, error) {
 
 		}
 	}
-	return buf[:i+8], nil
+	{
+		l := uint64(len(d.ColumnTypes))
+
+		{
+
+			t := uint64(l)
+
+			for t >= 0x80 {
+				buf[i+8] = byte(t) | 0x80
+				t >>= 7
+				i++
+			}
+			buf[i+8] = byte(t)
+			i++
+
+		}
+		for k0 := range d.ColumnTypes {
+
+			{
+				l := uint64(len(d.ColumnTypes[k0]))
+
+				{
+
+					t := uint64(l)
+
+					for t >= 0x80 {
+						buf[i+8] = byte(t) | 0x80
+						t >>= 7
+						i++
+					}
+					buf[i+8] = byte(t)
+					i++
+
+				}
+				copy(buf[i+8:], d.ColumnTypes[k0])
+				i += l
+			}
+
+		}
+	}
+	{
+
+		buf[i+0+8] = byte(d.Checksum >> 0)
+
+		buf[i+1+8] = byte(d.Checksum >> 8)
+
+		buf[i+2+8] = byte(d.Checksum >> 16)
+
+		buf[i+3+8] = byte(d.Checksum >> 24)
+
+	}
+	return buf[:i+12], nil
 }
 
 func (d *DumpEntry) Unmarshal(buf []byte) (uint64, error) {
@@ -958,7 +1046,59 @@ func (d *DumpEntry) Unmarshal(buf []byte) (uint64, error) {
 
 		}
 	}
-	return i + 8, nil
+	{
+		l := uint64(0)
+
+		{
+
+			bs := uint8(7)
+			t := uint64(buf[i+8] & 0x7F)
+			for buf[i+8]&0x80 == 0x80 {
+				i++
+				t |= uint64(buf[i+8]&0x7F) << bs
+				bs += 7
+			}
+			i++
+
+			l = t
+
+		}
+		if uint64(cap(d.ColumnTypes)) >= l {
+			d.ColumnTypes = d.ColumnTypes[:l]
+		} else {
+			d.ColumnTypes = make([]string, l)
+		}
+		for k0 := range d.ColumnTypes {
+
+			{
+				l := uint64(0)
+
+				{
+
+					bs := uint8(7)
+					t := uint64(buf[i+8] & 0x7F)
+					for buf[i+8]&0x80 == 0x80 {
+						i++
+						t |= uint64(buf[i+8]&0x7F) << bs
+						bs += 7
+					}
+					i++
+
+					l = t
+
+				}
+				d.ColumnTypes[k0] = string(buf[i+8 : i+8+l])
+				i += l
+			}
+
+		}
+	}
+	{
+
+		d.Checksum = 0 | (uint32(buf[i+0+8]) << 0) | (uint32(buf[i+1+8]) << 8) | (uint32(buf[i+2+8]) << 16) | (uint32(buf[i+3+8]) << 24)
+
+	}
+	return i + 12, nil
 }
 
 type MySQLCoordinateTx struct {
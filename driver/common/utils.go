@@ -12,6 +12,7 @@ import (
 	"github.com/pingcap/tidb/parser/format"
 	"regexp"
 	"strconv"
+	"time"
 )
 
 const ParserRestoreFlag = format.DefaultRestoreFlags | format.RestoreStringWithoutDefaultCharset
@@ -39,6 +40,46 @@ func MysqlVersionInDigit(v string) (int, error) {
 	return m0*10000 + m1*100 + m2, nil
 }
 
+// RetryInGracePeriod calls `retry` until it succeeds or `gracePeriod` passes.
+// The last error is returned if it never succeeds.
+func RetryInGracePeriod(gracePeriod time.Duration, interval time.Duration, shutdownCh <-chan struct{},
+	retry func() error) (err error) {
+
+	deadline := time.Now().Add(gracePeriod)
+	for {
+		select {
+		case <-shutdownCh:
+			return fmt.Errorf("RetryInGracePeriod: shutdown")
+		case <-time.After(interval):
+		}
+		err = retry()
+		if err == nil || !time.Now().Add(interval).Before(deadline) {
+			return err
+		}
+	}
+}
+
+// RetryWithBackoff calls `op` up to `attempts` times while it fails with an error accepted by `isTransient`.
+// The delay between attempts doubles from `delay` up to `maxDelay`.
+func RetryWithBackoff(attempts int, delay time.Duration, maxDelay time.Duration, shutdownCh <-chan struct{},
+	isTransient func(error) bool, op func() error) (err error) {
+
+	for i := 1; ; i++ {
+		err = op()
+		if err == nil || i >= attempts || !isTransient(err) {
+			return err
+		}
+		select {
+		case <-shutdownCh:
+			return fmt.Errorf("RetryWithBackoff: shutdown. last err: %v", err)
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
 func WriteWaitCh(ch chan<- *drivers.ExitResult, r *drivers.ExitResult) {
 	select {
 	case ch<-r:
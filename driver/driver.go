@@ -93,6 +93,12 @@ var (
 		"Password": hclspec.NewAttr("Password", "string", true),
 		"Charset": hclspec.NewDefault(hclspec.NewAttr("Charset", "string", false),
 			hclspec.NewLiteral(`"utf8mb4"`)),
+		"RequirePrimary": hclspec.NewDefault(hclspec.NewAttr("RequirePrimary", "bool", false),
+			hclspec.NewLiteral(`false`)),
+		"AuthTokenCommand": hclspec.NewDefault(hclspec.NewAttr("AuthTokenCommand", "string", false),
+			hclspec.NewLiteral(`""`)),
+		"AuthTokenTTLSec": hclspec.NewDefault(hclspec.NewAttr("AuthTokenTTLSec", "number", false),
+			hclspec.NewLiteral(`900`)),
 	})
 	oracleConfigSpec = hclspec.NewObject(map[string]*hclspec.Spec{
 		"ServiceName": hclspec.NewAttr("ServiceName", "string", true),
@@ -137,24 +143,98 @@ var (
 		"MaxRetries":           hclspec.NewAttr("MaxRetries", "number", false),
 		"ChunkSize":            hclspec.NewAttr("ChunkSize", "number", false),
 		"SqlFilter":            hclspec.NewAttr("SqlFilter", "list(string)", false),
-		"GroupMaxSize":         hclspec.NewAttr("GroupMaxSize", "number", false),
-		"GroupTimeout":         hclspec.NewAttr("GroupTimeout", "number", false),
-		"Gtid":                 hclspec.NewAttr("Gtid", "string", false),
-		"TwoWaySyncGtid":       hclspec.NewAttr("TwoWaySyncGtid", "string", false),
-		"BinlogFile":           hclspec.NewAttr("BinlogFile", "string", false),
-		"BinlogPos":            hclspec.NewAttr("BinlogPos", "number", false),
-		"GtidStart":            hclspec.NewAttr("GtidStart", "string", false),
-		"AutoGtid":             hclspec.NewAttr("AutoGtid", "bool", false),
-		"BinlogRelay":          hclspec.NewAttr("BinlogRelay", "bool", false),
-		"ParallelWorkers":      hclspec.NewAttr("ParallelWorkers", "number", false),
-		"SkipCreateDbTable":    hclspec.NewAttr("SkipCreateDbTable", "bool", false),
-		"SkipPrivilegeCheck":   hclspec.NewAttr("SkipPrivilegeCheck", "bool", false),
-		"SkipIncrementalCopy":  hclspec.NewAttr("SkipIncrementalCopy", "bool", false),
+		"SchemaRenameMap":      hclspec.NewAttr("SchemaRenameMap", "map(string)", false),
+		"TableRetryPolicies": hclspec.NewBlockMap("TableRetryPolicies", []string{"Table"},
+			hclspec.NewObject(map[string]*hclspec.Spec{
+				"MaxRetries":         hclspec.NewAttr("MaxRetries", "number", false),
+				"RetryIntervalMs":    hclspec.NewAttr("RetryIntervalMs", "number", false),
+				"MaxRetryIntervalMs": hclspec.NewAttr("MaxRetryIntervalMs", "number", false),
+			})),
+		"SoftDeleteTables": hclspec.NewBlockMap("SoftDeleteTables", []string{"Table"},
+			hclspec.NewObject(map[string]*hclspec.Spec{
+				"Column": hclspec.NewAttr("Column", "string", false),
+				"Value":  hclspec.NewAttr("Value", "string", false),
+				"Where":  hclspec.NewAttr("Where", "string", false),
+			})),
+		"FanOutTables": hclspec.NewBlockMap("FanOutTables", []string{"Table"},
+			hclspec.NewObject(map[string]*hclspec.Spec{
+				"Column":  hclspec.NewAttr("Column", "string", true),
+				"Routes":  hclspec.NewAttr("Routes", "map(list(string))", false),
+				"Default": hclspec.NewAttr("Default", "list(string)", false),
+			})),
+		"ApplyRowFilters": hclspec.NewAttr("ApplyRowFilters", "map(string)", false),
+		"GroupMaxSize":    hclspec.NewAttr("GroupMaxSize", "number", false),
+		"GroupTimeout":    hclspec.NewAttr("GroupTimeout", "number", false),
+		"Gtid":            hclspec.NewAttr("Gtid", "string", false),
+		"TwoWaySyncGtid":  hclspec.NewAttr("TwoWaySyncGtid", "string", false),
+		"BinlogFile":      hclspec.NewAttr("BinlogFile", "string", false),
+		"BinlogPos":       hclspec.NewAttr("BinlogPos", "number", false),
+		"GtidStart":       hclspec.NewAttr("GtidStart", "string", false),
+		"AutoGtid":        hclspec.NewAttr("AutoGtid", "bool", false),
+		"BinlogRelay":     hclspec.NewAttr("BinlogRelay", "bool", false),
+		"ParallelWorkers": hclspec.NewAttr("ParallelWorkers", "number", false),
+		"WorkerRampUpMs": hclspec.NewDefault(hclspec.NewAttr("WorkerRampUpMs", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"SkipCreateDbTable":   hclspec.NewAttr("SkipCreateDbTable", "bool", false),
+		"SkipPrivilegeCheck":  hclspec.NewAttr("SkipPrivilegeCheck", "bool", false),
+		"SkipIncrementalCopy": hclspec.NewAttr("SkipIncrementalCopy", "bool", false),
+		"TxIsolationLevel":    hclspec.NewAttr("TxIsolationLevel", "string", false),
+		"OutputMode": hclspec.NewDefault(hclspec.NewAttr("OutputMode", "string", false),
+			hclspec.NewLiteral(`"exec"`)),
+		"OutputFile": hclspec.NewAttr("OutputFile", "string", false),
+		"OutputDelimiter": hclspec.NewDefault(hclspec.NewAttr("OutputDelimiter", "string", false),
+			hclspec.NewLiteral(`";"`)),
+		"SequenceLogFile":  hclspec.NewAttr("SequenceLogFile", "string", false),
+		"TargetEmptyCheck": hclspec.NewAttr("TargetEmptyCheck", "string", false),
+		"MaxConcurrentDDL": hclspec.NewDefault(hclspec.NewAttr("MaxConcurrentDDL", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"EncryptColumns":      hclspec.NewAttr("EncryptColumns", "list(string)", false),
+		"ColumnEncryptionKey": hclspec.NewAttr("ColumnEncryptionKey", "string", false),
+		"ColumnCharsets":      hclspec.NewAttr("ColumnCharsets", "map(string)", false),
+		"ErrorGracePeriodMs": hclspec.NewDefault(hclspec.NewAttr("ErrorGracePeriodMs", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"ProgressStallTimeout": hclspec.NewDefault(hclspec.NewAttr("ProgressStallTimeout", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"SkipInvalidTables": hclspec.NewDefault(hclspec.NewAttr("SkipInvalidTables", "bool", false),
+			hclspec.NewLiteral(`true`)),
+		"RequireUniqueKey": hclspec.NewDefault(hclspec.NewAttr("RequireUniqueKey", "bool", false),
+			hclspec.NewLiteral(`false`)),
+		"AllowIncompatibleColumnType": hclspec.NewDefault(hclspec.NewAttr("AllowIncompatibleColumnType", "bool", false),
+			hclspec.NewLiteral(`false`)),
+		"NumericAttrMismatch": hclspec.NewDefault(hclspec.NewAttr("NumericAttrMismatch", "string", false),
+			hclspec.NewLiteral(`"warn"`)),
+		"AutoIncrementOverflow": hclspec.NewDefault(hclspec.NewAttr("AutoIncrementOverflow", "string", false),
+			hclspec.NewLiteral(`"fail"`)),
+		"OnEncodingError":  hclspec.NewAttr("OnEncodingError", "string", false),
+		"SqlCommentPrefix": hclspec.NewAttr("SqlCommentPrefix", "string", false),
+		"GroupMaxRows": hclspec.NewDefault(hclspec.NewAttr("GroupMaxRows", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"GroupMaxBytes": hclspec.NewDefault(hclspec.NewAttr("GroupMaxBytes", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"StrictFullThenIncr": hclspec.NewDefault(hclspec.NewAttr("StrictFullThenIncr", "bool", false),
+			hclspec.NewLiteral(`false`)),
+		"MessageCodec": hclspec.NewDefault(hclspec.NewAttr("MessageCodec", "string", false),
+			hclspec.NewLiteral(`"gencode"`)),
+		"ValidateProtocolVersion": hclspec.NewDefault(hclspec.NewAttr("ValidateProtocolVersion", "bool", false),
+			hclspec.NewLiteral(`true`)),
+		"IdempotentDDL": hclspec.NewDefault(hclspec.NewAttr("IdempotentDDL", "bool", false),
+			hclspec.NewLiteral(`false`)),
+		"PrefetchDDLDependencies": hclspec.NewDefault(hclspec.NewAttr("PrefetchDDLDependencies", "bool", false),
+			hclspec.NewLiteral(`false`)),
+		"OnUnparseableDDL": hclspec.NewDefault(hclspec.NewAttr("OnUnparseableDDL", "string", false),
+			hclspec.NewLiteral(`"apply_raw"`)),
+		"OnGtidConflict": hclspec.NewDefault(hclspec.NewAttr("OnGtidConflict", "string", false),
+			hclspec.NewLiteral(`"warn"`)),
+		"StrictTableFilter": hclspec.NewDefault(hclspec.NewAttr("StrictTableFilter", "string", false),
+			hclspec.NewLiteral(`"off"`)),
+		"FilterBySourceUUID": hclspec.NewAttr("FilterBySourceUUID", "list(string)", false),
+		"AutoCreateDatabase": hclspec.NewDefault(hclspec.NewAttr("AutoCreateDatabase", "bool", false),
+			hclspec.NewLiteral(`false`)),
 		"SlaveNetWriteTimeout": hclspec.NewDefault(hclspec.NewAttr("SlaveNetWriteTimeout", "number", false),
 			hclspec.NewLiteral(`28800`)), // 8 hours
-		"SrcConnectionConfig": hclspec.NewBlock("SrcConnectionConfig", false, connectionConfigSpec),
+		"SrcConnectionConfig":  hclspec.NewBlock("SrcConnectionConfig", false, connectionConfigSpec),
 		"DestConnectionConfig": hclspec.NewBlock("DestConnectionConfig", false, connectionConfigSpec),
-		"WaitOnJob": hclspec.NewAttr("WaitOnJob", "string", false),
+		"WaitOnJob":            hclspec.NewAttr("WaitOnJob", "string", false),
 		"TwoWaySync": hclspec.NewDefault(hclspec.NewAttr("TwoWaySync", "bool", false),
 			hclspec.NewLiteral(`false`)),
 		"BulkInsert1": hclspec.NewDefault(hclspec.NewAttr("BulkInsert1", "number", false),
@@ -187,11 +267,68 @@ var (
 			hclspec.NewLiteral(`true`)),
 		"ForeignKeyChecks": hclspec.NewDefault(hclspec.NewAttr("ForeignKeyChecks", "bool", false),
 			hclspec.NewLiteral(`true`)),
+		"KeepForeignKeyChecks": hclspec.NewDefault(hclspec.NewAttr("KeepForeignKeyChecks", "bool", false),
+			hclspec.NewLiteral(`false`)),
 		"DumpEntryLimit": hclspec.NewDefault(hclspec.NewAttr("DumpEntryLimit", "number", false),
 			hclspec.NewLiteral(`67108864`)),
+		"StreamDumpEntry": hclspec.NewDefault(hclspec.NewAttr("StreamDumpEntry", "bool", false),
+			hclspec.NewLiteral(`false`)),
+		"VerifyChunkChecksum": hclspec.NewDefault(hclspec.NewAttr("VerifyChunkChecksum", "bool", false),
+			hclspec.NewLiteral(`false`)),
+		"FullApplyMemoryLimit": hclspec.NewDefault(hclspec.NewAttr("FullApplyMemoryLimit", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"MaxBufferedBytes": hclspec.NewDefault(hclspec.NewAttr("MaxBufferedBytes", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"ApplierConnPoolHeadroom": hclspec.NewDefault(hclspec.NewAttr("ApplierConnPoolHeadroom", "number", false),
+			hclspec.NewLiteral(`10`)),
+		"ApplierConnMaxIdle": hclspec.NewDefault(hclspec.NewAttr("ApplierConnMaxIdle", "number", false),
+			hclspec.NewLiteral(`2`)),
+		"ApplierConnMaxLifetimeMs": hclspec.NewDefault(hclspec.NewAttr("ApplierConnMaxLifetimeMs", "number", false),
+			hclspec.NewLiteral(`300000`)),
+		"NatsMaxReconnects": hclspec.NewDefault(hclspec.NewAttr("NatsMaxReconnects", "number", false),
+			hclspec.NewLiteral(`60`)),
+		"NatsReconnectWaitMs": hclspec.NewDefault(hclspec.NewAttr("NatsReconnectWaitMs", "number", false),
+			hclspec.NewLiteral(`2000`)),
+		"NatsSubscribeRetries": hclspec.NewDefault(hclspec.NewAttr("NatsSubscribeRetries", "number", false),
+			hclspec.NewLiteral(`5`)),
+		"NatsSubscribeRetryWaitMs": hclspec.NewDefault(hclspec.NewAttr("NatsSubscribeRetryWaitMs", "number", false),
+			hclspec.NewLiteral(`500`)),
+		"FullBytesQueueSize": hclspec.NewDefault(hclspec.NewAttr("FullBytesQueueSize", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"DumpEntryQueueSize": hclspec.NewDefault(hclspec.NewAttr("DumpEntryQueueSize", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"IncrBytesQueueSize": hclspec.NewDefault(hclspec.NewAttr("IncrBytesQueueSize", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"BinlogEntryQueueSize": hclspec.NewDefault(hclspec.NewAttr("BinlogEntryQueueSize", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"TxTimeoutMs": hclspec.NewDefault(hclspec.NewAttr("TxTimeoutMs", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"TargetMaxThreadsRunning": hclspec.NewDefault(hclspec.NewAttr("TargetMaxThreadsRunning", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"TargetMaxThreadsConnected": hclspec.NewDefault(hclspec.NewAttr("TargetMaxThreadsConnected", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"TargetStatusIntervalMs": hclspec.NewDefault(hclspec.NewAttr("TargetStatusIntervalMs", "number", false),
+			hclspec.NewLiteral(`1000`)),
+		"ApplyBatchSizeBytes": hclspec.NewDefault(hclspec.NewAttr("ApplyBatchSizeBytes", "number", false),
+			hclspec.NewLiteral(`0`)),
+		"ClampApplyBatchSize": hclspec.NewDefault(hclspec.NewAttr("ClampApplyBatchSize", "bool", false),
+			hclspec.NewLiteral(`false`)),
+		"ParameterizedBatchInsert": hclspec.NewDefault(hclspec.NewAttr("ParameterizedBatchInsert", "bool", false),
+			hclspec.NewLiteral(`false`)),
+		"LoadDataInsert": hclspec.NewDefault(hclspec.NewAttr("LoadDataInsert", "bool", false),
+			hclspec.NewLiteral(`false`)),
+		"LoadDataNullSentinel": hclspec.NewAttr("LoadDataNullSentinel", "string", false),
+		"FullCopyConflictMode": hclspec.NewDefault(hclspec.NewAttr("FullCopyConflictMode", "string", false),
+			hclspec.NewLiteral(`"replace"`)),
+		"TableCopyOrder":   hclspec.NewAttr("TableCopyOrder", "string", false),
+		"OrphanRowsPolicy": hclspec.NewAttr("OrphanRowsPolicy", "string", false),
+		"ValidateRows": hclspec.NewDefault(hclspec.NewAttr("ValidateRows", "bool", false),
+			hclspec.NewLiteral(`false`)),
+		"DetectDuplicateKeys": hclspec.NewDefault(hclspec.NewAttr("DetectDuplicateKeys", "bool", false),
+			hclspec.NewLiteral(`false`)),
 		"SetGtidNext": hclspec.NewDefault(hclspec.NewAttr("SetGtidNext", "bool", false),
 			hclspec.NewLiteral(`false`)),
-		"DestType": hclspec.NewAttr("DestType", "string", false),
+		"DestType":        hclspec.NewAttr("DestType", "string", false),
 		"SrcOracleConfig": hclspec.NewBlock("SrcOracleConfig", false, oracleConfigSpec),
 	})
 
@@ -817,7 +954,12 @@ func (d *Driver) SignalTask(taskID string, signal string) error {
 		if h.runner == nil {
 			return fmt.Errorf("h.runner is nil")
 		}
-		err := h.runner.Shutdown()
+		var err error
+		if p, ok := h.runner.(pauser); ok {
+			err = p.Pause()
+		} else {
+			err = h.runner.Shutdown()
+		}
 		if err != nil {
 			d.logger.Error("error when pausing a task", "taskID", taskID, "err", err)
 		}
@@ -149,6 +149,9 @@ func (h *taskHandle) run(d *Driver) {
 
 	go func() {
 		duration := time.Duration(d.config.StatsCollectionInterval) * time.Second
+		stall := &common.ProgressStallDetector{
+			Timeout: time.Duration(h.driverConfig.ProgressStallTimeout) * time.Second,
+		}
 		t := time.NewTimer(0)
 		for {
 			select {
@@ -162,6 +165,9 @@ func (h *taskHandle) run(d *Driver) {
 						// ignore
 					} else {
 						h.stats = s
+						if stall.Timeout > 0 && stall.Check(s.ProgressPct, time.Now()) {
+							h.emitStalled(d, s.ProgressPct, stall.Timeout)
+						}
 						if d.config.PublishMetrics {
 							h.logger.Trace("emitStats")
 							h.emitStats(s)
@@ -189,7 +195,8 @@ func (h *taskHandle) NewRunner(d *Driver) (runner DriverHandle, err error) {
 				return nil, errors.Wrap(err, "NewExtractor")
 			}
 		} else {
-			e, err := mysql.NewExtractor(ctx, h.driverConfig, h.logger, d.storeManager, h.waitCh, h.ctx)
+			e, err := mysql.NewExtractor(ctx, h.driverConfig, h.logger, d.storeManager, h.waitCh,
+				d.eventer, h.taskConfig, h.ctx)
 			if err != nil {
 				return nil, errors.Wrap(err, "NewOracleExtractor")
 			}
@@ -235,6 +242,22 @@ func (h *taskHandle) NewRunner(d *Driver) (runner DriverHandle, err error) {
 	return runner, err
 }
 
+// emitStalled sends a non-fatal task event about the stalled progress.
+func (h *taskHandle) emitStalled(d *Driver, progressPct string, timeout time.Duration) {
+	msg := fmt.Sprintf("progress stalled at %v%% for %v", progressPct, timeout)
+	h.logger.Warn(msg)
+	err := d.eventer.EmitEvent(&drivers.TaskEvent{
+		TaskID:    h.taskConfig.ID,
+		TaskName:  h.taskConfig.Name,
+		AllocID:   h.taskConfig.AllocID,
+		Timestamp: time.Now(),
+		Message:   msg,
+	})
+	if err != nil {
+		h.logger.Error("error at sending task event", "err", err, "msg", msg)
+	}
+}
+
 func (h *taskHandle) emitStats(ru *common.TaskStatistics) {
 	const srcFullFactor float32 = 4.5
 	const dstFullFactor float32 = 5
@@ -351,3 +374,14 @@ type DriverHandle interface {
 
 	Finish1() error
 }
+
+// pauser is a DriverHandle keeping its state on being paused.
+type pauser interface {
+	// Pause is Shutdown exporting the state of the task.
+	Pause() error
+}
+
+// schemaCacheDumper is a DriverHandle keeping a cache of table definitions.
+type schemaCacheDumper interface {
+	DumpSchemaCache() map[string]string
+}
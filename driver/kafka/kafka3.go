@@ -51,8 +51,10 @@ type KafkaRunner struct {
 	shutdownLock sync.Mutex
 
 	kafkaConfig *common.KafkaConfig
-	kafkaMgr    *KafkaManager
-	natsAddr    string
+	// MessageCodec of the src task
+	messageCodec string
+	kafkaMgr     *KafkaManager
+	natsAddr     string
 
 	storeManager *common.StoreManager
 
@@ -257,8 +259,14 @@ func (kr *KafkaRunner) Run() {
 		return
 	}
 
-	err = kr.storeManager.DstPutNats(kr.subject, kr.natsAddr, kr.shutdownCh, func(err error) {
-		kr.onError(common.TaskStateDead, errors.Wrap(err, "DstPutNats"))
+	if err := kr.storeManager.PutProtocolInfo(kr.subject, "dest"); err != nil {
+		kr.onError(common.TaskStateDead, errors.Wrap(err, "PutProtocolInfo"))
+		return
+	}
+	err = kr.storeManager.Retry("DstPutNats", kr.shutdownCh, func() error {
+		return kr.storeManager.DstPutNats(kr.subject, kr.natsAddr, kr.shutdownCh, func(err error) {
+			kr.onError(common.TaskStateDead, errors.Wrap(err, "DstPutNats"))
+		})
 	})
 	if err != nil {
 		kr.onError(common.TaskStateDead, errors.Wrap(err, "DstPutNats"))
@@ -270,8 +278,15 @@ func (kr *KafkaRunner) Run() {
 		kr.onError(common.TaskStateDead, errors.Wrap(err, "GetConfig"))
 		return
 	}
+	if taskConfig.ValidateProtocolVersion {
+		if err := kr.storeManager.CheckPeerProtocol(kr.subject, "src"); err != nil {
+			kr.onError(common.TaskStateDead, err)
+			return
+		}
+	}
 
 	kr.kafkaConfig = taskConfig.KafkaConfig
+	kr.messageCodec = taskConfig.MessageCodec
 	kr.logger.Debug("KafkaRunner.Run", "brokers", kr.kafkaConfig.Brokers)
 	kr.kafkaMgr, err = NewKafkaManager(kr.kafkaConfig)
 	if err != nil {
@@ -543,7 +558,7 @@ func (kr *KafkaRunner) initiateStreaming() error {
 		} else {
 			kr.fullWg.Add(1)
 			dumpData := &common.DumpEntry{}
-			err = common.Decode(fullNMM.GetBytes(), dumpData)
+			err = common.DecodeWith(kr.messageCodec, fullNMM.GetBytes(), dumpData)
 			if err != nil {
 				kr.onError(common.TaskStateDead, err)
 				return
@@ -572,7 +587,7 @@ func (kr *KafkaRunner) initiateStreaming() error {
 		kr.logger.Debug("recv a full_complete msg")
 
 		dumpData := &common.DumpStatResult{}
-		if err := common.Decode(m.Data, dumpData); err != nil {
+		if err := common.DecodeWith(kr.messageCodec, m.Data, dumpData); err != nil {
 			kr.onError(common.TaskStateDead, err)
 			return
 		}
@@ -619,7 +634,7 @@ func (kr *KafkaRunner) initiateStreaming() error {
 			kr.logger.Debug("incr. after publish nats reply. intermediate")
 		} else {
 			var binlogEntries common.DataEntries
-			if err := common.Decode(incrNMM.GetBytes(), &binlogEntries); err != nil {
+			if err := common.DecodeWith(kr.messageCodec, incrNMM.GetBytes(), &binlogEntries); err != nil {
 				kr.onError(common.TaskStateDead, err)
 				return
 			}
@@ -917,6 +932,11 @@ func (kr *KafkaRunner) kafkaTransformDMLEventQueries(dmlEntries []*common.DataEn
 					return err
 				}
 
+				if dataEvent.DtleFlags&common.DtleFlagPartialJSON != 0 {
+					return fmt.Errorf("partial JSON updates are not supported by kafka. set binlog_row_value_options='' on the source. %v.%v gno %v",
+						realSchema, dataEvent.TableName, coord.GetGNO())
+				}
+
 				table := tableItem.table
 				colList := table.OriginalTableColumns.ColumnList()
 
@@ -20,7 +20,9 @@ import (
 	"github.com/actiontech/dtle/driver/common"
 	"github.com/actiontech/dtle/driver/mysql/base"
 	"github.com/actiontech/dtle/driver/mysql/sql"
+	sqle "github.com/actiontech/dtle/driver/mysql/sqle/inspector"
 	"github.com/hashicorp/nomad/plugins/drivers"
+	"github.com/pingcap/tidb/parser"
 	"github.com/pkg/errors"
 	uuid "github.com/satori/go.uuid"
 
@@ -28,6 +30,8 @@ import (
 	gonats "github.com/nats-io/go-nats"
 
 	"context"
+	"io"
+	"net"
 	"os"
 
 	umconf "github.com/actiontech/dtle/driver/mysql/mysqlconfig"
@@ -40,6 +44,11 @@ import (
 const (
 	cleanupGtidExecutedLimit = 2048
 	pingInterval             = 10 * time.Second
+	errorRetryInterval       = 200 * time.Millisecond
+	defaultMaxAllowedPacket  = 4 * 1024 * 1024
+	defaultApplyBatchSize    = 1 * 1024 * 1024
+	defaultConnPoolHeadroom  = 10
+	defaultConnMaxIdle       = 2 // the default of database/sql
 	JobIncrCopy              = "job_stage_incr"
 	JobFullCopy              = "job_stage_full"
 )
@@ -52,8 +61,11 @@ type Applier struct {
 	subject      string
 	mysqlContext *common.MySQLDriverConfig
 
-	NatsAddr            string
-	MySQLVersion        string
+	NatsAddr     string
+	MySQLVersion string
+	// FlavorMySQL or FlavorMariaDB
+	targetFlavor        string
+	targetVersion       base.MySQLVersion
 	lowerCaseTableNames umconf.LowerCaseTableNamesValue
 	TotalRowsReplayed   int64
 
@@ -66,7 +78,11 @@ type Applier struct {
 	ai              *ApplierIncr
 
 	natsConn *gonats.Conn
-	waitCh   chan *drivers.ExitResult
+	// subscription of _incr_hete. subscribed again if it is lost on reconnecting.
+	incrSub     *gonats.Subscription
+	incrSubLock sync.Mutex
+	incrNMM     *common.NatsMsgMerger
+	waitCh      chan *drivers.ExitResult
 	// we need to close all data channel while pausing task runner. and these data channel will be recreate when restart the runner.
 	// to avoid writing closed channel, we need to wait for all goroutines that deal with data channels finishing. wg is used for the waiting.
 	wg sync.WaitGroup
@@ -78,6 +94,8 @@ type Applier struct {
 	cancelFunc   context.CancelFunc
 
 	nDumpEntry int64
+	// set when the target gtid is met. see stopAtTargetGtid.
+	stoppingAtTarget int32
 
 	stubFullApplyDelay time.Duration
 
@@ -85,10 +103,24 @@ type Applier struct {
 	gtidCh       chan common.CoordinatesI
 
 	stage      string
+	stageLock  sync.Mutex // guards transitions of mysqlContext.Stage
 	memory1    *int64
 	memory2    *int64
 	event      *eventer.Eventer
 	taskConfig *drivers.TaskConfig
+	// number of nats handlers waiting for MaxBufferedBytes
+	nBackpressure int32
+	// nil if the target is not monitored
+	targetPressure *targetPressure
+	// nil without VerifyChunkChecksum
+	dataParity *dataParity
+	// number of full copy batches split on lock wait timeouts
+	lockTimeoutSplits int64
+	// @@innodb_rollback_on_timeout of the target. a lock wait timeout rolls back the whole tx if true.
+	rollbackOnTimeout bool
+	// rows committed by full copy, keyed by "schema.table". nil until the first entry.
+	tableRows     map[string]int64
+	tableRowsLock sync.Mutex
 
 	gtidSet      *gomysql.MysqlGTIDSet
 	gtidSetLock  *sync.RWMutex
@@ -96,6 +128,58 @@ type Applier struct {
 	stateDir     string
 	revExtractor *Extractor
 	fwdExtractor *Extractor
+
+	// limits of the target. checked before creating tables.
+	tableLimits base.TableLimits
+
+	// "schema.table" => columns to be clamped on full copy
+	numericClamps map[string][]base.NumericAttrMismatch
+	// tables written in full copy
+	copiedTables map[common.SchemaTable]struct{}
+	// set once ImportState has run. the state is only exported after it, not to overwrite an unread one.
+	stateImported bool
+	// set by Pause
+	exportStateOnShutdown bool
+
+	rowValidators  map[common.SchemaTable]*rowValidator
+	deadLetterSink DeadLetterSink
+	// nil to write incremental rows to the target
+	changeSink ChangeSink
+
+	// the statement of system variables applied in full copy
+	appliedSystemVariables string
+	// sets explicit_defaults_for_timestamp of the source on sessions of the target, if they differ.
+	// Empty if they are the same or the target does not allow it.
+	explicitDefaultsStatement string
+	// options of transactions applying data. nil for the server default.
+	txOptions *gosql.TxOptions
+	// @@max_allowed_packet of the target
+	maxAllowedPacket int64
+	// max bytes of an insert statement in full copy
+	applyBatchSize int64
+	// nil for unlimited
+	ddlLimiter *ddlLimiter
+	// nil if no column is to be encrypted
+	columnEncryptor *columnEncryptor
+	// "schema.table" => target columns to insert into on full copy, if it differs from all columns
+	// of the target (e.g. the generated invisible primary key is excluded).
+	insertColumns map[string][]string
+	// "schema.table" => target columns with an SRID constraint, by positions of values on full copy
+	sridColumns map[string]map[int]*umconf.Column
+	// "schema.table" to filters of ApplyRowFilters
+	rowFilters map[string]*rowFilter
+	// "schema.table" => indexes of values to be encrypted on full copy
+	encryptIndexes map[string][]int
+	// nil if no column has a configured character set
+	columnCharsets columnCharsets
+	// "schema.table" => character sets by indexes of values to be converted on full copy
+	charsetIndexes map[string]map[int]string
+	// "schema.table" to checks of OnEncodingError on full copy
+	encodingChecks map[string]*encodingCheck
+	// "schema.table" => indexes of values of the unique key, for DetectDuplicateKeys
+	uniqueKeyIndexes map[string][]int
+	// full copy statements are written here instead of being executed. nil for OutputMode exec.
+	outputFile io.WriteCloser
 }
 
 func (a *Applier) Finish1() error {
@@ -115,8 +199,8 @@ func NewApplier(
 		mysqlContext:    cfg,
 		NatsAddr:        natsAddr,
 		rowCopyComplete: make(chan struct{}),
-		fullBytesQueue:  make(chan []byte, 16),
-		dumpEntryQueue:  make(chan *common.DumpEntry, 8),
+		fullBytesQueue:  make(chan []byte, cfg.FullBytesQueueSize),
+		dumpEntryQueue:  make(chan *common.DumpEntry, cfg.DumpEntryQueueSize),
 		waitCh:          waitCh,
 		gtidSetLock:     &sync.RWMutex{},
 		shutdownCh:      make(chan struct{}),
@@ -128,6 +212,10 @@ func NewApplier(
 		taskConfig:      taskConfig,
 	}
 
+	if cfg.DestConnectionConfig != nil {
+		cfg.DestConnectionConfig.InitAuthProvider()
+	}
+
 	a.ctx, a.cancelFunc = context.WithCancel(ctx)
 
 	stubFullApplyDelayStr := os.Getenv(g.ENV_FULL_APPLY_DELAY)
@@ -144,6 +232,9 @@ func NewApplier(
 	return a, nil
 }
 
+// minimal interval of uploading gtid on flags in gtidCh
+const gtidFlushInterval = 1 * time.Second
+
 func (a *Applier) updateGtidLoop() {
 	a.wg.Add(1)
 	defer a.wg.Done()
@@ -187,20 +278,18 @@ func (a *Applier) updateGtidLoop() {
 			}
 
 			if a.mysqlContext.Gtid != "" {
-				if a.stage != JobIncrCopy {
-					a.stage = JobIncrCopy
-					err := a.storeManager.PutJobStage(a.subject, JobIncrCopy)
-					if err != nil {
-						a.onError(common.TaskStateDead, errors.Wrap(err, "PutJobStage"))
-						return
-					}
-					a.sendEvent(JobIncrCopy)
+				if err := a.setJobStage(JobIncrCopy); err != nil {
+					a.onError(common.TaskStateDead, errors.Wrap(err, "PutJobStage"))
+					return
 				}
 			}
 		}
 	}
 
 	testTargetGtid := func() {
+		if atomic.LoadInt32(&a.stoppingAtTarget) != 0 {
+			return
+		}
 		if a.gtidSet.Contain(a.targetGtid) {
 			a.logger.Info("meet target gtid , update job status", "gtidSet", a.targetGtid.String())
 			jobInfo, err := a.storeManager.GetJobInfo(a.subject)
@@ -212,7 +301,41 @@ func (a *Applier) updateGtidLoop() {
 			if err != nil {
 				a.onError(common.TaskStateDead, errors.Wrap(err, "SaveJobInfo"))
 			}
-			_ = a.Shutdown()
+			a.stopAtTargetGtid()
+		}
+	}
+
+	// returns true if coord is the flag to update/upload gtid
+	handleCoord := func(coord common.CoordinatesI) bool {
+		needUpdate = true
+		needUpload = true
+		if coord == nil {
+			return true
+		}
+		a.gtidSetLock.Lock()
+		common.UpdateGtidSet(a.gtidSet, coord.GetSid().(uuid.UUID), coord.GetGNO())
+		if a.targetGtid != nil {
+			testTargetGtid()
+		}
+		a.gtidSetLock.Unlock()
+		file = coord.GetLogFile()
+		pos = coord.GetLogPos()
+		return false
+	}
+
+	// Flags are coalesced: gtid is uploaded at most once per gtidFlushInterval.
+	// A pending flag is handled on the next tUpdate, so the latest gtid is always uploaded.
+	var lastFlush time.Time
+	pendingFlush := false
+	doFlush := func() {
+		pendingFlush = false
+		lastFlush = time.Now()
+		doUpdate()
+		doUpload()
+		if a.targetGtid != nil {
+			a.gtidSetLock.RLock()
+			testTargetGtid()
+			a.gtidSetLock.RUnlock()
 		}
 	}
 
@@ -224,28 +347,29 @@ func (a *Applier) updateGtidLoop() {
 			doUpdate()
 			doUpload()
 		case <-tUpdate.C:
-			doUpdate()
-		case coord := <-a.gtidCh:
-			needUpdate = true
-			needUpload = true
-			if coord == nil {
-				// coord == nil is a flag for update/upload gtid
+			if pendingFlush {
+				doFlush()
+			} else {
 				doUpdate()
-				doUpload()
-				if a.targetGtid != nil {
-					a.gtidSetLock.RLock()
-					testTargetGtid()
-					a.gtidSetLock.RUnlock()
+			}
+		case coord := <-a.gtidCh:
+			flag := handleCoord(coord)
+			// drain queued coordinates at once. bounded to check shutdownCh in time.
+		drain:
+			for i := 0; i < cap(a.gtidCh); i++ {
+				select {
+				case coord := <-a.gtidCh:
+					flag = handleCoord(coord) || flag
+				default:
+					break drain
 				}
-			} else {
-				a.gtidSetLock.Lock()
-				common.UpdateGtidSet(a.gtidSet, coord.GetSid().(uuid.UUID), coord.GetGNO())
-				if a.targetGtid != nil {
-					testTargetGtid()
+			}
+			if flag {
+				if time.Since(lastFlush) >= gtidFlushInterval {
+					doFlush()
+				} else {
+					pendingFlush = true
 				}
-				a.gtidSetLock.Unlock()
-				file = coord.GetLogFile()
-				pos = coord.GetLogPos()
 			}
 		}
 	}
@@ -284,8 +408,19 @@ func (a *Applier) Run() {
 		a.onError(common.TaskStateDead, err)
 		return
 	}
-	err = a.storeManager.DstPutNats(a.subject, a.NatsAddr, a.shutdownCh, func(err error) {
-		a.onError(common.TaskStateDead, errors.Wrap(err, "DstPutNats"))
+	if err := a.storeManager.PutProtocolInfo(a.subject, "dest"); err != nil {
+		a.onError(common.TaskStateDead, errors.Wrap(err, "PutProtocolInfo"))
+		return
+	}
+	// the src task reads the positions after DstPutNats
+	if _, err := a.ImportState(); err != nil {
+		a.onError(common.TaskStateDead, err)
+		return
+	}
+	err = a.storeManager.Retry("DstPutNats", a.shutdownCh, func() error {
+		return a.storeManager.DstPutNats(a.subject, a.NatsAddr, a.shutdownCh, func(err error) {
+			a.onError(common.TaskStateDead, errors.Wrap(err, "DstPutNats"))
+		})
 	})
 	if err != nil {
 		a.onError(common.TaskStateDead, errors.Wrap(err, "DstPutNats"))
@@ -297,6 +432,13 @@ func (a *Applier) Run() {
 		a.onError(common.TaskStateDead, errors.Wrap(err, "GetConfig"))
 		return
 	}
+	// the src task has put its ProtocolInfo before asking for NatsAddr
+	if a.mysqlContext.ValidateProtocolVersion {
+		if err := a.storeManager.CheckPeerProtocol(a.subject, "src"); err != nil {
+			a.onError(common.TaskStateDead, err)
+			return
+		}
+	}
 
 	if a.mysqlContext.TwoWaySync {
 		execCtx2 := &common.ExecContext{
@@ -317,7 +459,7 @@ func (a *Applier) Run() {
 		cfg2.TwoWaySync = false
 		cfg2.TwoWaySyncGtid = ""
 
-		a.revExtractor, err = NewExtractor(execCtx2, &cfg2, a.logger, a.storeManager, a.waitCh, a.ctx)
+		a.revExtractor, err = NewExtractor(execCtx2, &cfg2, a.logger, a.storeManager, a.waitCh, a.event, a.taskConfig, a.ctx)
 		if err != nil {
 			a.onError(common.TaskStateDead, errors.Wrap(err, "reversed Extractor"))
 			return
@@ -339,6 +481,10 @@ func (a *Applier) Run() {
 		a.onError(common.TaskStateDead, err)
 		return
 	}
+	if err := a.initOutputFile(); err != nil {
+		a.onError(common.TaskStateDead, err)
+		return
+	}
 
 	a.ai, err = NewApplierIncr(a, sourceType)
 	if err != nil {
@@ -376,18 +522,15 @@ func (a *Applier) Run() {
 		}
 	}
 	a.ai.OnError = a.onError
+	a.ai.OnErrorRetry = a.onErrorRetry
+	a.ai.OnStage = a.setStage
 
 	go a.updateDumpProgressLoop()
 	if sourceType == "mysql" {
 		go a.updateGtidLoop()
 	}
-	if a.stage != JobFullCopy {
-		a.stage = JobFullCopy
-		err = a.storeManager.PutJobStage(a.subject, a.stage)
-		if err != nil {
-			a.onError(common.TaskStateDead, err)
-		}
-		a.sendEvent(JobFullCopy)
+	if err := a.setJobStage(JobFullCopy); err != nil {
+		a.onError(common.TaskStateDead, err)
 	}
 
 	go a.doFullCopy()
@@ -403,7 +546,7 @@ func (a *Applier) doFullCopy() {
 	a.wg.Add(1)
 	defer a.wg.Done()
 
-	a.mysqlContext.Stage = common.StageSlaveWaitingForWorkersToProcessQueue
+	a.setStage(common.StageSlaveWaitingForWorkersToProcessQueue)
 	a.logger.Info("Operating until row copy is complete")
 
 	a.wg.Add(1)
@@ -421,9 +564,24 @@ func (a *Applier) doFullCopy() {
 				return
 			case copyRows := <-a.dumpEntryQueue:
 				//time.Sleep(20 * time.Second) // #348 stub
-				if err = a.ApplyEventQueries(a.db, copyRows); err != nil {
+				if !a.targetPressure.wait(a.shutdownCh) {
 					return
 				}
+				err1 := a.applyDumpEntry(a.db, copyRows)
+				if err1 != nil && sql.IsPacketTooLargeError(err1) {
+					// max_allowed_packet of the target might have been changed. check and try again.
+					a.logger.Warn("packet too large. check max_allowed_packet of the target again", "err", err1)
+					if err1 = a.initApplyBatchSize(); err1 == nil {
+						err1 = a.applyDumpEntry(a.db, copyRows)
+					}
+				}
+				if err1 != nil {
+					if !a.onErrorRetry(common.TaskStateDead, err1, func() error {
+						return a.applyDumpEntry(a.db, copyRows)
+					}) {
+						return
+					}
+				}
 				atomic.AddInt64(a.memory1, -int64(copyRows.Size()))
 				if atomic.LoadInt64(&a.nDumpEntry) <= 0 {
 					err = fmt.Errorf("DTLE_BUG a.nDumpEntry <= 0")
@@ -431,7 +589,7 @@ func (a *Applier) doFullCopy() {
 					return
 				} else {
 					atomic.AddInt64(&a.nDumpEntry, -1)
-					a.logger.Debug("ApplyEventQueries. after", "nDumpEntry", a.nDumpEntry)
+					a.logger.Debug("ApplyEventQueries. after", "nDumpEntry", atomic.LoadInt64(&a.nDumpEntry))
 				}
 			}
 		}
@@ -450,7 +608,7 @@ func (a *Applier) doFullCopy() {
 			atomic.AddInt64(a.memory1, -int64(len(bs)))
 
 			copyRows := &common.DumpEntry{}
-			err := common.Decode(bs, copyRows) // TODO decode once for discarded-resent msg
+			err := common.DecodeWith(a.mysqlContext.MessageCodec, bs, copyRows) // TODO decode once for discarded-resent msg
 			if err != nil {
 				a.onError(common.TaskStateDead, errors.Wrap(err, "DecodeDumpEntry"))
 				return
@@ -474,8 +632,59 @@ func (a *Applier) doFullCopy() {
 	}
 }
 
+// waitFullApplyMemory blocks while queued full copy data exceeds FullApplyMemoryLimit.
+// Returns false if the applier is shutdown.
+func (a *Applier) waitFullApplyMemory() bool {
+	limit := a.mysqlContext.FullApplyMemoryLimit
+	if limit <= 0 {
+		return true
+	}
+	t := time.NewTicker(100 * time.Millisecond)
+	defer t.Stop()
+	for atomic.LoadInt64(a.memory1) >= limit {
+		a.logger.Debug("full apply memory limit reached. waiting", "memory", atomic.LoadInt64(a.memory1))
+		select {
+		case <-a.shutdownCh:
+			return false
+		case <-t.C:
+		}
+	}
+	return true
+}
+
+// waitBufferedBytes blocks while queued full and incr data exceeds MaxBufferedBytes,
+// delaying the reply so that the source stops sending. Returns false if the applier is shutdown.
+func (a *Applier) waitBufferedBytes() bool {
+	limit := a.mysqlContext.MaxBufferedBytes
+	bufferedBytes := func() int64 {
+		return atomic.LoadInt64(a.memory1) + atomic.LoadInt64(a.memory2)
+	}
+	if limit <= 0 || bufferedBytes() < limit {
+		return true
+	}
+
+	atomic.AddInt32(&a.nBackpressure, 1)
+	defer atomic.AddInt32(&a.nBackpressure, -1)
+	a.logger.Info("MaxBufferedBytes reached. pausing acks", "buffered", bufferedBytes(), "limit", limit)
+	t := time.NewTicker(100 * time.Millisecond)
+	defer t.Stop()
+	for bufferedBytes() >= limit {
+		select {
+		case <-a.shutdownCh:
+			return false
+		case <-t.C:
+		}
+	}
+	a.logger.Info("buffered data drained. resuming acks", "buffered", bufferedBytes())
+	return true
+}
+
 func (a *Applier) initNatSubClient() (err error) {
-	sc, err := gonats.Connect(a.NatsAddr)
+	var sc *gonats.Conn
+	err = a.retryNats("connect", func() (err error) {
+		sc, err = gonats.Connect(a.NatsAddr, a.natsOptions()...)
+		return err
+	})
 	if err != nil {
 		a.logger.Error("cannot connect to nats server", "natsAddr", a.NatsAddr, "err", err)
 		return err
@@ -485,7 +694,108 @@ func (a *Applier) initNatSubClient() (err error) {
 	return nil
 }
 
+// natsOptions returns options to reconnect to the nats server after a transient outage.
+func (a *Applier) natsOptions() []gonats.Option {
+	maxReconnects := a.mysqlContext.NatsMaxReconnects
+	if maxReconnects == 0 {
+		maxReconnects = gonats.DefaultMaxReconnect
+	}
+	reconnectWait := time.Duration(a.mysqlContext.NatsReconnectWaitMs) * time.Millisecond
+	if reconnectWait <= 0 {
+		reconnectWait = gonats.DefaultReconnectWait
+	}
+	return []gonats.Option{
+		gonats.MaxReconnects(maxReconnects),
+		gonats.ReconnectWait(reconnectWait),
+		gonats.DisconnectHandler(func(nc *gonats.Conn) {
+			a.logger.Warn("disconnected from nats server", "err", nc.LastError())
+		}),
+		gonats.ReconnectHandler(a.onNatsReconnect),
+		gonats.ClosedHandler(func(nc *gonats.Conn) {
+			a.shutdownLock.Lock()
+			shutdown := a.shutdown
+			a.shutdownLock.Unlock()
+			if !shutdown {
+				// reconnecting is exhausted
+				a.onError(common.TaskStateDead, fmt.Errorf("nats connection closed. err: %v", nc.LastError()))
+			}
+		}),
+	}
+}
+
+// natsRetryMaxWait caps the backoff of retryNats.
+const natsRetryMaxWait = 30 * time.Second
+
+// retryNats calls fn, retrying transient errors up to NatsSubscribeRetries times. The wait between
+// attempts starts from NatsSubscribeRetryWaitMs and doubles each time.
+func (a *Applier) retryNats(op string, fn func() error) error {
+	wait := time.Duration(a.mysqlContext.NatsSubscribeRetryWaitMs) * time.Millisecond
+	if wait <= 0 {
+		wait = 500 * time.Millisecond
+	}
+	for i := 0; ; i++ {
+		err := fn()
+		if err == nil || !isTransientNatsError(err) || i >= a.mysqlContext.NatsSubscribeRetries {
+			return err
+		}
+		a.logger.Warn("nats operation failed. retrying", "op", op, "err", err, "retry", i+1, "wait", wait)
+		select {
+		case <-a.shutdownCh:
+			return err
+		case <-time.After(wait):
+		}
+		wait *= 2
+		if wait > natsRetryMaxWait {
+			wait = natsRetryMaxWait
+		}
+	}
+}
+
+// subscribeWithRetry subscribes the subject with retryNats.
+func (a *Applier) subscribeWithRetry(subject string, cb gonats.MsgHandler) (sub *gonats.Subscription, err error) {
+	err = a.retryNats("subscribe "+subject, func() (err error) {
+		sub, err = a.natsConn.Subscribe(subject, cb)
+		return err
+	})
+	return sub, err
+}
+
+// isTransientNatsError returns true if the error might go away by retrying, e.g. the server is
+// not ready yet. Errors of the arguments (e.g. a bad subject) or the state of the connection
+// (e.g. closed) are not.
+func isTransientNatsError(err error) bool {
+	switch errors.Cause(err) {
+	case gonats.ErrNoServers, gonats.ErrTimeout, gonats.ErrStaleConnection, io.EOF:
+		return true
+	}
+	_, ok := errors.Cause(err).(net.Error)
+	return ok
+}
+
+// onNatsReconnect subscribes _incr_hete again if the subscription was not kept across reconnecting.
+func (a *Applier) onNatsReconnect(nc *gonats.Conn) {
+	a.logger.Info("reconnected to nats server", "url", nc.ConnectedUrl())
+	a.incrSubLock.Lock()
+	lost := a.incrSub != nil && !a.incrSub.IsValid()
+	a.incrSubLock.Unlock()
+	if !lost {
+		return
+	}
+	a.logger.Warn("incr subscription is lost. subscribing again")
+	if err := a.subscribeIncr(); err != nil {
+		a.onError(common.TaskStateDead, errors.Wrap(err, "subscribeIncr"))
+	}
+}
+
+// SetChangeSink sends incremental rows to the sink instead of the target. Call it before Run.
+func (a *Applier) SetChangeSink(sink ChangeSink) {
+	a.changeSink = sink
+}
+
 func (a *Applier) sendEvent(status string) {
+	if a.event == nil || a.taskConfig == nil {
+		return
+	}
 	err := a.event.EmitEvent(&drivers.TaskEvent{
 		TaskID:      a.taskConfig.ID,
 		TaskName:    a.taskConfig.Name,
@@ -500,13 +810,47 @@ func (a *Applier) sendEvent(status string) {
 	}
 }
 
+// setJobStage sets and saves the stage of the job, JobFullCopy or JobIncrCopy. A task event is sent if it changes.
+func (a *Applier) setJobStage(stage string) error {
+	if a.stage == stage {
+		return nil
+	}
+	a.stage = stage
+	if err := a.storeManager.PutJobStage(a.subject, stage); err != nil {
+		return err
+	}
+	a.sendEvent(stage)
+	return nil
+}
+
+// setStage sets mysqlContext.Stage. A task event is sent if the stage changes.
+func (a *Applier) setStage(stage string) {
+	a.stageLock.Lock()
+	changed := a.mysqlContext.Stage != stage
+	a.mysqlContext.Stage = stage
+	a.stageLock.Unlock()
+	if changed {
+		a.sendEvent(stage)
+	}
+}
+
+// verifyDumpEntryChecksum decodes a full copy msg and checks its rows against the checksum from the source.
+// The entry is returned if it can be decoded.
+func verifyDumpEntryChecksum(codec string, bs []byte) (*common.DumpEntry, error) {
+	entry := &common.DumpEntry{}
+	if err := common.DecodeWith(codec, bs, entry); err != nil {
+		return nil, errors.Wrap(err, "Decode")
+	}
+	return entry, entry.VerifyChecksum()
+}
+
 // initiateStreaming begins treaming of binary log events and registers listeners for such events
 func (a *Applier) subscribeNats() (err error) {
 	a.mysqlContext.MarkRowCopyStartTime()
 	a.logger.Debug("nats subscribe")
 
 	fullNMM := common.NewNatsMsgMerger(a.logger.With("nmm", "full"))
-	_, err = a.natsConn.Subscribe(fmt.Sprintf("%s_full", a.subject), func(m *gonats.Msg) {
+	_, err = a.subscribeWithRetry(fmt.Sprintf("%s_full", a.subject), func(m *gonats.Msg) {
 		a.wg.Add(1)
 		defer a.wg.Done()
 
@@ -534,15 +878,35 @@ func (a *Applier) subscribeNats() (err error) {
 			}
 			a.logger.Debug("full. after publish nats reply")
 		} else {
-			atomic.AddInt64(&a.nDumpEntry, 1) // this must be increased before enqueuing
+			// delay the reply so that the extractor stops sending.
+			if !a.waitFullApplyMemory() || !a.waitBufferedBytes() {
+				return
+			}
 			bs := fullNMM.GetBytes()
+			if a.mysqlContext.VerifyChunkChecksum {
+				entry, err := verifyDumpEntryChecksum(a.mysqlContext.MessageCodec, bs)
+				if err != nil {
+					// ask the source to send the chunk again
+					a.logger.Warn("full. bad chunk", "err", err)
+					if entry != nil {
+						a.dataParity.chunkMismatched(entry.TableSchema, entry.TableName)
+					}
+					fullNMM.Reset()
+					if err := a.natsConn.Publish(m.Reply, []byte(common.FullChunkChecksumMismatch)); err != nil {
+						a.onError(common.TaskStateDead, err)
+					}
+					return
+				}
+				a.dataParity.chunkVerified(entry.TableSchema, entry.TableName, int64(len(entry.ValuesX)))
+			}
+			atomic.AddInt64(&a.nDumpEntry, 1) // this must be increased before enqueuing
 			select {
 			case <-a.shutdownCh:
 				return
 			case a.fullBytesQueue <- bs:
 				atomic.AddInt64(a.memory1, int64(len(bs)))
-				a.logger.Debug("full. enqueue", "nDumpEntry", a.nDumpEntry)
-				a.mysqlContext.Stage = common.StageSlaveWaitingForWorkersToProcessQueue
+				a.logger.Debug("full. enqueue", "nDumpEntry", atomic.LoadInt64(&a.nDumpEntry))
+				a.setStage(common.StageSlaveWaitingForWorkersToProcessQueue)
 				fullNMM.Reset()
 
 				vacancy := cap(a.fullBytesQueue) - len(a.fullBytesQueue)
@@ -556,11 +920,11 @@ func (a *Applier) subscribeNats() (err error) {
 		}
 	})
 
-	_, err = a.natsConn.Subscribe(fmt.Sprintf("%s_full_complete", a.subject), func(m *gonats.Msg) {
+	_, err = a.subscribeWithRetry(fmt.Sprintf("%s_full_complete", a.subject), func(m *gonats.Msg) {
 		a.logger.Debug("recv _full_complete.")
 
 		dumpData := &common.DumpStatResult{}
-		if err := common.Decode(m.Data, dumpData); err != nil {
+		if err := common.DecodeWith(a.mysqlContext.MessageCodec, m.Data, dumpData); err != nil {
 			a.onError(common.TaskStateDead, errors.Wrap(err, "Decode"))
 			return
 		}
@@ -576,7 +940,7 @@ func (a *Applier) subscribeNats() (err error) {
 		}
 
 		for atomic.LoadInt64(&a.nDumpEntry) != 0 {
-			a.logger.Debug("nDumpEntry is not zero, waiting", "nDumpEntry", a.nDumpEntry)
+			a.logger.Debug("nDumpEntry is not zero, waiting", "nDumpEntry", atomic.LoadInt64(&a.nDumpEntry))
 			time.Sleep(1 * time.Second)
 			if a.shutdown {
 				return
@@ -592,7 +956,16 @@ func (a *Applier) subscribeNats() (err error) {
 				a.onError(common.TaskStateDead, errors.Wrap(err, "SaveOracleSCNPos"))
 			}
 		} else {
-			if a.mysqlContext.ForeignKeyChecks {
+			if a.mysqlContext.OrphanRowsPolicy != "" {
+				err = a.checkOrphanRows()
+				if err != nil {
+					a.onError(common.TaskStateDead, errors.Wrap(err, "checkOrphanRows"))
+					return
+				}
+			}
+			if a.mysqlContext.KeepForeignKeyChecks {
+				// never disabled
+			} else if a.mysqlContext.ForeignKeyChecks {
 				err = a.enableForeignKeyChecks()
 				if err != nil {
 					a.onError(common.TaskStateDead, errors.Wrap(err, "enableForeignKeyChecks"))
@@ -603,6 +976,10 @@ func (a *Applier) subscribeNats() (err error) {
 			}
 
 			a.logger.Info("got gtid from extractor", "gtid", dumpData.Coord.GetTxSet())
+			if err := a.checkGtidConflicts("full copy gtid", a.gtidSet, dumpData.Coord.GetTxSet()); err != nil {
+				a.onError(common.TaskStateDead, err)
+				return
+			}
 			// Do not re-assign a.gtidSet (#538). Update it.
 			gs0, err := gomysql.ParseMysqlGTIDSet(dumpData.Coord.GetTxSet())
 			if err != nil {
@@ -619,7 +996,7 @@ func (a *Applier) subscribeNats() (err error) {
 			a.gtidCh <- nil // coord == nil is a flag for update/upload gtid
 		}
 
-		a.mysqlContext.Stage = common.StageSlaveWaitingForWorkersToProcessQueue
+		a.setStage(common.StageSlaveWaitingForWorkersToProcessQueue)
 		close(a.rowCopyComplete)
 
 		a.logger.Debug("ack _full_complete")
@@ -632,8 +1009,15 @@ func (a *Applier) subscribeNats() (err error) {
 		return err
 	}
 
-	incrNMM := common.NewNatsMsgMerger(a.logger.With("nmm", "incr"))
-	_, err = a.natsConn.Subscribe(fmt.Sprintf("%s_incr_hete", a.subject), func(m *gonats.Msg) {
+	a.incrNMM = common.NewNatsMsgMerger(a.logger.With("nmm", "incr"))
+	return a.subscribeIncr()
+}
+
+// subscribeIncr subscribes _incr_hete. a.incrNMM is kept across subscriptions, so that a big msg
+// interrupted by reconnecting can be continued.
+func (a *Applier) subscribeIncr() error {
+	incrNMM := a.incrNMM
+	sub, err := a.subscribeWithRetry(fmt.Sprintf("%s_incr_hete", a.subject), func(m *gonats.Msg) {
 		a.logger.Debug("incr. recv a msg.")
 
 		segmentFinished, err := incrNMM.Handle(m.Data)
@@ -650,28 +1034,32 @@ func (a *Applier) subscribeNats() (err error) {
 			a.logger.Debug("incr. after publish nats reply.")
 		} else {
 			bs := incrNMM.GetBytes()
-			select {
-			case <-a.shutdownCh:
+			if !a.ai.enqueueIncrBytes(bs) {
 				return
-			case a.ai.incrBytesQueue <- bs:
-				atomic.AddInt64(a.memory2, int64(len(bs)))
-				incrNMM.Reset()
-
-				a.logger.Debug("incr. incrBytesQueue enqueued", "vacancy", cap(a.ai.incrBytesQueue)-len(a.ai.incrBytesQueue))
+			}
+			atomic.AddInt64(a.memory2, int64(len(bs)))
+			incrNMM.Reset()
 
-				if err := a.natsConn.Publish(m.Reply, nil); err != nil {
-					a.onError(common.TaskStateDead, err)
-					return
-				}
-				a.logger.Debug("incr. after publish nats reply.")
+			a.logger.Debug("incr. incrBytesQueue enqueued", "vacancy", cap(a.ai.incrBytesQueue)-len(a.ai.incrBytesQueue))
 
-				a.mysqlContext.Stage = common.StageWaitingForMasterToSendEvent
+			if !a.waitBufferedBytes() {
+				return
+			}
+			if err := a.natsConn.Publish(m.Reply, nil); err != nil {
+				a.onError(common.TaskStateDead, err)
+				return
 			}
+			a.logger.Debug("incr. after publish nats reply.")
+
+			a.setStage(common.StageWaitingForMasterToSendEvent)
 		}
 	})
 	if err != nil {
 		return err
 	}
+	a.incrSubLock.Lock()
+	a.incrSub = sub
+	a.incrSubLock.Unlock()
 
 	return nil
 }
@@ -704,8 +1092,7 @@ func (a *Applier) publishProgress() {
 }
 
 func (a *Applier) InitDB() (err error) {
-	applierUri := a.mysqlContext.DestConnectionConfig.GetDBUri()
-	if a.db, err = sql.CreateDB(applierUri); err != nil {
+	if a.db, err = sql.CreateDBWithConfig(a.mysqlContext.DestConnectionConfig, ""); err != nil {
 		return err
 	}
 	return nil
@@ -715,10 +1102,7 @@ func (a *Applier) initDBConnections() (err error) {
 	if err := a.InitDB(); nil != err {
 		return err
 	}
-	a.db.SetMaxOpenConns(10 + a.mysqlContext.ParallelWorkers)
-	a.logger.Debug("CreateConns", "ParallelWorkers", a.mysqlContext.ParallelWorkers)
-	if a.dbs, err = sql.CreateConns(a.ctx, a.db, a.mysqlContext.ParallelWorkers); err != nil {
-		a.logger.Debug("beging connetion mysql 2 create conns err")
+	if err := a.negotiateConnCharset(); err != nil {
 		return err
 	}
 
@@ -731,9 +1115,69 @@ func (a *Applier) initDBConnections() (err error) {
 
 	a.MySQLVersion = someSysVars.Version
 	a.lowerCaseTableNames = someSysVars.LowerCaseTableNames
+	if err := a.initTargetFlavor(); err != nil {
+		return err
+	}
+
+	pool := getConnPool(&a.mysqlContext.DtleTaskConfig, a.targetVersion)
+	if pool.workers != a.mysqlContext.ParallelWorkers {
+		a.logger.Warn("the target cannot apply transactions in parallel. using 1 worker",
+			"ParallelWorkers", a.mysqlContext.ParallelWorkers, "version", a.MySQLVersion)
+		a.mysqlContext.ParallelWorkers = pool.workers
+	}
+	a.db.SetMaxOpenConns(pool.maxOpen)
+	a.db.SetMaxIdleConns(pool.maxIdle)
+	a.db.SetConnMaxLifetime(pool.maxLifetime)
+	a.logger.Debug("CreateConns", "ParallelWorkers", a.mysqlContext.ParallelWorkers, "maxOpen", pool.maxOpen,
+		"maxIdle", pool.maxIdle, "maxLifetime", pool.maxLifetime)
+	if a.dbs, err = sql.CreateConns(a.ctx, a.db, a.mysqlContext.ParallelWorkers,
+		a.mysqlContext.KeepForeignKeyChecks); err != nil {
+		a.logger.Debug("beging connetion mysql 2 create conns err")
+		return err
+	}
+	if err := a.db.QueryRow("select @@innodb_page_size").Scan(&a.tableLimits.InnodbPageSize); err != nil {
+		a.logger.Warn("cannot get innodb_page_size. skip checking row size against it", "err", err)
+	}
+
+	if err := a.db.QueryRow("select @@innodb_rollback_on_timeout").Scan(&a.rollbackOnTimeout); err != nil {
+		a.logger.Warn("cannot get innodb_rollback_on_timeout. assume ON", "err", err)
+		a.rollbackOnTimeout = true
+	}
+
+	if err := a.initApplyBatchSize(); err != nil {
+		return err
+	}
 
-	if strings.HasPrefix(a.MySQLVersion, "5.6") {
-		a.mysqlContext.ParallelWorkers = 1
+	if err := a.initTxOptions(); err != nil {
+		return err
+	}
+	a.ddlLimiter = getDDLLimiter(a.mysqlContext.DestConnectionConfig.GetAddr(), a.mysqlContext.MaxConcurrentDDL)
+	a.columnEncryptor, err = newColumnEncryptor(a.mysqlContext.ColumnEncryptionKey, a.mysqlContext.EncryptColumns)
+	if err != nil {
+		return err
+	}
+	a.columnCharsets, err = newColumnCharsets(a.mysqlContext.ColumnCharsets)
+	if err != nil {
+		return err
+	}
+	if err := validateOnEncodingError(a.mysqlContext.OnEncodingError); err != nil {
+		return err
+	}
+	if err := validateFullCopyConflictMode(a.mysqlContext.FullCopyConflictMode); err != nil {
+		return err
+	}
+	if err := validateLoadDataInsert(a.mysqlContext); err != nil {
+		return err
+	}
+	if err := checkSqlCommentPrefix(a.mysqlContext.SqlCommentPrefix); err != nil {
+		return err
+	}
+	if a.mysqlContext.VerifyChunkChecksum {
+		a.dataParity = newDataParity()
+	}
+	a.targetPressure = newTargetPressure(a.logger, a.mysqlContext, getTargetThreads(a.db))
+	if a.targetPressure != nil {
+		go a.targetPressure.run(a.shutdownCh)
 	}
 
 	a.logger.Debug("beging connetion mysql 5 validate  grants")
@@ -743,11 +1187,215 @@ func (a *Applier) initDBConnections() (err error) {
 	}
 	a.logger.Debug("after ValidateGrants")
 
+	if err := a.checkTargetDatabases(); err != nil {
+		return err
+	}
+
 	a.logger.Info("Initiated", "mysql", a.mysqlContext.DestConnectionConfig.GetAddr(), "version", a.MySQLVersion)
 
 	return nil
 }
 
+// targetDatabases returns names of the target databases in ReplicateDoDb. Regex schemas are not included.
+func (a *Applier) targetDatabases() (r []string) {
+	seen := make(map[string]bool)
+	for _, doDb := range a.mysqlContext.ReplicateDoDb {
+		if doDb.TableSchema == "" || doDb.TableSchemaRegex != "" {
+			continue
+		}
+		name := g.StringElse(doDb.TableSchemaRename, doDb.TableSchema)
+		if newName, ok := a.mysqlContext.SchemaRenameMap[name]; ok {
+			name = newName
+		}
+		if !seen[name] {
+			seen[name] = true
+			r = append(r, name)
+		}
+	}
+	return r
+}
+
+// checkTargetDatabases checks the target databases exist, and creates missing ones if AutoCreateDatabase
+// is set. Otherwise a missing database is left to full copy, and fails the job if full copy will not
+// create it.
+func (a *Applier) checkTargetDatabases() error {
+	if a.mysqlContext.OutputMode == common.OutputModeFile {
+		// databases are to be created when the file is applied
+		return nil
+	}
+	fullCopyCreates := a.mysqlContext.Gtid == "" && a.mysqlContext.BinlogFile == "" &&
+		!a.mysqlContext.AutoGtid && a.mysqlContext.GtidStart == "" && !a.mysqlContext.SkipCreateDbTable
+
+	for _, name := range a.targetDatabases() {
+		exists, err := base.SchemaExists(a.db, name)
+		if err != nil {
+			return errors.Wrapf(err, "SchemaExists %v", name)
+		}
+		if exists {
+			continue
+		}
+		switch {
+		case a.mysqlContext.AutoCreateDatabase:
+			query := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", umconf.EscapeName(name))
+			if _, err := a.db.ExecContext(a.ctx, query); err != nil {
+				return fmt.Errorf("target database %v does not exist and cannot be created. check the"+
+					" CREATE privilege of the user: %v", name, err)
+			}
+			a.logger.Info("created the target database", "database", name)
+		case fullCopyCreates:
+			a.logger.Warn("target database does not exist. it will be created by full copy", "database", name)
+		default:
+			return fmt.Errorf("target database %v does not exist. create it or set AutoCreateDatabase", name)
+		}
+	}
+	return nil
+}
+
+// negotiateConnCharset widens the connection charset to keep all characters of the source and
+// the target (see mysqlconfig.NegotiateCharset), reconnecting if it is changed, and validates it.
+func (a *Applier) negotiateConnCharset() error {
+	connConfig := a.mysqlContext.DestConnectionConfig
+	var targetCharset string
+	if err := a.db.QueryRow("select @@character_set_server").Scan(&targetCharset); err != nil {
+		return errors.Wrap(err, "select @@character_set_server")
+	}
+	sourceCharset := ""
+	if a.mysqlContext.SrcConnectionConfig != nil {
+		sourceCharset = a.mysqlContext.SrcConnectionConfig.Charset
+	}
+
+	charset := umconf.NegotiateCharset(connConfig.Charset, sourceCharset, targetCharset)
+	if umconf.NormalizeCharset(charset) != umconf.NormalizeCharset(connConfig.Charset) {
+		a.logger.Info("widen the connection charset", "from", connConfig.Charset, "to", charset,
+			"source", sourceCharset, "target", targetCharset)
+		connConfig.Charset = charset
+		a.db.Close()
+		if err := a.InitDB(); err != nil {
+			return err
+		}
+	}
+	return checkConnCharset(a.db, charset)
+}
+
+// checkConnCharset returns an error if the connection charset is not the expected one.
+func checkConnCharset(db *gosql.DB, charset string) error {
+	var connCharset string
+	if err := db.QueryRow("select @@character_set_connection").Scan(&connCharset); err != nil {
+		return errors.Wrap(err, "select @@character_set_connection")
+	}
+	if umconf.NormalizeCharset(connCharset) != umconf.NormalizeCharset(charset) {
+		return fmt.Errorf("the connection charset is %v, expect %v", connCharset, charset)
+	}
+	return nil
+}
+
+// initTargetFlavor parses the version, detecting MySQL or MariaDB, and sets up flavor-specific handling.
+// connPool is the sizing of the connection pool to the target.
+type connPool struct {
+	workers     int
+	maxOpen     int
+	maxIdle     int
+	maxLifetime time.Duration
+}
+
+// getConnPool returns the pool for ParallelWorkers on the target. Each worker holds a connection.
+// ApplierConnPoolHeadroom connections are left for full copy and queries of metadata.
+func getConnPool(cfg *common.DtleTaskConfig, targetVersion base.MySQLVersion) connPool {
+	p := connPool{workers: cfg.ParallelWorkers}
+	if targetVersion.ForceSingleWorker() {
+		p.workers = 1
+	}
+	headroom := cfg.ApplierConnPoolHeadroom
+	if headroom <= 0 {
+		headroom = defaultConnPoolHeadroom
+	}
+	p.maxOpen = p.workers + headroom
+	p.maxIdle = cfg.ApplierConnMaxIdle
+	if p.maxIdle <= 0 {
+		p.maxIdle = defaultConnMaxIdle
+	}
+	if p.maxIdle > p.maxOpen {
+		p.maxIdle = p.maxOpen
+	}
+	p.maxLifetime = time.Duration(cfg.ApplierConnMaxLifetimeMs) * time.Millisecond
+	if p.maxLifetime <= 0 {
+		p.maxLifetime = sql.ConnMaxLifetime
+	}
+	return p
+}
+
+func (a *Applier) initTargetFlavor() (err error) {
+	if a.targetVersion, err = base.ParseMySQLVersion(a.MySQLVersion); err != nil {
+		return err
+	}
+	a.targetFlavor = a.targetVersion.Flavor
+	a.logger.Info("target flavor", "flavor", a.targetFlavor, "version", a.MySQLVersion)
+
+	switch a.targetFlavor {
+	case base.FlavorMariaDB:
+		// MariaDB uses gtid_domain_id/gtid_seq_no instead of gtid_next.
+		if a.mysqlContext.SetGtidNext {
+			return fmt.Errorf("SetGtidNext is not supported on MariaDB target %v", a.MySQLVersion)
+		}
+		// MariaDB keeps the InnoDB limits of MySQL 5.7.
+		a.tableLimits = base.GetTableLimits(50700)
+	default:
+		a.tableLimits = base.GetTableLimits(a.targetVersion.Digit())
+	}
+	return nil
+}
+
+// initApplyBatchSize gets max_allowed_packet of the target and checks ApplyBatchSizeBytes against it.
+// A batch is sent after it reaches the size, so the statement might be larger by a row.
+// Half of max_allowed_packet is left for that.
+func (a *Applier) initApplyBatchSize() error {
+	if err := a.db.QueryRow("select @@max_allowed_packet").Scan(&a.maxAllowedPacket); err != nil {
+		a.logger.Warn("cannot get max_allowed_packet. use the default", "err", err,
+			"default", defaultMaxAllowedPacket)
+		a.maxAllowedPacket = defaultMaxAllowedPacket
+	}
+	limit := a.maxAllowedPacket / 2
+
+	a.applyBatchSize = a.mysqlContext.ApplyBatchSizeBytes
+	if a.applyBatchSize <= 0 {
+		a.applyBatchSize = defaultApplyBatchSize
+		if a.applyBatchSize > limit {
+			a.applyBatchSize = limit
+		}
+	} else if a.applyBatchSize > limit {
+		if !a.mysqlContext.ClampApplyBatchSize {
+			return fmt.Errorf("ApplyBatchSizeBytes %v exceeds half of max_allowed_packet %v of the target."+
+				" lower ApplyBatchSizeBytes, raise max_allowed_packet or set ClampApplyBatchSize",
+				a.applyBatchSize, a.maxAllowedPacket)
+		}
+		a.logger.Warn("ApplyBatchSizeBytes exceeds half of max_allowed_packet of the target. clamp it",
+			"ApplyBatchSizeBytes", a.applyBatchSize, "max_allowed_packet", a.maxAllowedPacket, "clamped", limit)
+		a.applyBatchSize = limit
+	}
+	a.logger.Info("apply batch size", "bytes", a.applyBatchSize, "max_allowed_packet", a.maxAllowedPacket)
+	return nil
+}
+
+// initTxOptions parses TxIsolationLevel and checks the target accepts it.
+func (a *Applier) initTxOptions() error {
+	level, err := sql.ParseIsolationLevel(a.mysqlContext.TxIsolationLevel)
+	if err != nil {
+		return err
+	}
+	if level == gosql.LevelDefault {
+		return nil
+	}
+	txOptions := &gosql.TxOptions{Isolation: level}
+	tx, err := a.db.BeginTx(a.ctx, txOptions)
+	if err != nil {
+		return errors.Wrapf(err, "target does not support TxIsolationLevel %v", a.mysqlContext.TxIsolationLevel)
+	}
+	_ = tx.Rollback()
+	a.txOptions = txOptions
+	a.logger.Info("using transaction isolation level", "level", level.String())
+	return nil
+}
+
 // for compatibility
 func (a *Applier) ValidateConnection() error {
 	r := base.GetSomeSysVars(a.db, a.logger)
@@ -757,6 +1405,10 @@ func (a *Applier) ValidateConnection() error {
 	return nil
 }
 
+func (a *Applier) GetTimeSettings() (*base.TimeSettings, error) {
+	return base.GetTimeSettings(a.db)
+}
+
 // ValidateGrants verifies the user by which we're executing has necessary grants
 // to do its thang.
 func (a *Applier) ValidateGrants() error {
@@ -764,39 +1416,12 @@ func (a *Applier) ValidateGrants() error {
 		a.logger.Debug("skipping priv check")
 		return nil
 	}
-	query := `show grants for current_user()`
-	foundAll := false
-	foundSuper := false
-	foundDBAll := false
-	foundReplicationApplier := false
-
-	err := sql.QueryRowsMap(a.db, query, func(rowMap sql.RowMap) error {
-		for _, grantData := range rowMap {
-			grant := grantData.String
-			if strings.Contains(grant, `GRANT ALL PRIVILEGES ON`) {
-				foundAll = true
-			}
-			if strings.Contains(grant, `SUPER`) && strings.Contains(grant, ` ON *.*`) {
-				foundSuper = true
-			}
-			if strings.Contains(grant, fmt.Sprintf("GRANT ALL PRIVILEGES ON `%v`.`%v`",
-				g.DtleSchemaName, g.GtidExecutedTableV4)) {
-				foundDBAll = true
-			}
-			if strings.Contains(grant, "REPLICATION_APPLIER") {
-				foundReplicationApplier = true
-			}
-			if base.StringContainsAll(grant, `ALTER`, `CREATE`, `DELETE`, `DROP`, `INDEX`, `INSERT`, `SELECT`, `TRIGGER`, `UPDATE`, ` ON`) {
-				foundDBAll = true
-			}
-		}
-		return nil
-	})
+	r, err := base.CheckApplierGrants(a.db, a.logger, a.mysqlContext.SetGtidNext)
 	if err != nil {
 		return err
 	}
 
-	if foundAll {
+	if r.Has(base.PrivilegeAll) {
 		a.logger.Info("User has ALL privileges")
 		return nil
 	}
@@ -809,33 +1434,39 @@ func (a *Applier) ValidateGrants() error {
 		}
 	}
 
-	if foundSuper {
-		a.logger.Info("User has SUPER privileges")
+	if r.Sufficient() {
+		a.logger.Info("User has sufficient privileges", "privileges", r.Present)
 		return nil
 	}
-	if a.mysqlContext.SetGtidNext && !foundReplicationApplier {
-		return fmt.Errorf("SetGtidNext = true. REPLICATION_APPLIER (8.0) or SUPER is required")
-	}
-	if foundDBAll {
-		a.logger.Info("User has ALL privileges on *.*")
-		return nil
+	for _, p := range r.Missing {
+		if p == base.PrivilegeReplicationApplier {
+			return fmt.Errorf("SetGtidNext = true. REPLICATION_APPLIER (8.0) or SUPER is required")
+		}
 	}
-	a.logger.Debug("Privileges", "Super", foundSuper, "All", foundAll)
-	return fmt.Errorf("user has insufficient privileges for applier. Needed:ALTER, CREATE, DROP, INDEX, REFERENCES, INSERT, DELETE, UPDATE, SELECT, TRIGGER ON *.*")
+	return fmt.Errorf("user has insufficient privileges for applier. missing: %v."+
+		" Needed:ALTER, CREATE, DROP, INDEX, REFERENCES, INSERT, DELETE, UPDATE, SELECT, TRIGGER ON *.*",
+		strings.Join(r.Missing, ", "))
 }
 
+// ApplyEventQueries applies an entry of full copy in a transaction.
+// Rows are written in the order of the entry, in one or more statements of FullCopyConflictMode
+// executed one by one. If rows share a unique key, the later row wins, except for insert-ignore.
 func (a *Applier) ApplyEventQueries(db *gosql.DB, entry *common.DumpEntry) (err error) {
 	a.logger.Debug("ApplyEventQueries", "schema", entry.TableSchema, "table", entry.TableName,
 		"rows", len(entry.ValuesX))
+	// the entry is applied again on retrying. keep it as received.
+	entry = copyDumpEntry(entry)
 
-	if a.stubFullApplyDelay != 0 {
-		a.logger.Debug("stubFullApplyDelay start sleep")
-		time.Sleep(a.stubFullApplyDelay)
-		a.logger.Debug("stubFullApplyDelay end sleep")
+	if len(a.mysqlContext.SchemaRenameMap) > 0 {
+		err = renameSchemaForDumpEntry(entry, a.mysqlContext.SchemaRenameMap)
+		if err != nil {
+			return errors.Wrap(err, "renameSchemaForDumpEntry")
+		}
 	}
 
 	queries := []string{}
-	if strings.HasPrefix(a.MySQLVersion, "5") {
+	// MariaDB does not have the utf8mb4_0900 collations either.
+	if !a.targetVersion.AtLeast(8, 0, 0) || a.targetFlavor == base.FlavorMariaDB {
 		entry.DbSQL = base.MySQL57CollationReplaceWorkaround(entry.DbSQL)
 		for i := range entry.TbSQL {
 			entry.TbSQL[i] = base.MySQL57CollationReplaceWorkaround(entry.TbSQL[i])
@@ -851,123 +1482,1218 @@ func (a *Applier) ApplyEventQueries(db *gosql.DB, entry *common.DumpEntry) (err
 		}
 	}
 
+	entry.SystemVariables, err = a.matchExplicitDefaultsForTimestamp(entry.SystemVariables)
+	if err != nil {
+		return err
+	}
 	if len(entry.SystemVariables) > 0 {
 		systemVariablesStatement := base.GenerateSetSystemVariables(entry.SystemVariables)
+		if systemVariablesStatement == a.appliedSystemVariables {
+			a.logger.Debug("skip applied sysvar query on a.dbs", "query", systemVariablesStatement)
+		} else {
+			if a.appliedSystemVariables != "" {
+				a.logger.Warn("system variables differ from the previous entry",
+					"previous", a.appliedSystemVariables, "current", systemVariablesStatement)
+			}
+			err = a.applySystemVariables(systemVariablesStatement)
+			if err != nil {
+				return err
+			}
+		}
+		// the tx runs on any connection of a.db. the statement is always in it.
 		queries = append(queries, systemVariablesStatement)
+	}
+	if a.explicitDefaultsStatement != "" {
+		queries = append(queries, a.explicitDefaultsStatement)
+	}
+
+	if entry.SqlMode != "" {
+		for i := range a.dbs {
+			a.logger.Debug("exec sqlmode query", "query", entry.SqlMode)
+			_, err := a.dbs[i].Db.ExecContext(a.ctx, entry.SqlMode)
+			if err != nil {
+				a.logger.Error("err exec sysvar query.", "err", err)
+				return err
+			}
+		}
+	}
+
+	if a.mysqlContext.IdempotentDDL {
+		entry.DbSQL = idempotentDDL(a.logger, entry.DbSQL)
+	}
+	for i := range entry.TbSQL {
+		if a.mysqlContext.IdempotentDDL {
+			entry.TbSQL[i] = idempotentDDL(a.logger, entry.TbSQL[i])
+		}
+		entry.TbSQL[i] = stripTextBlobDefaultsForTarget(a.logger, a.targetVersion, entry.TbSQL[i])
+		err = base.CheckCreateTableLimits(entry.TbSQL[i], a.tableLimits)
+		if err != nil {
+			return err
+		}
+		err = checkGeneratedColumnsForTarget(a.logger, a.targetVersion, entry.TbSQL[i])
+		if err != nil {
+			return err
+		}
+		for _, warning := range base.CheckRowSize(entry.TbSQL[i], a.tableLimits) {
+			a.logger.Warn(warning)
+		}
+	}
+
+	queries = append(queries, entry.SqlMode, entry.DbSQL)
+	queries = append(queries, entry.TbSQL...)
+	// with OutputMode file, statements are written to outputFile instead of being executed. The tx
+	// only reads the target, and is never committed.
+	var output *outputTx
+	if a.outputFile != nil {
+		output = a.newOutputTx()
+	}
+	// stop building batches of a large entry on shutdown or TxTimeoutMs. the tx is rolled back.
+	ctx, cancel := a.txContext()
+	defer cancel()
+	defer func() {
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			err = errors.Wrapf(errTxTimeout, "%v.%v: %v", entry.TableSchema, entry.TableName, err)
+		}
+	}()
+	tx, err := db.BeginTx(ctx, a.txOptions)
+	if err != nil {
+		return err
+	}
+	nRows := int64(len(entry.ValuesX))
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		if output != nil {
+			_ = tx.Rollback()
+			if err = output.commit(a.outputFile); err != nil {
+				return
+			}
+		} else if err = tx.Commit(); err != nil {
+			// the tx is done after a failed Commit. Rollback is only a safeguard.
+			_ = tx.Rollback()
+			err = errors.Wrap(err, "tx.Commit")
+			return
+		}
+		// count rows only when they are committed
+		atomic.AddInt64(&a.TotalRowsReplayed, nRows)
+		if entry.TableName != "" {
+			a.addTableRows(entry.TableSchema, entry.TableName, nRows)
+		}
+	}()
+	if a.stubFullApplyDelay != 0 {
+		a.logger.Debug("stubFullApplyDelay start sleep")
+		select {
+		case <-time.After(a.stubFullApplyDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		a.logger.Debug("stubFullApplyDelay end sleep")
+	}
+	querier := a.newTxQuerier(ctx, tx)
+	if !a.mysqlContext.KeepForeignKeyChecks {
+		if output != nil {
+			output.write(prefixSqlComment(a.mysqlContext.SqlCommentPrefix, querySetFKChecksOff))
+		} else if _, err := tx.ExecContext(ctx, prefixSqlComment(a.mysqlContext.SqlCommentPrefix, querySetFKChecksOff)); err != nil {
+			return err
+		}
+	}
+	execQuery := func(query string) error {
+		if output != nil {
+			output.write(prefixSqlComment(a.mysqlContext.SqlCommentPrefix, query))
+			return nil
+		}
+		a.logger.Debug("ApplyEventQueries. exec", "query", g.StrLim(query, 256))
+		_, err := tx.ExecContext(ctx, prefixSqlComment(a.mysqlContext.SqlCommentPrefix, query))
+		if err != nil {
+			queryStart := g.StrLim(query, 10) // avoid printing sensitive information
+			errCtx := errors.Wrapf(err, "tx.Exec. queryStart %v seq", queryStart)
+			if !sql.IgnoreError(err) {
+				a.logger.Error("ApplyEventQueries. exec error", "err", errCtx)
+				return errCtx
+			}
+			if !sql.IgnoreExistsError(err) {
+				a.logger.Warn("ApplyEventQueries. ignore error", "err", errCtx)
+			}
+		}
+		return nil
+	}
+
+	execQueries := func() error {
+		for _, query := range queries {
+			if query == "" {
+				continue
+			}
+			err := execQuery(query)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if entry.DbSQL != "" || len(entry.TbSQL) > 0 {
+		err = a.ddlLimiter.Do(ctx, execQueries)
+	} else {
+		err = execQueries()
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(entry.Table) > 0 {
+		// first chunk of a table carries the source table definition
+		if a.mysqlContext.TargetEmptyCheck != "" {
+			empty, err := base.IsTableEmpty(querier, entry.TableSchema, entry.TableName, a.mysqlContext.TargetEmptyCheck)
+			if err != nil {
+				return errors.Wrap(err, "IsTableEmpty")
+			}
+			if !empty {
+				return fmt.Errorf("target table %v.%v is not empty", entry.TableSchema, entry.TableName)
+			}
+		}
+		err = a.checkColumnTypes(querier, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	clamps := a.numericClamps[fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)]
+	for _, m := range clamps {
+		for i := range entry.ValuesX {
+			if colData := entry.ValuesX[i][m.Index]; colData != nil {
+				v := m.Clamp(string(*colData))
+				if v != string(*colData) {
+					a.logger.Warn("clamp out of range value", "schema", entry.TableSchema,
+						"table", entry.TableName, "column", m.Column, "value", string(*colData), "to", v)
+					bs := []byte(v)
+					entry.ValuesX[i][m.Index] = &bs
+				}
+			}
+		}
+	}
+
+	if a.mysqlContext.DetectDuplicateKeys {
+		a.warnDuplicateKeys(entry)
+	}
+
+	if a.mysqlContext.ValidateRows && len(entry.ValuesX) > 0 {
+		entry.ValuesX, err = a.filterInvalidRows(querier, entry)
+		if err != nil {
+			return err
+		}
+		nRows = int64(len(entry.ValuesX))
+	}
+
+	if filter := a.rowFilters[fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)]; filter != nil &&
+		len(entry.ValuesX) > 0 {
+		entry.ValuesX, err = filter.filterRowValues(entry.ValuesX)
+		if err != nil {
+			return errors.Wrapf(err, "ApplyRowFilters %v.%v", entry.TableSchema, entry.TableName)
+		}
+		nRows = int64(len(entry.ValuesX))
+	}
+
+	if entry.TableName != "" {
+		if a.copiedTables == nil {
+			a.copiedTables = make(map[common.SchemaTable]struct{})
+		}
+		a.copiedTables[common.SchemaTable{Schema: entry.TableSchema, Table: entry.TableName}] = struct{}{}
+	}
+
+	valuesX, columnTypes := entry.ValuesX, entry.ColumnTypes
+	if charsets := a.charsetIndexes[fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)]; len(charsets) > 0 {
+		valuesX, err = convertRowValues(valuesX, charsets)
+		if err != nil {
+			return errors.Wrapf(err, "table %v.%v", entry.TableSchema, entry.TableName)
+		}
+	}
+	if check := a.encodingChecks[fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)]; check != nil {
+		valuesX, err = check.fixRowValues(valuesX)
+		if err != nil {
+			return err
+		}
+	}
+	if indexes := a.encryptIndexes[fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)]; len(indexes) > 0 {
+		// encrypt a copy. the entry might be applied again on retrying.
+		valuesX = a.columnEncryptor.encryptRowValues(valuesX, indexes)
+		columnTypes = make([]string, len(entry.ColumnTypes), len(entry.ColumnTypes)+len(indexes))
+		copy(columnTypes, entry.ColumnTypes)
+		for _, j := range indexes {
+			for len(columnTypes) <= j {
+				columnTypes = append(columnTypes, "")
+			}
+			columnTypes[j] = "varbinary" // write as a hex literal
+		}
+	}
+
+	if columns := a.sridColumns[fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)]; len(columns) > 0 {
+		if err := checkRowValuesSRID(entry.TableSchema, entry.TableName, valuesX, columns); err != nil {
+			return err
+		}
+	}
+
+	insertColumns := entry.ColumnMapTo
+	if len(insertColumns) == 0 {
+		insertColumns = a.insertColumns[fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)]
+	}
+
+	return a.replaceRowsSplitOnLockTimeout(valuesX, func(rows [][]*[]byte) error {
+		if output != nil {
+			// written as text, which can be read by any client
+			return buildReplaceBatches(ctx, entry.TableSchema, entry.TableName, insertColumns,
+				a.mysqlContext.FullCopyConflictMode, rows, columnTypes, a.batchSizeLimit(), execQuery)
+		}
+		if a.mysqlContext.LoadDataInsert {
+			return a.loadDataRows(ctx, tx, entry.TableSchema, entry.TableName, insertColumns, rows, columnTypes)
+		}
+		if a.mysqlContext.ParameterizedBatchInsert && canBuildParamReplace(rows, maxPlaceholders) {
+			// batches of the same size share a statement.
+			stmts := make(map[string]*gosql.Stmt)
+			defer func() {
+				for _, stmt := range stmts {
+					stmt.Close()
+				}
+			}()
+			return buildParamReplaceBatches(ctx, entry.TableSchema, entry.TableName, insertColumns,
+				a.mysqlContext.FullCopyConflictMode, rows, columnTypes, a.batchSizeLimit(), maxPlaceholders, func(query string, args []interface{}) error {
+					stmt, ok := stmts[query]
+					if !ok {
+						var err error
+						stmt, err = tx.PrepareContext(ctx, prefixSqlComment(a.mysqlContext.SqlCommentPrefix, query))
+						if err != nil {
+							return errors.Wrapf(err, "tx.Prepare. rows %v", len(args)/len(rows[0]))
+						}
+						stmts[query] = stmt
+					}
+					a.logger.Debug("ApplyEventQueries. exec", "query", g.StrLim(query, 256), "args", len(args))
+					if _, err := stmt.ExecContext(ctx, args...); err != nil {
+						return errors.Wrapf(err, "stmt.Exec. rows %v", len(args)/len(rows[0]))
+					}
+					return nil
+				})
+		}
+		return buildReplaceBatches(ctx, entry.TableSchema, entry.TableName, insertColumns,
+			a.mysqlContext.FullCopyConflictMode, rows, columnTypes, a.batchSizeLimit(), execQuery)
+	})
+}
+
+// initOutputFile opens OutputFile for OutputMode file.
+func (a *Applier) initOutputFile() error {
+	if a.mysqlContext.OutputMode != common.OutputModeFile {
+		return nil
+	}
+	if a.mysqlContext.OutputFile == "" {
+		return fmt.Errorf("OutputFile is required for OutputMode file")
+	}
+	if !a.mysqlContext.SkipIncrementalCopy {
+		return fmt.Errorf("OutputMode file only supports full copy. set SkipIncrementalCopy")
+	}
+	if a.mysqlContext.OutputFile == "-" {
+		a.outputFile = nopWriteCloser{os.Stdout}
+	} else {
+		f, err := os.OpenFile(a.mysqlContext.OutputFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+		if err != nil {
+			return errors.Wrap(err, "open OutputFile")
+		}
+		a.outputFile = f
+	}
+	if delimiter := a.mysqlContext.OutputDelimiter; delimiter != "" && delimiter != ";" {
+		if _, err := fmt.Fprintf(a.outputFile, "DELIMITER %s\n", delimiter); err != nil {
+			return errors.Wrap(err, "write OutputFile")
+		}
+	}
+	a.logger.Info("full copy statements will be written to a file", "file", a.mysqlContext.OutputFile)
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// outputTx holds statements of an entry for OutputMode file, in a transaction like ApplyEventQueries.
+type outputTx struct {
+	delimiter string
+	buf       bytes.Buffer
+}
 
+func (a *Applier) newOutputTx() *outputTx {
+	o := &outputTx{delimiter: a.mysqlContext.OutputDelimiter}
+	if o.delimiter == "" {
+		o.delimiter = ";"
+	}
+	o.write("BEGIN")
+	return o
+}
+
+func (o *outputTx) write(query string) {
+	o.buf.WriteString(query)
+	o.buf.WriteString(o.delimiter)
+	o.buf.WriteByte('\n')
+}
+
+// commit writes the statements and COMMIT to w at once.
+func (o *outputTx) commit(w io.Writer) error {
+	o.write("COMMIT")
+	if _, err := w.Write(o.buf.Bytes()); err != nil {
+		return errors.Wrap(err, "write OutputFile")
+	}
+	return nil
+}
+
+// replaceRowsSplitOnLockTimeout calls replaceRows with the rows. On a lock wait timeout, the rows
+// are split in halves and replaced separately, down to a single row, which is likely to wait for
+// fewer locks. Only the timed out statement is rolled back (innodb_rollback_on_timeout=OFF) and
+// statements of all FullCopyConflictMode are idempotent, so rows already written are safe to be
+// written again. With innodb_rollback_on_timeout=ON, the whole tx has been rolled back. The error
+// is returned and the entry is applied again by applyDumpEntry.
+func (a *Applier) replaceRowsSplitOnLockTimeout(rows [][]*[]byte, replaceRows func(rows [][]*[]byte) error) error {
+	err := replaceRows(rows)
+	if err == nil || len(rows) <= 1 || !sql.IsLockWaitTimeoutError(err) || a.rollbackOnTimeout {
+		return err
+	}
+	atomic.AddInt64(&a.lockTimeoutSplits, 1)
+	half := len(rows) / 2
+	a.logger.Warn("lock wait timeout. split the batch", "rows", len(rows), "err", err)
+	if err := a.replaceRowsSplitOnLockTimeout(rows[:half], replaceRows); err != nil {
+		return err
+	}
+	return a.replaceRowsSplitOnLockTimeout(rows[half:], replaceRows)
+}
+
+func (a *Applier) batchSizeLimit() int {
+	if a.applyBatchSize <= 0 {
+		return defaultApplyBatchSize
+	}
+	return int(a.applyBatchSize)
+}
+
+func validateFullCopyConflictMode(mode string) error {
+	switch mode {
+	case "", common.FullCopyConflictModeReplace, common.FullCopyConflictModeInsertIgnore,
+		common.FullCopyConflictModeUpsert:
+		return nil
+	default:
+		return fmt.Errorf("unknown FullCopyConflictMode %v", mode)
+	}
+}
+
+// buildFullCopyInsertClauses returns the clauses before and after the values of a full copy
+// statement of FullCopyConflictMode. upsert updates all columns, thus requires the column list.
+func buildFullCopyInsertClauses(mode string, schema string, table string,
+	columns []string) (head string, tail string, err error) {
+
+	var verb string
+	switch mode {
+	case "", common.FullCopyConflictModeReplace:
+		verb = "replace into"
+	case common.FullCopyConflictModeInsertIgnore:
+		verb = "insert ignore into"
+	case common.FullCopyConflictModeUpsert:
+		if len(columns) == 0 {
+			return "", "", fmt.Errorf("FullCopyConflictMode upsert: unknown columns of %v.%v", schema, table)
+		}
+		verb = "insert into"
+		var buf bytes.Buffer
+		buf.WriteString(" on duplicate key update ")
+		for i, column := range umconf.EscapeNameSlice(columns) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(column)
+			buf.WriteString("=values(")
+			buf.WriteString(column)
+			buf.WriteByte(')')
+		}
+		tail = buf.String()
+	default:
+		return "", "", validateFullCopyConflictMode(mode)
+	}
+	head = fmt.Sprintf(`%s %s.%s %s values `, verb,
+		umconf.EscapeName(schema), umconf.EscapeName(table), umconf.BuildInsertColumnList(columns))
+	return head, tail, nil
+}
+
+// buildReplaceBatches builds statements of FullCopyConflictMode (`replace into` by default) of the rows,
+// each of at most sizeLimit bytes, and calls fn with each of them. A row larger than sizeLimit is sent
+// in a statement of its own.
+func buildReplaceBatches(ctx context.Context, schema string, table string, columns []string, mode string,
+	valuesX [][]*[]byte, columnTypes []string, sizeLimit int, fn func(query string) error) error {
+
+	head, tail, err := buildFullCopyInsertClauses(mode, schema, table, columns)
+	if err != nil {
+		return err
+	}
+	var buf, row bytes.Buffer
+	buf.Grow(sizeLimit)
+	flush := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+		buf.WriteString(tail)
+		err := fn(buf.String())
+		buf.Reset()
+		return err
+	}
+	for i := range valuesX {
+		if err := checkCanceled(ctx, i); err != nil {
+			return err
+		}
+		row.Reset()
+		row.WriteByte('(')
+		for j := range valuesX[i] {
+			if j > 0 {
+				row.WriteByte(',')
+			}
+
+			colData := valuesX[i][j]
+			if colData != nil {
+				if j < len(columnTypes) {
+					row.WriteString(sql.BuildColumnLiteral(*colData, columnTypes[j]))
+				} else {
+					row.WriteByte('\'')
+					row.WriteString(sql.EscapeValue(string(*colData)))
+					row.WriteByte('\'')
+				}
+			} else {
+				row.WriteString("NULL")
+			}
+		}
+		row.WriteByte(')')
+
+		// the row does not fit. send the previous rows first.
+		if buf.Len() > 0 && buf.Len()+1+row.Len()+len(tail) > sizeLimit {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if buf.Len() == 0 {
+			buf.WriteString(head)
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.Write(row.Bytes())
+
+		if buf.Len()+len(tail) >= sizeLimit {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// maxPlaceholders is the max number of placeholders in a prepared statement of MySQL.
+const maxPlaceholders = 65535
+
+// canBuildParamReplace returns true if all rows have the same number of values, not exceeding
+// maxPlaceholders. Otherwise rows should be written as literals by buildReplaceBatches.
+func canBuildParamReplace(valuesX [][]*[]byte, maxPlaceholders int) bool {
+	if len(valuesX) == 0 {
+		return false
+	}
+	nCols := len(valuesX[0])
+	if nCols == 0 || nCols > maxPlaceholders {
+		return false
+	}
+	for i := range valuesX {
+		if len(valuesX[i]) != nCols {
+			return false
+		}
+	}
+	return true
+}
+
+// buildParamReplaceBatches is buildReplaceBatches with the values bound to placeholders. Each
+// statement has at most maxPlaceholders of them. Statements of the same number of rows are the same.
+// Rows should be checked by canBuildParamReplace.
+func buildParamReplaceBatches(ctx context.Context, schema string, table string, columns []string, mode string,
+	valuesX [][]*[]byte, columnTypes []string, sizeLimit int, maxPlaceholders int,
+	fn func(query string, args []interface{}) error) error {
+
+	nCols := len(valuesX[0])
+	maxRows := maxPlaceholders / nCols
+	head, tail, err := buildFullCopyInsertClauses(mode, schema, table, columns)
+	if err != nil {
+		return err
+	}
+	rowPlaceholders := "(" + strings.TrimSuffix(strings.Repeat("?,", nCols), ",") + ")"
+	queries := make(map[int]string)
+	buildQuery := func(nRows int) string {
+		query, ok := queries[nRows]
+		if !ok {
+			query = head + strings.TrimSuffix(strings.Repeat(rowPlaceholders+",", nRows), ",") + tail
+			queries[nRows] = query
+		}
+		return query
+	}
+
+	args := make([]interface{}, 0, nCols*g.MinInt(maxRows, len(valuesX)))
+	size := 0
+	nRows := 0
+	flush := func() error {
+		if nRows == 0 {
+			return nil
+		}
+		err := fn(buildQuery(nRows), args)
+		args = make([]interface{}, 0, cap(args))
+		size = 0
+		nRows = 0
+		return err
+	}
+	for i := range valuesX {
+		if err := checkCanceled(ctx, i); err != nil {
+			return err
+		}
+		rowSize := 0
+		for _, colData := range valuesX[i] {
+			if colData != nil {
+				rowSize += len(*colData)
+			}
+		}
+		// the row does not fit. send the previous rows first.
+		if nRows > 0 && size+rowSize > sizeLimit {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+
+		for j, colData := range valuesX[i] {
+			if colData == nil {
+				args = append(args, nil)
+				continue
+			}
+			if j < len(columnTypes) && isBinaryColumnLiteral(columnTypes[j]) {
+				args = append(args, *colData)
+			} else {
+				args = append(args, string(*colData))
+			}
+		}
+		size += rowSize
+		nRows += 1
+
+		if size >= sizeLimit || nRows == maxRows {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// cancelCheckRows is the number of rows between checks of cancellation in loops over rows of an entry.
+const cancelCheckRows = 1000
+
+// checkCanceled returns the error of ctx if it is done. It is checked only every cancelCheckRows rows.
+func checkCanceled(ctx context.Context, iRow int) error {
+	if iRow%cancelCheckRows != 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
+
+// entryContext returns a context of a.ctx, which is also canceled on shutdown. a.ctx is canceled only
+// after goroutines of the applier exit.
+func (a *Applier) entryContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(a.ctx)
+	select {
+	case <-a.shutdownCh:
+		cancel()
+		return ctx, cancel
+	default:
+	}
+	go func() {
+		select {
+		case <-a.shutdownCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// isBinaryColumnLiteral returns true if sql.BuildColumnLiteral writes values of the type as bytes.
+func isBinaryColumnLiteral(columnType string) bool {
+	columnType = strings.ToLower(columnType)
+	return strings.HasPrefix(columnType, "bit") || strings.HasPrefix(columnType, "binary") ||
+		strings.HasPrefix(columnType, "varbinary") || strings.Contains(columnType, "blob") ||
+		sql.IsGeometryType(columnType)
+}
+
+// checkSqlCommentPrefix checks that SqlCommentPrefix is a single /* */ comment, which neither is
+// executed by MySQL (/*! */) nor changes how the following statement is parsed.
+func checkSqlCommentPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	body := strings.TrimSuffix(strings.TrimPrefix(prefix, "/*"), "*/")
+	if !strings.HasPrefix(prefix, "/*") || !strings.HasSuffix(prefix, "*/") || len(prefix) < 4 ||
+		strings.Contains(body, "*/") || strings.HasPrefix(body, "!") {
+		return fmt.Errorf("SqlCommentPrefix should be a /* */ comment. got %v", prefix)
+	}
+	stmts, _, err := parser.New().Parse(prefixSqlComment(prefix, "select 1"), "", "")
+	if err != nil || len(stmts) != 1 {
+		return fmt.Errorf("SqlCommentPrefix %v breaks statements. err %v", prefix, err)
+	}
+	return nil
+}
+
+// prefixSqlComment prepends SqlCommentPrefix to the query.
+func prefixSqlComment(prefix string, query string) string {
+	if prefix == "" || query == "" {
+		return query
+	}
+	return prefix + " " + query
+}
+
+// idempotentDDL adds IF [NOT] EXISTS to CREATE/DROP DATABASE/TABLE for IdempotentDDL.
+// The query is returned unchanged if it cannot be parsed.
+func idempotentDDL(logger g.LoggerType, query string) string {
+	if query == "" {
+		return query
+	}
+	r, err := base.MakeDDLIdempotent(query)
+	if err != nil {
+		logger.Debug("cannot parse query for IdempotentDDL. keep it as is", "err", err, "query", g.StrLim(query, 256))
+		return query
+	}
+	return r
+}
+
+// stripTextBlobDefaultsForTarget removes defaults of TEXT/BLOB columns if the target does not support them.
+// The query is returned unchanged if it cannot be parsed.
+func stripTextBlobDefaultsForTarget(logger g.LoggerType, targetVersion base.MySQLVersion, query string) string {
+	supported := base.TextBlobDefaultSupported(targetVersion.Digit())
+	if targetVersion.Flavor == base.FlavorMariaDB {
+		supported = targetVersion.AtLeast(10, 2, 1)
+	}
+	// the version is unknown if it is zero.
+	if targetVersion.Major == 0 || supported {
+		return query
+	}
+	r, columns, err := base.StripTextBlobDefaults(query)
+	if err != nil {
+		logger.Debug("cannot parse query for TEXT/BLOB defaults. keep it as is", "err", err, "query", g.StrLim(query, 256))
+		return query
+	}
+	if len(columns) > 0 {
+		logger.Warn("removed defaults of TEXT/BLOB columns which are not supported by the target",
+			"version", targetVersion, "columns", columns)
+	}
+	return r
+}
+
+// checkGeneratedColumnsForTarget returns an error if the DDL has generated columns which the target
+// cannot create, e.g. with a function of a later MySQL version.
+// Queries which cannot be parsed are left for the target to check.
+func checkGeneratedColumnsForTarget(logger g.LoggerType, targetVersion base.MySQLVersion, query string) error {
+	if targetVersion.Major == 0 || targetVersion.Flavor == base.FlavorMariaDB {
+		// functions are checked against versions of MySQL only.
+		return nil
+	}
+	incompatibilities, err := sqle.CheckGeneratedColumnFunctions("mysql", query, targetVersion.Digit())
+	if err != nil {
+		logger.Debug("cannot parse query for generated columns. skip checking", "err", err, "query", g.StrLim(query, 256))
+		return nil
+	}
+	if len(incompatibilities) > 0 {
+		return fmt.Errorf("the target (%v) cannot replay DDL with generated columns: %v. query: %v",
+			targetVersion, strings.Join(incompatibilities, "; "), g.StrLim(query, 256))
+	}
+	return nil
+}
+
+// copyDumpEntry copies the entry for rewriting its statements and rows. Values are shared.
+func copyDumpEntry(entry *common.DumpEntry) *common.DumpEntry {
+	r := *entry
+	r.SystemVariables = append([][2]string(nil), entry.SystemVariables...)
+	r.TbSQL = append([]string(nil), entry.TbSQL...)
+	if entry.ValuesX != nil {
+		r.ValuesX = make([][]*[]byte, len(entry.ValuesX))
+		for i := range entry.ValuesX {
+			r.ValuesX[i] = append([]*[]byte(nil), entry.ValuesX[i]...)
+		}
+	}
+	return &r
+}
+
+func renameSchemaForDumpEntry(entry *common.DumpEntry, schemaRenameMap map[string]string) (err error) {
+	if newSchema, ok := schemaRenameMap[entry.TableSchema]; ok {
+		entry.TableSchema = newSchema
+	}
+	entry.DbSQL, err = base.RenameSchemaInQuery(entry.DbSQL, schemaRenameMap)
+	if err != nil {
+		return errors.Wrapf(err, "DbSQL %v", g.StrLim(entry.DbSQL, 256))
+	}
+	for i := range entry.TbSQL {
+		entry.TbSQL[i], err = base.RenameSchemaInQuery(entry.TbSQL[i], schemaRenameMap)
+		if err != nil {
+			return errors.Wrapf(err, "TbSQL %v", g.StrLim(entry.TbSQL[i], 256))
+		}
+	}
+	return nil
+}
+
+// matchExplicitDefaultsForTimestamp takes explicit_defaults_for_timestamp of the source out of the
+// system variables and compares it with the target. If they differ, sessions applying data use the
+// value of the source, so that TIMESTAMP columns get the same definitions (implicit NOT NULL, DEFAULT
+// and ON UPDATE) and NULL inserted into them is kept as on the source. If the target does not allow
+// setting it (before MySQL 8.0.18), it is only warned.
+func (a *Applier) matchExplicitDefaultsForTimestamp(systemVariables [][2]string) ([][2]string, error) {
+	var r [][2]string
+	for _, v := range systemVariables {
+		if !strings.EqualFold(v[0], base.VarExplicitDefaultsForTimestamp) {
+			r = append(r, v)
+			continue
+		}
+		src, err := base.ParseOnOff(v[1])
+		if err != nil {
+			return nil, errors.Wrap(err, base.VarExplicitDefaultsForTimestamp)
+		}
+		var dst bool
+		err = a.db.QueryRowContext(a.ctx, "select @@explicit_defaults_for_timestamp").Scan(&dst)
+		if err != nil {
+			return nil, errors.Wrap(err, "select @@explicit_defaults_for_timestamp")
+		}
+		a.explicitDefaultsStatement = ""
+		if src == dst {
+			continue
+		}
+		value := "OFF"
+		if src {
+			value = "ON"
+		}
+		statement := fmt.Sprintf("SET @@session.explicit_defaults_for_timestamp = %v", value)
+		if _, err := a.db.ExecContext(a.ctx, statement); err != nil {
+			a.logger.Warn("explicit_defaults_for_timestamp differs and cannot be set on the target."+
+				" TIMESTAMP columns might get different defaults and NULL handling on the target",
+				"source", src, "target", dst, "err", err)
+			continue
+		}
 		for i := range a.dbs {
-			a.logger.Debug("exec sysvar query", "query", systemVariablesStatement)
-			_, err := a.dbs[i].Db.ExecContext(a.ctx, systemVariablesStatement)
-			if err != nil {
-				a.logger.Error("err exec sysvar query.", "err", err)
-				return err
+			if _, err := a.dbs[i].Db.ExecContext(a.ctx, statement); err != nil {
+				return nil, errors.Wrap(err, "set explicit_defaults_for_timestamp")
 			}
 		}
+		a.logger.Warn("explicit_defaults_for_timestamp differs. use the value of the source on the target",
+			"source", src, "target", dst)
+		a.explicitDefaultsStatement = statement
 	}
+	return r, nil
+}
 
-	if entry.SqlMode != "" {
-		for i := range a.dbs {
-			a.logger.Debug("exec sqlmode query", "query", entry.SqlMode)
-			_, err := a.dbs[i].Db.ExecContext(a.ctx, entry.SqlMode)
-			if err != nil {
-				a.logger.Error("err exec sysvar query.", "err", err)
-				return err
-			}
+// applySystemVariables executes the statement on a.dbs and records it as applied.
+func (a *Applier) applySystemVariables(systemVariablesStatement string) error {
+	for i := range a.dbs {
+		a.logger.Debug("exec sysvar query", "query", systemVariablesStatement)
+		_, err := a.dbs[i].Db.ExecContext(a.ctx, systemVariablesStatement)
+		if err != nil {
+			a.logger.Error("err exec sysvar query.", "err", err)
+			return err
 		}
 	}
+	a.appliedSystemVariables = systemVariablesStatement
+	return nil
+}
 
-	queries = append(queries, entry.SqlMode, entry.DbSQL)
-	queries = append(queries, entry.TbSQL...)
-	tx, err := db.BeginTx(a.ctx, &gosql.TxOptions{})
-	if err != nil {
-		return err
+// filterInvalidRows returns rows of the entry which are valid for the target table.
+// Invalid rows are put into the dead letter sink.
+func (a *Applier) filterInvalidRows(db sql.QueryAble, entry *common.DumpEntry) ([][]*[]byte, error) {
+	st := common.SchemaTable{Schema: entry.TableSchema, Table: entry.TableName}
+	v, ok := a.rowValidators[st]
+	if !ok {
+		createTable, err := base.ShowCreateTable(db, entry.TableSchema, entry.TableName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ShowCreateTable %v.%v", entry.TableSchema, entry.TableName)
+		}
+		v, err = newRowValidator(createTable, entry.ColumnMapTo)
+		if err != nil {
+			a.logger.Warn("cannot validate rows", "schema", entry.TableSchema, "table", entry.TableName, "err", err)
+		}
+		if a.rowValidators == nil {
+			a.rowValidators = make(map[common.SchemaTable]*rowValidator)
+		}
+		a.rowValidators[st] = v
 	}
-	nRows := int64(len(entry.ValuesX))
-	defer func() {
+	if v == nil {
+		return entry.ValuesX, nil
+	}
+	if a.deadLetterSink == nil {
+		a.deadLetterSink = newFileDeadLetterSink(a.stateDir, a.subject)
+	}
+
+	valid := entry.ValuesX[:0]
+	for _, row := range entry.ValuesX {
+		reason := v.validate(row)
+		if reason == "" {
+			valid = append(valid, row)
+			continue
+		}
+		a.logger.Warn("put an invalid row into dead letter", "schema", entry.TableSchema,
+			"table", entry.TableName, "reason", reason)
+		err := a.deadLetterSink.Put(entry.TableSchema, entry.TableName, row, reason)
 		if err != nil {
-			return
+			return nil, errors.Wrap(err, "deadLetterSink.Put")
 		}
-		err = tx.Commit()
-		if err == nil {
-			atomic.AddInt64(&a.TotalRowsReplayed, nRows)
+	}
+	return valid, nil
+}
+
+func (a *Applier) checkColumnTypes(db sql.QueryAble, entry *common.DumpEntry) error {
+	table, err := common.DecodeMaybeTable(entry.Table)
+	if err != nil {
+		return errors.Wrap(err, "DecodeMaybeTable")
+	}
+	if table != nil {
+		if err := a.checkTableEngine(db, entry.TableSchema, entry.TableName, table.TableEngine); err != nil {
+			return err
 		}
-	}()
-	if _, err := tx.ExecContext(a.ctx, querySetFKChecksOff); err != nil {
+	}
+	a.initUniqueKeyIndexes(entry, table)
+	targetColumns, err := base.GetTableColumns(db, entry.TableSchema, entry.TableName)
+	if err != nil && a.outputFile != nil && table != nil && sql.IsNoSuchTableError(err) {
+		// to be created as on the source by the statements written to OutputFile
+		targetColumns, err = table.OriginalTableColumns, nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "GetTableColumns %v.%v", entry.TableSchema, entry.TableName)
+	}
+	err = base.ApplyColumnTypes(db, entry.TableSchema, entry.TableName, targetColumns)
+	if err != nil {
+		return errors.Wrapf(err, "ApplyColumnTypes %v.%v", entry.TableSchema, entry.TableName)
+	}
+	targetColumns = a.excludeGIPK(entry, table, targetColumns)
+	a.initUpsertColumns(entry, targetColumns)
+	a.initEncryptIndexes(entry, targetColumns)
+	a.initSRIDColumns(entry, targetColumns)
+	if err := a.initRowFilter(entry, targetColumns); err != nil {
 		return err
 	}
-	execQuery := func(query string) error {
-		a.logger.Debug("ApplyEventQueries. exec", "query", g.StrLim(query, 256))
-		_, err := tx.ExecContext(a.ctx, query)
-		if err != nil {
-			queryStart := g.StrLim(query, 10) // avoid printing sensitive information
-			errCtx := errors.Wrapf(err, "tx.Exec. queryStart %v seq", queryStart)
-			if !sql.IgnoreError(err) {
-				a.logger.Error("ApplyEventQueries. exec error", "err", errCtx)
-				return errCtx
-			}
-			if !sql.IgnoreExistsError(err) {
-				a.logger.Warn("ApplyEventQueries. ignore error", "err", errCtx)
+	if err := a.initCharsetIndexes(entry, targetColumns); err != nil {
+		return err
+	}
+	a.initEncodingCheck(entry, targetColumns)
+	// encrypted columns are binary on the target regardless of the source type
+	targetColumns = a.columnEncryptor.excludeColumns(entry.TableSchema, entry.TableName, targetColumns)
+	err = base.CheckColumnTypeCompatibility(a.logger, table, targetColumns,
+		a.mysqlContext.AllowIncompatibleColumnType)
+	if err != nil {
+		return err
+	}
+
+	base.CheckKeyCollations(a.logger, table, targetColumns)
+	if err := a.checkAutoIncrementCapacity(entry, table, targetColumns); err != nil {
+		return err
+	}
+
+	tableKey := fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)
+	delete(a.numericClamps, tableKey)
+	for _, m := range base.FindNumericAttrMismatches(table, targetColumns) {
+		a.logger.Warn("UNSIGNED/ZEROFILL differs between source and target column",
+			"schema", entry.TableSchema, "table", entry.TableName, "column", m.Column,
+			"srcUnsigned", m.SrcUnsigned, "dstUnsigned", m.DstUnsigned,
+			"srcZerofill", m.SrcZerofill, "dstZerofill", m.DstZerofill)
+		if !m.SignednessDiffers() {
+			continue
+		}
+		switch a.mysqlContext.NumericAttrMismatch {
+		case common.NumericAttrMismatchFail:
+			return fmt.Errorf("signedness of column %v.%v.%v differs between source and target",
+				entry.TableSchema, entry.TableName, m.Column)
+		case common.NumericAttrMismatchClamp:
+			if a.numericClamps == nil {
+				a.numericClamps = make(map[string][]base.NumericAttrMismatch)
 			}
+			a.numericClamps[tableKey] = append(a.numericClamps[tableKey], m)
+		}
+	}
+	return nil
+}
+
+// checkAutoIncrementCapacity compares the AUTO_INCREMENT value of the source table with the max
+// of the target column, on which inserts of larger values fail with out-of-range.
+func (a *Applier) checkAutoIncrementCapacity(entry *common.DumpEntry, table *common.Table,
+	targetColumns *common.ColumnList) error {
+
+	c, ok := base.GetAutoIncrementCapacity(table, targetColumns)
+	if !ok {
+		return nil
+	}
+	if c.Overflows() {
+		if a.mysqlContext.AutoIncrementOverflow != common.AutoIncrementOverflowWarn {
+			return fmt.Errorf("AUTO_INCREMENT value %v of %v.%v exceeds the max %v of the target column %v",
+				c.Value, entry.TableSchema, entry.TableName, c.Max, c.Column)
 		}
+		a.logger.Warn("AUTO_INCREMENT value exceeds the max of the target column. inserts will fail",
+			"schema", entry.TableSchema, "table", entry.TableName, "column", c.Column,
+			"value", c.Value, "max", c.Max)
+	} else if c.Near() {
+		a.logger.Warn("AUTO_INCREMENT value is near the max of the target column",
+			"schema", entry.TableSchema, "table", entry.TableName, "column", c.Column,
+			"value", c.Value, "max", c.Max)
+	}
+	return nil
+}
+
+// checkTableEngine compares storage engines of the source and the target table.
+// A mismatch is warned, as transactional behavior differs. Options relying on transactions
+// or foreign keys are rejected if the target engine does not support them.
+func (a *Applier) checkTableEngine(db sql.QueryAble, schema, table, srcEngine string) error {
+	if srcEngine == "" {
+		return nil
+	}
+	dstEngine, err := base.GetTableEngine(db, schema, table)
+	if err != nil {
+		return errors.Wrapf(err, "GetTableEngine %v.%v", schema, table)
+	}
+	if dstEngine == "" || strings.EqualFold(srcEngine, dstEngine) {
 		return nil
 	}
+	a.logger.Warn("storage engine differs between source and target table", "schema", schema,
+		"table", table, "srcEngine", srcEngine, "dstEngine", dstEngine)
 
-	for _, query := range queries {
-		if query == "" {
-			continue
+	if !base.IsTransactionalEngine(dstEngine) {
+		if a.mysqlContext.OrphanRowsPolicy != "" {
+			return fmt.Errorf("OrphanRowsPolicy relies on foreign keys, which are not supported by"+
+				" the target engine %v of %v.%v", dstEngine, schema, table)
 		}
-		err := execQuery(query)
-		if err != nil {
-			return err
+		if a.mysqlContext.TxIsolationLevel != "" {
+			return fmt.Errorf("TxIsolationLevel relies on transactions, which are not supported by"+
+				" the target engine %v of %v.%v", dstEngine, schema, table)
 		}
 	}
+	return nil
+}
 
-	var buf bytes.Buffer
-	BufSizeLimit := 1 * 1024 * 1024 // 1MB. TODO parameterize it
-	BufSizeLimitDelta := 1024
-	buf.Grow(BufSizeLimit + BufSizeLimitDelta)
-	for i := range entry.ValuesX {
-		if buf.Len() == 0 {
-			buf.WriteString(fmt.Sprintf(`replace into %s.%s %s values (`,
-				umconf.EscapeName(entry.TableSchema), umconf.EscapeName(entry.TableName), umconf.BuildInsertColumnList(entry.ColumnMapTo)))
-		} else {
-			buf.WriteString(",(")
-		}
+// initUniqueKeyIndexes finds the values of the unique key used by the source in full copy of the table.
+func (a *Applier) initUniqueKeyIndexes(entry *common.DumpEntry, table *common.Table) {
+	tableKey := fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)
+	delete(a.uniqueKeyIndexes, tableKey)
+	if !a.mysqlContext.DetectDuplicateKeys || table == nil || table.UseUniqueKey == nil {
+		return
+	}
 
-		firstCol := true
-		for j := range entry.ValuesX[i] {
-			if firstCol {
-				firstCol = false
-			} else {
-				buf.WriteByte(',')
+	columnNames := table.ColumnMapFrom
+	if len(columnNames) == 0 && table.OriginalTableColumns != nil {
+		columnNames = table.OriginalTableColumns.Names()
+	}
+	var indexes []int
+	for _, name := range table.UseUniqueKey.Columns.Names() {
+		index := -1
+		for i := range columnNames {
+			if columnNames[i] == name {
+				index = i
+				break
 			}
+		}
+		if index < 0 {
+			// the key is not fully copied
+			return
+		}
+		indexes = append(indexes, index)
+	}
+	if a.uniqueKeyIndexes == nil {
+		a.uniqueKeyIndexes = make(map[string][]int)
+	}
+	a.uniqueKeyIndexes[tableKey] = indexes
+}
 
-			colData := entry.ValuesX[i][j]
-			if colData != nil {
-				buf.WriteByte('\'')
-				buf.WriteString(sql.EscapeValue(string(*colData)))
-				buf.WriteByte('\'')
-			} else {
-				buf.WriteString("NULL")
+// warnDuplicateKeys warns on rows of the entry sharing a unique key.
+func (a *Applier) warnDuplicateKeys(entry *common.DumpEntry) {
+	indexes := a.uniqueKeyIndexes[fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)]
+	if len(indexes) == 0 {
+		return
+	}
+	rowOfKey := make(map[string]int, len(entry.ValuesX))
+	var sb strings.Builder
+	for i, row := range entry.ValuesX {
+		sb.Reset()
+		hasNull := false
+		for _, j := range indexes {
+			if j >= len(row) || row[j] == nil {
+				hasNull = true
+				break
 			}
+			sb.Write(*row[j])
+			sb.WriteByte(0)
 		}
-		buf.WriteByte(')')
+		if hasNull {
+			// NULLs never collide in a unique key
+			continue
+		}
+		key := sb.String()
+		if prev, ok := rowOfKey[key]; ok {
+			a.logger.Warn("rows in an entry share a unique key. the later row wins", "schema", entry.TableSchema,
+				"table", entry.TableName, "key", strings.Split(strings.TrimSuffix(key, "\x00"), "\x00"),
+				"row", prev, "laterRow", i)
+		}
+		rowOfKey[key] = i
+	}
+}
 
-		needInsert := (i == len(entry.ValuesX)-1) || (buf.Len() >= BufSizeLimit)
-		// last rows or sql too large
+// initEncryptIndexes finds the values to be encrypted in full copy of the table.
+func (a *Applier) initEncryptIndexes(entry *common.DumpEntry, targetColumns *common.ColumnList) {
+	tableKey := fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)
+	delete(a.encryptIndexes, tableKey)
 
-		if needInsert {
-			err := execQuery(buf.String())
-			buf.Reset()
-			if err != nil {
-				return err
-			}
+	columnNames := entry.ColumnMapTo
+	if len(columnNames) == 0 {
+		// values are inserted by the position of the target columns
+		columnNames = targetColumns.Names()
+	}
+	indexes := a.columnEncryptor.indexes(entry.TableSchema, entry.TableName, columnNames)
+	if len(indexes) == 0 {
+		return
+	}
+	a.logger.Info("encrypt columns on full copy", "schema", entry.TableSchema, "table", entry.TableName,
+		"indexes", indexes)
+	if a.encryptIndexes == nil {
+		a.encryptIndexes = make(map[string][]int)
+	}
+	a.encryptIndexes[tableKey] = indexes
+}
+
+// initCharsetIndexes finds the values to be converted by ColumnCharsets in full copy of the table.
+func (a *Applier) initCharsetIndexes(entry *common.DumpEntry, targetColumns *common.ColumnList) error {
+	tableKey := fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)
+	delete(a.charsetIndexes, tableKey)
+	if a.columnCharsets == nil {
+		return nil
+	}
+
+	columnNames := entry.ColumnMapTo
+	if len(columnNames) == 0 {
+		columnNames = targetColumns.Names()
+	}
+	charsets, err := a.columnCharsets.indexes(entry.TableSchema, entry.TableName, columnNames, targetColumns)
+	if err != nil || len(charsets) == 0 {
+		return err
+	}
+	a.logger.Info("convert character sets of columns on full copy", "schema", entry.TableSchema,
+		"table", entry.TableName, "charsets", charsets)
+	if a.charsetIndexes == nil {
+		a.charsetIndexes = make(map[string]map[int]string)
+	}
+	a.charsetIndexes[tableKey] = charsets
+	return nil
+}
+
+// initEncodingCheck builds the check of OnEncodingError for full copy of the table.
+func (a *Applier) initEncodingCheck(entry *common.DumpEntry, targetColumns *common.ColumnList) {
+	tableKey := fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)
+	delete(a.encodingChecks, tableKey)
+
+	columnNames := entry.ColumnMapTo
+	if len(columnNames) == 0 {
+		columnNames = targetColumns.Names()
+	}
+	check := newEncodingCheck(a.mysqlContext.OnEncodingError, entry.TableSchema, entry.TableName,
+		columnNames, targetColumns)
+	if check == nil {
+		return
+	}
+	if a.encodingChecks == nil {
+		a.encodingChecks = make(map[string]*encodingCheck)
+	}
+	a.encodingChecks[tableKey] = check
+}
+
+// excludeGIPK excludes the generated invisible primary key of the target table if the source does not
+// have it. Values are then inserted with an explicit list of the other columns.
+func (a *Applier) excludeGIPK(entry *common.DumpEntry, table *common.Table,
+	targetColumns *common.ColumnList) *common.ColumnList {
+
+	tableKey := fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)
+	delete(a.insertColumns, tableKey)
+
+	r, found := base.WithoutGIPK(targetColumns)
+	if !found {
+		return targetColumns
+	}
+	if table != nil && table.OriginalTableColumns != nil &&
+		table.OriginalTableColumns.GetColumn(base.GIPKColumnName) != nil {
+		// the source has it too. values of it are copied.
+		return targetColumns
+	}
+	a.logger.Info("exclude the generated invisible primary key of the target", "schema", entry.TableSchema,
+		"table", entry.TableName, "column", base.GIPKColumnName)
+	if len(entry.ColumnMapTo) == 0 {
+		if a.insertColumns == nil {
+			a.insertColumns = make(map[string][]string)
 		}
+		a.insertColumns[tableKey] = r.Names()
+	}
+	return r
+}
+
+// initUpsertColumns lists the columns of the target for FullCopyConflictMode upsert, which updates
+// each of them with VALUES(column), and for LoadDataInsert, which sets each of them from a variable.
+// Rows without ColumnMapTo are in the order of the target columns.
+func (a *Applier) initUpsertColumns(entry *common.DumpEntry, targetColumns *common.ColumnList) {
+	if (a.mysqlContext.FullCopyConflictMode != common.FullCopyConflictModeUpsert && !a.mysqlContext.LoadDataInsert) ||
+		len(entry.ColumnMapTo) > 0 {
+		return
+	}
+	tableKey := fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)
+	if _, ok := a.insertColumns[tableKey]; ok {
+		// set by excludeGIPK
+		return
+	}
+	if a.insertColumns == nil {
+		a.insertColumns = make(map[string][]string)
 	}
+	a.insertColumns[tableKey] = targetColumns.Names()
+}
+
+// initRowFilter builds the filter of ApplyRowFilters for full copy of the table.
+func (a *Applier) initRowFilter(entry *common.DumpEntry, targetColumns *common.ColumnList) error {
+	tableKey := fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)
+	delete(a.rowFilters, tableKey)
 
+	columnNames := entry.ColumnMapTo
+	if len(columnNames) == 0 {
+		columnNames = targetColumns.Names()
+	}
+	filter, err := newRowFilter(a.mysqlContext.ApplyRowFilters, entry.TableSchema, entry.TableName,
+		columnNames, targetColumns)
+	if err != nil || filter == nil {
+		return err
+	}
+	if a.rowFilters == nil {
+		a.rowFilters = make(map[string]*rowFilter)
+	}
+	a.rowFilters[tableKey] = filter
 	return nil
 }
 
+// initSRIDColumns finds target columns with an SRID constraint for checking values on full copy.
+func (a *Applier) initSRIDColumns(entry *common.DumpEntry, targetColumns *common.ColumnList) {
+	tableKey := fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)
+	delete(a.sridColumns, tableKey)
+
+	columnNames := entry.ColumnMapTo
+	if len(columnNames) == 0 {
+		columnNames = targetColumns.Names()
+	}
+	columns := sridColumns(targetColumns, columnNames)
+	if len(columns) == 0 {
+		return
+	}
+	if a.sridColumns == nil {
+		a.sridColumns = make(map[string]map[int]*umconf.Column)
+	}
+	a.sridColumns[tableKey] = columns
+}
+
 func (a *Applier) Stats() (*common.TaskStatistics, error) {
 	a.logger.Debug("Stats")
 	var totalDeltaCopied int64
@@ -1008,7 +2734,7 @@ func (a *Applier) Stats() (*common.TaskStatistics, error) {
 	eta = "N/A"
 	if progressPct >= 100.0 {
 		eta = "0s"
-		a.mysqlContext.Stage = common.StageSlaveHasReadAllRelayLog
+		a.setStage(common.StageSlaveHasReadAllRelayLog)
 	} else if progressPct >= 1.0 {
 		elapsedRowCopySeconds := a.mysqlContext.ElapsedRowCopyTime().Seconds()
 		totalExpectedSeconds := elapsedRowCopySeconds * float64(rowsEstimate) / float64(totalRowsReplay)
@@ -1066,14 +2792,71 @@ func (a *Applier) Stats() (*common.TaskStatistics, error) {
 		HandledQueryCount: common.QueryCount{
 			AppliedQueryCount: &queryCount,
 		},
+		TargetFlavor:       a.targetFlavor,
+		ActiveDDLCount:     a.ddlLimiter.Active(),
+		BackpressureActive: atomic.LoadInt32(&a.nBackpressure) > 0,
+		TargetThrottled:    a.targetPressure.isThrottled(),
 	}
 	if a.natsConn != nil {
 		taskResUsage.MsgStat = a.natsConn.Statistics
 	}
+	if a.ai != nil && a.ai.tableActivity != nil {
+		taskResUsage.TopTables = a.ai.tableActivity.top(tableActivityTopDefault, time.Now())
+	}
+	if a.ai != nil && a.ai.tableApplyTime != nil {
+		taskResUsage.SlowestTables = a.ai.tableApplyTime.slowest(tableActivityTopDefault)
+	}
+	if a.ai != nil {
+		taskResUsage.DroppedEvents = atomic.LoadInt64(&a.ai.droppedEvents)
+		taskResUsage.IncrHeldForFullCopy = atomic.LoadInt64(&a.ai.heldForFullCopy)
+	}
+	if a.targetPressure != nil {
+		taskResUsage.TargetThreadsRunning = atomic.LoadInt64(&a.targetPressure.threadsRunning)
+		taskResUsage.TargetThreadsConnected = atomic.LoadInt64(&a.targetPressure.threadsConnected)
+	}
+	if a.dataParity != nil {
+		var coverage float64
+		if a.targetGtid != nil {
+			a.gtidSetLock.RLock()
+			coverage = gtidSetCoverage(a.gtidSet, a.targetGtid.(*gomysql.MysqlGTIDSet))
+			a.gtidSetLock.RUnlock()
+		} else {
+			coverage = txCoverage(totalDeltaCopied, deltaEstimate)
+		}
+		taskResUsage.DataParityPct = strconv.FormatFloat(a.dataParity.pct(rowsEstimate, coverage), 'f', 1, 64)
+	}
+	taskResUsage.LockTimeoutSplits = atomic.LoadInt64(&a.lockTimeoutSplits)
+	taskResUsage.PerTableRowCount = a.tableRowCounts()
+	if a.ai != nil {
+		taskResUsage.EffectiveWorkers = a.ai.workerRampUp.effectiveWorkers(time.Now())
+	}
 
 	return &taskResUsage, nil
 }
 
+func (a *Applier) addTableRows(schema, table string, n int64) {
+	a.tableRowsLock.Lock()
+	defer a.tableRowsLock.Unlock()
+	if a.tableRows == nil {
+		a.tableRows = make(map[string]int64)
+	}
+	a.tableRows[fmt.Sprintf("%s.%s", schema, table)] += n
+}
+
+// tableRowCounts returns a copy of rows committed by full copy of each table. nil if there is none.
+func (a *Applier) tableRowCounts() map[string]int64 {
+	a.tableRowsLock.Lock()
+	defer a.tableRowsLock.Unlock()
+	if a.tableRows == nil {
+		return nil
+	}
+	r := make(map[string]int64, len(a.tableRows))
+	for k, v := range a.tableRows {
+		r[k] = v
+	}
+	return r
+}
+
 func (a *Applier) onError(state int, err error) {
 	a.logger.Error("onError", "err", err, "hasShutdown", a.shutdown)
 	if a.shutdown {
@@ -1110,6 +2893,23 @@ func (a *Applier) onError(state int, err error) {
 	_ = a.Shutdown()
 }
 
+// onErrorRetry retries the failed operation within ErrorGracePeriodMs if the error is transient.
+// It calls onError if the error is not recovered. `retry` can be nil if the operation cannot be retried.
+// Returns true if recovered.
+func (a *Applier) onErrorRetry(state int, err error, retry func() error) bool {
+	gracePeriod := time.Duration(a.mysqlContext.ErrorGracePeriodMs) * time.Millisecond
+	if retry != nil && gracePeriod > 0 && sql.IsTransientError(err) {
+		a.logger.Warn("transient error. retrying in the grace period", "err", err, "gracePeriod", gracePeriod)
+		err = common.RetryInGracePeriod(gracePeriod, errorRetryInterval, a.shutdownCh, retry)
+		if err == nil {
+			a.logger.Info("recovered from the transient error")
+			return true
+		}
+	}
+	a.onError(state, err)
+	return false
+}
+
 func (a *Applier) Shutdown() error {
 	a.logger.Debug("Shutting down")
 	a.shutdownLock.Lock()
@@ -1138,10 +2938,28 @@ func (a *Applier) Shutdown() error {
 	}
 	a.wg.Wait()
 	a.logger.Debug("Shutdown. a.wg.Wait. after")
+	if a.exportStateOnShutdown && a.stateImported {
+		if _, err := a.ExportState(); err != nil {
+			a.logger.Error("Shutdown. ExportState", "err", err)
+		}
+	}
 
 	a.cancelFunc()
 	_ = sql.CloseDB(a.db)
 	a.logger.Debug("Shutdown. CloseDB. after")
+	a.tableRowsLock.Lock()
+	a.tableRows = nil
+	a.tableRowsLock.Unlock()
+	if a.outputFile != nil {
+		if err := a.outputFile.Close(); err != nil {
+			a.logger.Error("Shutdown. close OutputFile", "err", err)
+		}
+	}
+	if a.ai != nil {
+		if err := a.ai.sequenceLog.Close(); err != nil {
+			a.logger.Error("Shutdown. close SequenceLogFile", "err", err)
+		}
+	}
 	_ = sql.CloseConns(a.dbs...)
 	a.logger.Debug("Shutdown. CloseConns. after")
 
@@ -1150,24 +2968,117 @@ func (a *Applier) Shutdown() error {
 }
 
 func (a *Applier) watchTargetGtid() {
-	target, err := a.storeManager.WatchTargetGtid(a.subject, a.shutdownCh)
+	var target string
+	err := a.storeManager.Retry("WatchTargetGtid", a.shutdownCh, func() (err error) {
+		target, err = a.storeManager.WatchTargetGtid(a.subject, a.shutdownCh)
+		return err
+	})
 	if err != nil {
 		a.onError(common.TaskStateDead, err)
+		return
 	}
 	a.logger.Info("got target GTIDSet", "gs", target)
+	if strings.TrimSpace(target) == "" {
+		// an empty set would be contained by any executed set and stop the job at once.
+		a.logger.Info("empty target GTIDSet. no stop condition")
+		return
+	}
 
+	if err := a.checkGtidConflicts("target gtid", nil, target); err != nil {
+		a.onError(common.TaskStateDead, err)
+		return
+	}
 	gs, err := gomysql.ParseMysqlGTIDSet(target)
 	if err != nil {
 		a.onError(common.TaskStateDead, errors.Wrap(err, "CommandTypeJobFinish. ParseMysqlGTIDSet"))
+		return
 	}
 	a.targetGtid = gs
 	a.gtidCh <- nil // trigger `testTargetGtid()` in `updateGtidLoop()`
 }
 
+const (
+	// the time to apply buffered incr msgs after the target gtid is met
+	targetGtidDrainTimeout = 10 * time.Minute
+	drainCheckInterval     = 100 * time.Millisecond
+)
+
+// stopAtTargetGtid stops receiving incr msgs when the target gtid is met. Msgs and entries
+// already buffered are applied before shutting down.
+func (a *Applier) stopAtTargetGtid() {
+	if !atomic.CompareAndSwapInt32(&a.stoppingAtTarget, 0, 1) {
+		return
+	}
+	a.incrSubLock.Lock()
+	if a.incrSub != nil {
+		if err := a.incrSub.Unsubscribe(); err != nil {
+			a.logger.Warn("stopAtTargetGtid. Unsubscribe", "err", err)
+		}
+		a.incrSub = nil // not to be subscribed again on reconnecting
+	}
+	a.incrSubLock.Unlock()
+
+	go func() {
+		if a.ai != nil {
+			a.drainIncr()
+		}
+		_ = a.Shutdown()
+	}()
+}
+
+// drainIncr waits for the buffered incr msgs and entries to be applied, up to targetGtidDrainTimeout.
+func (a *Applier) drainIncr() {
+	start := time.Now()
+	a.logger.Info("target gtid met. draining incr queues", "msgs", len(a.ai.incrBytesQueue),
+		"entries", len(a.ai.binlogEntryQueue), "inFlight", atomic.LoadInt64(&a.ai.inFlight))
+	t := time.NewTicker(drainCheckInterval)
+	defer t.Stop()
+	timeout := time.After(targetGtidDrainTimeout)
+	for atomic.LoadInt64(&a.ai.inFlight) > 0 {
+		select {
+		case <-a.shutdownCh:
+			a.logger.Info("draining incr queues. shutdown", "inFlight", atomic.LoadInt64(&a.ai.inFlight))
+			return
+		case <-timeout:
+			a.logger.Warn("draining incr queues timed out", "inFlight", atomic.LoadInt64(&a.ai.inFlight),
+				"timeout", targetGtidDrainTimeout)
+			return
+		case <-t.C:
+		}
+	}
+	a.logger.Info("incr queues drained", "elapsed", time.Since(start))
+}
+
+// checkGtidConflicts checks gtidStr before it is merged into gtidSet (nil for none) and handles
+// the conflicts according to OnGtidConflict. Returns an error to fail the job.
+func (a *Applier) checkGtidConflicts(name string, gtidSet *gomysql.MysqlGTIDSet, gtidStr string) error {
+	if a.mysqlContext.OnGtidConflict == common.OnGtidConflictIgnore {
+		return nil
+	}
+	conflicts, err := common.GtidSetConflicts(gtidSet, gtidStr)
+	if err != nil {
+		return errors.Wrapf(err, "GtidSetConflicts %v", name)
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	if a.mysqlContext.OnGtidConflict == common.OnGtidConflictFail {
+		return fmt.Errorf("conflicting intervals in %v: %v", name, strings.Join(conflicts, "; "))
+	}
+	a.logger.Warn("conflicting intervals in gtid set. two masters might share a UUID",
+		"name", name, "conflicts", conflicts)
+	return nil
+}
+
 func (a *Applier) checkJobFinish() {
-	jobStatus, err := a.storeManager.GetJobStatus(a.subject)
+	var jobStatus string
+	err := a.storeManager.Retry("GetJobStatus", a.shutdownCh, func() (err error) {
+		jobStatus, err = a.storeManager.GetJobStatus(a.subject)
+		return err
+	})
 	if err != nil {
 		a.onError(common.TaskStateDead, err)
+		return
 	}
 	if jobStatus == common.TargetGtidFinished {
 		a.logger.Info("job finish. shutting down")
@@ -1175,6 +3086,40 @@ func (a *Applier) checkJobFinish() {
 	}
 }
 
+// checkOrphanRows finds rows of copied tables whose parent row does not exist, e.g. the parent
+// is filtered out. They are handled according to OrphanRowsPolicy.
+func (a *Applier) checkOrphanRows() error {
+	for st := range a.copiedTables {
+		fks, err := base.GetForeignKeys(a.db, st.Schema, st.Table)
+		if err != nil {
+			return errors.Wrapf(err, "GetForeignKeys %v.%v", st.Schema, st.Table)
+		}
+		for _, fk := range fks {
+			n, err := base.CountOrphanRows(a.db, st.Schema, st.Table, fk)
+			if err != nil {
+				return errors.Wrapf(err, "CountOrphanRows %v.%v %v", st.Schema, st.Table, fk.Name)
+			}
+			if n == 0 {
+				continue
+			}
+			a.logger.Warn("found orphan rows", "schema", st.Schema, "table", st.Table,
+				"fk", fk.Name, "rows", n, "policy", a.mysqlContext.OrphanRowsPolicy)
+			switch a.mysqlContext.OrphanRowsPolicy {
+			case common.OrphanRowsFail:
+				return fmt.Errorf("%v orphan rows in %v.%v for foreign key %v", n, st.Schema, st.Table, fk.Name)
+			case common.OrphanRowsDelete:
+				deleted, err := base.DeleteOrphanRows(a.db, st.Schema, st.Table, fk)
+				if err != nil {
+					return errors.Wrapf(err, "DeleteOrphanRows %v.%v %v", st.Schema, st.Table, fk.Name)
+				}
+				a.logger.Info("deleted orphan rows", "schema", st.Schema, "table", st.Table,
+					"fk", fk.Name, "rows", deleted)
+			}
+		}
+	}
+	return nil
+}
+
 func (a *Applier) enableForeignKeyChecks() error {
 	_, err := a.db.ExecContext(a.ctx, querySetFKChecksOn)
 	if err != nil {
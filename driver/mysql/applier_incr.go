@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,12 +17,17 @@ import (
 	sql "github.com/actiontech/dtle/driver/mysql/sql"
 	"github.com/actiontech/dtle/g"
 	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/pingcap/tidb/parser"
 	"github.com/pkg/errors"
 	uuid "github.com/satori/go.uuid"
 )
 
 const (
 	querySetFKChecksOff = "set @@session.foreign_key_checks = 0 /*dtle*/"
+	// keep 0 of AUTO_INCREMENT columns. the original sql_mode is saved to be restored.
+	querySetNoAutoValueOnZero = "set @dtle_sql_mode = @@session.sql_mode, @@session.sql_mode = " +
+		"if(@@session.sql_mode = '', 'NO_AUTO_VALUE_ON_ZERO', concat(@@session.sql_mode, ',NO_AUTO_VALUE_ON_ZERO')) /*dtle*/"
+	queryRestoreSqlMode = "set @@session.sql_mode = @dtle_sql_mode /*dtle*/"
 	querySetFKChecksOn  = "set @@session.foreign_key_checks = 1 /*dtle*/"
 )
 
@@ -34,6 +40,8 @@ type ApplierIncr struct {
 	binlogEntryQueue chan *common.DataEntry
 	// only TX can be executed should be put into this chan
 	applyBinlogMtsTxQueue chan *common.EntryContext
+	// msgs and entries queued but not yet applied. see enqueueIncrBytes.
+	inFlight int64
 
 	db              *gosql.DB
 	dbs             []*sql.Conn
@@ -55,6 +63,10 @@ type ApplierIncr struct {
 	tableItems mapSchemaTableItems
 
 	OnError func(int, error)
+	// retry the operation on transient errors before calling OnError. returns true if recovered.
+	OnErrorRetry func(int, error, func() error) bool
+	// sets mysqlContext.Stage, sending a task event on changes. nil to only set it.
+	OnStage func(string)
 
 	prevDDL             bool
 	replayingBinlogFile string
@@ -76,6 +88,45 @@ type ApplierIncr struct {
 	bigTxEventQueue chan *dmlExecItem
 	bigTxEventWg    sync.WaitGroup
 
+	// options of transactions applying data. nil for the server default.
+	txOptions *gosql.TxOptions
+	// version of the target
+	targetVersion base.MySQLVersion
+	// @@max_allowed_packet of the target
+	maxAllowedPacket int64
+	// nil for unlimited
+	ddlLimiter *ddlLimiter
+	// nil if no column is to be encrypted
+	columnEncryptor *columnEncryptor
+	// DML events applied to each table
+	tableActivity *tableActivity
+	// time spent applying DML events of each table
+	tableApplyTime *tableApplyTime
+	// nil if the target is not monitored
+	targetPressure *targetPressure
+	// gets DDL of FK parents for PrefetchDDLDependencies
+	storeManager *common.StoreManager
+	// DML events dropped by StrictTableFilter. atomic.
+	droppedEvents int64
+	// "schema.table" warned by StrictTableFilter warn_once
+	warnedTables map[string]struct{}
+	// "schema.table" to filters of ApplyRowFilters
+	rowFilters map[string]*rowFilter
+	// "schema.table" to checks of OnEncodingError, and the columns they are built with
+	encodingChecks       map[string]*encodingCheck
+	encodingCheckColumns map[string]*common.ColumnList
+	// source UUIDs of FilterBySourceUUID, in lower case. nil for none.
+	excludedSources map[string]struct{}
+	// nil without SequenceLogFile
+	sequenceLog  *sequenceLog
+	workerRampUp *workerRampUp
+	// rows go to the sink instead of the target if it is not nil
+	changeSink ChangeSink
+	// closed when the full copy completes. nil unless StrictFullThenIncr.
+	fullCopyComplete <-chan struct{}
+	// entries received before fullCopyComplete is closed. atomic.
+	heldForFullCopy int64
+
 	fwdExtractor *Extractor
 }
 
@@ -86,8 +137,8 @@ func NewApplierIncr(applier *Applier, sourcetype string) (*ApplierIncr, error) {
 		logger:                applier.logger,
 		subject:               applier.subject,
 		mysqlContext:          driverContext,
-		incrBytesQueue:        make(chan []byte, driverContext.ReplChanBufferSize),
-		binlogEntryQueue:      make(chan *common.DataEntry, driverContext.ReplChanBufferSize*2),
+		incrBytesQueue:        make(chan []byte, driverContext.IncrBytesQueueSize),
+		binlogEntryQueue:      make(chan *common.DataEntry, driverContext.BinlogEntryQueueSize),
 		applyBinlogMtsTxQueue: make(chan *common.EntryContext, driverContext.ReplChanBufferSize*2),
 		db:                    applier.db,
 		dbs:                   applier.dbs,
@@ -99,6 +150,28 @@ func NewApplierIncr(applier *Applier, sourcetype string) (*ApplierIncr, error) {
 		tableItems:            make(mapSchemaTableItems),
 		sourceType:            sourcetype,
 		bigTxEventQueue:       make(chan *dmlExecItem, 16),
+		txOptions:             applier.txOptions,
+		targetVersion:         applier.targetVersion,
+		maxAllowedPacket:      applier.maxAllowedPacket,
+		ddlLimiter:            applier.ddlLimiter,
+		columnEncryptor:       applier.columnEncryptor,
+		tableActivity:         newTableActivity(),
+		workerRampUp:          newWorkerRampUp(driverContext.WorkerRampUpMs, driverContext.ParallelWorkers),
+		tableApplyTime:        newTableApplyTime(),
+		targetPressure:        applier.targetPressure,
+		storeManager:          applier.storeManager,
+		warnedTables:          make(map[string]struct{}),
+		changeSink:            applier.changeSink,
+	}
+
+	var err error
+	a.excludedSources, err = newSourceUUIDFilter(driverContext.FilterBySourceUUID)
+	if err != nil {
+		return nil, err
+	}
+	a.sequenceLog, err = newSequenceLog(driverContext.SequenceLogFile)
+	if err != nil {
+		return nil, err
 	}
 
 	if g.EnvIsTrue(g.ENV_SKIP_GTID_EXECUTED_TABLE) {
@@ -113,6 +186,15 @@ func NewApplierIncr(applier *Applier, sourcetype string) (*ApplierIncr, error) {
 		a.noBigTxDMLPipe = true
 	}
 
+	if driverContext.StrictFullThenIncr {
+		if sourcetype == "mysql" {
+			a.fullCopyComplete = applier.rowCopyComplete
+		} else {
+			// the src does not send _full_complete when resuming incremental replication
+			a.logger.Warn("StrictFullThenIncr is ignored for the source", "sourceType", sourcetype)
+		}
+	}
+
 	a.timestampCtx = NewTimestampContext(a.shutdownCh, a.logger, func() bool {
 		return len(a.binlogEntryQueue) == 0 && len(a.applyBinlogMtsTxQueue) == 0
 		// TODO need a more reliable method to determine queue.empty.
@@ -126,6 +208,14 @@ func NewApplierIncr(applier *Applier, sourcetype string) (*ApplierIncr, error) {
 	return a, nil
 }
 
+func (a *ApplierIncr) setStage(stage string) {
+	if a.OnStage != nil {
+		a.OnStage(stage)
+	} else {
+		a.mysqlContext.Stage = stage
+	}
+}
+
 func (a *ApplierIncr) Run() (err error) {
 	a.logger.Debug("Run. GetServerUUID. before")
 	a.MySQLServerUuid, err = sql.GetServerUUID(a.db)
@@ -169,6 +259,7 @@ func (a *ApplierIncr) Run() (err error) {
 		a.logger.Debug("after SelectAllGtidExecuted")
 	}
 
+	a.workerRampUp.begin(time.Now())
 	for i := 0; i < a.mysqlContext.ParallelWorkers; i++ {
 		go a.MtsWorker(i)
 	}
@@ -222,6 +313,12 @@ func (a *ApplierIncr) MtsWorker(workerIndex int) {
 	if workerIndex == 0 {
 		go a.bigTxQueueExecutor()
 	}
+	if !a.workerRampUp.wait(workerIndex, a.shutdownCh) {
+		return
+	}
+	if workerIndex > 0 && a.mysqlContext.WorkerRampUpMs > 0 {
+		logger.Info("worker ramped up", "workers", workerIndex+1)
+	}
 
 	t := time.NewTicker(pingInterval)
 	defer t.Stop()
@@ -233,12 +330,10 @@ func (a *ApplierIncr) MtsWorker(workerIndex int) {
 		case entryContext := <-a.applyBinlogMtsTxQueue:
 			hasEntry = true
 			logger.Debug("a binlogEntry MTS dequeue", "gno", entryContext.Entry.Coordinates.GetGNO())
-			if err := a.ApplyBinlogEvent(workerIndex, entryContext); err != nil {
-				a.OnError(common.TaskStateDead, err) // TODO coordinate with other goroutine
+			if !a.applyEntryWithRetry(workerIndex, entryContext) {
 				keepLoop = false
-			} else {
-				// do nothing
 			}
+			atomic.AddInt64(&a.inFlight, -1)
 			logger.Debug("after ApplyBinlogEvent.", "gno", entryContext.Entry.Coordinates.GetGNO())
 		case <-t.C:
 			if !hasEntry {
@@ -254,8 +349,101 @@ func (a *ApplierIncr) MtsWorker(workerIndex int) {
 	}
 }
 
+// applyEntryWithRetry applies the entry, retrying on transient errors as TableRetryPolicies
+// or ErrorGracePeriodMs. Returns false if failed and OnError has been called.
+func (a *ApplierIncr) applyEntryWithRetry(workerIndex int, entryContext *common.EntryContext) bool {
+	// the entry is held until the last attempt.
+	defer atomic.AddInt64(a.memory2, -int64(entryContext.Entry.Size()))
+	err := a.applyBinlogEvent(workerIndex, entryContext)
+	if err == nil {
+		return true
+	}
+	var retry func() error
+	if !entryContext.Entry.IsPartOfBigTx() {
+		// the TX has been rolled back. it could be applied again.
+		retry = func() error {
+			return a.applyBinlogEvent(workerIndex, entryContext)
+		}
+	}
+	policy := a.tableRetryPolicy(entryContext.Entry)
+	if policy == nil || retry == nil || !sql.IsTransientError(err) {
+		return a.OnErrorRetry(common.TaskStateDead, err, retry) // TODO coordinate with other goroutine
+	}
+
+	interval := time.Duration(policy.RetryIntervalMs) * time.Millisecond
+	if interval == 0 {
+		interval = errorRetryInterval
+	}
+	maxInterval := time.Duration(policy.MaxRetryIntervalMs) * time.Millisecond
+	if maxInterval < interval {
+		maxInterval = interval
+	}
+	a.logger.Warn("transient error. retrying as the table retry policy", "err", err,
+		"maxRetries", policy.MaxRetries, "gno", entryContext.Entry.Coordinates.GetGNO())
+	select {
+	case <-a.shutdownCh:
+		return false
+	case <-time.After(interval):
+	}
+	nextInterval := interval * 2
+	if nextInterval > maxInterval {
+		nextInterval = maxInterval
+	}
+	err = common.RetryWithBackoff(policy.MaxRetries, nextInterval, maxInterval, a.shutdownCh,
+		sql.IsTransientError, retry)
+	if err != nil {
+		a.OnError(common.TaskStateDead, err)
+		return false
+	}
+	a.logger.Info("recovered from the transient error")
+	return true
+}
+
+// tableRetryPolicy returns the policy with the most retries among the tables of the entry, or nil.
+func (a *ApplierIncr) tableRetryPolicy(entry *common.DataEntry) (policy *common.TableRetryPolicy) {
+	if len(a.mysqlContext.TableRetryPolicies) == 0 {
+		return nil
+	}
+	for i := range entry.Events {
+		event := &entry.Events[i]
+		if event.TableName == "" {
+			continue
+		}
+		p := a.mysqlContext.TableRetryPolicies[fmt.Sprintf("%v.%v", event.DatabaseName, event.TableName)]
+		if p != nil && p.MaxRetries > 0 && (policy == nil || p.MaxRetries > policy.MaxRetries) {
+			policy = p
+		}
+	}
+	return policy
+}
+
+// softDeletePolicy returns the policy if DELETE on the table of the event should be applied as an update.
+func (a *ApplierIncr) softDeletePolicy(event *common.DataEvent) *common.SoftDeletePolicy {
+	if len(a.mysqlContext.SoftDeleteTables) == 0 {
+		return nil
+	}
+	return a.mysqlContext.SoftDeleteTables[fmt.Sprintf("%v.%v", event.DatabaseName, event.TableName)]
+}
+
 func (a *ApplierIncr) handleEntry(entryCtx *common.EntryContext) (err error) {
 	binlogEntry := entryCtx.Entry
+	if !a.targetPressure.wait(a.shutdownCh) {
+		return nil // shutdown
+	}
+	a.filterUnconfiguredTables(binlogEntry)
+	err = a.handleUnparseableDDL(binlogEntry)
+	if err != nil {
+		return err
+	}
+	if len(a.mysqlContext.SchemaRenameMap) > 0 {
+		err = a.renameSchemaForBinlogEntry(binlogEntry)
+		if err != nil {
+			return errors.Wrap(err, "renameSchemaForBinlogEntry")
+		}
+	}
+	if err := a.fanOutEntry(binlogEntry); err != nil {
+		return err
+	}
 	isBig := binlogEntry.IsPartOfBigTx()
 	txGno := binlogEntry.Coordinates.GetGNO()
 
@@ -284,6 +472,11 @@ func (a *ApplierIncr) handleEntry(entryCtx *common.EntryContext) (err error) {
 		a.EntryExecutedHook(binlogEntry) // make gtid continuous
 		return nil
 	}
+	if _, excluded := a.excludedSources[txSid]; excluded {
+		a.logger.Debug("skipping a tx of an excluded source.", "sid", txSid, "gno", txGno)
+		a.EntryExecutedHook(binlogEntry) // make gtid continuous
+		return nil
+	}
 
 	// Note: the gtidExecuted will be updated after commit. For a big-tx, we determine
 	// whether to skip for each parts.
@@ -415,6 +608,7 @@ func (a *ApplierIncr) handleEntry(entryCtx *common.EntryContext) (err error) {
 				return nil // shutdown
 			}
 			a.logger.Debug("a binlogEntry MTS enqueue.", "gno", txGno)
+			atomic.AddInt64(&a.inFlight, 1)
 			a.applyBinlogMtsTxQueue <- entryCtx
 		}
 	}
@@ -427,6 +621,17 @@ func (a *ApplierIncr) heterogeneousReplay() {
 
 	a.wg.Add(1)
 	go func() {
+		if a.fullCopyComplete != nil {
+			// entries are held in the queues. The src is blocked once they are full.
+			select {
+			case <-a.shutdownCh:
+				a.wg.Done()
+				return
+			case <-a.fullCopyComplete:
+				a.logger.Info("StrictFullThenIncr: full copy completed. applying incr entries",
+					"held", atomic.LoadInt64(&a.heldForFullCopy))
+			}
+		}
 		for {
 			select {
 			case <-a.shutdownCh:
@@ -442,6 +647,7 @@ func (a *ApplierIncr) heterogeneousReplay() {
 					a.OnError(common.TaskStateDead, err)
 					return
 				}
+				atomic.AddInt64(&a.inFlight, -1)
 				atomic.AddInt64(&a.mysqlContext.DeltaEstimate, 1)
 			}
 		}
@@ -460,19 +666,24 @@ func (a *ApplierIncr) heterogeneousReplay() {
 			hasEntry = true
 
 			binlogEntries := &common.DataEntries{}
-			if err := common.Decode(bs, binlogEntries); err != nil {
+			if err := common.DecodeWith(a.mysqlContext.MessageCodec, bs, binlogEntries); err != nil {
 				a.OnError(common.TaskStateDead, err)
 				return
 			}
 
 			for _, entry := range binlogEntries.Entries {
+				atomic.AddInt64(&a.inFlight, 1)
 				select {
 				case <-a.shutdownCh:
 					return
 				case a.binlogEntryQueue <- entry:
 					atomic.AddInt64(a.memory2, int64(entry.Size()))
+					if a.isFullCopyPending() {
+						atomic.AddInt64(&a.heldForFullCopy, 1)
+					}
 				}
 			}
+			atomic.AddInt64(&a.inFlight, -1) // the msg
 
 		case <-t.C:
 			if !hasEntry {
@@ -483,6 +694,39 @@ func (a *ApplierIncr) heterogeneousReplay() {
 	}
 }
 
+// enqueueIncrBytes queues a msg for heterogeneousReplay. Returns false on shutdown.
+// inFlight is counted before the msg is queued, and the entries of the msg before the msg is done,
+// so it is not 0 until all of them are applied.
+func (a *ApplierIncr) enqueueIncrBytes(bs []byte) bool {
+	atomic.AddInt64(&a.inFlight, 1)
+	select {
+	case <-a.shutdownCh:
+		atomic.AddInt64(&a.inFlight, -1)
+		return false
+	case a.incrBytesQueue <- bs:
+		return true
+	}
+}
+
+// isFullCopyPending returns true if entries are held for StrictFullThenIncr.
+func (a *ApplierIncr) isFullCopyPending() bool {
+	if a.fullCopyComplete == nil {
+		return false
+	}
+	select {
+	case <-a.fullCopyComplete:
+		return false
+	default:
+		return true
+	}
+}
+
+// toggleFKChecks returns true if foreign_key_checks is to be disabled for events executed without it
+// on the source, and enabled again after them.
+func (a *ApplierIncr) toggleFKChecks() bool {
+	return a.mysqlContext.ForeignKeyChecks && !a.mysqlContext.KeepForeignKeyChecks
+}
+
 func (a *ApplierIncr) HasShutdown() bool {
 	select {
 	case <-a.shutdownCh:
@@ -498,7 +742,8 @@ func (a *ApplierIncr) prepareIfNilAndExecute(item *dmlExecItem, workerIdx int) (
 	if item.hasUK {
 		if *item.pstmt == nil {
 			a.logger.Debug("buildDMLEventQuery prepare query", "query", item.query)
-			*item.pstmt, err = a.dbs[workerIdx].Db.PrepareContext(a.ctx, item.query)
+			*item.pstmt, err = a.dbs[workerIdx].Db.PrepareContext(a.ctx,
+				prefixSqlComment(a.mysqlContext.SqlCommentPrefix, item.query))
 			if err != nil {
 				a.logger.Error("buildDMLEventQuery prepare query", "query", item.query, "err", err)
 				return err
@@ -507,7 +752,8 @@ func (a *ApplierIncr) prepareIfNilAndExecute(item *dmlExecItem, workerIdx int) (
 
 		r, err = (*item.pstmt).ExecContext(a.ctx, item.args...)
 	} else {
-		r, err = a.dbs[workerIdx].Db.ExecContext(a.ctx, item.query, item.args...)
+		r, err = a.dbs[workerIdx].Db.ExecContext(a.ctx,
+			prefixSqlComment(a.mysqlContext.SqlCommentPrefix, item.query), item.args...)
 	}
 
 	if err != nil {
@@ -526,10 +772,15 @@ func (a *ApplierIncr) prepareIfNilAndExecute(item *dmlExecItem, workerIdx int) (
 
 // ApplyEventQueries applies multiple DML queries onto the dest table
 func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.EntryContext) (err error) {
+	defer atomic.AddInt64(a.memory2, -int64(binlogEntryCtx.Entry.Size()))
+	return a.applyBinlogEvent(workerIdx, binlogEntryCtx)
+}
+
+// applyBinlogEvent is ApplyBinlogEvent without releasing memory2 of the entry.
+func (a *ApplierIncr) applyBinlogEvent(workerIdx int, binlogEntryCtx *common.EntryContext) (err error) {
 	logger := a.logger.Named("ApplyBinlogEvent")
 	binlogEntryCtx.Rows = 0 // count for logging
 	binlogEntry := binlogEntryCtx.Entry
-	defer atomic.AddInt64(a.memory2, -int64(binlogEntry.Size()))
 
 	dbApplier := a.dbs[workerIdx]
 
@@ -558,8 +809,52 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 		}()
 	}
 
+	defer func() {
+		if sql.IsReadOnlyError(err) {
+			err = errors.Wrap(err, "a write landed on a read-only server. consider RequirePrimary for the dest connection")
+		}
+	}()
+	defer func() {
+		if err != nil && !binlogEntry.IsOneStmtDDL() {
+			// A source TX (including all parts of a big TX) is applied in one target TX on one worker.
+			// Rollback on error so that the TX is not partially applied and will be re-applied entirely.
+			_, errRollback := dbApplier.Db.ExecContext(context.Background(), "rollback")
+			if errRollback != nil {
+				logger.Warn("rollback after error failed", "gno", gno, "err", errRollback)
+			}
+		}
+	}()
+	// stats of tables are recorded only if the entry is applied, as it might be applied again on retrying.
+	var tableStats []func()
+	defer func() {
+		if err == nil {
+			for _, record := range tableStats {
+				record()
+			}
+		}
+	}()
+	// sql_mode changed by querySetNoAutoValueOnZero and not restored yet
+	sqlModeChanged := false
+	defer func() {
+		if sqlModeChanged {
+			// do not leave it on the session for later transactions
+			_, errRestore := dbApplier.Db.ExecContext(context.Background(), queryRestoreSqlMode)
+			if errRestore != nil {
+				logger.Warn("restore sql_mode after error failed", "gno", gno, "err", errRestore)
+			}
+		}
+	}()
+
 	if binlogEntry.Index == 0 && !binlogEntry.IsOneStmtDDL() {
-		_, err = dbApplier.Db.ExecContext(a.ctx, "begin")
+		if a.txOptions != nil {
+			// applies to the next transaction only
+			_, err = dbApplier.Db.ExecContext(a.ctx, fmt.Sprintf("set transaction isolation level %v",
+				strings.ToUpper(a.txOptions.Isolation.String())))
+			if err != nil {
+				return errors.Wrap(err, "set transaction isolation level")
+			}
+		}
+		_, err = dbApplier.Db.ExecContext(a.ctx, prefixSqlComment(a.mysqlContext.SqlCommentPrefix, "begin"))
 		if err != nil {
 			return err
 		}
@@ -567,7 +862,7 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 
 	execQuery := func(query string) error {
 		a.logger.Debug("execQuery", "query", query)
-		_, err = dbApplier.Db.ExecContext(a.ctx, query)
+		_, err = dbApplier.Db.ExecContext(a.ctx, prefixSqlComment(a.mysqlContext.SqlCommentPrefix, query))
 		if err != nil {
 			errCtx := errors.Wrapf(err, "tx.Exec. gno %v queryBegin %v workerIdx %v",
 				gno, g.StrLim(query, 10), workerIdx)
@@ -597,12 +892,60 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 		}
 	}
 
+	// consecutive deletes on a table with a single-column key are applied with IN-lists.
+	var pendingDeletes *bulkDelete
+	flushDeletes := func() error {
+		bulk := pendingDeletes
+		pendingDeletes = nil
+		if a.tableApplyTime != nil {
+			// rows are counted when queued
+			defer func(start time.Time) {
+				d := time.Since(start)
+				tableStats = append(tableStats, func() { a.tableApplyTime.add(bulk.schema, bulk.table, 0, d) })
+			}(time.Now())
+		}
+		if bulk.noFKCheck && a.toggleFKChecks() {
+			if _, err := dbApplier.Db.ExecContext(a.ctx, querySetFKChecksOff); err != nil {
+				return errors.Wrap(err, "querySetFKChecksOff")
+			}
+		}
+		for _, rows := range splitBulkDeleteRows(bulk.rows, bulk.keyIndex, a.maxAllowedPacket) {
+			query, args, err := sql.BuildDMLBulkDeleteQuery(bulk.schema, bulk.table,
+				bulk.tableItem.Columns, bulk.tableItem.ColumnMapTo, bulk.keyIndex, rows)
+			if err != nil {
+				return err
+			}
+			a.logger.Debug("BuildDMLBulkDeleteQuery", "query", g.StrLim(query, 256), "rows", len(rows))
+			err = queueOrExec(&dmlExecItem{false, nil, query, args, gno})
+			if err != nil {
+				return err
+			}
+		}
+		if bulk.noFKCheck && a.toggleFKChecks() {
+			if _, err := dbApplier.Db.ExecContext(a.ctx, querySetFKChecksOn); err != nil {
+				return errors.Wrap(err, "querySetFKChecksOn")
+			}
+		}
+		return nil
+	}
+
+	// table items are got before applying the entry. a DDL in the entry might reset them.
+	tableItemsReset := false
 	for i, event := range binlogEntry.Events {
 		if a.HasShutdown() {
 			break
 		}
 		logger.Debug("binlogEntry.Events", "gno", gno, "event", i)
 
+		// queued deletes are applied before a delete of another table or with other foreign_key_checks.
+		if pendingDeletes != nil && !(event.DML == common.DeleteDML &&
+			event.DatabaseName == pendingDeletes.schema && event.TableName == pendingDeletes.table &&
+			rowsEventNoFKCheck(&event) == pendingDeletes.noFKCheck) {
+			if err := flushDeletes(); err != nil {
+				return err
+			}
+		}
+
 		if event.DML == common.NotDML {
 			var err error
 			logger.Debug("not dml", "query", event.Query)
@@ -633,6 +976,7 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 				}
 				logger.Debug("reset tableItem", "schema", schema, "table", event.TableName)
 				a.getTableItem(schema, event.TableName).Reset()
+				tableItemsReset = true
 			} else { // TableName == ""
 				if event.DatabaseName != "" {
 					if schemaItem, ok := a.tableItems[event.DatabaseName]; ok {
@@ -642,6 +986,7 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 						}
 					}
 					delete(a.tableItems, event.DatabaseName)
+					tableItemsReset = true
 				}
 			}
 
@@ -649,20 +994,35 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 			if err != nil {
 				return err
 			}
-			if flag.NoForeignKeyChecks && a.mysqlContext.ForeignKeyChecks {
+			if flag.NoForeignKeyChecks && a.toggleFKChecks() {
 				err = execQuery(querySetFKChecksOff)
 				if err != nil {
 					return err
 				}
 			}
 
-			err = execQuery(event.Query)
+			query := event.Query
+			if a.mysqlContext.PrefetchDDLDependencies && event.DtleFlags&common.DtleFlagRawQuery == 0 {
+				err = a.createMissingFKParents(event.CurrentSchema, query, execQuery)
+				if err != nil {
+					return errors.Wrap(err, "createMissingFKParents")
+				}
+			}
+			if a.mysqlContext.IdempotentDDL && event.DtleFlags&common.DtleFlagRawQuery == 0 {
+				query = idempotentDDL(logger, query)
+			}
+			if err := checkGeneratedColumnsForTarget(logger, a.targetVersion, query); err != nil {
+				return err
+			}
+			err = a.ddlLimiter.Do(a.ctx, func() error {
+				return execQuery(stripTextBlobDefaultsForTarget(logger, a.targetVersion, query))
+			})
 			if err != nil {
 				return err
 			}
 			logger.Debug("Exec.after", "query", event.Query)
 
-			if flag.NoForeignKeyChecks && a.mysqlContext.ForeignKeyChecks {
+			if flag.NoForeignKeyChecks && a.toggleFKChecks() {
 				err = execQuery(querySetFKChecksOn)
 				if err != nil {
 					return err
@@ -671,14 +1031,8 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 		} else {
 			logger.Debug("a dml event")
 
-			flag := uint16(0)
-			if len(event.Flags) > 0 {
-				flag = binary.LittleEndian.Uint16(event.Flags)
-			} else {
-				// Oracle
-			}
-			noFKCheckFlag := flag&common.RowsEventFlagNoForeignKeyChecks != 0
-			if noFKCheckFlag && a.mysqlContext.ForeignKeyChecks {
+			noFKCheckFlag := rowsEventNoFKCheck(&event)
+			if noFKCheckFlag && a.toggleFKChecks() && a.changeSink == nil {
 				_, err = a.dbs[workerIdx].Db.ExecContext(a.ctx, querySetFKChecksOff)
 				if err != nil {
 					return errors.Wrap(err, "querySetFKChecksOff")
@@ -686,7 +1040,95 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 			}
 
 			tableItem := binlogEntryCtx.TableItems[i]
+			if tableItemsReset && tableItem != nil && tableItem.Columns == nil {
+				// the DDL might have changed column types. get the columns of the table again.
+				// prepared statements and checks built on the old columns are not reused.
+				tableItem, err = a.loadTableItem(event.DatabaseName, event.TableName)
+				if err != nil {
+					return err
+				}
+				binlogEntryCtx.TableItems[i] = tableItem
+			}
+			if len(a.mysqlContext.ApplyRowFilters) > 0 && tableItem.Columns != nil {
+				filter, err := a.getRowFilter(event.DatabaseName, event.TableName, tableItem)
+				if err != nil {
+					return err
+				}
+				if filter != nil {
+					// event is a copy. rows of the entry are kept as is.
+					event.Rows, err = filter.filterEventRows(&event)
+					if err != nil {
+						return errors.Wrapf(err, "ApplyRowFilters %v.%v", event.DatabaseName, event.TableName)
+					}
+				}
+			}
+			if a.mysqlContext.OnEncodingError != "" && tableItem.Columns != nil {
+				if check := a.getEncodingCheck(event.DatabaseName, event.TableName, tableItem); check != nil {
+					// event is a copy. rows of the entry are kept as is.
+					event.Rows, err = check.fixRowArgs(event.Rows)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			if a.columnEncryptor.hasTable(event.DatabaseName, event.TableName) {
+				columnNames := tableItem.ColumnMapTo
+				if len(columnNames) == 0 && tableItem.Columns != nil {
+					columnNames = tableItem.Columns.Names()
+				}
+				indexes := a.columnEncryptor.indexes(event.DatabaseName, event.TableName, columnNames)
+				if len(indexes) > 0 {
+					// event is a copy. rows of the entry are kept as is.
+					event.Rows = a.columnEncryptor.encryptRowArgs(event.Rows, indexes)
+				}
+			}
+			if tableItem.Columns != nil {
+				columnNames := tableItem.ColumnMapTo
+				if len(columnNames) == 0 {
+					columnNames = tableItem.Columns.Names()
+				}
+				columns := sridColumns(tableItem.Columns, columnNames)
+				if len(columns) > 0 {
+					err := checkRowArgsSRID(event.DatabaseName, event.TableName, event.Rows, columns)
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			if a.tableActivity != nil {
+				schema, table, now := event.DatabaseName, event.TableName, time.Now()
+				tableStats = append(tableStats, func() { a.tableActivity.add(schema, table, 1, now) })
+			}
+
+			if a.changeSink != nil {
+				if event.DtleFlags&common.DtleFlagPartialJSON != 0 {
+					return fmt.Errorf("partial JSON updates cannot be written to ChangeSink. set binlog_row_value_options='' on the source. %v.%v gno %v",
+						event.DatabaseName, event.TableName, gno)
+				}
+				nRows, err := applyEventToSink(a.changeSink, &event, tableItem)
+				if err != nil {
+					return errors.Wrapf(err, "ChangeSink %v.%v gno %v", event.DatabaseName, event.TableName, gno)
+				}
+				binlogEntryCtx.Rows += nRows
+				timestamp = event.Timestamp
+				atomic.AddUint64(&a.appliedQueryCount, uint64(1))
+				continue
+			}
+
+			// the source stored 0 with NO_AUTO_VALUE_ON_ZERO, which the target might not have.
+			zeroAutoInc := event.DML != common.DeleteDML && tableItem.Columns != nil &&
+				sql.HasZeroAutoIncrement(tableItem.Columns, tableItem.ColumnMapTo, event.Rows)
+			if zeroAutoInc {
+				_, err = a.dbs[workerIdx].Db.ExecContext(a.ctx, querySetNoAutoValueOnZero)
+				if err != nil {
+					return errors.Wrap(err, "querySetNoAutoValueOnZero")
+				}
+				sqlModeChanged = true
+			}
 
+			applyStart := time.Now()
+			rowsBefore := binlogEntryCtx.Rows
 			switch event.DML {
 			case common.InsertDML:
 				nRows := len(event.Rows)
@@ -726,6 +1168,38 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 				}
 			case common.DeleteDML:
 				binlogEntryCtx.Rows += len(event.Rows)
+				if softDelete := a.softDeletePolicy(&event); softDelete != nil {
+					for _, row := range event.Rows {
+						pstmt := &tableItem.PsSoftDelete[workerIdx]
+						query, uniqueKeyArgs, hasUK, err := sql.BuildDMLSoftDeleteQuery(event.DatabaseName,
+							event.TableName, tableItem.Columns, tableItem.ColumnMapTo, row,
+							softDelete.Column, softDelete.Value, softDelete.Where, *pstmt)
+						if err != nil {
+							return err
+						}
+						a.logger.Debug("BuildDMLSoftDeleteQuery", "query", query)
+
+						err = queueOrExec(&dmlExecItem{hasUK, pstmt, query, uniqueKeyArgs, gno})
+						if err != nil {
+							return err
+						}
+					}
+					break // from switch
+				}
+				if len(event.Rows) > 0 {
+					keyIndex := sql.BulkDeleteKeyIndex(tableItem.Columns, tableItem.ColumnMapTo, len(event.Rows[0]))
+					if keyIndex >= 0 {
+						bulk := pendingDeletes
+						if bulk == nil || bulk.schema != event.DatabaseName || bulk.table != event.TableName ||
+							bulk.noFKCheck != noFKCheckFlag {
+							bulk = &bulkDelete{schema: event.DatabaseName, table: event.TableName,
+								tableItem: tableItem, keyIndex: keyIndex, noFKCheck: noFKCheckFlag}
+						}
+						bulk.rows = append(bulk.rows, event.Rows...)
+						pendingDeletes = bulk
+						break // from switch
+					}
+				}
 				for _, row := range event.Rows {
 					pstmt := &tableItem.PsDelete[workerIdx]
 					query, uniqueKeyArgs, hasUK, err := sql.BuildDMLDeleteQuery(event.DatabaseName, event.TableName,
@@ -755,7 +1229,18 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 							len(event.Rows), gno)
 					}
 
-					if len(rowBefore) == 0 { // insert
+					var diffsRow []interface{}
+					if event.DtleFlags&common.DtleFlagPartialJSON != 0 && len(rowAfter) > 0 {
+						diffsRow, err = decodeRowJSONDiffs(rowAfter)
+						if err != nil {
+							return err
+						}
+					}
+
+					if len(rowBefore) == 0 && diffsRow != nil {
+						return fmt.Errorf("a partial JSON update cannot be applied as an insert. %v.%v gno %v",
+							event.DatabaseName, event.TableName, gno)
+					} else if len(rowBefore) == 0 { // insert
 						pstmt := &tableItem.PsInsert0[workerIdx]
 						query, sharedArgs, err := sql.BuildDMLInsertQuery(event.DatabaseName, event.TableName,
 							tableItem.Columns, tableItem.ColumnMapTo, event.Rows[i+1:i+2], *pstmt)
@@ -780,6 +1265,17 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 						if err != nil {
 							return err
 						}
+					} else if diffsRow != nil {
+						// the statement varies with the diffs and is not prepared.
+						query, sharedArgs, uniqueKeyArgs, _, err := sql.BuildDMLUpdateQuery(event.DatabaseName, event.TableName, tableItem.Columns, tableItem.ColumnMapTo, diffsRow, rowBefore, nil)
+						if err != nil {
+							return err
+						}
+
+						err = queueOrExec(&dmlExecItem{false, nil, query, append(sharedArgs, uniqueKeyArgs...), gno})
+						if err != nil {
+							return err
+						}
 					} else {
 						pstmt := &tableItem.PsUpdate[workerIdx]
 						query, sharedArgs, uniqueKeyArgs, hasUK, err := sql.BuildDMLUpdateQuery(event.DatabaseName, event.TableName, tableItem.Columns, tableItem.ColumnMapTo, rowAfter, rowBefore, *pstmt)
@@ -798,8 +1294,20 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 					}
 				}
 			}
+			if a.tableApplyTime != nil {
+				schema, table := event.DatabaseName, event.TableName
+				nRows, d := int64(binlogEntryCtx.Rows-rowsBefore), time.Since(applyStart)
+				tableStats = append(tableStats, func() { a.tableApplyTime.add(schema, table, nRows, d) })
+			}
 
-			if noFKCheckFlag && a.mysqlContext.ForeignKeyChecks {
+			if zeroAutoInc {
+				_, err = a.dbs[workerIdx].Db.ExecContext(a.ctx, queryRestoreSqlMode)
+				if err != nil {
+					return errors.Wrap(err, "queryRestoreSqlMode")
+				}
+				sqlModeChanged = false
+			}
+			if noFKCheckFlag && a.toggleFKChecks() {
 				_, err = a.dbs[workerIdx].Db.ExecContext(a.ctx, querySetFKChecksOn)
 				if err != nil {
 					return errors.Wrap(err, "querySetFKChecksOn")
@@ -810,6 +1318,11 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 		timestamp = event.Timestamp
 		atomic.AddUint64(&a.appliedQueryCount, uint64(1))
 	}
+	if pendingDeletes != nil && !a.HasShutdown() {
+		if err := flushDeletes(); err != nil {
+			return err
+		}
+	}
 	if a.inBigTx && !a.noBigTxDMLPipe {
 		a.logger.Info("a.bigTxEventWg.Wait before", "gno", gno, "index", binlogEntry.Index)
 	}
@@ -835,6 +1348,8 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 				logger.Debug("insert gno", "gno", gno, "rows", binlogEntryCtx.Rows)
 			}
 
+			// The GTID is recorded in the transaction of the data, so that a crash leaves both or
+			// neither. A one-statement DDL commits implicitly and its GTID is recorded after it.
 			_, err = dbApplier.PsInsertExecutedGtid.ExecContext(a.ctx,
 				a.subject, binlogEntry.Coordinates.GetSid().(uuid.UUID).Bytes(), gno)
 			if err != nil {
@@ -846,7 +1361,7 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 			logger.Info("committing tx", "gno", gno, "bigtx", isBigTx, "index", binlogEntry.Index,
 				"rows", binlogEntryCtx.Rows)
 		}
-		if _, err := dbApplier.Db.ExecContext(a.ctx, "commit"); err != nil {
+		if _, err := dbApplier.Db.ExecContext(a.ctx, prefixSqlComment(a.mysqlContext.SqlCommentPrefix, "commit")); err != nil {
 			return errors.Wrap(err, "dbApplier.Tx.Commit")
 		} else {
 			a.mtsManager.Executed(binlogEntry)
@@ -865,10 +1380,13 @@ func (a *ApplierIncr) ApplyBinlogEvent(workerIdx int, binlogEntryCtx *common.Ent
 	} else {
 		logger.Info("uncommitted bigtx part", "gno", gno, "index", binlogEntry.Index, "rows", binlogEntryCtx.Rows)
 	}
+	if err := a.sequenceLog.recordEntry(binlogEntry); err != nil {
+		return err
+	}
 	a.EntryExecutedHook(binlogEntry)
 
 	// no error
-	a.mysqlContext.Stage = common.StageWaitingForGtidToBeCommitted
+	a.setStage(common.StageWaitingForGtidToBeCommitted)
 	atomic.AddInt64(&a.TotalDeltaCopied, 1)
 	logger.Debug("event delay time", "timestamp", timestamp)
 	if timestamp != 0 {
@@ -888,7 +1406,8 @@ func (a *ApplierIncr) getTableItem(schema string, table string) *common.ApplierT
 	if !ok {
 		tableItem = common.NewApplierTableItem(a.mysqlContext.ParallelWorkers)
 		for _, tableSpec := range a.tableSpecs {
-			if tableSpec.Schema == schema && tableSpec.Table == table {
+			// schema is of the target, while tableSpec is of the source (before SchemaRenameMap).
+			if renameSchema(a.mysqlContext.SchemaRenameMap, tableSpec.Schema) == schema && tableSpec.Table == table {
 				tableItem.ColumnMapTo = tableSpec.ColumnMapTo
 			}
 		}
@@ -901,7 +1420,6 @@ func (a *ApplierIncr) getTableItem(schema string, table string) *common.ApplierT
 type mapSchemaTableItems map[string](map[string](*common.ApplierTableItem))
 
 func (a *ApplierIncr) setTableItemForBinlogEntry(binlogEntry *common.EntryContext) error {
-	var err error
 	binlogEntry.TableItems = make([]*common.ApplierTableItem, len(binlogEntry.Entry.Events))
 
 	for i := range binlogEntry.Entry.Events {
@@ -910,35 +1428,214 @@ func (a *ApplierIncr) setTableItemForBinlogEntry(binlogEntry *common.EntryContex
 		case common.NotDML:
 			// do nothing
 		default:
-			tableItem := a.getTableItem(dmlEvent.DatabaseName, dmlEvent.TableName)
-			if tableItem.Columns == nil {
-				a.logger.Debug("get tableColumns", "schema", dmlEvent.DatabaseName, "table", dmlEvent.TableName)
-				tableItem.Columns, err = base.GetTableColumns(a.db, dmlEvent.DatabaseName, dmlEvent.TableName)
+			tableItem, err := a.loadTableItem(dmlEvent.DatabaseName, dmlEvent.TableName)
+			if err != nil {
+				return err
+			}
+			binlogEntry.TableItems[i] = tableItem
+		}
+	}
+	return nil
+}
+
+// loadTableItem returns the table item with the columns of the target table, got on the first use.
+func (a *ApplierIncr) loadTableItem(schema, table string) (*common.ApplierTableItem, error) {
+	tableItem := a.getTableItem(schema, table)
+	if tableItem.Columns != nil {
+		a.logger.Debug("reuse tableColumns", "schema", schema, "table", table)
+		return tableItem, nil
+	}
+
+	var err error
+	a.logger.Debug("get tableColumns", "schema", schema, "table", table)
+	tableItem.Columns, err = base.GetTableColumns(a.db, schema, table)
+	if err != nil {
+		err = errors.Wrapf(err, "GetTableColumns. %v %v", schema, table)
+		a.logger.Error(err.Error())
+		return nil, err
+	}
+	uk, err := base.GetCandidateUniqueKeys(a.logger, a.db, schema, table, tableItem.Columns)
+	if err != nil {
+		return nil, err
+	}
+	tableItem.Columns.UniqueKeys = uk
+	err = base.ApplyColumnTypes(a.db, schema, table, tableItem.Columns)
+	if err != nil {
+		err = errors.Wrapf(err, "ApplyColumnTypes. %v %v", schema, table)
+		a.logger.Error(err.Error())
+		return nil, err
+	}
+	return tableItem, nil
+}
+
+// handleUnparseableDDL handles DDL which cannot be parsed according to OnUnparseableDDL.
+// Skipped DDL is removed from the entry. DDL to be applied as is gets DtleFlagRawQuery.
+func (a *ApplierIncr) handleUnparseableDDL(binlogEntry *common.DataEntry) error {
+	policy := a.mysqlContext.OnUnparseableDDL
+	if (policy == "" || policy == common.OnUnparseableDDLApplyRaw) && len(a.mysqlContext.SchemaRenameMap) == 0 {
+		// DDL is not rewritten. nothing to do.
+		return nil
+	}
+
+	events := binlogEntry.Events[:0]
+	for i := range binlogEntry.Events {
+		event := binlogEntry.Events[i]
+		if event.DML == common.NotDML && event.Query != "" {
+			if _, err := parser.New().ParseOneStmt(event.Query, "", ""); err != nil {
+				keep, err := a.onUnparseableDDL(&event, err)
 				if err != nil {
-					err = errors.Wrapf(err, "GetTableColumns. %v %v", dmlEvent.DatabaseName, dmlEvent.TableName)
-					a.logger.Error(err.Error())
 					return err
 				}
-				uk, err := base.GetCandidateUniqueKeys(a.logger, a.db, dmlEvent.DatabaseName, dmlEvent.TableName, tableItem.Columns)
-				if err != nil {
-					return err
+				if !keep {
+					continue
 				}
-				tableItem.Columns.UniqueKeys = uk
-				err = base.ApplyColumnTypes(a.db, dmlEvent.DatabaseName, dmlEvent.TableName, tableItem.Columns)
+			}
+		}
+		events = append(events, event)
+	}
+	binlogEntry.Events = events
+	return nil
+}
+
+// onUnparseableDDL applies OnUnparseableDDL to a DDL event which cannot be parsed or rewritten.
+// It returns false if the event is to be skipped.
+func (a *ApplierIncr) onUnparseableDDL(event *common.DataEvent, err error) (bool, error) {
+	switch a.mysqlContext.OnUnparseableDDL {
+	case common.OnUnparseableDDLFail:
+		return false, errors.Wrapf(err, "cannot parse DDL %v", g.StrLim(event.Query, 256))
+	case common.OnUnparseableDDLSkip:
+		a.logger.Warn("skip a DDL which cannot be parsed", "err", err, "query", g.StrLim(event.Query, 256))
+		return false, nil
+	default:
+		a.logger.Warn("cannot parse a DDL. apply it as is", "err", err, "query", g.StrLim(event.Query, 256))
+		event.DtleFlags |= common.DtleFlagRawQuery
+		return true, nil
+	}
+}
+
+// getRowFilter returns the filter of ApplyRowFilters for the table, built again if the columns
+// of the table have been reloaded (e.g. after a DDL).
+func (a *ApplierIncr) getRowFilter(schema, table string, tableItem *common.ApplierTableItem) (*rowFilter, error) {
+	key := fmt.Sprintf("%v.%v", schema, table)
+	filter, ok := a.rowFilters[key]
+	if ok && (filter == nil || filter.targetColumns == tableItem.Columns) {
+		return filter, nil
+	}
+	columnNames := tableItem.ColumnMapTo
+	if len(columnNames) == 0 {
+		columnNames = tableItem.Columns.Names()
+	}
+	filter, err := newRowFilter(a.mysqlContext.ApplyRowFilters, schema, table, columnNames, tableItem.Columns)
+	if err != nil {
+		return nil, err
+	}
+	if a.rowFilters == nil {
+		a.rowFilters = make(map[string]*rowFilter)
+	}
+	a.rowFilters[key] = filter
+	return filter, nil
+}
+
+// getEncodingCheck returns the check of OnEncodingError for the table, built again if the columns
+// have been reloaded.
+func (a *ApplierIncr) getEncodingCheck(schema, table string, tableItem *common.ApplierTableItem) *encodingCheck {
+	key := fmt.Sprintf("%v.%v", schema, table)
+	if check, ok := a.encodingChecks[key]; ok && a.encodingCheckColumns[key] == tableItem.Columns {
+		return check
+	}
+	columnNames := tableItem.ColumnMapTo
+	if len(columnNames) == 0 {
+		columnNames = tableItem.Columns.Names()
+	}
+	check := newEncodingCheck(a.mysqlContext.OnEncodingError, schema, table, columnNames, tableItem.Columns)
+	if a.encodingChecks == nil {
+		a.encodingChecks = make(map[string]*encodingCheck)
+		a.encodingCheckColumns = make(map[string]*common.ColumnList)
+	}
+	a.encodingChecks[key] = check
+	a.encodingCheckColumns[key] = tableItem.Columns
+	return check
+}
+
+// newSourceUUIDFilter returns the set of source UUIDs (in lower case) of FilterBySourceUUID.
+func newSourceUUIDFilter(uuids []string) (map[string]struct{}, error) {
+	if len(uuids) == 0 {
+		return nil, nil
+	}
+	r := make(map[string]struct{}, len(uuids))
+	for _, s := range uuids {
+		u, err := uuid.FromString(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("FilterBySourceUUID: bad UUID %v: %v", s, err)
+		}
+		r[u.String()] = struct{}{}
+	}
+	return r, nil
+}
+
+// filterUnconfiguredTables drops DML events of tables not in ReplicateDoDb, according to StrictTableFilter.
+func (a *ApplierIncr) filterUnconfiguredTables(binlogEntry *common.DataEntry) {
+	policy := a.mysqlContext.StrictTableFilter
+	if policy == "" || policy == common.StrictTableFilterOff || len(a.mysqlContext.ReplicateDoDb) == 0 {
+		return
+	}
+
+	events := binlogEntry.Events[:0]
+	for i := range binlogEntry.Events {
+		event := binlogEntry.Events[i]
+		if event.DML != common.NotDML &&
+			!common.MatchReplicateDoDb(a.mysqlContext.ReplicateDoDb, event.DatabaseName, event.TableName) {
+			atomic.AddInt64(&a.droppedEvents, 1)
+			key := fmt.Sprintf("%v.%v", event.DatabaseName, event.TableName)
+			if _, warned := a.warnedTables[key]; policy != common.StrictTableFilterWarnOnce || !warned {
+				a.warnedTables[key] = struct{}{}
+				a.logger.Warn("drop an event of a table not in ReplicateDoDb",
+					"schema", event.DatabaseName, "table", event.TableName,
+					"gno", binlogEntry.Coordinates.GetGNO())
+			}
+			continue
+		}
+		events = append(events, event)
+	}
+	binlogEntry.Events = events
+}
+
+// renameSchemaForBinlogEntry renames schemas of the entry according to SchemaRenameMap.
+// DDL which cannot be rewritten is handled according to OnUnparseableDDL.
+func (a *ApplierIncr) renameSchemaForBinlogEntry(binlogEntry *common.DataEntry) error {
+	schemaRenameMap := a.mysqlContext.SchemaRenameMap
+	events := binlogEntry.Events[:0]
+	for i := range binlogEntry.Events {
+		event := binlogEntry.Events[i]
+		event.DatabaseName = renameSchema(schemaRenameMap, event.DatabaseName)
+		event.CurrentSchema = renameSchema(schemaRenameMap, event.CurrentSchema)
+		if event.DML == common.NotDML && event.DtleFlags&common.DtleFlagRawQuery == 0 {
+			query, err := base.RenameSchemaInQuery(event.Query, schemaRenameMap)
+			if err != nil {
+				keep, err := a.onUnparseableDDL(&event, err)
 				if err != nil {
-					err = errors.Wrapf(err, "ApplyColumnTypes. %v %v", dmlEvent.DatabaseName, dmlEvent.TableName)
-					a.logger.Error(err.Error())
 					return err
 				}
+				if !keep {
+					continue
+				}
 			} else {
-				a.logger.Debug("reuse tableColumns", "schema", dmlEvent.DatabaseName, "table", dmlEvent.TableName)
+				event.Query = query
 			}
-			binlogEntry.TableItems[i] = tableItem
 		}
+		events = append(events, event)
 	}
+	binlogEntry.Events = events
 	return nil
 }
 
+func renameSchema(schemaRenameMap map[string]string, schema string) string {
+	if newSchema, ok := schemaRenameMap[schema]; ok {
+		return newSchema
+	}
+	return schema
+}
+
 func (a *ApplierIncr) handleEntryOracle(entryCtx *common.EntryContext) (err error) {
 	err = a.setTableItemForBinlogEntry(entryCtx)
 	if err != nil {
@@ -960,6 +1657,83 @@ func (a *ApplierIncr) Shutdown() {
 	a.logger.Debug("Shutdown. ApplierIncr.wg.Wait. after")
 }
 
+// rowsEventNoFKCheck returns true if the rows event is logged with foreign_key_checks=0.
+func rowsEventNoFKCheck(event *common.DataEvent) bool {
+	flag := uint16(0)
+	if len(event.Flags) > 0 {
+		flag = binary.LittleEndian.Uint16(event.Flags)
+	} else {
+		// Oracle
+	}
+	return flag&common.RowsEventFlagNoForeignKeyChecks != 0
+}
+
+type bulkDelete struct {
+	schema    string
+	table     string
+	tableItem *common.ApplierTableItem
+	keyIndex  int
+	noFKCheck bool
+	rows      [][]interface{}
+}
+
+const (
+	// a prepared statement takes at most 65535 placeholders
+	bulkDeleteMaxRows = 10000
+	// per-row bytes besides the key value in the query and the execute packet
+	bulkDeleteRowOverhead = 16
+)
+
+// splitBulkDeleteRows splits rows so that a bulk delete does not exceed maxAllowedPacket.
+func splitBulkDeleteRows(rows [][]interface{}, keyIndex int, maxAllowedPacket int64) (r [][][]interface{}) {
+	if maxAllowedPacket <= 0 {
+		maxAllowedPacket = defaultMaxAllowedPacket
+	}
+	// leave a half for the statement and protocol overheads
+	limit := maxAllowedPacket / 2
+
+	start := 0
+	size := int64(0)
+	for i, row := range rows {
+		rowSize := int64(bulkDeleteRowOverhead)
+		switch v := row[keyIndex].(type) {
+		case []byte:
+			rowSize += int64(len(v))
+		case string:
+			rowSize += int64(len(v))
+		default:
+			rowSize += 8
+		}
+		if i > start && (size+rowSize > limit || i-start >= bulkDeleteMaxRows) {
+			r = append(r, rows[start:i])
+			start = i
+			size = 0
+		}
+		size += rowSize
+	}
+	return append(r, rows[start:])
+}
+
+// decodeRowJSONDiffs returns a copy of the row with the diffs of partial JSON updates decoded,
+// or nil if there is no diff.
+func decodeRowJSONDiffs(row []interface{}) ([]interface{}, error) {
+	var newRow []interface{}
+	for i := range row {
+		diffs, ok, err := common.DecodeJSONDiffs(row[i])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if newRow == nil {
+			newRow = append([]interface{}{}, row...)
+		}
+		newRow[i] = diffs
+	}
+	return newRow, nil
+}
+
 type dmlExecItem struct {
 	hasUK bool
 	pstmt **gosql.Stmt
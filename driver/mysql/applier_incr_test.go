@@ -1,2 +1,1154 @@
 package mysql
 
+import (
+	"context"
+	gosql "database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/actiontech/dtle/driver/mysql/base"
+	"github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+	"github.com/actiontech/dtle/driver/mysql/sql"
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-sql-driver/mysql"
+	hclog "github.com/hashicorp/go-hclog"
+	uuid "github.com/satori/go.uuid"
+)
+
+func newTestApplierIncr(t *testing.T) (*ApplierIncr, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memory := int64(0)
+	shutdownCh := make(chan struct{})
+	a := &ApplierIncr{
+		logger:                hclog.NewNullLogger(),
+		mysqlContext:          &common.MySQLDriverConfig{},
+		dbs:                   []*sql.Conn{{DbMutex: &sync.Mutex{}, Db: conn}},
+		ctx:                   context.Background(),
+		shutdownCh:            shutdownCh,
+		memory2:               &memory,
+		SkipGtidExecutedTable: true,
+		mtsManager:            NewMtsManager(shutdownCh, hclog.NewNullLogger()),
+		EntryExecutedHook:     func(entry *common.DataEntry) {},
+		warnedTables:          make(map[string]struct{}),
+	}
+	return a, mock
+}
+
+func TestApplyBinlogEventRollbackOnError(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 10, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.NotDML, Query: "update a.t1 set c = 1"},
+			{DML: common.NotDML, Query: "update a.t2 set c = 1"},
+		},
+		Final: true,
+	}
+
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("update a.t1 set c = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	// the applier crashes between the two parts of the source TX
+	mock.ExpectExec("update a.t2 set c = 1").WillReturnError(fmt.Errorf("connection lost"))
+	mock.ExpectExec("rollback").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry})
+	if err == nil {
+		t.Fatalf("expect error")
+	}
+	// no commit: the TX is neither partially applied nor marked as executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// after restarting, the whole TX is applied again
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("update a.t1 set c = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("update a.t2 set c = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq := <-executed; seq != 1 {
+		t.Errorf("executed seq %v, expect 1", seq)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyBinlogEventTxIsolationLevel(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+	a.txOptions = &gosql.TxOptions{Isolation: gosql.LevelReadCommitted}
+
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 11, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.NotDML, Query: "update a.t1 set c = 1"},
+			{DML: common.NotDML, Query: "update a.t2 set c = 1"},
+		},
+		Final: true,
+	}
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	mock.ExpectExec("set transaction isolation level READ COMMITTED").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("update a.t1 set c = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("update a.t2 set c = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry}); err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyBinlogEventBulkDelete(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+
+	newTableItem := func(columns ...mysqlconfig.Column) *common.ApplierTableItem {
+		tableItem := common.NewApplierTableItem(1)
+		tableItem.Columns = common.NewColumnList(columns)
+		return tableItem
+	}
+	singleKey := newTableItem(
+		mysqlconfig.Column{RawName: "id", EscapedName: "`id`", Key: "PRI"},
+		mysqlconfig.Column{RawName: "c", EscapedName: "`c`"})
+	compositeKey := newTableItem(
+		mysqlconfig.Column{RawName: "id1", EscapedName: "`id1`", Key: "PRI"},
+		mysqlconfig.Column{RawName: "id2", EscapedName: "`id2`", Key: "PRI"})
+
+	// a single-column-key table in two rows events, then a composite-key table
+	var rows1, rows2 [][]interface{}
+	var args []driver.Value
+	var placeholders []string
+	for i := 0; i < 100; i++ {
+		row := []interface{}{int64(i), "x"}
+		if i < 60 {
+			rows1 = append(rows1, row)
+		} else {
+			rows2 = append(rows2, row)
+		}
+		args = append(args, int64(i))
+		placeholders = append(placeholders, "?")
+	}
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 12, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.DeleteDML, DatabaseName: "a", TableName: "t1", Rows: rows1},
+			{DML: common.DeleteDML, DatabaseName: "a", TableName: "t1", Rows: rows2},
+			{DML: common.DeleteDML, DatabaseName: "a", TableName: "t2", Rows: [][]interface{}{{int64(1), int64(2)}}},
+		},
+		Final: true,
+	}
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf("delete from `a`.`t1` where `id` in (%v)",
+		strings.Join(placeholders, ",")))).WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, 100))
+	mock.ExpectPrepare("delete from `a`.`t2`").
+		ExpectExec().WithArgs(int64(1), int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry,
+		TableItems: []*common.ApplierTableItem{singleKey, singleKey, compositeKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyBinlogEventBulkDeleteFKChecks(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+	a.mysqlContext.ForeignKeyChecks = true
+
+	tableItem := common.NewApplierTableItem(1)
+	tableItem.Columns = common.NewColumnList([]mysqlconfig.Column{
+		{RawName: "id", EscapedName: "`id`", Key: "PRI"},
+		{RawName: "c", EscapedName: "`c`"}})
+
+	noFKCheck := make([]byte, 2)
+	binary.LittleEndian.PutUint16(noFKCheck, common.RowsEventFlagNoForeignKeyChecks)
+	// two deletes of a table differing only in foreign_key_checks
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 12, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.DeleteDML, DatabaseName: "a", TableName: "t1", Rows: [][]interface{}{{int64(1), "x"}}},
+			{DML: common.DeleteDML, DatabaseName: "a", TableName: "t1", Rows: [][]interface{}{{int64(2), "y"}},
+				Flags: noFKCheck},
+		},
+		Final: true,
+	}
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	// the rows of the first event are applied with foreign_key_checks on, before the second event.
+	mock.ExpectExec(regexp.QuoteMeta("delete from `a`.`t1` where `id` in (?)")).
+		WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(querySetFKChecksOff)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(querySetFKChecksOn)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(querySetFKChecksOff)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("delete from `a`.`t1` where `id` in (?)")).
+		WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(querySetFKChecksOn)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry,
+		TableItems: []*common.ApplierTableItem{tableItem, tableItem}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyBinlogEventRowFilterUpdate(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+	a.mysqlContext.ApplyRowFilters = map[string]string{"a.t1": "c >= 100"}
+
+	tableItem := common.NewApplierTableItem(1)
+	tableItem.Columns = common.NewColumnList([]mysqlconfig.Column{
+		{RawName: "id", EscapedName: "`id`", Key: "PRI", Type: mysqlconfig.IntColumnType},
+		{RawName: "c", EscapedName: "`c`", Type: mysqlconfig.IntColumnType}})
+
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 12, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.UpdateDML, DatabaseName: "a", TableName: "t1", Rows: [][]interface{}{
+				{int64(1), int64(200)}, {int64(1), int64(20)}, // out of the filter
+				{int64(2), int64(20)}, {int64(2), int64(200)}, // into the filter
+			}},
+		},
+		Final: true,
+	}
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("delete from `a`.`t1`").
+		ExpectExec().WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare("replace into `a`.`t1`").
+		ExpectExec().WithArgs(int64(2), int64(200)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry,
+		TableItems: []*common.ApplierTableItem{tableItem}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyBinlogEventPartialJSON(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+
+	tableItem := common.NewApplierTableItem(1)
+	tableItem.Columns = common.NewColumnList([]mysqlconfig.Column{
+		{RawName: "id", EscapedName: "`id`", Key: "PRI", Type: mysqlconfig.IntColumnType},
+		{RawName: "j", EscapedName: "`j`", Type: mysqlconfig.JSONColumnType}})
+
+	diffs, err := common.EncodeJSONDiffs([]common.JSONDiff{
+		{Op: common.JSONDiffReplace, Path: "$[0]", Value: "2"},
+		{Op: common.JSONDiffRemove, Path: "$[1]"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 12, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.UpdateDML, DatabaseName: "a", TableName: "t1", DtleFlags: common.DtleFlagPartialJSON,
+				Rows: [][]interface{}{{int64(1), "[1, 2]"}, {int64(1), diffs}}},
+		},
+		Final: true,
+	}
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	// the same as a full update of `j` to [2]
+	mock.ExpectExec(regexp.QuoteMeta("`j`=json_remove(json_replace(`j`, ?, cast(? as json)), ?)")).
+		WithArgs(int64(1), "$[0]", "2", "$[1]", int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry,
+		TableItems: []*common.ApplierTableItem{tableItem}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if entry.Events[0].Rows[1][1] != diffs {
+		t.Errorf("the entry is modified")
+	}
+}
+
+func TestApplyBinlogEventZeroAutoIncrement(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+	a.mysqlContext.BulkInsert1, a.mysqlContext.BulkInsert2, a.mysqlContext.BulkInsert3 = 4, 8, 128
+
+	tableItem := common.NewApplierTableItem(1)
+	tableItem.Columns = common.NewColumnList([]mysqlconfig.Column{
+		{RawName: "id", EscapedName: "`id`", Key: "PRI", ColumnType: "int", AutoIncrement: true},
+		{RawName: "c", EscapedName: "`c`"}})
+
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 13, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.InsertDML, DatabaseName: "a", TableName: "t1", Rows: [][]interface{}{{int64(0), "x"}}},
+			{DML: common.InsertDML, DatabaseName: "a", TableName: "t1", Rows: [][]interface{}{{int64(1), "y"}}},
+		},
+		Final: true,
+	}
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	// the explicit 0 is sent with NO_AUTO_VALUE_ON_ZERO, then sql_mode is restored.
+	mock.ExpectExec(regexp.QuoteMeta(querySetNoAutoValueOnZero)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("replace into `a`.`t1`").
+		ExpectExec().WithArgs(int64(0), "x").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(queryRestoreSqlMode)).WillReturnResult(sqlmock.NewResult(0, 0))
+	// a non-zero value does not touch sql_mode.
+	mock.ExpectExec("replace into `a`.`t1`").WithArgs(int64(1), "y").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry,
+		TableItems: []*common.ApplierTableItem{tableItem, tableItem}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyBinlogEventZeroAutoIncrementError(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+	a.mysqlContext.BulkInsert1, a.mysqlContext.BulkInsert2, a.mysqlContext.BulkInsert3 = 4, 8, 128
+
+	tableItem := common.NewApplierTableItem(1)
+	tableItem.Columns = common.NewColumnList([]mysqlconfig.Column{
+		{RawName: "id", EscapedName: "`id`", Key: "PRI", ColumnType: "int", AutoIncrement: true},
+		{RawName: "c", EscapedName: "`c`"}})
+
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 13, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.InsertDML, DatabaseName: "a", TableName: "t1", Rows: [][]interface{}{{int64(0), "x"}}},
+		},
+		Final: true,
+	}
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(querySetNoAutoValueOnZero)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("replace into `a`.`t1`").
+		ExpectExec().WithArgs(int64(0), "x").WillReturnError(fmt.Errorf("lock wait timeout"))
+	// sql_mode is restored on error, as the session is kept for later transactions.
+	mock.ExpectExec(regexp.QuoteMeta(queryRestoreSqlMode)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("rollback").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry,
+		TableItems: []*common.ApplierTableItem{tableItem}})
+	if err == nil {
+		t.Fatal("expect an error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyBinlogEventKeepForeignKeyChecks(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		a, mock := newTestApplierIncr(t)
+		a.mysqlContext.BulkInsert1, a.mysqlContext.BulkInsert2, a.mysqlContext.BulkInsert3 = 4, 8, 128
+		tableItem := common.NewApplierTableItem(1)
+		tableItem.Columns = common.NewColumnList([]mysqlconfig.Column{
+			{RawName: "id", EscapedName: "`id`", Key: "PRI"}, {RawName: "c", EscapedName: "`c`"}})
+		a.mysqlContext.ForeignKeyChecks = true
+		a.mysqlContext.KeepForeignKeyChecks = keep
+
+		// the row was written with foreign_key_checks = 0 on the source
+		flags := make([]byte, 2)
+		binary.LittleEndian.PutUint16(flags, common.RowsEventFlagNoForeignKeyChecks)
+		entry := &common.DataEntry{
+			Coordinates: &common.MySQLCoordinateTx{GNO: 15, SeqenceNumber: 1},
+			Events: []common.DataEvent{{DML: common.InsertDML, DatabaseName: "a", TableName: "t1",
+				Flags: flags, Rows: [][]interface{}{{int64(1), "x"}}}},
+			Final: true,
+		}
+		executed := make(chan int64, 1)
+		go func() {
+			executed <- <-a.mtsManager.chExecuted
+		}()
+		mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+		if !keep {
+			mock.ExpectExec(regexp.QuoteMeta(querySetFKChecksOff)).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectPrepare("replace into `a`.`t1`").
+			ExpectExec().WithArgs(int64(1), "x").WillReturnResult(sqlmock.NewResult(0, 1))
+		if !keep {
+			mock.ExpectExec(regexp.QuoteMeta(querySetFKChecksOn)).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry,
+			TableItems: []*common.ApplierTableItem{tableItem}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-executed
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("KeepForeignKeyChecks %v: %v", keep, err)
+		}
+	}
+}
+
+func TestApplyBinlogEventColumnTypeChanged(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+	a.mysqlContext.BulkInsert1, a.mysqlContext.BulkInsert2, a.mysqlContext.BulkInsert3 = 4, 8, 128
+	metaDB, metaMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer metaDB.Close()
+	a.db = metaDB
+	a.mysqlContext.ParallelWorkers = 1
+	a.tableItems = make(mapSchemaTableItems)
+
+	// columns got before the entry is applied
+	tableItem := a.getTableItem("a", "t1")
+	tableItem.Columns = common.NewColumnList([]mysqlconfig.Column{
+		{RawName: "id", EscapedName: "`id`", Key: "PRI", ColumnType: "int"},
+		{RawName: "c", EscapedName: "`c`", ColumnType: "int"}})
+
+	// e.g. an entry of Oracle, which might have both DDL and DML
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 15, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.NotDML, DatabaseName: "a", TableName: "t1",
+				Query: "alter table a.t1 modify c int unsigned"},
+			{DML: common.InsertDML, DatabaseName: "a", TableName: "t1",
+				Rows: [][]interface{}{{int32(1), int32(-1)}}},
+		},
+		Final: true,
+	}
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("alter table a.t1 modify c int unsigned").WillReturnResult(sqlmock.NewResult(0, 0))
+	metaMock.ExpectQuery("show columns from `a`.`t1`").WillReturnRows(
+		sqlmock.NewRows([]string{"Field", "Type", "Null", "Key", "Default", "Extra"}).
+			AddRow("id", "int(11)", "NO", "PRI", nil, "").
+			AddRow("c", "int(10) unsigned", "YES", "", nil, ""))
+	metaMock.ExpectQuery("SELECT COUNT").WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+	metaMock.ExpectQuery("SELECT UNIQUES.INDEX_NAME").WillReturnRows(
+		sqlmock.NewRows([]string{"INDEX_NAME", "COLUMN_NAMES", "is_auto_increment", "has_nullable", "is_invisible"}).
+			AddRow("PRIMARY", "id", 0, 0, 0))
+	metaMock.ExpectQuery("information_schema.columns").WithArgs("a", "t1").WillReturnRows(
+		sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "DATETIME_PRECISION"}).
+			AddRow("id", "int(11)", nil).
+			AddRow("c", "int(10) unsigned", nil))
+	// the row is applied with the new type
+	mock.ExpectPrepare("replace into `a`.`t1`").
+		ExpectExec().WithArgs(int32(1), uint32(4294967295)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	entryCtx := &common.EntryContext{Entry: entry, TableItems: []*common.ApplierTableItem{nil, tableItem}}
+	if err := a.ApplyBinlogEvent(0, entryCtx); err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if err := metaMock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if c := a.getTableItem("a", "t1").Columns.GetColumn("c"); c == nil || !c.IsUnsigned {
+		t.Errorf("expect the new columns to be kept for later entries. got %+v", c)
+	}
+}
+
+func TestApplyEntryWithTableRetryPolicy(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: sql.ErrLockDeadlock, Message: "Deadlock found when trying to get lock"}
+	tableItem := common.NewApplierTableItem(1)
+	tableItem.Columns = common.NewColumnList([]mysqlconfig.Column{
+		{RawName: "id", EscapedName: "`id`", Key: "PRI"}})
+
+	// applies a delete on the table, failing with a deadlock nDeadlocks times.
+	apply := func(table string, nDeadlocks int) (ok bool, onErrorCalled bool) {
+		a, mock := newTestApplierIncr(t)
+		a.mysqlContext.TableRetryPolicies = map[string]*common.TableRetryPolicy{
+			"a.hot": {MaxRetries: 5, RetryIntervalMs: 1, MaxRetryIntervalMs: 4},
+		}
+		// the global default: a single retry.
+		a.OnErrorRetry = func(state int, err error, retry func() error) bool {
+			if retry != nil && sql.IsTransientError(err) && retry() == nil {
+				return true
+			}
+			onErrorCalled = true
+			return false
+		}
+		a.OnError = func(state int, err error) {
+			onErrorCalled = true
+		}
+		go func() {
+			<-a.mtsManager.chExecuted
+		}()
+
+		query := regexp.QuoteMeta(fmt.Sprintf("delete from `a`.`%v` where `id` in (?)", table))
+		for i := 0; i < nDeadlocks; i++ {
+			mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(query).WillReturnError(deadlock)
+			mock.ExpectExec("rollback").WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		entry := &common.DataEntry{
+			Coordinates: &common.MySQLCoordinateTx{GNO: 14, SeqenceNumber: 1},
+			Events: []common.DataEvent{
+				{DML: common.DeleteDML, DatabaseName: "a", TableName: table, Rows: [][]interface{}{{int64(1)}}},
+			},
+			Final: true,
+		}
+		a.tableActivity, a.tableApplyTime = newTableActivity(), newTableApplyTime()
+		*a.memory2 = int64(entry.Size())
+		ok = a.applyEntryWithRetry(0, &common.EntryContext{Entry: entry,
+			TableItems: []*common.ApplierTableItem{tableItem}})
+		// failed attempts are not counted
+		if activity := a.tableActivity.top(1, time.Now()); ok && (len(activity) != 1 || activity[0].TotalEvents != 1) {
+			t.Errorf("%v: table activity %+v, want 1 event", table, activity)
+		}
+		if applyTime := a.tableApplyTime.slowest(1); ok && (len(applyTime) != 1 || applyTime[0].Rows != 1) {
+			t.Errorf("%v: table apply time %+v, want 1 row", table, applyTime)
+		}
+		if m := atomic.LoadInt64(a.memory2); m != 0 {
+			t.Errorf("%v: memory2 = %v after applying, want 0", table, m)
+		}
+		return ok, onErrorCalled
+	}
+
+	if ok, onErrorCalled := apply("cold", 1); !ok || onErrorCalled {
+		t.Errorf("cold table: expect recovered from 1 deadlock with the default")
+	}
+	if ok, onErrorCalled := apply("cold", 3); ok || !onErrorCalled {
+		t.Errorf("cold table: expect failure on 3 deadlocks with the default")
+	}
+	if ok, onErrorCalled := apply("hot", 5); !ok || onErrorCalled {
+		t.Errorf("hot table: expect recovered from 5 deadlocks with its policy")
+	}
+	if ok, onErrorCalled := apply("hot", 6); ok || !onErrorCalled {
+		t.Errorf("hot table: expect failure on 6 deadlocks")
+	}
+}
+
+func TestApplyBinlogEventIdempotentDDL(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+	a.mysqlContext.IdempotentDDL = true
+
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 15, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.NotDML, CurrentSchema: "a", Query: "create table t1 (id int)"},
+			{DML: common.NotDML, CurrentSchema: "a", Query: "drop table t2"},
+		},
+		Final: true,
+	}
+	// replayed after a restart. the second run must not fail on existing/missing tables.
+	for i := 0; i < 2; i++ {
+		executed := make(chan int64, 1)
+		go func() {
+			executed <- <-a.mtsManager.chExecuted
+		}()
+		mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("USE `a`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS `t1` (`id` INT)")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("USE `a`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS `t2`")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+		if err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry}); err != nil {
+			t.Fatalf("run %v: %v", i, err)
+		}
+		<-executed
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("run %v: %v", i, err)
+		}
+	}
+}
+
+func TestApplyBinlogEventSqlCommentPrefix(t *testing.T) {
+	const prefix = "/*+ route_to_master */"
+	a, mock := newTestApplierIncr(t)
+	a.mysqlContext.SqlCommentPrefix = prefix
+
+	tableItem := common.NewApplierTableItem(1)
+	tableItem.Columns = common.NewColumnList([]mysqlconfig.Column{
+		{RawName: "id", EscapedName: "`id`", Key: "PRI"}})
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 16, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.NotDML, Query: "update a.t1 set c = 1"},
+			{DML: common.DeleteDML, DatabaseName: "a", TableName: "t2", Rows: [][]interface{}{{int64(1)}}},
+		},
+		Final: true,
+	}
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	expectPrefixed := func(query string) *sqlmock.ExpectedExec {
+		return mock.ExpectExec("^" + regexp.QuoteMeta(prefix+" "+query) + "$")
+	}
+	expectPrefixed("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectPrefixed("update a.t1 set c = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectPrefixed("delete from `a`.`t2` where `id` in (?)").WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectPrefixed("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry,
+		TableItems: []*common.ApplierTableItem{nil, tableItem}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyBinlogEventSoftDelete(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+	a.mysqlContext.SoftDeleteTables = map[string]*common.SoftDeletePolicy{
+		"a.t1": {Where: "`deleted_at` is null"},
+	}
+	a.mysqlContext.SetDefaultForEmpty()
+
+	newTableItem := func() *common.ApplierTableItem {
+		tableItem := common.NewApplierTableItem(1)
+		tableItem.Columns = common.NewColumnList([]mysqlconfig.Column{
+			{RawName: "id", EscapedName: "`id`", Key: "PRI"},
+			{RawName: "deleted_at", EscapedName: "`deleted_at`"}})
+		return tableItem
+	}
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 17, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.DeleteDML, DatabaseName: "a", TableName: "t1",
+				Rows: [][]interface{}{{int64(1), nil}, {int64(2), nil}}},
+			{DML: common.DeleteDML, DatabaseName: "a", TableName: "t2", Rows: [][]interface{}{{int64(3), nil}}},
+		},
+		Final: true,
+	}
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	ps := mock.ExpectPrepare(regexp.QuoteMeta(
+		"update `a`.`t1` set `deleted_at` = NOW() where ((`id` = ?) and (`deleted_at` is null)) limit 1"))
+	ps.ExpectExec().WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	ps.ExpectExec().WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	// tables not configured are deleted as usual
+	mock.ExpectExec(regexp.QuoteMeta("delete from `a`.`t2` where `id` in (?)")).WithArgs(int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry,
+		TableItems: []*common.ApplierTableItem{newTableItem(), newTableItem()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyBinlogEventTableApplyTime(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+	a.tableApplyTime = newTableApplyTime()
+	a.mysqlContext.BulkInsert1, a.mysqlContext.BulkInsert2, a.mysqlContext.BulkInsert3 = 4, 8, 128
+
+	newTableItem := func() *common.ApplierTableItem {
+		tableItem := common.NewApplierTableItem(1)
+		tableItem.Columns = common.NewColumnList([]mysqlconfig.Column{
+			{RawName: "id", EscapedName: "`id`", Key: "PRI"},
+			{RawName: "c", EscapedName: "`c`"}})
+		return tableItem
+	}
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 18, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.InsertDML, DatabaseName: "a", TableName: "fast", Rows: [][]interface{}{{int64(1), "x"}}},
+			{DML: common.InsertDML, DatabaseName: "a", TableName: "slow",
+				Rows: [][]interface{}{{int64(1), "x"}, {int64(2), "x"}}},
+		},
+		Final: true,
+	}
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("replace into `a`.`fast`").ExpectExec().
+		WillDelayFor(10 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 1))
+	ps := mock.ExpectPrepare("replace into `a`.`slow`")
+	ps.ExpectExec().WillDelayFor(50 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 1))
+	ps.ExpectExec().WillDelayFor(50 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry,
+		TableItems: []*common.ApplierTableItem{newTableItem(), newTableItem()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	slowest := a.tableApplyTime.slowest(10)
+	if len(slowest) != 2 {
+		t.Fatalf("got %+v, expect 2 tables", slowest)
+	}
+	if slowest[0].Table != "slow" || slowest[1].Table != "fast" {
+		t.Errorf("expect a.slow ranked before a.fast, got %+v", slowest)
+	}
+	if slowest[0].Rows != 2 || slowest[0].ApplyTimeUs < 100000 || slowest[0].AvgRowTimeUs < 50000 {
+		t.Errorf("bad apply time of a.slow %+v", slowest[0])
+	}
+	if slowest[1].Rows != 1 || slowest[1].ApplyTimeUs < 10000 {
+		t.Errorf("bad apply time of a.fast %+v", slowest[1])
+	}
+}
+
+func TestSplitBulkDeleteRows(t *testing.T) {
+	var rows [][]interface{}
+	for i := 0; i < 10; i++ {
+		rows = append(rows, []interface{}{strings.Repeat("k", 84)})
+	}
+	// each row takes 100 bytes. 5 rows in the limit of 500 bytes.
+	batches := splitBulkDeleteRows(rows, 0, 1000)
+	if len(batches) != 2 || len(batches[0]) != 5 || len(batches[1]) != 5 {
+		t.Errorf("unexpected batches %v", len(batches))
+	}
+	if batches := splitBulkDeleteRows(rows, 0, 0); len(batches) != 1 {
+		t.Errorf("expect 1 batch with the default max_allowed_packet, got %v", len(batches))
+	}
+}
+
+func TestHandleUnparseableDDL(t *testing.T) {
+	// valid on MySQL but not supported by the parser
+	const ddl = "CREATE TABLESPACE ts1 ADD DATAFILE 'ts1.ibd' ENGINE=INNODB"
+	newEntry := func() *common.DataEntry {
+		return &common.DataEntry{
+			Coordinates: &common.MySQLCoordinateTx{GNO: 12, SeqenceNumber: 1},
+			Events: []common.DataEvent{
+				{DML: common.NotDML, CurrentSchema: "src_db", Query: ddl},
+				{DML: common.NotDML, CurrentSchema: "src_db", Query: "alter table src_db.t1 add column c2 int"},
+			},
+			Final: true,
+		}
+	}
+	renameMap := map[string]string{"src_db": "dst_db"}
+
+	a, mock := newTestApplierIncr(t)
+	a.mysqlContext.SchemaRenameMap = renameMap
+
+	a.mysqlContext.OnUnparseableDDL = common.OnUnparseableDDLFail
+	if err := a.handleUnparseableDDL(newEntry()); err == nil || !strings.Contains(err.Error(), "cannot parse DDL") {
+		t.Errorf("expect an error for fail, got %v", err)
+	}
+
+	a.mysqlContext.OnUnparseableDDL = common.OnUnparseableDDLSkip
+	entry := newEntry()
+	if err := a.handleUnparseableDDL(entry); err != nil {
+		t.Fatal(err)
+	}
+	if len(entry.Events) != 1 || entry.Events[0].Query == ddl {
+		t.Errorf("expect the DDL to be skipped, got %v", entry.Events)
+	}
+
+	// the raw DDL is executed, while the other DDL is still renamed
+	a.mysqlContext.OnUnparseableDDL = common.OnUnparseableDDLApplyRaw
+	entry = newEntry()
+	if err := a.handleUnparseableDDL(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.renameSchemaForBinlogEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("USE `dst_db`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(ddl)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("USE `dst_db`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE `dst_db`.`t1` ADD COLUMN `c2` INT")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry}); err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFilterUnconfiguredTables(t *testing.T) {
+	a, _ := newTestApplierIncr(t)
+	a.mysqlContext.ReplicateDoDb = []*common.DataSource{
+		{TableSchema: "a", Tables: []*common.Table{{TableName: "t1"}}},
+		{TableSchema: "b", TableSchemaRename: "b2"},
+	}
+	newEntry := func() *common.DataEntry {
+		return &common.DataEntry{
+			Coordinates: &common.MySQLCoordinateTx{GNO: 13, SeqenceNumber: 1},
+			Events: []common.DataEvent{
+				{DML: common.InsertDML, DatabaseName: "a", TableName: "t1"},
+				{DML: common.InsertDML, DatabaseName: "a", TableName: "t9"},
+				{DML: common.UpdateDML, DatabaseName: "a", TableName: "t9"},
+				{DML: common.InsertDML, DatabaseName: "b2", TableName: "t1"},
+				{DML: common.NotDML, CurrentSchema: "c", Query: "create table c.t1 (id int)"},
+			},
+			Final: true,
+		}
+	}
+
+	a.mysqlContext.StrictTableFilter = common.StrictTableFilterOff
+	entry := newEntry()
+	a.filterUnconfiguredTables(entry)
+	if len(entry.Events) != 5 || a.droppedEvents != 0 {
+		t.Errorf("expect no filtering when off. events %v dropped %v", len(entry.Events), a.droppedEvents)
+	}
+
+	a.mysqlContext.StrictTableFilter = common.StrictTableFilterWarnOnce
+	entry = newEntry()
+	a.filterUnconfiguredTables(entry)
+	if len(entry.Events) != 3 {
+		t.Fatalf("expect 3 events left, got %v", entry.Events)
+	}
+	for _, event := range entry.Events {
+		if event.TableName == "t9" {
+			t.Errorf("expect events of a.t9 to be dropped")
+		}
+	}
+	if a.droppedEvents != 2 {
+		t.Errorf("expect 2 dropped events, got %v", a.droppedEvents)
+	}
+	if _, ok := a.warnedTables["a.t9"]; !ok || len(a.warnedTables) != 1 {
+		t.Errorf("unexpected warned tables %v", a.warnedTables)
+	}
+}
+
+func TestHandleEntryFilterBySourceUUID(t *testing.T) {
+	const allowed = "7b2a3a4e-1c1d-11ee-8b2f-0242ac120002"
+	const excluded = "8c3b4b5f-1c1d-11ee-8b2f-0242ac120003"
+	if _, err := newSourceUUIDFilter([]string{"not-a-uuid"}); err == nil {
+		t.Fatal("expect an error on a bad UUID")
+	}
+
+	a, mock := newTestApplierIncr(t)
+	var err error
+	a.excludedSources, err = newSourceUUIDFilter([]string{strings.ToUpper(excluded)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.tableItems = make(mapSchemaTableItems)
+	a.gtidSetLock = &sync.RWMutex{}
+	a.gtidSet = new(gomysql.MysqlGTIDSet)
+	a.gtidSet.Sets = make(map[string]*gomysql.UUIDSet)
+	a.gtidItemMap = make(base.GtidItemMap)
+	var executedSids []string
+	a.EntryExecutedHook = func(entry *common.DataEntry) {
+		executedSids = append(executedSids, entry.Coordinates.GetSidStr())
+	}
+
+	newEntry := func(sid string, gno int64, table string) *common.EntryContext {
+		return &common.EntryContext{Entry: &common.DataEntry{
+			Coordinates: &common.MySQLCoordinateTx{SID: uuid.FromStringOrNil(sid), GNO: gno},
+			Events: []common.DataEvent{{DML: common.NotDML, DatabaseName: "a", TableName: table,
+				Query: fmt.Sprintf("create table a.%v (id int)", table)}},
+			Final: true,
+		}}
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("create table a.t1 (id int)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+	go func() {
+		<-a.mtsManager.chExecuted
+	}()
+	for _, entryCtx := range []*common.EntryContext{
+		newEntry(excluded, 5, "t2"),
+		newEntry(allowed, 10, "t1"),
+	} {
+		if err := a.handleEntry(entryCtx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if len(executedSids) != 2 || executedSids[0] != excluded || executedSids[1] != allowed {
+		t.Errorf("unexpected executed entries %v", executedSids)
+	}
+}
+
+func TestApplyBinlogEventGtidExecutedInTx(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+	a.SkipGtidExecutedTable = false
+	a.sourceType = "mysql"
+	a.subject = "job1"
+	const queryInsertGtid = "replace into dtle.gtid_executed_v4 (job_name,source_uuid,gtid,gtid_set) values (?, ?, ?, null)"
+	mock.ExpectPrepare(regexp.QuoteMeta(queryInsertGtid))
+	var err error
+	a.dbs[0].PsInsertExecutedGtid, err = a.dbs[0].Db.PrepareContext(context.Background(), queryInsertGtid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sid := uuid.FromStringOrNil("7b2a3a4e-1c1d-11ee-8b2f-0242ac120002")
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{SID: sid, GNO: 20, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.NotDML, Query: "update a.t1 set c = 1"},
+			{DML: common.NotDML, Query: "update a.t2 set c = 1"},
+		},
+		Final: true,
+	}
+	insertGtid := regexp.QuoteMeta(queryInsertGtid)
+
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("update a.t1 set c = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("update a.t2 set c = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	// the applier crashes between the data and the bookkeeping
+	mock.ExpectExec(insertGtid).WithArgs("job1", sid.Bytes(), int64(20)).
+		WillReturnError(fmt.Errorf("connection lost"))
+	mock.ExpectExec("rollback").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry}); err == nil {
+		t.Fatalf("expect error")
+	}
+	// no commit: the data is rolled back with the GTID
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("update a.t1 set c = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("update a.t2 set c = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertGtid).WithArgs("job1", sid.Bytes(), int64(20)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry}); err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHeterogeneousReplayStrictFullThenIncr(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+	a.tableItems = make(mapSchemaTableItems)
+	a.gtidSetLock = &sync.RWMutex{}
+	a.gtidSet = new(gomysql.MysqlGTIDSet)
+	a.gtidSet.Sets = make(map[string]*gomysql.UUIDSet)
+	a.gtidItemMap = make(base.GtidItemMap)
+	a.incrBytesQueue = make(chan []byte, 1)
+	a.binlogEntryQueue = make(chan *common.DataEntry, 2)
+	fullCopyComplete := make(chan struct{})
+	a.fullCopyComplete = fullCopyComplete
+	executed := make(chan struct{}, 1)
+	a.EntryExecutedHook = func(entry *common.DataEntry) {
+		executed <- struct{}{}
+	}
+	go func() {
+		<-a.mtsManager.chExecuted
+	}()
+
+	// the full copy row is applied before the incr update, though the update is received first
+	mock.ExpectExec(regexp.QuoteMeta("insert into a.t1 values (1, 'full')")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("update a.t1 set c = 'incr' where id = 1")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	bs, err := common.Encode(&common.DataEntries{Entries: []*common.DataEntry{{
+		Coordinates: &common.MySQLCoordinateTx{
+			SID: uuid.FromStringOrNil("7b2a3a4e-1c1d-11ee-8b2f-0242ac120002"), GNO: 10},
+		Events: []common.DataEvent{{DML: common.NotDML, DatabaseName: "a", TableName: "t1",
+			Query: "update a.t1 set c = 'incr' where id = 1"}},
+		Final: true,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go a.heterogeneousReplay()
+	a.incrBytesQueue <- bs
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&a.heldForFullCopy) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("expect the incr entry to be held")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-executed:
+		t.Fatal("expect the incr entry not to be applied before the full copy completes")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	_, err = a.dbs[0].Db.ExecContext(context.Background(), "insert into a.t1 values (1, 'full')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(fullCopyComplete)
+
+	select {
+	case <-executed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect the incr entry to be applied after the full copy completes")
+	}
+	close(a.shutdownCh)
+	a.wg.Wait()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if a.heldForFullCopy != 1 {
+		t.Errorf("heldForFullCopy = %v, want 1", a.heldForFullCopy)
+	}
+}
+
+func TestStopAtTargetGtidDrainsQueues(t *testing.T) {
+	ai, mock := newTestApplierIncr(t)
+	ai.tableItems = make(mapSchemaTableItems)
+	ai.gtidSetLock = &sync.RWMutex{}
+	ai.gtidSet = new(gomysql.MysqlGTIDSet)
+	ai.gtidSet.Sets = make(map[string]*gomysql.UUIDSet)
+	ai.gtidItemMap = make(base.GtidItemMap)
+	ai.incrBytesQueue = make(chan []byte, 4)
+	ai.binlogEntryQueue = make(chan *common.DataEntry, 2)
+	ai.bigTxEventQueue = make(chan *dmlExecItem, 1)
+	var nExecuted int64
+	ai.EntryExecutedHook = func(entry *common.DataEntry) {
+		atomic.AddInt64(&nExecuted, 1)
+	}
+	go func() {
+		for {
+			select {
+			case <-ai.mtsManager.chExecuted:
+			case <-ai.shutdownCh:
+				return
+			}
+		}
+	}()
+
+	a := &Applier{
+		logger:       hclog.NewNullLogger(),
+		mysqlContext: ai.mysqlContext,
+		shutdownCh:   ai.shutdownCh,
+		ai:           ai,
+	}
+	a.ctx, a.cancelFunc = context.WithCancel(context.Background())
+
+	sid := uuid.FromStringOrNil("7b2a3a4e-1c1d-11ee-8b2f-0242ac120002")
+	entry := func(gno int64) *common.DataEntry {
+		query := fmt.Sprintf("update a.t1 set c = %v where id = 1", gno)
+		mock.ExpectExec(regexp.QuoteMeta(query)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+		return &common.DataEntry{
+			Coordinates: &common.MySQLCoordinateTx{SID: sid, GNO: gno},
+			Events: []common.DataEvent{{DML: common.NotDML, DatabaseName: "a", TableName: "t1",
+				Query: query}},
+			Final: true,
+		}
+	}
+	// entries are buffered when the target is met
+	for _, entries := range [][]*common.DataEntry{{entry(1), entry(2)}, {entry(3)}} {
+		bs, err := common.Encode(&common.DataEntries{Entries: entries})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ai.enqueueIncrBytes(bs) {
+			t.Fatal("enqueueIncrBytes")
+		}
+	}
+	a.stopAtTargetGtid()
+	go ai.heterogeneousReplay()
+
+	select {
+	case <-a.shutdownCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect shutdown after draining")
+	}
+	if n := atomic.LoadInt64(&nExecuted); n != 3 {
+		t.Errorf("%v entries applied before shutdown, want 3", n)
+	}
+	if n := atomic.LoadInt64(&ai.inFlight); n != 0 {
+		t.Errorf("inFlight = %v, want 0", n)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
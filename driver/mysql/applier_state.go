@@ -0,0 +1,115 @@
+package mysql
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/pkg/errors"
+)
+
+// Pause shuts the task down and exports its state, to be resumed later, possibly by another dtle version.
+func (a *Applier) Pause() error {
+	a.shutdownLock.Lock()
+	a.exportStateOnShutdown = true
+	a.shutdownLock.Unlock()
+	return a.Shutdown()
+}
+
+// ExportState stores the state of the job as a versioned blob, so that the job can be stopped
+// and resumed on another dtle version without copying again.
+// It is called on pausing, after the apply loops have stopped.
+func (a *Applier) ExportState() (*common.ApplierState, error) {
+	state, err := a.storeManager.ExportApplierState(a.subject, a.stateManifest(), a.queueCheckpoints())
+	if err != nil {
+		return nil, errors.Wrap(err, "ExportApplierState")
+	}
+	a.logger.Info("exported applier state", "version", state.Version, "gtid", state.ResumeGtid(), "stage", state.Stage)
+	return state, nil
+}
+
+// ImportState restores the state exported by ExportState. It is a no-op if there is no exported state.
+// It is called on starting, before the src task reads the positions of the job.
+func (a *Applier) ImportState() (*common.ApplierState, error) {
+	state, err := a.storeManager.ImportApplierState(a.subject)
+	if err != nil {
+		return nil, errors.Wrap(err, "ImportApplierState")
+	}
+	a.stateImported = true
+	if state == nil {
+		return nil, nil
+	}
+
+	// positions are read from the store by prepareGTID and the src task.
+	a.copiedTables = make(map[common.SchemaTable]struct{}, len(state.Tables))
+	a.tableRowsLock.Lock()
+	a.tableRows = make(map[string]int64, len(state.Tables))
+	for _, table := range state.Tables {
+		if table.Copied {
+			a.copiedTables[common.SchemaTable{Schema: table.Schema, Table: table.Table}] = struct{}{}
+		}
+		if table.Rows > 0 {
+			a.tableRows[fmt.Sprintf("%s.%s", table.Schema, table.Table)] = table.Rows
+		}
+	}
+	a.tableRowsLock.Unlock()
+	if state.Stage != "" {
+		if err := a.setJobStage(state.Stage); err != nil {
+			return nil, errors.Wrap(err, "PutJobStage")
+		}
+	}
+	a.logger.Info("imported applier state", "version", state.Version, "gtid", state.ResumeGtid(), "stage", state.Stage)
+	return state, nil
+}
+
+// stateManifest lists the tables known to the task, sorted by name.
+func (a *Applier) stateManifest() []common.ApplierStateTable {
+	tables := map[common.SchemaTable]*common.ApplierStateTable{}
+	get := func(schema, table string) *common.ApplierStateTable {
+		st := common.SchemaTable{Schema: schema, Table: table}
+		if tables[st] == nil {
+			tables[st] = &common.ApplierStateTable{Schema: schema, Table: table}
+		}
+		return tables[st]
+	}
+	if a.ai != nil {
+		for _, spec := range a.ai.tableSpecs {
+			get(spec.Schema, spec.Table).ColumnMapTo = spec.ColumnMapTo
+		}
+	}
+	for st := range a.copiedTables {
+		get(st.Schema, st.Table).Copied = true
+	}
+	rows := a.tableRowCounts()
+	for _, table := range tables {
+		table.Rows = rows[fmt.Sprintf("%s.%s", table.Schema, table.Table)]
+	}
+
+	r := make([]common.ApplierStateTable, 0, len(tables))
+	for _, table := range tables {
+		r = append(r, *table)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Schema != r[j].Schema {
+			return r[i].Schema < r[j].Schema
+		}
+		return r[i].Table < r[j].Table
+	})
+	return r
+}
+
+// queueCheckpoints returns the positions of the task in the full and incr queues.
+func (a *Applier) queueCheckpoints() []common.QueueCheckpoint {
+	full := common.QueueCheckpoint{Name: common.QueueFull, Pending: atomic.LoadInt64(&a.nDumpEntry)}
+	incr := common.QueueCheckpoint{Name: common.QueueIncr}
+	if a.ai != nil {
+		incr.Pending = int64(len(a.ai.incrBytesQueue))
+	}
+	a.gtidSetLock.RLock()
+	if a.gtidSet != nil {
+		incr.AppliedGtid = a.gtidSet.String()
+	}
+	a.gtidSetLock.RUnlock()
+	return []common.QueueCheckpoint{full, incr}
+}
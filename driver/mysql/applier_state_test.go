@@ -0,0 +1,143 @@
+package mysql
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/drivers/shared/eventer"
+	"github.com/hashicorp/nomad/plugins/drivers"
+)
+
+func newTestStateApplier(t *testing.T, sm *common.StoreManager) *Applier {
+	a, _ := newTestApplier(t, &common.MySQLDriverConfig{})
+	a.subject = "job1"
+	a.storeManager = sm
+	a.shutdownCh = make(chan struct{})
+	a.ctx, a.cancelFunc = context.WithCancel(context.Background())
+	a.gtidSetLock = &sync.RWMutex{}
+	return a
+}
+
+func TestApplierStatePauseResume(t *testing.T) {
+	const uuid = "acd7d195-06cd-11e9-928f-02000aba3e28"
+	oldStore := common.NewMemStore(nil)
+	oldSM := common.NewMemStoreManager(oldStore, hclog.NewNullLogger())
+	// saved periodically. behind the applied entries.
+	if err := oldSM.SaveGtidForJob("job1", uuid+":1-100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := oldSM.PutJobStage("job1", JobIncrCopy); err != nil {
+		t.Fatal(err)
+	}
+
+	a := newTestStateApplier(t, oldSM)
+	if _, err := a.ImportState(); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if a.gtidSet, err = common.DtleParseMysqlGTIDSet(uuid + ":1-105"); err != nil {
+		t.Fatal(err)
+	}
+	a.copiedTables = map[common.SchemaTable]struct{}{{Schema: "a", Table: "t1"}: {}}
+	a.addTableRows("a", "t1", 60)
+	a.ai = &ApplierIncr{
+		logger:          hclog.NewNullLogger(),
+		tableSpecs:      []*common.TableSpec{{Schema: "a", Table: "t2", ColumnMapTo: []string{"id"}}},
+		incrBytesQueue:  make(chan []byte, 4),
+		bigTxEventQueue: make(chan *dmlExecItem),
+	}
+	a.ai.incrBytesQueue <- []byte("entry")
+	if err := a.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := oldStore.Kvs["dtle/job1/ApplierState"]; !ok {
+		t.Fatalf("expect the state to be exported on pausing")
+	}
+
+	// resume on another deployment having only the exported blob
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ev := eventer.NewEventer(ctx, hclog.NewNullLogger())
+	consumer, err := ev.TaskEvents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan *drivers.TaskEvent, 16)
+	go func() {
+		for event := range consumer {
+			events <- event
+		}
+	}()
+	newStore := common.NewMemStore(map[string][]byte{
+		"dtle/job1/ApplierState": oldStore.Kvs["dtle/job1/ApplierState"],
+	})
+	b := newTestStateApplier(t, common.NewMemStoreManager(newStore, hclog.NewNullLogger()))
+	b.event = ev
+	b.taskConfig = &drivers.TaskConfig{ID: "task1", Name: "dest"}
+	state, err := b.ImportState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectTables := []common.ApplierStateTable{
+		{Schema: "a", Table: "t1", Rows: 60, Copied: true},
+		{Schema: "a", Table: "t2", ColumnMapTo: []string{"id"}},
+	}
+	if !reflect.DeepEqual(state.Tables, expectTables) {
+		t.Errorf("manifest %+v, expect %+v", state.Tables, expectTables)
+	}
+	expectQueues := []common.QueueCheckpoint{
+		{Name: common.QueueFull},
+		{Name: common.QueueIncr, Pending: 1, AppliedGtid: uuid + ":1-105"},
+	}
+	if !reflect.DeepEqual(state.Queues, expectQueues) {
+		t.Errorf("queue checkpoints %+v, expect %+v", state.Queues, expectQueues)
+	}
+
+	// resumes from the applied entries, not from the last saved gtid
+	if gtid, _ := b.storeManager.GetGtidForJob("job1"); gtid != uuid+":1-105" {
+		t.Errorf("gtid %v", gtid)
+	}
+	if _, ok := b.copiedTables[common.SchemaTable{Schema: "a", Table: "t1"}]; !ok || len(b.copiedTables) != 1 {
+		t.Errorf("copiedTables %v", b.copiedTables)
+	}
+	if rows := b.tableRowCounts(); rows["a.t1"] != 60 {
+		t.Errorf("tableRows %v", rows)
+	}
+	select {
+	case event := <-events:
+		if event.Message != JobIncrCopy {
+			t.Errorf("got event %v, want %v", event.Message, JobIncrCopy)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no event on the imported stage")
+	}
+
+	// consumed. a restart after resuming does not go back to the exported positions.
+	if _, ok := newStore.Kvs["dtle/job1/ApplierState"]; ok {
+		t.Errorf("expect the imported state to be deleted")
+	}
+	if state, err := b.ImportState(); state != nil || err != nil {
+		t.Errorf("expect no state on restarting, got %v %v", state, err)
+	}
+}
+
+func TestApplierStateNotExportedBeforeImport(t *testing.T) {
+	// written by a newer dtle. it cannot be imported and should be kept.
+	blob := []byte(`{"Version":9,"MinReaderVersion":9}`)
+	s := common.NewMemStore(map[string][]byte{"dtle/job1/ApplierState": blob})
+	a := newTestStateApplier(t, common.NewMemStoreManager(s, hclog.NewNullLogger()))
+	if _, err := a.ImportState(); err == nil {
+		t.Fatalf("expect an error on importing a newer state")
+	}
+	if err := a.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if string(s.Kvs["dtle/job1/ApplierState"]) != string(blob) {
+		t.Errorf("expect the state to be kept, got %s", s.Kvs["dtle/job1/ApplierState"])
+	}
+}
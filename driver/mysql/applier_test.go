@@ -0,0 +1,2325 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	gosql "database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/actiontech/dtle/driver/mysql/base"
+	umconf "github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+	"github.com/actiontech/dtle/driver/mysql/sql"
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/drivers/shared/eventer"
+	"github.com/hashicorp/nomad/plugins/drivers"
+	gonats "github.com/nats-io/go-nats"
+	gnatsd "github.com/nats-io/nats-server/v2/server"
+	"github.com/pingcap/tidb/parser"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// compare queries ignoring differences in whitespaces
+var queryMatcherIgnoreSpace = sqlmock.QueryMatcherFunc(func(expectedSQL, actualSQL string) error {
+	if strings.Join(strings.Fields(expectedSQL), " ") != strings.Join(strings.Fields(actualSQL), " ") {
+		return fmt.Errorf("query %q does not equal %q", actualSQL, expectedSQL)
+	}
+	return nil
+})
+
+func newTestApplier(t *testing.T, cfg *common.MySQLDriverConfig) (*Applier, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(queryMatcherIgnoreSpace))
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	a := &Applier{
+		logger:        hclog.NewNullLogger(),
+		mysqlContext:  cfg,
+		db:            db,
+		MySQLVersion:  "8.0.23",
+		targetVersion: base.MySQLVersion{Major: 8, Minor: 0, Patch: 23, Flavor: base.FlavorMySQL},
+		ctx:           context.Background(),
+	}
+	return a, mock
+}
+
+func TestApplyEventQueriesSchemaRenameMap(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		SchemaRenameMap: map[string]string{"src_db": "dst_db"},
+	}})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS `dst_db`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("USE `dst_db`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE `dst_db`.`t1` (`id` INT)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("replace into `dst_db`.`t1`  values ('1')").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	val := []byte("1")
+	entry := &common.DumpEntry{
+		TableSchema: "src_db",
+		TableName:   "t1",
+		DbSQL:       "CREATE DATABASE IF NOT EXISTS `src_db`",
+		TbSQL:       []string{"USE `src_db`", "CREATE TABLE `src_db`.`t1` (`id` INT)"},
+		ValuesX:     [][]*[]byte{{&val}},
+	}
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if a.TotalRowsReplayed != 1 {
+		t.Errorf("TotalRowsReplayed = %v, want 1", a.TotalRowsReplayed)
+	}
+	// the entry is kept as received, to be applied again on retrying
+	if entry.TableSchema != "src_db" || entry.TbSQL[1] != "CREATE TABLE `src_db`.`t1` (`id` INT)" {
+		t.Errorf("entry changed: %v %v", entry.TableSchema, entry.TbSQL)
+	}
+}
+
+func TestRenameSchemaForBinlogEntry(t *testing.T) {
+	entry := &common.DataEntry{Events: []common.DataEvent{
+		{DML: common.NotDML, CurrentSchema: "src_db", DatabaseName: "src_db",
+			Query: "alter table src_db.t1 add column c2 int"},
+		{DML: common.InsertDML, DatabaseName: "src_db", TableName: "t1"},
+		{DML: common.InsertDML, DatabaseName: "other_db", TableName: "t1"},
+	}}
+	a, _ := newTestApplierIncr(t)
+	a.mysqlContext.SchemaRenameMap = map[string]string{"src_db": "dst_db"}
+	err := a.renameSchemaForBinlogEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Events[0].CurrentSchema != "dst_db" || entry.Events[0].DatabaseName != "dst_db" {
+		t.Errorf("DDL schema not renamed: %v %v", entry.Events[0].CurrentSchema, entry.Events[0].DatabaseName)
+	}
+	if want := "ALTER TABLE `dst_db`.`t1` ADD COLUMN `c2` INT"; entry.Events[0].Query != want {
+		t.Errorf("query = %v, want %v", entry.Events[0].Query, want)
+	}
+	if entry.Events[1].DatabaseName != "dst_db" || entry.Events[2].DatabaseName != "other_db" {
+		t.Errorf("DML routing: %v %v", entry.Events[1].DatabaseName, entry.Events[2].DatabaseName)
+	}
+
+	// per-table config of the source table is kept for the renamed schema
+	a.tableItems = make(mapSchemaTableItems)
+	a.tableSpecs = []*common.TableSpec{{Schema: "src_db", Table: "t1", ColumnMapTo: []string{"id", "c2"}}}
+	if item := a.getTableItem(entry.Events[1].DatabaseName, "t1"); len(item.ColumnMapTo) != 2 {
+		t.Errorf("ColumnMapTo of the renamed table: %v", item.ColumnMapTo)
+	}
+}
+
+func TestApplyEventQueriesNumericAttrMismatch(t *testing.T) {
+	srcTable := common.NewTable("db1", "t1")
+	srcTable.OriginalTableColumns = common.NewColumnList([]umconf.Column{
+		{RawName: "id", ColumnType: "int(11)"},
+		{RawName: "c1", ColumnType: "int(10) unsigned", IsUnsigned: true},
+	})
+	tableBs, err := common.EncodeTable(srcTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newEntry := func() *common.DumpEntry {
+		id := []byte("1")
+		c1 := []byte("4294967295") // above max of signed int
+		return &common.DumpEntry{
+			TableSchema: "db1",
+			TableName:   "t1",
+			ValuesX:     [][]*[]byte{{&id, &c1}},
+			Table:       tableBs,
+		}
+	}
+	expectTargetColumns := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("show columns from `db1`.`t1`").WillReturnRows(
+			sqlmock.NewRows([]string{"Field", "Type", "Null", "Key", "Default", "Extra"}).
+				AddRow("id", "int(11)", "NO", "PRI", nil, "").
+				AddRow("c1", "int(11)", "YES", "", nil, ""))
+		mock.ExpectQuery("select * from information_schema.columns where table_schema=? and table_name=?").
+			WithArgs("db1", "t1").WillReturnRows(
+			sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "DATETIME_PRECISION"}).
+				AddRow("id", "int(11)", nil).
+				AddRow("c1", "int(11)", nil))
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		a, mock := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+			NumericAttrMismatch: common.NumericAttrMismatchFail,
+		}})
+		mock.ExpectBegin()
+		mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectTargetColumns(mock)
+
+		err := a.ApplyEventQueries(a.db, newEntry())
+		if err == nil || !strings.Contains(err.Error(), "signedness") {
+			t.Fatalf("expect signedness error, got %v", err)
+		}
+	})
+
+	t.Run("clamp", func(t *testing.T) {
+		a, mock := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+			NumericAttrMismatch: common.NumericAttrMismatchClamp,
+		}})
+		mock.ExpectBegin()
+		mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectTargetColumns(mock)
+		mock.ExpectExec("replace into `db1`.`t1`  values ('1','2147483647')").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := a.ApplyEventQueries(a.db, newEntry()); err != nil {
+			t.Fatalf("ApplyEventQueries: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestApplyEventQueriesTableLimits(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+	a.tableLimits = base.TableLimits{MaxColumns: 3, MaxIndexes: 1}
+
+	entry := &common.DumpEntry{
+		TbSQL: []string{"CREATE TABLE `db1`.`t1` (`c1` INT, `c2` INT, `c3` INT, `c4` INT)"},
+	}
+	err := a.ApplyEventQueries(a.db, entry)
+	if err == nil || !strings.Contains(err.Error(), "4 columns") {
+		t.Fatalf("expect columns limit error, got %v", err)
+	}
+
+	entry = &common.DumpEntry{
+		TbSQL: []string{"CREATE TABLE `db1`.`t1` (`c1` INT PRIMARY KEY, `c2` INT UNIQUE, `c3` INT, KEY `k3` (`c3`))"},
+	}
+	err = a.ApplyEventQueries(a.db, entry)
+	if err == nil || !strings.Contains(err.Error(), "2 secondary indexes") {
+		t.Fatalf("expect indexes limit error, got %v", err)
+	}
+
+	// nothing is executed on the target
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyEventQueriesBitAndBinary(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+
+	bitVal := []byte{0xA5}
+	binaryVal := []byte{0x00, '\'', '\\', 0xFF}
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ColumnTypes: []string{"bit(8)", "binary(4)"},
+		ValuesX:     [][]*[]byte{{&bitVal, &binaryVal}},
+	}
+	// as sent by the extractor
+	bs, err := entry.Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry = &common.DumpEntry{}
+	if _, err = entry.Unmarshal(bs); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("replace into `db1`.`t1`  values (b'10100101',X'00275CFF')").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckOrphanRows(t *testing.T) {
+	const countQuery = "select count(*) from `db1`.`child` c left join `db1`.`parent` p" +
+		" on c.`pid` = p.`id` where c.`pid` is not null and p.`id` is null"
+	const deleteQuery = "delete c from `db1`.`child` c left join `db1`.`parent` p" +
+		" on c.`pid` = p.`id` where c.`pid` is not null and p.`id` is null"
+
+	expectForeignKeys := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(`select CONSTRAINT_NAME, COLUMN_NAME, REFERENCED_TABLE_SCHEMA, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+			from information_schema.KEY_COLUMN_USAGE
+			where TABLE_SCHEMA = ? and TABLE_NAME = ? and REFERENCED_TABLE_NAME is not null
+			order by CONSTRAINT_NAME, ORDINAL_POSITION`).
+			WithArgs("db1", "child").
+			WillReturnRows(sqlmock.NewRows([]string{"CONSTRAINT_NAME", "COLUMN_NAME",
+				"REFERENCED_TABLE_SCHEMA", "REFERENCED_TABLE_NAME", "REFERENCED_COLUMN_NAME"}).
+				AddRow("fk1", "pid", "db1", "parent", "id"))
+		// the parent row was filtered out by a `where` on the source
+		mock.ExpectQuery(countQuery).WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(2))
+	}
+	newApplier := func(policy string) (*Applier, sqlmock.Sqlmock) {
+		a, mock := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+			OrphanRowsPolicy: policy,
+		}})
+		a.copiedTables = map[common.SchemaTable]struct{}{{Schema: "db1", Table: "child"}: {}}
+		return a, mock
+	}
+
+	t.Run("report", func(t *testing.T) {
+		a, mock := newApplier(common.OrphanRowsReport)
+		expectForeignKeys(mock)
+		if err := a.checkOrphanRows(); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("delete", func(t *testing.T) {
+		a, mock := newApplier(common.OrphanRowsDelete)
+		expectForeignKeys(mock)
+		mock.ExpectExec(deleteQuery).WillReturnResult(sqlmock.NewResult(0, 2))
+		if err := a.checkOrphanRows(); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("fail", func(t *testing.T) {
+		a, mock := newApplier(common.OrphanRowsFail)
+		expectForeignKeys(mock)
+		err := a.checkOrphanRows()
+		if err == nil || !strings.Contains(err.Error(), "2 orphan rows") {
+			t.Fatalf("expect orphan rows error, got %v", err)
+		}
+	})
+}
+
+type memDeadLetterSink struct {
+	rows    [][]*[]byte
+	reasons []string
+}
+
+func (s *memDeadLetterSink) Put(schema string, table string, row []*[]byte, reason string) error {
+	s.rows = append(s.rows, row)
+	s.reasons = append(s.reasons, reason)
+	return nil
+}
+
+func TestApplyEventQueriesValidateRows(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		ValidateRows: true,
+	}})
+	sink := &memDeadLetterSink{}
+	a.deadLetterSink = sink
+
+	newRow := func(vals ...string) []*[]byte {
+		row := make([]*[]byte, len(vals))
+		for i := range vals {
+			bs := []byte(vals[i])
+			row[i] = &bs
+		}
+		return row
+	}
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ValuesX: [][]*[]byte{
+			newRow("1", "20", "a"),
+			newRow("2", "-1", "a"), // violates chk_age
+			newRow("3", "30", "c"), // not in enum
+			newRow("4", "40", "b"),
+		},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("show create table `db1`.`t1`").WillReturnRows(
+		sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("t1",
+			"CREATE TABLE `t1` (`id` int NOT NULL, `age` int, `e` enum('a','b'), PRIMARY KEY (`id`),"+
+				" CONSTRAINT `chk_age` CHECK ((`age` >= 0)))"))
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1','20','a'),('4','40','b')").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.rows) != 2 || string(*sink.rows[0][0]) != "2" || string(*sink.rows[1][0]) != "3" {
+		t.Fatalf("unexpected dead letter rows: %v", sink.reasons)
+	}
+	if !strings.Contains(sink.reasons[0], "chk_age") {
+		t.Errorf("unexpected reason %v", sink.reasons[0])
+	}
+	if a.TotalRowsReplayed != 2 {
+		t.Errorf("TotalRowsReplayed = %v, want 2", a.TotalRowsReplayed)
+	}
+}
+
+func TestApplyEventQueriesSplitOnLockWaitTimeout(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+
+	newRow := func(id string) []*[]byte {
+		bs := []byte(id)
+		return []*[]byte{&bs}
+	}
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ValuesX:     [][]*[]byte{newRow("1"), newRow("2"), newRow("3"), newRow("4")},
+	}
+	lockWaitTimeout := &mysql.MySQLError{Number: sql.ErrLockWaitTimeout,
+		Message: "Lock wait timeout exceeded; try restarting transaction"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1'),('2'),('3'),('4')").
+		WillReturnError(lockWaitTimeout)
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1'),('2')").
+		WillReturnError(lockWaitTimeout)
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1')").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("replace into `db1`.`t1`  values ('2')").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("replace into `db1`.`t1`  values ('3'),('4')").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if a.lockTimeoutSplits != 2 {
+		t.Errorf("lockTimeoutSplits = %v, want 2", a.lockTimeoutSplits)
+	}
+	if a.TotalRowsReplayed != 4 {
+		t.Errorf("TotalRowsReplayed = %v, want 4", a.TotalRowsReplayed)
+	}
+
+	// a single row is not split
+	entry.ValuesX = entry.ValuesX[:1]
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1')").WillReturnError(lockWaitTimeout)
+	mock.ExpectRollback()
+
+	if err := a.ApplyEventQueries(a.db, entry); !sql.IsLockWaitTimeoutError(err) {
+		t.Fatalf("ApplyEventQueries: %v, want a lock wait timeout", err)
+	}
+	if a.lockTimeoutSplits != 2 {
+		t.Errorf("lockTimeoutSplits = %v, want 2", a.lockTimeoutSplits)
+	}
+}
+
+func TestApplyEventQueriesCommitError(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+	val := []byte("1")
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ValuesX:     [][]*[]byte{{&val}},
+	}
+	commitErr := fmt.Errorf("connection lost")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1')").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit().WillReturnError(commitErr)
+
+	err := a.ApplyEventQueries(a.db, entry)
+	if errors.Cause(err) != commitErr {
+		t.Fatalf("ApplyEventQueries: %v, want %v", err, commitErr)
+	}
+	if a.TotalRowsReplayed != 0 {
+		t.Errorf("TotalRowsReplayed = %v, want 0", a.TotalRowsReplayed)
+	}
+
+	// the entry is applied again on retrying
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1')").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if a.TotalRowsReplayed != 1 {
+		t.Errorf("TotalRowsReplayed = %v, want 1", a.TotalRowsReplayed)
+	}
+}
+
+func TestApplyEventQueriesPerTableRowCount(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+	if counts := a.tableRowCounts(); counts != nil {
+		t.Fatalf("expect nil before the first entry, got %v", counts)
+	}
+	val1, val2, val3 := []byte("1"), []byte("2"), []byte("3")
+	entries := []*common.DumpEntry{
+		{TableSchema: "db1", TableName: "t1", ValuesX: [][]*[]byte{{&val1}, {&val2}}},
+		{TableSchema: "db1", TableName: "t2", ValuesX: [][]*[]byte{{&val1}}},
+		{TableSchema: "db1", TableName: "t1", ValuesX: [][]*[]byte{{&val3}}},
+	}
+	for _, query := range []string{
+		"replace into `db1`.`t1`  values ('1'),('2')",
+		"replace into `db1`.`t2`  values ('1')",
+		"replace into `db1`.`t1`  values ('3')",
+	} {
+		mock.ExpectBegin()
+		mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	for _, entry := range entries {
+		if err := a.ApplyEventQueries(a.db, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int64{"db1.t1": 3, "db1.t2": 1}
+	if counts := a.tableRowCounts(); !reflect.DeepEqual(counts, expected) {
+		t.Errorf("PerTableRowCount = %v, want %v", counts, expected)
+	}
+	if a.TotalRowsReplayed != 4 {
+		t.Errorf("TotalRowsReplayed = %v, want 4", a.TotalRowsReplayed)
+	}
+}
+
+func TestApplyEventQueriesKeepForeignKeyChecks(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+	a.mysqlContext.KeepForeignKeyChecks = true
+	val := []byte("1")
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ValuesX:     [][]*[]byte{{&val}},
+	}
+
+	// no querySetFKChecksOff
+	mock.ExpectBegin()
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1')").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyDumpEntryRollbackOnTimeout(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+	a.rollbackOnTimeout = true
+
+	newRow := func(id string) []*[]byte {
+		bs := []byte(id)
+		return []*[]byte{&bs}
+	}
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ValuesX:     [][]*[]byte{newRow("1"), newRow("2")},
+	}
+	lockWaitTimeout := &mysql.MySQLError{Number: sql.ErrLockWaitTimeout,
+		Message: "Lock wait timeout exceeded; try restarting transaction"}
+
+	// the whole tx has been rolled back. the batch is not split, and the entry is applied again.
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1'),('2')").WillReturnError(lockWaitTimeout)
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1'),('2')").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	if err := a.applyDumpEntry(a.db, entry); err != nil {
+		t.Fatalf("applyDumpEntry: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if a.lockTimeoutSplits != 0 {
+		t.Errorf("lockTimeoutSplits = %v, want 0", a.lockTimeoutSplits)
+	}
+	if a.TotalRowsReplayed != 2 {
+		t.Errorf("TotalRowsReplayed = %v, want 2", a.TotalRowsReplayed)
+	}
+}
+
+func TestApplyEventQueriesSystemVariablesOnce(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+	dbsDb, dbsMock, err := sqlmock.New(sqlmock.QueryMatcherOption(queryMatcherIgnoreSpace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbsDb.Close()
+	conn, err := dbsDb.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.dbs = []*sql.Conn{{DbMutex: &sync.Mutex{}, Db: conn}}
+	sysVars := [][2]string{{"character_set_client", "utf8mb4"}}
+	sysVarStatement := "SET character_set_client = utf8mb4"
+
+	// executed on a.dbs once.
+	dbsMock.ExpectExec(sysVarStatement).WillReturnResult(sqlmock.NewResult(0, 0))
+	// each tx might run on another connection of a.db. the statement is in each of them.
+	for i := 0; i < 2; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(sysVarStatement).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+	}
+
+	for i := 0; i < 2; i++ {
+		entry := &common.DumpEntry{SystemVariables: sysVars}
+		if err := a.ApplyEventQueries(a.db, entry); err != nil {
+			t.Fatalf("ApplyEventQueries: %v", err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbsMock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOnErrorRetryGracePeriod(t *testing.T) {
+	newApplier := func() *Applier {
+		a, _ := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+			ErrorGracePeriodMs: 2000,
+		}})
+		a.waitCh = make(chan *drivers.ExitResult, 1)
+		a.shutdownCh = make(chan struct{})
+		a.cancelFunc = func() {}
+		return a
+	}
+	transientErr := &mysql.MySQLError{Number: sql.ErrLockDeadlock, Message: "Deadlock found"}
+
+	t.Run("recovered", func(t *testing.T) {
+		a := newApplier()
+		nRetry := 0
+		recovered := a.onErrorRetry(common.TaskStateDead, transientErr, func() error {
+			nRetry += 1
+			if nRetry < 2 {
+				return transientErr
+			}
+			return nil
+		})
+		if !recovered || nRetry != 2 {
+			t.Errorf("recovered %v nRetry %v, expect recovered after 2 retries", recovered, nRetry)
+		}
+		select {
+		case r := <-a.waitCh:
+			t.Errorf("unexpected ExitResult %v", r)
+		default:
+		}
+	})
+
+	t.Run("not transient", func(t *testing.T) {
+		a := newApplier()
+		nRetry := 0
+		recovered := a.onErrorRetry(common.TaskStateDead, fmt.Errorf("bad data"), func() error {
+			nRetry += 1
+			return nil
+		})
+		if recovered || nRetry != 0 {
+			t.Errorf("recovered %v nRetry %v, expect no retry", recovered, nRetry)
+		}
+		select {
+		case r := <-a.waitCh:
+			if r.ExitCode != common.TaskStateDead {
+				t.Errorf("ExitCode %v", r.ExitCode)
+			}
+		default:
+			t.Errorf("expect an ExitResult")
+		}
+	})
+}
+
+// txOptionsRecorder records options of transactions begun on the wrapped connection.
+type txOptionsRecorder struct {
+	driver.Conn
+	opts []driver.TxOptions
+}
+
+func (c *txOptionsRecorder) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.opts = append(c.opts, opts)
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c *txOptionsRecorder) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+type txOptionsRecorderConnector struct {
+	drv  driver.Driver
+	dsn  string
+	conn *txOptionsRecorder
+}
+
+func (c *txOptionsRecorderConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.drv.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = &txOptionsRecorder{Conn: conn}
+	return c.conn, nil
+}
+
+func (c *txOptionsRecorderConnector) Driver() driver.Driver {
+	return c.drv
+}
+
+func TestApplyEventQueriesTxIsolationLevel(t *testing.T) {
+	dsn := "TestApplyEventQueriesTxIsolationLevel"
+	mockDB, mock, err := sqlmock.NewWithDSN(dsn, sqlmock.QueryMatcherOption(queryMatcherIgnoreSpace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	connector := &txOptionsRecorderConnector{drv: mockDB.Driver(), dsn: dsn}
+	db := gosql.OpenDB(connector)
+	defer db.Close()
+
+	a := &Applier{
+		logger: hclog.NewNullLogger(),
+		mysqlContext: &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+			TxIsolationLevel: "read-committed",
+		}},
+		db:            db,
+		MySQLVersion:  "8.0.23",
+		targetVersion: base.MySQLVersion{Major: 8, Minor: 0, Patch: 23, Flavor: base.FlavorMySQL},
+		ctx:           context.Background(),
+	}
+
+	// validating the level on the target
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	if err := a.initTxOptions(); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1')").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	val := []byte("1")
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ValuesX:     [][]*[]byte{{&val}},
+	}
+	if err := a.ApplyEventQueries(db, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(connector.conn.opts) != 2 {
+		t.Fatalf("got %v transactions, expect 2", len(connector.conn.opts))
+	}
+	for _, opts := range connector.conn.opts {
+		if gosql.IsolationLevel(opts.Isolation) != gosql.LevelReadCommitted {
+			t.Errorf("isolation %v, expect %v", gosql.IsolationLevel(opts.Isolation), gosql.LevelReadCommitted)
+		}
+	}
+
+	if _, err := sql.ParseIsolationLevel("snapshot"); err == nil {
+		t.Errorf("expect error for an unsupported level")
+	}
+}
+
+func TestStripTextBlobDefaultsForTarget(t *testing.T) {
+	logger := hclog.NewNullLogger()
+	createTable := "CREATE TABLE `a`.`t1` (`id` INT PRIMARY KEY,`c1` TEXT DEFAULT ('abc'),`c2` BLOB DEFAULT NULL," +
+		"`c3` VARCHAR(10) DEFAULT 'x')"
+	tests := []struct {
+		name    string
+		version string
+		query   string
+		want    string
+	}{
+		{"5.7 create table", "5.7.35-log", createTable,
+			"CREATE TABLE `a`.`t1` (`id` INT PRIMARY KEY,`c1` TEXT,`c2` BLOB DEFAULT NULL,`c3` VARCHAR(10) DEFAULT 'x')"},
+		{"5.7 show create table of 8.0", "5.7.35",
+			"CREATE TABLE `t2` (\n  `id` int NOT NULL,\n  `c1` text DEFAULT (_utf8mb4'a(b)'),\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB",
+			"CREATE TABLE `t2` (\n  `id` int NOT NULL,\n  `c1` text,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB"},
+		{"5.7 literal default", "5.7.35", "CREATE TABLE `t3` (`c1` TEXT DEFAULT 'abc')",
+			"CREATE TABLE `t3` (`c1` TEXT)"},
+		{"5.7 alter table", "5.7.35", "ALTER TABLE `a`.`t1` ADD COLUMN `c4` JSON DEFAULT ('{}')",
+			"ALTER TABLE `a`.`t1` ADD COLUMN `c4` JSON"},
+		{"5.7 no text default", "5.7.35", "ALTER TABLE `a`.`t1` ADD COLUMN `c4` INT DEFAULT 1",
+			"ALTER TABLE `a`.`t1` ADD COLUMN `c4` INT DEFAULT 1"},
+		{"8.0 keeps defaults", "8.0.23", createTable, createTable},
+		{"mariadb 10.1", "10.1.48-MariaDB", "CREATE TABLE `t3` (`c1` TEXT DEFAULT 'abc')",
+			"CREATE TABLE `t3` (`c1` TEXT)"},
+		{"mariadb 10.5 keeps defaults", "5.5.5-10.5.12-MariaDB-log", createTable, createTable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := base.ParseMySQLVersion(tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := stripTextBlobDefaultsForTarget(logger, version, tt.query); got != tt.want {
+				t.Errorf("got %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckGeneratedColumnsForTarget(t *testing.T) {
+	logger := hclog.NewNullLogger()
+	createTable := "CREATE TABLE `a`.`t1` (`s` VARCHAR(32), `m` TINYINT AS (REGEXP_LIKE(`s`, '^a')) VIRTUAL)"
+
+	mysql57 := base.MySQLVersion{Major: 5, Minor: 7, Patch: 35, Flavor: base.FlavorMySQL}
+	err := checkGeneratedColumnsForTarget(logger, mysql57, createTable)
+	if err == nil || !strings.Contains(err.Error(), "function regexp_like needs MySQL 8.0.4") {
+		t.Errorf("expect regexp_like reported for a 5.7 target, got %v", err)
+	}
+	mysql80 := base.MySQLVersion{Major: 8, Minor: 0, Patch: 23, Flavor: base.FlavorMySQL}
+	if err := checkGeneratedColumnsForTarget(logger, mysql80, createTable); err != nil {
+		t.Errorf("expect no error for an 8.0 target, got %v", err)
+	}
+	if err := checkGeneratedColumnsForTarget(logger, mysql57, "not a statement"); err != nil {
+		t.Errorf("expect unparseable queries left to the target, got %v", err)
+	}
+}
+
+func TestGetConnPool(t *testing.T) {
+	cases := []struct {
+		version     string
+		cfg         common.DtleTaskConfig
+		workers     int
+		maxOpen     int
+		maxIdle     int
+		maxLifetime time.Duration
+	}{
+		{"5.7.30-log", common.DtleTaskConfig{ParallelWorkers: 4}, 4, 14, 2, sql.ConnMaxLifetime},
+		{"8.0.23", common.DtleTaskConfig{ParallelWorkers: 1}, 1, 11, 2, sql.ConnMaxLifetime},
+		// MySQL 5.6 cannot apply in parallel
+		{"5.6.40-log", common.DtleTaskConfig{ParallelWorkers: 4}, 1, 11, 2, sql.ConnMaxLifetime},
+		{"10.5.12-MariaDB-log", common.DtleTaskConfig{ParallelWorkers: 4}, 4, 14, 2, sql.ConnMaxLifetime},
+		{"8.0.23", common.DtleTaskConfig{ParallelWorkers: 8, ApplierConnPoolHeadroom: 2, ApplierConnMaxIdle: 6,
+			ApplierConnMaxLifetimeMs: 60000}, 8, 10, 6, time.Minute},
+		// idle connections are no more than open ones
+		{"8.0.23", common.DtleTaskConfig{ParallelWorkers: 2, ApplierConnPoolHeadroom: 1, ApplierConnMaxIdle: 10},
+			2, 3, 3, sql.ConnMaxLifetime},
+	}
+	for i, c := range cases {
+		version, err := base.ParseMySQLVersion(c.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := getConnPool(&c.cfg, version)
+		if p.workers != c.workers || p.maxOpen != c.maxOpen || p.maxIdle != c.maxIdle ||
+			p.maxLifetime != c.maxLifetime {
+			t.Errorf("case %v %v: got %+v", i, c.version, p)
+		}
+	}
+}
+
+func TestInitTargetFlavorMariaDB(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+	a.MySQLVersion = "10.5.12-MariaDB-log"
+	if err := a.initTargetFlavor(); err != nil {
+		t.Fatal(err)
+	}
+	if a.targetFlavor != base.FlavorMariaDB {
+		t.Fatalf("flavor %v, expect %v", a.targetFlavor, base.FlavorMariaDB)
+	}
+	if a.tableLimits.MaxColumns != 1017 {
+		t.Errorf("MaxColumns %v, expect 1017", a.tableLimits.MaxColumns)
+	}
+
+	// the MariaDB path maps the MySQL 8.0 collations
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE `db1`.`t1` (`id` INT) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		TbSQL:       []string{"CREATE TABLE `db1`.`t1` (`id` INT) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci"},
+	}
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	memory1, memory2 := int64(0), int64(0)
+	a.memory1, a.memory2 = &memory1, &memory2
+	stats, err := a.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TargetFlavor != base.FlavorMariaDB {
+		t.Errorf("TargetFlavor in stats %v", stats.TargetFlavor)
+	}
+
+	a.mysqlContext.SetGtidNext = true
+	if err := a.initTargetFlavor(); err == nil {
+		t.Errorf("expect SetGtidNext to be rejected on MariaDB")
+	}
+
+	a.mysqlContext.SetGtidNext = false
+	a.MySQLVersion = "8.0.23"
+	if err := a.initTargetFlavor(); err != nil || a.targetFlavor != base.FlavorMySQL {
+		t.Errorf("flavor %v err %v, expect %v", a.targetFlavor, err, base.FlavorMySQL)
+	}
+}
+
+func TestNegotiateConnCharset(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		SrcConnectionConfig:  &umconf.ConnectionConfig{Charset: "utf8"},
+		DestConnectionConfig: &umconf.ConnectionConfig{Charset: "utf8mb4"},
+	}})
+	mock.ExpectQuery("select @@character_set_server").WillReturnRows(
+		sqlmock.NewRows([]string{"@@character_set_server"}).AddRow("latin1"))
+	mock.ExpectQuery("select @@character_set_connection").WillReturnRows(
+		sqlmock.NewRows([]string{"@@character_set_connection"}).AddRow("utf8mb4"))
+	if err := a.negotiateConnCharset(); err != nil {
+		t.Fatal(err)
+	}
+	if a.mysqlContext.DestConnectionConfig.Charset != "utf8mb4" {
+		t.Errorf("connection charset %v, expect utf8mb4", a.mysqlContext.DestConnectionConfig.Charset)
+	}
+
+	mock.ExpectQuery("select @@character_set_connection").WillReturnRows(
+		sqlmock.NewRows([]string{"@@character_set_connection"}).AddRow("utf8"))
+	if err := checkConnCharset(a.db, "utf8mb4"); err == nil {
+		t.Errorf("expect an error on a narrower connection charset")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckTableEngine(t *testing.T) {
+	expectEngine := func(mock sqlmock.Sqlmock, engine string) {
+		mock.ExpectQuery("select ENGINE from information_schema.TABLES where TABLE_SCHEMA = ? and TABLE_NAME = ?").
+			WithArgs("db1", "t1").WillReturnRows(sqlmock.NewRows([]string{"ENGINE"}).AddRow(engine))
+	}
+
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+	var logBuf bytes.Buffer
+	a.logger = hclog.New(&hclog.LoggerOptions{Output: &logBuf})
+	expectEngine(mock, "MyISAM")
+	if err := a.checkTableEngine(a.db, "db1", "t1", "InnoDB"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logBuf.String(), "storage engine differs") ||
+		!strings.Contains(logBuf.String(), "dstEngine=MyISAM") {
+		t.Errorf("expect a warning on the engine mismatch, got %q", logBuf.String())
+	}
+
+	logBuf.Reset()
+	expectEngine(mock, "innodb")
+	if err := a.checkTableEngine(a.db, "db1", "t1", "InnoDB"); err != nil {
+		t.Fatal(err)
+	}
+	if logBuf.Len() != 0 {
+		t.Errorf("expect no warning for the same engine, got %q", logBuf.String())
+	}
+
+	// foreign keys are not supported by the target engine
+	a.mysqlContext.OrphanRowsPolicy = common.OrphanRowsReport
+	expectEngine(mock, "MyISAM")
+	err := a.checkTableEngine(a.db, "db1", "t1", "InnoDB")
+	if err == nil || !strings.Contains(err.Error(), "OrphanRowsPolicy") {
+		t.Errorf("expect OrphanRowsPolicy to be rejected, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyEventQueriesVirtualColumnIndex(t *testing.T) {
+	// the generated column must be defined when its index is built.
+	// the table is created by a single statement, which keeps them together.
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+	createTable := "CREATE TABLE `db1`.`t1` (`id` int NOT NULL, `doc` json," +
+		" `name` varchar(32) GENERATED ALWAYS AS (json_unquote(json_extract(`doc`,_utf8mb4'$.name'))) VIRTUAL," +
+		" PRIMARY KEY (`id`), KEY `idx_name` (`name`)) ENGINE=InnoDB"
+
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("USE `db1`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(createTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		TbSQL:       []string{"USE `db1`", createTable},
+	}
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyEventQueriesDuplicateKeys(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		DetectDuplicateKeys: true,
+	}})
+	var logBuf bytes.Buffer
+	a.logger = hclog.New(&hclog.LoggerOptions{Output: &logBuf})
+
+	srcTable := common.NewTable("db1", "t1")
+	srcTable.OriginalTableColumns = common.NewColumnList([]umconf.Column{
+		{RawName: "id", ColumnType: "int(11)"},
+		{RawName: "c1", ColumnType: "varchar(10)"},
+	})
+	srcTable.UseUniqueKey = &common.UniqueKey{Name: "PRIMARY",
+		Columns: *common.NewColumnList([]umconf.Column{{RawName: "id"}})}
+	tableBs, err := common.EncodeTable(srcTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id1, id2, v1, v2, v3 := []byte("1"), []byte("2"), []byte("a"), []byte("b"), []byte("c")
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		// the source changed the row with id 1 during the copy
+		ValuesX: [][]*[]byte{{&id1, &v1}, {&id2, &v2}, {&id1, &v3}},
+		Table:   tableBs,
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("show columns from `db1`.`t1`").WillReturnRows(
+		sqlmock.NewRows([]string{"Field", "Type", "Null", "Key", "Default", "Extra"}).
+			AddRow("id", "int(11)", "NO", "PRI", nil, "").
+			AddRow("c1", "varchar(10)", "YES", "", nil, ""))
+	mock.ExpectQuery("select * from information_schema.columns where table_schema=? and table_name=?").
+		WithArgs("db1", "t1").WillReturnRows(
+		sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "DATETIME_PRECISION"}).
+			AddRow("id", "int(11)", nil).
+			AddRow("c1", "varchar(10)", nil))
+	// rows are written in the order of the entry. the later row of id 1 wins.
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1','a'),('2','b'),('1','c')").
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectCommit()
+
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logBuf.String(), "share a unique key") ||
+		!strings.Contains(logBuf.String(), "row=0 laterRow=2") {
+		t.Errorf("expect a warning on the duplicate key, got %q", logBuf.String())
+	}
+}
+
+func TestUpdateGtidLoopCoalesce(t *testing.T) {
+	s := common.NewMemStore(nil)
+	sm := common.NewMemStoreManager(s, hclog.NewNullLogger())
+
+	gtidSet, err := common.DtleParseMysqlGTIDSet("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Applier{
+		logger:       hclog.NewNullLogger(),
+		subject:      "job1",
+		mysqlContext: &common.MySQLDriverConfig{},
+		storeManager: sm,
+		stage:        JobIncrCopy,
+		shutdownCh:   make(chan struct{}),
+		gtidCh:       make(chan common.CoordinatesI, 4096),
+		gtidSet:      gtidSet,
+		gtidSetLock:  &sync.RWMutex{},
+	}
+	go a.updateGtidLoop()
+	defer close(a.shutdownCh)
+
+	sid := uuid.Must(uuid.FromString("acd7d195-06cd-11e9-928f-02000aba3e28"))
+	const nTx = 5000
+	for i := 1; i <= nTx; i++ {
+		a.gtidCh <- &common.MySQLCoordinateTx{SID: sid, GNO: int64(i)}
+		if i%10 == 0 {
+			a.gtidCh <- nil
+		}
+	}
+
+	expect := fmt.Sprintf("%v:1-%v", sid, nTx)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		kv, err := s.Get("dtle/job1/Gtid")
+		if err == nil && string(kv.Value) == expect {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("gtid is not uploaded. got %v %v, expect %v", kv, err, expect)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	puts, _ := s.Counts()
+	// 500 flags would be 1000 writes (gtid and binlog pos) without coalescing.
+	if puts > 10 {
+		t.Errorf("%v writes to the store, expect far fewer", puts)
+	}
+}
+
+func TestInitApplyBatchSize(t *testing.T) {
+	packetRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"@@max_allowed_packet"}).AddRow(65536)
+	}
+
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		ApplyBatchSizeBytes: 1024 * 1024,
+	}})
+	mock.ExpectQuery("select @@max_allowed_packet").WillReturnRows(packetRows())
+	if err := a.initApplyBatchSize(); err == nil || !strings.Contains(err.Error(), "ApplyBatchSizeBytes") {
+		t.Errorf("expect an error on a batch size exceeding max_allowed_packet, got %v", err)
+	}
+
+	a.mysqlContext.ClampApplyBatchSize = true
+	mock.ExpectQuery("select @@max_allowed_packet").WillReturnRows(packetRows())
+	if err := a.initApplyBatchSize(); err != nil {
+		t.Fatal(err)
+	}
+	if a.applyBatchSize != 32768 {
+		t.Errorf("applyBatchSize %v, expect clamped to 32768", a.applyBatchSize)
+	}
+
+	// the default batch size fits the packet without an error
+	a.mysqlContext.ApplyBatchSizeBytes = 0
+	a.mysqlContext.ClampApplyBatchSize = false
+	mock.ExpectQuery("select @@max_allowed_packet").WillReturnRows(packetRows())
+	if err := a.initApplyBatchSize(); err != nil {
+		t.Fatal(err)
+	}
+	if a.applyBatchSize != 32768 {
+		t.Errorf("applyBatchSize %v, expect 32768", a.applyBatchSize)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// rows are split into statements of the batch size
+	a.applyBatchSize = 8
+	v1, v2 := []byte("1"), []byte("2")
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ColumnTypes: []string{"int(11)"},
+		ValuesX:     [][]*[]byte{{&v1}, {&v2}},
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1')").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("replace into `db1`.`t1`  values ('2')").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyEventQueriesGeometrySRID(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+
+	srcTable := common.NewTable("db1", "t1")
+	srcTable.OriginalTableColumns = common.NewColumnList([]umconf.Column{
+		{RawName: "id", ColumnType: "int(11)"},
+		{RawName: "g", ColumnType: "point"},
+	})
+	tableBs, err := common.EncodeTable(srcTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// POINT(1 2) with SRID 4326 in the internal format
+	wkb := []byte{0x01, 0x01, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 0, 0, 0, 0, 0, 0, 0, 0x40}
+	id1, g1 := []byte("1"), append([]byte{0xe6, 0x10, 0, 0}, wkb...)
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ColumnTypes: []string{"int(11)", "point"},
+		ValuesX:     [][]*[]byte{{&id1, &g1}},
+		Table:       tableBs,
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("show columns from `db1`.`t1`").WillReturnRows(
+		sqlmock.NewRows([]string{"Field", "Type", "Null", "Key", "Default", "Extra"}).
+			AddRow("id", "int(11)", "NO", "PRI", nil, "").
+			AddRow("g", "point", "NO", "", nil, ""))
+	mock.ExpectQuery("select * from information_schema.columns where table_schema=? and table_name=?").
+		WithArgs("db1", "t1").WillReturnRows(
+		sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "DATETIME_PRECISION", "SRS_ID"}).
+			AddRow("id", "int(11)", nil, nil).
+			AddRow("g", "point", nil, "4326"))
+	// the SRID is kept in the hex literal
+	mock.ExpectExec(fmt.Sprintf("replace into `db1`.`t1`  values ('1',X'%X')", g1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+
+	// a value with another SRID is rejected before writing
+	id2, g2 := []byte("2"), append([]byte{0, 0, 0, 0}, wkb...)
+	entry = &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ColumnTypes: []string{"int(11)", "point"},
+		ValuesX:     [][]*[]byte{{&id2, &g2}},
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	err = a.ApplyEventQueries(a.db, entry)
+	if err == nil || !strings.Contains(err.Error(), "SRID 4326") || !strings.Contains(err.Error(), "db1.t1") {
+		t.Errorf("expect an SRID mismatch error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckTargetDatabases(t *testing.T) {
+	cfg := &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		ReplicateDoDb: []*common.DataSource{
+			{TableSchema: "db1", TableSchemaRename: "db1_new"},
+			{TableSchemaRegex: "db(.*)"},
+		},
+		Gtid: "acd7d195-06cd-11e9-928f-02000aba3e28:1-100", // incremental only
+	}}
+	schemaExists := "select count(*) from information_schema.SCHEMATA where SCHEMA_NAME = ?"
+
+	a, mock := newTestApplier(t, cfg)
+	mock.ExpectQuery(schemaExists).WithArgs("db1_new").
+		WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(0))
+	err := a.checkTargetDatabases()
+	if err == nil || !strings.Contains(err.Error(), "target database db1_new does not exist") {
+		t.Errorf("expect an error on the missing database, got %v", err)
+	}
+
+	cfg.AutoCreateDatabase = true
+	mock.ExpectQuery(schemaExists).WithArgs("db1_new").
+		WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(0))
+	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS `db1_new`").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := a.checkTargetDatabases(); err != nil {
+		t.Fatal(err)
+	}
+
+	// no privilege to create it
+	mock.ExpectQuery(schemaExists).WithArgs("db1_new").
+		WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(0))
+	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS `db1_new`").WillReturnError(&mysql.MySQLError{
+		Number: 1044, Message: "Access denied for user 'u1'@'%' to database 'db1_new'"})
+	err = a.checkTargetDatabases()
+	if err == nil || !strings.Contains(err.Error(), "cannot be created") {
+		t.Errorf("expect an error on creating the database, got %v", err)
+	}
+
+	// an existing database is left as is
+	mock.ExpectQuery(schemaExists).WithArgs("db1_new").
+		WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(1))
+	if err := a.checkTargetDatabases(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyEventQueriesGIPK(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+
+	// the source table has no primary key
+	srcTable := common.NewTable("db1", "t1")
+	srcTable.OriginalTableColumns = common.NewColumnList([]umconf.Column{
+		{RawName: "a", ColumnType: "int(11)"},
+		{RawName: "b", ColumnType: "varchar(10)"},
+	})
+	tableBs, err := common.EncodeTable(srcTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a1, b1, a2, b2 := []byte("1"), []byte("x"), []byte("2"), []byte("y")
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ColumnTypes: []string{"int(11)", "varchar(10)"},
+		ValuesX:     [][]*[]byte{{&a1, &b1}, {&a2, &b2}},
+		Table:       tableBs,
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("show columns from `db1`.`t1`").WillReturnRows(
+		sqlmock.NewRows([]string{"Field", "Type", "Null", "Key", "Default", "Extra"}).
+			AddRow("my_row_id", "bigint unsigned", "NO", "PRI", nil, "auto_increment INVISIBLE").
+			AddRow("a", "int(11)", "YES", "", nil, "").
+			AddRow("b", "varchar(10)", "YES", "", nil, ""))
+	mock.ExpectQuery("select * from information_schema.columns where table_schema=? and table_name=?").
+		WithArgs("db1", "t1").WillReturnRows(
+		sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "DATETIME_PRECISION"}).
+			AddRow("my_row_id", "bigint unsigned", nil).
+			AddRow("a", "int(11)", nil).
+			AddRow("b", "varchar(10)", nil))
+	mock.ExpectExec("replace into `db1`.`t1` (`a`, `b`) values ('1','x'),('2','y')").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+
+	// later chunks use the same column list
+	entry = &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ColumnTypes: []string{"int(11)", "varchar(10)"},
+		ValuesX:     [][]*[]byte{{&a1, &b1}},
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("replace into `db1`.`t1` (`a`, `b`) values ('1','x')").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckJobFinishTransientStoreError(t *testing.T) {
+	// consul is unreachable for a moment
+	s := common.NewMemStore(nil)
+	s.GetErrs = []error{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	sm := common.NewMemStoreManager(s, hclog.NewNullLogger())
+	if err := sm.SaveJobInfo(common.JobListItemV2{JobId: "job1", JobStatus: common.DtleJobStatusNonPaused}); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &Applier{
+		logger:       hclog.NewNullLogger(),
+		subject:      "job1",
+		mysqlContext: &common.MySQLDriverConfig{},
+		storeManager: sm,
+		shutdownCh:   make(chan struct{}),
+	}
+	a.checkJobFinish()
+	if a.shutdown {
+		t.Errorf("expect the task to survive a transient store error")
+	}
+	if s.Gets != 2 {
+		t.Errorf("expect GetJobStatus to be retried once, got %v gets", s.Gets)
+	}
+}
+
+func TestApplyEventQueriesOutputFile(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		OutputMode:          common.OutputModeFile,
+		OutputFile:          filepath.Join(t.TempDir(), "out.sql"),
+		SkipIncrementalCopy: true,
+	}})
+	if err := a.initOutputFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	value := func(s string) *[]byte {
+		bs := []byte(s)
+		return &bs
+	}
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		DbSQL:       "CREATE DATABASE IF NOT EXISTS `db1`",
+		TbSQL:       []string{"USE `db1`", "CREATE TABLE `db1`.`t1` (`id` INT, `name` VARCHAR(20))"},
+		ColumnTypes: []string{"int", "varchar(20)"},
+		ValuesX:     [][]*[]byte{{value("1"), value("O'Brien; \\")}, {value("2"), nil}},
+	}
+	// nothing is executed on the target
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if err := a.outputFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := ioutil.ReadFile(a.mysqlContext.OutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "BEGIN;\n" +
+		querySetFKChecksOff + ";\n" +
+		"CREATE DATABASE IF NOT EXISTS `db1`;\n" +
+		"USE `db1`;\n" +
+		"CREATE TABLE `db1`.`t1` (`id` INT, `name` VARCHAR(20));\n" +
+		"replace into `db1`.`t1`  values ('1','O\\'Brien; \\\\'),('2',NULL);\n" +
+		"COMMIT;\n"
+	if string(bs) != expected {
+		t.Errorf("unexpected output:\n%s\nexpect:\n%s", bs, expected)
+	}
+	// re-runnable: every statement can be parsed
+	stmts, _, err := parser.New().Parse(string(bs), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) != 7 {
+		t.Errorf("expect 7 statements, got %v", len(stmts))
+	}
+}
+
+func TestApplyEventQueriesExplicitDefaultsForTimestamp(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+
+	// the source (ON) differs from the target (OFF)
+	mock.ExpectQuery("select @@explicit_defaults_for_timestamp").
+		WillReturnRows(sqlmock.NewRows([]string{"@@explicit_defaults_for_timestamp"}).AddRow(0))
+	mock.ExpectExec("SET @@session.explicit_defaults_for_timestamp = ON").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET character_set_server = utf8mb4").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET @@session.explicit_defaults_for_timestamp = ON").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	err := a.ApplyEventQueries(a.db, &common.DumpEntry{
+		SystemVariables: [][2]string{{"character_set_server", "utf8mb4"}, {"explicit_defaults_for_timestamp", "ON"}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+
+	// the table is created and NULL is inserted into the TIMESTAMP column as on the source
+	id, v := []byte("1"), []byte("2021-01-01 00:00:00")
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET @@session.explicit_defaults_for_timestamp = ON").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE `db1`.`t1` (`id` INT, `ts` TIMESTAMP)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1',NULL),('1','2021-01-01 00:00:00')").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	err = a.ApplyEventQueries(a.db, &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		TbSQL:       []string{"CREATE TABLE `db1`.`t1` (`id` INT, `ts` TIMESTAMP)"},
+		ValuesX:     [][]*[]byte{{&id, nil}, {&id, &v}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same value
+	a, mock = newTestApplier(t, &common.MySQLDriverConfig{})
+	mock.ExpectQuery("select @@explicit_defaults_for_timestamp").
+		WillReturnRows(sqlmock.NewRows([]string{"@@explicit_defaults_for_timestamp"}).AddRow(1))
+	if r, err := a.matchExplicitDefaultsForTimestamp([][2]string{{"explicit_defaults_for_timestamp", "ON"}}); err != nil ||
+		len(r) != 0 || a.explicitDefaultsStatement != "" {
+		t.Errorf("expect nothing to be set. got %v %v %q", r, err, a.explicitDefaultsStatement)
+	}
+
+	// the target does not allow setting it
+	mock.ExpectQuery("select @@explicit_defaults_for_timestamp").
+		WillReturnRows(sqlmock.NewRows([]string{"@@explicit_defaults_for_timestamp"}).AddRow(1))
+	mock.ExpectExec("SET @@session.explicit_defaults_for_timestamp = OFF").
+		WillReturnError(&mysql.MySQLError{Number: 1238, Message: "Variable is a read only variable"})
+	if _, err := a.matchExplicitDefaultsForTimestamp([][2]string{{"explicit_defaults_for_timestamp", "OFF"}}); err != nil ||
+		a.explicitDefaultsStatement != "" {
+		t.Errorf("expect only a warning. got %v %q", err, a.explicitDefaultsStatement)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubscribeNatsFullCopy(t *testing.T) {
+	s, err := gnatsd.NewServer(&gnatsd.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	defer s.Shutdown()
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+	nc, err := gonats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+	a.subject = "job1"
+	a.natsConn = nc
+	a.memory1 = new(int64)
+	a.memory2 = new(int64)
+	a.shutdownCh = make(chan struct{})
+	defer close(a.shutdownCh)
+	a.rowCopyComplete = make(chan struct{})
+	a.fullBytesQueue = make(chan []byte, 16)
+	a.dumpEntryQueue = make(chan *common.DumpEntry, 8)
+	a.gtidCh = make(chan common.CoordinatesI, 1)
+	gs, _ := gomysql.ParseMysqlGTIDSet("")
+	a.gtidSet = gs.(*gomysql.MysqlGTIDSet)
+	a.ai = &ApplierIncr{incrBytesQueue: make(chan []byte, 10), sourceType: "mysql"}
+	if err := a.subscribeNats(); err != nil {
+		t.Fatal(err)
+	}
+	go a.doFullCopy()
+
+	for i := 1; i <= 2; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(fmt.Sprintf("replace into `db1`.`t1`  values ('%v')", i)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		val := []byte(fmt.Sprint(i))
+		bs, err := common.Encode(&common.DumpEntry{
+			TableSchema: "db1",
+			TableName:   "t1",
+			ValuesX:     [][]*[]byte{{&val}},
+			TotalCount:  1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := nc.Request("job1_full", bs, 5*time.Second); err != nil {
+			t.Fatalf("full: %v", err)
+		}
+	}
+
+	bs, err := common.Encode(&common.DumpStatResult{
+		Coord: &common.MySQLCoordinates{LogFile: "bin.000001", LogPos: 4,
+			GtidSet: "00000000-0000-0000-0000-000000000001:1-10"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// acked after all dump entries are applied
+	if _, err := nc.Request("job1_full_complete", bs, 10*time.Second); err != nil {
+		t.Fatalf("full_complete: %v", err)
+	}
+	select {
+	case <-a.rowCopyComplete:
+	default:
+		t.Fatal("expect rowCopyComplete to be closed")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&a.nDumpEntry); n != 0 {
+		t.Errorf("expect all dump entries applied. got %v", n)
+	}
+	if a.gtidSet.String() != "00000000-0000-0000-0000-000000000001:1-10" || a.mysqlContext.BinlogFile != "bin.000001" {
+		t.Errorf("unexpected position after full copy. gtid %v file %v", a.gtidSet, a.mysqlContext.BinlogFile)
+	}
+	if coord := <-a.gtidCh; coord != nil {
+		t.Errorf("expect a gtid update request")
+	}
+}
+
+func TestNatsReconnectSubscribeIncr(t *testing.T) {
+	s, err := gnatsd.NewServer(&gnatsd.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	defer s.Shutdown()
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+
+	a, _ := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		NatsMaxReconnects:   -1,
+		NatsReconnectWaitMs: 100,
+	}})
+	a.subject = "job1"
+	a.NatsAddr = s.ClientURL()
+	a.memory2 = new(int64)
+	a.shutdownCh = make(chan struct{})
+	a.ai = &ApplierIncr{incrBytesQueue: make(chan []byte, 10)}
+	if err := a.initNatSubClient(); err != nil {
+		t.Fatal(err)
+	}
+	a.incrNMM = common.NewNatsMsgMerger(a.logger)
+	if err := a.subscribeIncr(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		// closing the connection on shutdown is not an error
+		a.shutdownLock.Lock()
+		a.shutdown = true
+		a.shutdownLock.Unlock()
+		a.natsConn.Close()
+		close(a.shutdownCh)
+	}()
+	if a.natsConn.Opts.MaxReconnect != -1 || a.natsConn.Opts.ReconnectWait != 100*time.Millisecond {
+		t.Errorf("unexpected reconnect options %v %v", a.natsConn.Opts.MaxReconnect, a.natsConn.Opts.ReconnectWait)
+	}
+
+	sendIncr := func(data string) {
+		nc, err := gonats.Connect(s.ClientURL())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer nc.Close()
+		if _, err := nc.Request("job1_incr_hete", []byte(data), 5*time.Second); err != nil {
+			t.Fatalf("incr: %v", err)
+		}
+		if bs := <-a.ai.incrBytesQueue; string(bs) != data {
+			t.Errorf("got %q, want %q", bs, data)
+		}
+	}
+	sendIncr("tx1")
+
+	// a kept subscription is not subscribed again
+	sub := a.incrSub
+	a.onNatsReconnect(a.natsConn)
+	if a.incrSub != sub {
+		t.Errorf("expect the subscription to be kept")
+	}
+
+	// the subscription is lost when the connection is dropped
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	a.onNatsReconnect(a.natsConn)
+	if a.incrSub == sub || !a.incrSub.IsValid() {
+		t.Fatalf("expect the subscription to be re-created")
+	}
+	sendIncr("tx2")
+}
+
+func TestNatsSubscribeRetry(t *testing.T) {
+	// the server is started after the first attempt to connect
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	s, err := gnatsd.NewServer(&gnatsd.Options{Host: "127.0.0.1", Port: port, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown()
+
+	a, _ := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		NatsSubscribeRetries:     20,
+		NatsSubscribeRetryWaitMs: 50,
+	}})
+	a.NatsAddr = fmt.Sprintf("nats://127.0.0.1:%v", port)
+	a.shutdownCh = make(chan struct{})
+	attempts := 0
+	err = a.retryNats("connect", func() error {
+		attempts += 1
+		if attempts == 2 {
+			go s.Start()
+		}
+		_, err := gonats.Connect(a.NatsAddr)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts < 2 {
+		t.Errorf("expect the first attempt to fail. attempts %v", attempts)
+	}
+	if err := a.initNatSubClient(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		a.shutdownLock.Lock()
+		a.shutdown = true
+		a.shutdownLock.Unlock()
+		a.natsConn.Close()
+		close(a.shutdownCh)
+	}()
+
+	// a transient error, then the subscription
+	attempts = 0
+	var sub *gonats.Subscription
+	err = a.retryNats("subscribe", func() (err error) {
+		attempts += 1
+		if attempts == 1 {
+			return gonats.ErrNoServers
+		}
+		sub, err = a.natsConn.Subscribe("job1_incr_hete", func(m *gonats.Msg) {})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 || sub == nil || !sub.IsValid() {
+		t.Errorf("expect to subscribe on the 2nd attempt. attempts %v", attempts)
+	}
+
+	// a permanent error is not retried
+	attempts = 0
+	err = a.retryNats("subscribe", func() error {
+		attempts += 1
+		return gonats.ErrBadSubject
+	})
+	if err != gonats.ErrBadSubject || attempts != 1 {
+		t.Errorf("expect no retry on a permanent error. err %v attempts %v", err, attempts)
+	}
+}
+
+func TestMaxBufferedBytesBackpressure(t *testing.T) {
+	s, err := gnatsd.NewServer(&gnatsd.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	defer s.Shutdown()
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+	nc, err := gonats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	a, _ := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		MaxBufferedBytes: 100,
+	}})
+	a.subject = "job1"
+	a.natsConn = nc
+	a.memory1 = new(int64)
+	a.memory2 = new(int64)
+	a.shutdownCh = make(chan struct{})
+	defer close(a.shutdownCh)
+	a.rowCopyComplete = make(chan struct{})
+	a.ai = &ApplierIncr{incrBytesQueue: make(chan []byte, 10)}
+	if err := a.subscribeNats(); err != nil {
+		t.Fatal(err)
+	}
+
+	acks := make(chan struct{}, 10)
+	if _, err := nc.Subscribe("job1_reply", func(m *gonats.Msg) {
+		acks <- struct{}{}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	send := func() {
+		if err := nc.PublishRequest("job1_incr_hete", "job1_reply", make([]byte, 60)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 60 bytes buffered. below the cap.
+	send()
+	select {
+	case <-acks:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect an ack below MaxBufferedBytes")
+	}
+	// 120 bytes buffered. past the cap.
+	send()
+	select {
+	case <-acks:
+		t.Fatal("expect acks to be paused past MaxBufferedBytes")
+	case <-time.After(500 * time.Millisecond):
+	}
+	if atomic.LoadInt32(&a.nBackpressure) != 1 {
+		t.Errorf("expect backpressure to be active")
+	}
+
+	// the queue is drained by applying
+	<-a.ai.incrBytesQueue
+	<-a.ai.incrBytesQueue
+	atomic.StoreInt64(a.memory2, 0)
+	select {
+	case <-acks:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect acks to resume after draining")
+	}
+	// the flag is cleared after the handler returns
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&a.nBackpressure) != 0 {
+		t.Errorf("expect backpressure to be inactive")
+	}
+}
+
+func TestCheckSqlCommentPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "/*+ route_to_master */", "/* master */"} {
+		if err := checkSqlCommentPrefix(prefix); err != nil {
+			t.Errorf("%q: %v", prefix, err)
+		}
+	}
+	for _, prefix := range []string{"route_to_master", "-- master", "/*! set autocommit=1 */",
+		"/* a */ select 1; /* b */", "/* unclosed"} {
+		if err := checkSqlCommentPrefix(prefix); err == nil {
+			t.Errorf("%q: expect error", prefix)
+		}
+	}
+
+	// the prefixed statement is still parsed as one
+	stmts, _, err := parser.New().Parse(prefixSqlComment("/*+ route_to_master */",
+		"replace into `a`.`t1` values ('1','x')"), "", "")
+	if err != nil || len(stmts) != 1 {
+		t.Errorf("unexpected parse result %v %v", len(stmts), err)
+	}
+}
+
+func TestApplyEventQueriesSqlCommentPrefix(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		SqlCommentPrefix: "/*+ route_to_master */",
+	}})
+	id := []byte("1")
+	entry := &common.DumpEntry{
+		TableSchema: "a",
+		TableName:   "t1",
+		ColumnTypes: []string{"int(11)"},
+		ValuesX:     [][]*[]byte{{&id}},
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec("/*+ route_to_master */ " + querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("/*+ route_to_master */ replace into `a`.`t1`  values ('1')").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWatchTargetGtidEmpty(t *testing.T) {
+	s := common.NewMemStore(map[string][]byte{"dtle/job1/targetGtid": []byte("")})
+	sm := common.NewMemStoreManager(s, hclog.NewNullLogger())
+
+	gtidSet, err := common.DtleParseMysqlGTIDSet("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Applier{
+		logger:       hclog.NewNullLogger(),
+		subject:      "job1",
+		mysqlContext: &common.MySQLDriverConfig{},
+		storeManager: sm,
+		stage:        JobIncrCopy,
+		shutdownCh:   make(chan struct{}),
+		gtidCh:       make(chan common.CoordinatesI, 4096),
+		gtidSet:      gtidSet,
+		gtidSetLock:  &sync.RWMutex{},
+	}
+	a.watchTargetGtid()
+	if a.targetGtid != nil || len(a.gtidCh) != 0 {
+		t.Fatalf("expect no stop condition for an empty target GTIDSet")
+	}
+
+	// transactions keep being applied
+	go a.updateGtidLoop()
+	sid := uuid.Must(uuid.FromString("acd7d195-06cd-11e9-928f-02000aba3e28"))
+	for gno := int64(1); gno <= 3; gno++ {
+		a.gtidCh <- &common.MySQLCoordinateTx{SID: sid, GNO: gno}
+	}
+	time.Sleep(100 * time.Millisecond)
+	a.shutdownLock.Lock()
+	shutdown := a.shutdown
+	a.shutdownLock.Unlock()
+	if shutdown {
+		t.Errorf("expect the task to keep running")
+	}
+	close(a.shutdownCh)
+}
+
+func TestBuildReplaceBatchesCanceled(t *testing.T) {
+	valuesX := make([][]*[]byte, 3*cancelCheckRows)
+	for i := range valuesX {
+		b := []byte("a")
+		valuesX[i] = []*[]byte{&b}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	// a statement of each row. cancel on the first one.
+	err := buildReplaceBatches(ctx, "a", "t", nil, "", valuesX, nil, 1, func(query string) error {
+		calls += 1
+		cancel()
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+	if calls > cancelCheckRows {
+		t.Errorf("expect to stop within %v rows, got %v statements", cancelCheckRows, calls)
+	}
+}
+
+func TestApplyEventQueriesShutdown(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+	a.shutdownCh = make(chan struct{})
+	close(a.shutdownCh)
+	val := []byte("1")
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ValuesX:     [][]*[]byte{{&val}},
+	}
+
+	// the tx is not begun after shutdown
+	if err := a.ApplyEventQueries(a.db, entry); err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if a.TotalRowsReplayed != 0 {
+		t.Errorf("TotalRowsReplayed = %v, want 0", a.TotalRowsReplayed)
+	}
+}
+
+func TestBuildReplaceBatchesSizeLimit(t *testing.T) {
+	row := func(s string) []*[]byte {
+		b := []byte(s)
+		return []*[]byte{&b}
+	}
+	build := func(valuesX [][]*[]byte, sizeLimit int) (queries []string) {
+		err := buildReplaceBatches(context.Background(), "a", "t", nil, "", valuesX, []string{"varchar(64)"}, sizeLimit,
+			func(query string) error {
+				queries = append(queries, query)
+				return nil
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return queries
+	}
+
+	valuesX := [][]*[]byte{row("aaaa"), row("bbbb"), row("cccc")}
+	twoRows := len("replace into `a`.`t`  values ('aaaa'),('bbbb')")
+
+	// 2 rows just fit
+	queries := build(valuesX, twoRows)
+	if len(queries) != 2 || queries[0] != "replace into `a`.`t`  values ('aaaa'),('bbbb')" ||
+		queries[1] != "replace into `a`.`t`  values ('cccc')" {
+		t.Errorf("unexpected batches %q", queries)
+	}
+	// 2 rows are just over the limit
+	queries = build(valuesX, twoRows-1)
+	if len(queries) != 3 {
+		t.Errorf("unexpected batches %q", queries)
+	}
+	for _, query := range queries {
+		if len(query) > twoRows-1 {
+			t.Errorf("query of %v bytes exceeds the limit %v", len(query), twoRows-1)
+		}
+	}
+
+	// a row larger than the limit is sent on its own
+	big := strings.Repeat("x", 2*twoRows)
+	queries = build([][]*[]byte{row("aaaa"), row(big), row("bbbb")}, twoRows)
+	if len(queries) != 3 || queries[1] != "replace into `a`.`t`  values ('"+big+"')" {
+		t.Errorf("unexpected batches %q", queries)
+	}
+
+	// the same for parameterized statements, by the size of values
+	var nArgs []int
+	err := buildParamReplaceBatches(context.Background(), "a", "t", nil, "", [][]*[]byte{row("aaaa"), row(big), row("bbbb"), row("cccc")},
+		[]string{"varchar(64)"}, 8, maxPlaceholders, func(query string, args []interface{}) error {
+			nArgs = append(nArgs, len(args))
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(nArgs) != "[1 1 2]" {
+		t.Errorf("unexpected batches %v", nArgs)
+	}
+}
+
+func TestBuildParamReplaceBatches(t *testing.T) {
+	bs := func(s string) *[]byte {
+		b := []byte(s)
+		return &b
+	}
+	columns := []string{"id", "name", "data"}
+	columnTypes := []string{"int", "varchar(64)", "varbinary(16)"}
+	valuesX := [][]*[]byte{
+		{bs("1"), bs("it's a \"quote\""), bs("\x00\x01")},
+		{bs("2"), nil, nil},
+		{bs("3"), bs("back\\slash\nnew line ? 中文"), bs("'")},
+		{bs("4"), bs(""), bs("\\")},
+		{bs("5"), bs("%_"), nil},
+	}
+
+	// render a parameterized statement as text, as the server would see it
+	render := func(query string, args []interface{}) string {
+		var buf bytes.Buffer
+		i := 0
+		for _, c := range query {
+			if c != '?' {
+				buf.WriteRune(c)
+				continue
+			}
+			switch arg := args[i].(type) {
+			case nil:
+				buf.WriteString("NULL")
+			case []byte:
+				buf.WriteString(sql.BuildColumnLiteral(arg, columnTypes[i%len(columns)]))
+			case string:
+				buf.WriteString(sql.BuildColumnLiteral([]byte(arg), columnTypes[i%len(columns)]))
+			default:
+				t.Fatalf("unexpected arg type %T", arg)
+			}
+			i += 1
+		}
+		if i != len(args) {
+			t.Fatalf("%v placeholders for %v args", i, len(args))
+		}
+		return buf.String()
+	}
+
+	var textQueries []string
+	err := buildReplaceBatches(context.Background(), "a", "t", columns, "", valuesX, columnTypes, 1024*1024, func(query string) error {
+		textQueries = append(textQueries, query)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !canBuildParamReplace(valuesX, maxPlaceholders) {
+		t.Fatal("expect rows of a fixed shape to be parameterized")
+	}
+	var paramQueries []string
+	err = buildParamReplaceBatches(context.Background(), "a", "t", columns, "", valuesX, columnTypes, 1024*1024, maxPlaceholders,
+		func(query string, args []interface{}) error {
+			if _, ok := args[2].([]byte); !ok {
+				t.Errorf("expect a varbinary value bound as bytes, got %T", args[2])
+			}
+			paramQueries = append(paramQueries, render(query, args))
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paramQueries) != 1 || len(textQueries) != 1 || paramQueries[0] != textQueries[0] {
+		t.Fatalf("parameterized rows differ from text rows\n%v\n%v", paramQueries, textQueries)
+	}
+
+	// at most 2 rows per statement. same sized batches share the statement.
+	var queries []string
+	var nArgs []int
+	err = buildParamReplaceBatches(context.Background(), "a", "t", columns, "", valuesX, columnTypes, 1024*1024, 2*len(columns)+1,
+		func(query string, args []interface{}) error {
+			queries = append(queries, query)
+			nArgs = append(nArgs, len(args))
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(nArgs) != "[6 6 3]" || queries[0] != queries[1] || queries[1] == queries[2] {
+		t.Errorf("bad batches %v %v", nArgs, queries)
+	}
+
+	// fall back to text
+	if canBuildParamReplace([][]*[]byte{{bs("1"), bs("2")}, {bs("1")}}, maxPlaceholders) {
+		t.Error("expect rows of different shapes not to be parameterized")
+	}
+	if canBuildParamReplace(valuesX, len(columns)-1) {
+		t.Error("expect a row over the placeholder limit not to be parameterized")
+	}
+}
+
+func TestApplyEventQueriesParameterizedBatchInsert(t *testing.T) {
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		ParameterizedBatchInsert: true,
+	}})
+	a.applyBatchSize = 1 // byte. a statement for each row
+
+	v1, v2 := []byte("1"), []byte("x'y")
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	ps := mock.ExpectPrepare("replace into `db1`.`t1`  values (?,?)")
+	ps.ExpectExec().WithArgs("1", nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	ps.ExpectExec().WithArgs("1", "x'y").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ValuesX:     [][]*[]byte{{&v1, nil}, {&v1, &v2}},
+	}
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyEventQueriesFullCopyConflictMode(t *testing.T) {
+	newEntry := func() *common.DumpEntry {
+		v1, v2, v3 := []byte("1"), []byte("a"), []byte("2")
+		return &common.DumpEntry{
+			TableSchema: "db1",
+			TableName:   "t1",
+			ColumnMapTo: []string{"id", "name"},
+			ColumnTypes: []string{"int", "varchar(16)"},
+			ValuesX:     [][]*[]byte{{&v1, &v2}, {&v3, nil}},
+		}
+	}
+	for _, c := range []struct {
+		mode  string
+		query string
+	}{
+		{"", "replace into `db1`.`t1` (`id`, `name`) values ('1','a'),('2',NULL)"},
+		{common.FullCopyConflictModeReplace, "replace into `db1`.`t1` (`id`, `name`) values ('1','a'),('2',NULL)"},
+		{common.FullCopyConflictModeInsertIgnore,
+			"insert ignore into `db1`.`t1` (`id`, `name`) values ('1','a'),('2',NULL)"},
+		{common.FullCopyConflictModeUpsert, "insert into `db1`.`t1` (`id`, `name`) values ('1','a'),('2',NULL)" +
+			" on duplicate key update `id`=values(`id`),`name`=values(`name`)"},
+	} {
+		a, mock := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+			FullCopyConflictMode: c.mode,
+		}})
+		mock.ExpectBegin()
+		mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(c.query).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+		if err := a.ApplyEventQueries(a.db, newEntry()); err != nil {
+			t.Fatalf("%v: ApplyEventQueries: %v", c.mode, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("%v: %v", c.mode, err)
+		}
+	}
+
+	// the same for parameterized statements
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		FullCopyConflictMode:     common.FullCopyConflictModeUpsert,
+		ParameterizedBatchInsert: true,
+	}})
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into `db1`.`t1` (`id`, `name`) values (?,?),(?,?)"+
+		" on duplicate key update `id`=values(`id`),`name`=values(`name`)").
+		ExpectExec().WithArgs("1", "a", "2", nil).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	if err := a.ApplyEventQueries(a.db, newEntry()); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// upsert lists all columns of the target without ColumnMapTo
+	a.mysqlContext.ParameterizedBatchInsert = false
+	entry := newEntry()
+	entry.ColumnMapTo = nil
+	a.initUpsertColumns(entry, common.NewColumnList([]umconf.Column{{RawName: "id"}, {RawName: "name"}}))
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into `db1`.`t1` (`id`, `name`) values ('1','a'),('2',NULL)" +
+		" on duplicate key update `id`=values(`id`),`name`=values(`name`)").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := buildReplaceBatches(context.Background(), "db1", "t1", nil, common.FullCopyConflictModeUpsert, newEntry().ValuesX, nil,
+		1024, func(query string) error { return nil })
+	if err == nil {
+		t.Error("expect an error on upsert without columns")
+	}
+	if err := validateFullCopyConflictMode("merge"); err == nil {
+		t.Error("expect an error on an unknown FullCopyConflictMode")
+	}
+}
+
+func TestCheckAutoIncrementCapacity(t *testing.T) {
+	table := common.NewTable("db1", "tb1")
+	table.OriginalTableColumns = common.NewColumnList([]umconf.Column{
+		{RawName: "id", ColumnType: "bigint(20)", AutoIncrement: true},
+	})
+	table.AutoIncrement = 2147483649
+	targetColumns := common.NewColumnList([]umconf.Column{{RawName: "id", ColumnType: "int(11)"}})
+	entry := &common.DumpEntry{TableSchema: "db1", TableName: "tb1"}
+
+	a, _ := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		AutoIncrementOverflow: common.AutoIncrementOverflowFail,
+	}})
+	err := a.checkAutoIncrementCapacity(entry, table, targetColumns)
+	if err == nil || !strings.Contains(err.Error(), "exceeds the max 2147483647") {
+		t.Errorf("expect an overflow error, got %v", err)
+	}
+
+	a.mysqlContext.AutoIncrementOverflow = common.AutoIncrementOverflowWarn
+	if err := a.checkAutoIncrementCapacity(entry, table, targetColumns); err != nil {
+		t.Errorf("expect only a warning, got %v", err)
+	}
+}
+
+func TestNewApplierQueueSizes(t *testing.T) {
+	newApplier := func(cfg *common.MySQLDriverConfig) (*Applier, *ApplierIncr) {
+		cfg.SetDefaultForEmpty()
+		a, err := NewApplier(&common.ExecContext{Subject: "job1"}, cfg, hclog.NewNullLogger(),
+			nil, "", nil, nil, nil, context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ai, err := NewApplierIncr(a, "mysql")
+		if err != nil {
+			t.Fatal(err)
+		}
+		close(a.shutdownCh)
+		return a, ai
+	}
+
+	a, ai := newApplier(&common.MySQLDriverConfig{})
+	if cap(a.fullBytesQueue) != common.DefaultFullBytesQueueSize || cap(a.dumpEntryQueue) != common.DefaultDumpEntryQueueSize {
+		t.Errorf("default full queue caps %v %v", cap(a.fullBytesQueue), cap(a.dumpEntryQueue))
+	}
+	if cap(ai.incrBytesQueue) != common.DefaultChannelBufferSize || cap(ai.binlogEntryQueue) != common.DefaultChannelBufferSize*2 {
+		t.Errorf("default incr queue caps %v %v", cap(ai.incrBytesQueue), cap(ai.binlogEntryQueue))
+	}
+
+	cfg := &common.MySQLDriverConfig{}
+	cfg.FullBytesQueueSize = 3
+	cfg.DumpEntryQueueSize = 5
+	cfg.IncrBytesQueueSize = 7
+	cfg.BinlogEntryQueueSize = 11
+	a, ai = newApplier(cfg)
+	if cap(a.fullBytesQueue) != 3 || cap(a.dumpEntryQueue) != 5 {
+		t.Errorf("full queue caps %v %v", cap(a.fullBytesQueue), cap(a.dumpEntryQueue))
+	}
+	if cap(ai.incrBytesQueue) != 7 || cap(ai.binlogEntryQueue) != 11 {
+		t.Errorf("incr queue caps %v %v", cap(ai.incrBytesQueue), cap(ai.binlogEntryQueue))
+	}
+}
+
+func TestSetStageSendsEvent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ev := eventer.NewEventer(ctx, hclog.NewNullLogger())
+	consumer, err := ev.TaskEvents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the eventer waits for the consumer to receive each event
+	events := make(chan *drivers.TaskEvent, 16)
+	go func() {
+		for event := range consumer {
+			events <- event
+		}
+	}()
+	a, _ := newTestApplier(t, &common.MySQLDriverConfig{})
+	a.event = ev
+	a.taskConfig = &drivers.TaskConfig{ID: "task1", Name: "dest"}
+	ai := &ApplierIncr{mysqlContext: a.mysqlContext, OnStage: a.setStage}
+
+	a.setStage(common.StageSlaveWaitingForWorkersToProcessQueue)
+	a.setStage(common.StageSlaveWaitingForWorkersToProcessQueue)
+	a.setStage(common.StageWaitingForMasterToSendEvent)
+	ai.setStage(common.StageWaitingForGtidToBeCommitted)
+	ai.setStage(common.StageWaitingForGtidToBeCommitted)
+	a.setStage(common.StageWaitingForGtidToBeCommitted)
+
+	expected := []string{common.StageSlaveWaitingForWorkersToProcessQueue,
+		common.StageWaitingForMasterToSendEvent, common.StageWaitingForGtidToBeCommitted}
+	for _, stage := range expected {
+		select {
+		case event := <-events:
+			if event.Message != stage || event.TaskID != "task1" {
+				t.Fatalf("got event %v of %v, want %v", event.Message, event.TaskID, stage)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event of %v", stage)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %v", event.Message)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if a.mysqlContext.Stage != common.StageWaitingForGtidToBeCommitted {
+		t.Errorf("Stage = %v", a.mysqlContext.Stage)
+	}
+}
+
+func TestCheckGtidConflicts(t *testing.T) {
+	const sid = "7b2a3a4e-1c1d-11ee-8b2f-0242ac120002"
+	gs, err := gomysql.ParseMysqlGTIDSet(sid + ":1-100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	executed := gs.(*gomysql.MysqlGTIDSet)
+	overlapping := sid + ":90-110"
+
+	var buf bytes.Buffer
+	a, _ := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		OnGtidConflict: common.OnGtidConflictWarn,
+	}})
+	a.logger = hclog.New(&hclog.LoggerOptions{Output: &buf})
+	if err := a.checkGtidConflicts("full copy gtid", executed, overlapping); err != nil {
+		t.Fatalf("warn: %v", err)
+	}
+	if log := buf.String(); !strings.Contains(log, "[WARN]") || !strings.Contains(log, "partially overlaps") {
+		t.Errorf("expect a warning. got %q", log)
+	}
+
+	a.mysqlContext.OnGtidConflict = common.OnGtidConflictFail
+	err = a.checkGtidConflicts("full copy gtid", executed, overlapping)
+	if err == nil || !strings.Contains(err.Error(), "partially overlaps") {
+		t.Errorf("fail: got %v", err)
+	}
+	if err := a.checkGtidConflicts("full copy gtid", executed, sid+":1-200"); err != nil {
+		t.Errorf("fail: no conflict expected. got %v", err)
+	}
+
+	a.mysqlContext.OnGtidConflict = common.OnGtidConflictIgnore
+	if err := a.checkGtidConflicts("full copy gtid", executed, overlapping); err != nil {
+		t.Errorf("ignore: %v", err)
+	}
+}
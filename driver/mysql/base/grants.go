@@ -0,0 +1,145 @@
+package base
+
+import (
+	"fmt"
+	"strings"
+
+	usql "github.com/actiontech/dtle/driver/mysql/sql"
+	"github.com/actiontech/dtle/g"
+)
+
+const (
+	PrivilegeAll                = "ALL PRIVILEGES"
+	PrivilegeSuper              = "SUPER"
+	PrivilegeReplicationClient  = "REPLICATION CLIENT"
+	PrivilegeReplicationSlave   = "REPLICATION SLAVE"
+	PrivilegeReplicationApplier = "REPLICATION_APPLIER"
+	PrivilegeSelect             = "SELECT"
+)
+
+// privileges on *.* needed by the applier if the user has neither ALL nor SUPER
+var applierDBPrivileges = []string{"ALTER", "CREATE", "DELETE", "DROP", "INDEX", "INSERT", "SELECT", "TRIGGER", "UPDATE"}
+
+// GrantsCheckResult tells which privileges of the user are present or missing for a role.
+type GrantsCheckResult struct {
+	Present []string
+	Missing []string
+}
+
+func (r *GrantsCheckResult) Has(privilege string) bool {
+	for _, p := range r.Present {
+		if p == privilege {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *GrantsCheckResult) Sufficient() bool {
+	return len(r.Missing) == 0
+}
+
+func (r *GrantsCheckResult) add(privilege string, found bool) {
+	if found {
+		r.Present = append(r.Present, privilege)
+	}
+}
+
+func showGrants(db usql.QueryAble) (grants []string, err error) {
+	err = usql.QueryRowsMap(db, `show grants for current_user()`, func(rowMap usql.RowMap) error {
+		for _, grantData := range rowMap {
+			grants = append(grants, grantData.String)
+		}
+		return nil
+	})
+	return grants, err
+}
+
+func anyGrantContains(grants []string, substrings ...string) bool {
+	for _, grant := range grants {
+		if StringContainsAll(grant, substrings...) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckExtractorGrants checks privileges of the current user for reading data and binlog.
+func CheckExtractorGrants(db usql.QueryAble, logger g.LoggerType) (*GrantsCheckResult, error) {
+	grants, err := showGrants(db)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &GrantsCheckResult{}
+	foundAll := anyGrantContains(grants, `GRANT ALL PRIVILEGES ON`)
+	foundSuper := anyGrantContains(grants, PrivilegeSuper)
+	foundReplicationClient := anyGrantContains(grants, PrivilegeReplicationClient)
+	foundReplicationSlave := anyGrantContains(grants, PrivilegeReplicationSlave)
+	foundDBAll := anyGrantContains(grants, PrivilegeSelect)
+	r.add(PrivilegeAll, foundAll)
+	r.add(PrivilegeSuper, foundSuper)
+	r.add(PrivilegeReplicationClient, foundReplicationClient)
+	r.add(PrivilegeReplicationSlave, foundReplicationSlave)
+	r.add(PrivilegeSelect, foundDBAll)
+	logger.Debug("Privileges", "Super", foundSuper, "ReplicationClient", foundReplicationClient,
+		"ReplicationSlave", foundReplicationSlave, "All", foundAll, "DBAll", foundDBAll)
+
+	if foundAll {
+		return r, nil
+	}
+	if !foundDBAll {
+		r.Missing = append(r.Missing, PrivilegeSelect)
+	}
+	if !foundReplicationSlave {
+		r.Missing = append(r.Missing, PrivilegeReplicationSlave)
+	}
+	// SUPER also works
+	if !foundReplicationClient && !foundSuper {
+		r.Missing = append(r.Missing, PrivilegeReplicationClient)
+	}
+	return r, nil
+}
+
+// CheckApplierGrants checks privileges of the current user for writing data.
+func CheckApplierGrants(db usql.QueryAble, logger g.LoggerType, setGtidNext bool) (*GrantsCheckResult, error) {
+	grants, err := showGrants(db)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &GrantsCheckResult{}
+	foundAll := anyGrantContains(grants, `GRANT ALL PRIVILEGES ON`)
+	foundSuper := anyGrantContains(grants, PrivilegeSuper, ` ON *.*`)
+	foundReplicationApplier := anyGrantContains(grants, PrivilegeReplicationApplier)
+	foundDBAll := anyGrantContains(grants, fmt.Sprintf("GRANT ALL PRIVILEGES ON `%v`.`%v`",
+		g.DtleSchemaName, g.GtidExecutedTableV4)) ||
+		anyGrantContains(grants, append(applierDBPrivileges, ` ON`)...)
+	r.add(PrivilegeAll, foundAll)
+	r.add(PrivilegeSuper, foundSuper)
+	r.add(PrivilegeReplicationApplier, foundReplicationApplier)
+	for _, p := range applierDBPrivileges {
+		r.add(p, anyGrantContains(grants, p))
+	}
+	logger.Debug("Privileges", "Super", foundSuper, "All", foundAll)
+
+	if foundAll || foundSuper {
+		return r, nil
+	}
+	if setGtidNext && !foundReplicationApplier {
+		r.Missing = append(r.Missing, PrivilegeReplicationApplier)
+	}
+	if !foundDBAll {
+		nMissing := len(r.Missing)
+		for _, p := range applierDBPrivileges {
+			if !r.Has(p) {
+				r.Missing = append(r.Missing, p)
+			}
+		}
+		if len(r.Missing) == nMissing {
+			// present, but not granted on the same level
+			r.Missing = append(r.Missing, strings.Join(applierDBPrivileges, ", ")+" ON *.*")
+		}
+	}
+	return r, nil
+}
@@ -9,10 +9,13 @@ package base
 import (
 	"bytes"
 	gosql "database/sql"
+	"encoding/binary"
 	"fmt"
 	"github.com/hashicorp/go-hclog"
 	"github.com/pingcap/tidb/types"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,6 +28,7 @@ import (
 
 	"github.com/pingcap/tidb/parser"
 	"github.com/pingcap/tidb/parser/ast"
+	"github.com/pingcap/tidb/parser/charset"
 	parsermysql "github.com/pingcap/tidb/parser/mysql"
 
 	"database/sql"
@@ -88,10 +92,12 @@ func GetTableColumns(db usql.QueryAble, databaseName, tableName string) (*common
 	columns := []umconf.Column{}
 	err := usql.QueryRowsMap(db, query, func(rowMap usql.RowMap) error {
 		aColumn := umconf.Column{
-			RawName:    rowMap.GetString("Field"),
-			ColumnType: rowMap.GetString("Type"),
-			Key:        strings.ToUpper(rowMap.GetString("Key")),
-			Nullable:   strings.ToUpper(rowMap.GetString("Null")) == "YES",
+			RawName:       rowMap.GetString("Field"),
+			ColumnType:    rowMap.GetString("Type"),
+			Key:           strings.ToUpper(rowMap.GetString("Key")),
+			Nullable:      strings.ToUpper(rowMap.GetString("Null")) == "YES",
+			Invisible:     strings.Contains(strings.ToUpper(rowMap.GetString("Extra")), "INVISIBLE"),
+			AutoIncrement: strings.Contains(strings.ToUpper(rowMap.GetString("Extra")), "AUTO_INCREMENT"),
 		}
 		if d, ok := rowMap["Default"]; ok {
 			if d.Valid {
@@ -112,15 +118,263 @@ func GetTableColumns(db usql.QueryAble, databaseName, tableName string) (*common
 	return common.NewColumnList(columns), nil
 }
 
+// GIPKColumnName is the name of the generated invisible primary key, which MySQL 8.0.30+ adds to tables
+// created without a primary key if sql_generate_invisible_primary_key is on.
+const GIPKColumnName = "my_row_id"
+
+// WithoutGIPK returns the columns without the generated invisible primary key, and whether it is found.
+func WithoutGIPK(columns *common.ColumnList) (*common.ColumnList, bool) {
+	if columns == nil {
+		return columns, false
+	}
+	col := columns.GetColumn(GIPKColumnName)
+	if col == nil || !col.Invisible || !col.IsPk() {
+		return columns, false
+	}
+	var r []umconf.Column
+	for _, c := range columns.ColumnList() {
+		if c.RawName != GIPKColumnName {
+			r = append(r, c)
+		}
+	}
+	return common.NewColumnList(r), true
+}
+
+// CheckColumnTypeCompatibility compares the source columns of `table` with the existing target columns.
+// Narrowing columns are logged as warnings. Incompatible columns are an error unless allowIncompatible.
+func CheckColumnTypeCompatibility(logger g.LoggerType, table *common.Table, targetColumns *common.ColumnList,
+	allowIncompatible bool) error {
+
+	if table == nil || table.OriginalTableColumns == nil || targetColumns == nil {
+		return nil
+	}
+
+	srcNames := table.ColumnMapFrom
+	if len(srcNames) == 0 {
+		srcNames = table.OriginalTableColumns.Names()
+	}
+	var incompatible []string
+	for i, srcName := range srcNames {
+		dstName := srcName
+		if i < len(table.ColumnMapTo) {
+			dstName = table.ColumnMapTo[i]
+		}
+		srcCol := table.OriginalTableColumns.GetColumn(srcName)
+		dstCol := targetColumns.GetColumn(dstName)
+		if srcCol == nil || dstCol == nil {
+			continue
+		}
+
+		switch umconf.CompareColumnType(srcCol, dstCol) {
+		case umconf.ColumnTypeNarrowing:
+			logger.Warn("target column type is narrower than source. data might be truncated",
+				"schema", table.TableSchema, "table", table.TableName, "column", dstName,
+				"srcType", srcCol.ColumnType, "dstType", dstCol.ColumnType)
+		case umconf.ColumnTypeIncompatible:
+			incompatible = append(incompatible, fmt.Sprintf("%v(%v -> %v)",
+				dstName, srcCol.ColumnType, dstCol.ColumnType))
+		}
+	}
+
+	if len(incompatible) > 0 {
+		if allowIncompatible {
+			logger.Warn("target column types are incompatible with source",
+				"schema", table.TableSchema, "table", table.TableName, "columns", incompatible)
+		} else {
+			return fmt.Errorf("incompatible column types for %v.%v: %v",
+				table.TableSchema, table.TableName, strings.Join(incompatible, ", "))
+		}
+	}
+	return nil
+}
+
+// NumericAttrMismatch is a numeric column whose UNSIGNED/ZEROFILL attribute differs
+// between source and target.
+type NumericAttrMismatch struct {
+	Index       int // index of the column in a dumped row
+	Column      string
+	SrcUnsigned bool
+	DstUnsigned bool
+	SrcZerofill bool
+	DstZerofill bool
+	// max value of a signed integer target column. 0 if not applicable.
+	DstSignedMax uint64
+}
+
+func (m *NumericAttrMismatch) SignednessDiffers() bool {
+	return m.SrcUnsigned != m.DstUnsigned
+}
+
+// Clamp limits a source value into the range of the target column.
+func (m *NumericAttrMismatch) Clamp(value string) string {
+	switch {
+	case m.SrcUnsigned && !m.DstUnsigned:
+		if m.DstSignedMax == 0 {
+			return value
+		}
+		v, err := strconv.ParseUint(value, 10, 64)
+		if err == nil && v > m.DstSignedMax {
+			return strconv.FormatUint(m.DstSignedMax, 10)
+		}
+	case !m.SrcUnsigned && m.DstUnsigned:
+		if strings.HasPrefix(value, "-") {
+			return "0"
+		}
+	}
+	return value
+}
+
+// FindNumericAttrMismatches compares UNSIGNED/ZEROFILL of numeric columns between the source
+// table and the target columns. Column attributes should be filled by ApplyColumnTypes.
+func FindNumericAttrMismatches(table *common.Table, targetColumns *common.ColumnList) (r []NumericAttrMismatch) {
+	if table == nil || table.OriginalTableColumns == nil || targetColumns == nil {
+		return nil
+	}
+	srcNames := table.ColumnMapFrom
+	if len(srcNames) == 0 {
+		srcNames = table.OriginalTableColumns.Names()
+	}
+	for i, srcName := range srcNames {
+		dstName := srcName
+		if i < len(table.ColumnMapTo) {
+			dstName = table.ColumnMapTo[i]
+		}
+		srcCol := table.OriginalTableColumns.GetColumn(srcName)
+		dstCol := targetColumns.GetColumn(dstName)
+		if srcCol == nil || dstCol == nil {
+			continue
+		}
+		if srcCol.IsUnsigned == dstCol.IsUnsigned && srcCol.IsZerofill == dstCol.IsZerofill {
+			continue
+		}
+		m := NumericAttrMismatch{
+			Index:       i,
+			Column:      dstName,
+			SrcUnsigned: srcCol.IsUnsigned,
+			DstUnsigned: dstCol.IsUnsigned,
+			SrcZerofill: srcCol.IsZerofill,
+			DstZerofill: dstCol.IsZerofill,
+		}
+		m.DstSignedMax, _ = umconf.IntegerSignedMax(dstCol)
+		r = append(r, m)
+	}
+	return r
+}
+
+// AutoIncrementCapacity is the AUTO_INCREMENT value of a source table against the max of
+// the target column.
+type AutoIncrementCapacity struct {
+	Column string
+	// the max value on the source, i.e. AUTO_INCREMENT - 1
+	Value uint64
+	Max   uint64
+}
+
+func (c *AutoIncrementCapacity) Overflows() bool {
+	return c.Value > c.Max
+}
+
+// Near tells if the value has used up 90% of the target column.
+func (c *AutoIncrementCapacity) Near() bool {
+	return c.Value >= c.Max/10*9
+}
+
+// GetAutoIncrementCapacity finds the target column of the AUTO_INCREMENT column of the source
+// table. ok is false if there is none, or the target column is not an integer.
+func GetAutoIncrementCapacity(table *common.Table, targetColumns *common.ColumnList) (
+	r AutoIncrementCapacity, ok bool) {
+
+	if table == nil || table.AutoIncrement == 0 || table.OriginalTableColumns == nil || targetColumns == nil {
+		return r, false
+	}
+	for _, srcCol := range table.OriginalTableColumns.ColumnList() {
+		if !srcCol.AutoIncrement {
+			continue
+		}
+		dstName := srcCol.RawName
+		for i, name := range table.ColumnMapFrom {
+			if name == srcCol.RawName && i < len(table.ColumnMapTo) {
+				dstName = table.ColumnMapTo[i]
+				break
+			}
+		}
+		dstCol := targetColumns.GetColumn(dstName)
+		if dstCol == nil {
+			return r, false
+		}
+		max, isInteger := umconf.IntegerMax(dstCol)
+		if !isInteger {
+			return r, false
+		}
+		return AutoIncrementCapacity{Column: dstName, Value: table.AutoIncrement - 1, Max: max}, true
+	}
+	return r, false
+}
+
+// IsCaseInsensitiveCollation tells if values of the collation compare case-insensitively,
+// e.g. utf8mb4_general_ci. Binary and *_bin/*_cs collations are case-sensitive.
+func IsCaseInsensitiveCollation(collation string) bool {
+	return strings.HasSuffix(strings.ToLower(collation), "_ci")
+}
+
+// KeyCollationMismatch is a column of the chosen unique key whose target collation is
+// case-insensitive while the source collation is case-sensitive.
+type KeyCollationMismatch struct {
+	Column       string
+	SrcCollation string
+	DstCollation string
+}
+
+// CheckKeyCollations compares collations of the columns of the unique key chosen by the source
+// (table.UseUniqueKey) with the target columns, and warns on each column where the target is less
+// strict. Values differing only in case are distinct keys on the source but duplicates on the
+// target, on which `replace into` fails with error 1062 or overwrites another row.
+// Column attributes should be filled by ApplyColumnTypes.
+func CheckKeyCollations(logger g.LoggerType, table *common.Table,
+	targetColumns *common.ColumnList) (r []KeyCollationMismatch) {
+
+	if table == nil || table.UseUniqueKey == nil || targetColumns == nil {
+		return nil
+	}
+	for _, srcCol := range table.UseUniqueKey.Columns.Columns {
+		dstName := srcCol.RawName
+		for i, name := range table.ColumnMapFrom {
+			if name == srcCol.RawName && i < len(table.ColumnMapTo) {
+				dstName = table.ColumnMapTo[i]
+				break
+			}
+		}
+		dstCol := targetColumns.GetColumn(dstName)
+		if dstCol == nil || srcCol.Collation == "" || dstCol.Collation == "" {
+			continue
+		}
+		if IsCaseInsensitiveCollation(srcCol.Collation) || !IsCaseInsensitiveCollation(dstCol.Collation) {
+			continue
+		}
+		logger.Warn("target collation of a unique key column is case-insensitive while the source is not."+
+			" rows with keys differing only in case might fail with duplicate-key error 1062",
+			"schema", table.TableSchema, "table", table.TableName, "key", table.UseUniqueKey.Name,
+			"column", dstName, "srcCollation", srcCol.Collation, "dstCollation", dstCol.Collation)
+		r = append(r, KeyCollationMismatch{
+			Column:       dstName,
+			SrcCollation: srcCol.Collation,
+			DstCollation: dstCol.Collation,
+		})
+	}
+	return r
+}
+
 func GetSomeSysVars(db usql.QueryAble, logger g.LoggerType) (r struct {
 	Err                 error
 	Version             string
 	TimeZome            string
 	LowerCaseTableNames umconf.LowerCaseTableNamesValue
 	NetWriteTimeout     int
+	MaxConnections      int
 }) {
-	query := `select @@version, @@time_zone, @@lower_case_table_names, @@net_write_timeout`
-	r.Err = db.QueryRow(query).Scan(&r.Version, &r.TimeZome, &r.LowerCaseTableNames, &r.NetWriteTimeout)
+	query := `select @@version, @@time_zone, @@lower_case_table_names, @@net_write_timeout, @@max_connections`
+	r.Err = db.QueryRow(query).Scan(&r.Version, &r.TimeZome, &r.LowerCaseTableNames, &r.NetWriteTimeout,
+		&r.MaxConnections)
 	if r.Err != nil {
 		return
 	}
@@ -134,10 +388,88 @@ func GetSomeSysVars(db usql.QueryAble, logger g.LoggerType) (r struct {
 	logger.Info("got sys_var timezone", "value", r.TimeZome)
 	logger.Info("got sys_var lower_case_table_names", "value", r.LowerCaseTableNames)
 	logger.Info("got sys_var net_write_timeout", "value", r.NetWriteTimeout)
+	logger.Info("got sys_var max_connections", "value", r.MaxConnections)
+
+	return r
+}
+
+// GetUsedConnections returns the number of current connections of the server.
+func GetUsedConnections(db usql.QueryAble) (n int, err error) {
+	query := `select count(*) from information_schema.PROCESSLIST`
+	err = db.QueryRow(query).Scan(&n)
+	return n, err
+}
+
+const (
+	// connections opened by an applier besides the parallel workers. See Applier.initDBConnections.
+	applierExtraConns = 10
+	// max parallel workers per CPU of the target
+	workersPerCPU = 2
+)
+
+type ParallelWorkersSuggestion struct {
+	ParallelWorkers int
+	MaxOpenConns    int
+	Reasons         []string
+}
+
+// SuggestParallelWorkers suggests ParallelWorkers and MaxOpenConns of an applier, which leaves
+// headroom of the target max_connections for other clients. cpuCount <= 0 means unknown.
+func SuggestParallelWorkers(maxConnections int, usedConnections int, cpuCount int) (r ParallelWorkersSuggestion) {
+	r.Reasons = append(r.Reasons, fmt.Sprintf("max_connections is %v, %v connections are in use",
+		maxConnections, usedConnections))
+
+	// keep 20% (at least 10) of max_connections for other clients
+	headroom := maxConnections / 5
+	if headroom < 10 {
+		headroom = 10
+	}
+	budget := maxConnections - usedConnections - headroom
+	r.Reasons = append(r.Reasons, fmt.Sprintf("keeping %v connections as headroom, %v connections are available",
+		headroom, budget))
 
+	r.ParallelWorkers = budget - applierExtraConns
+	r.Reasons = append(r.Reasons, fmt.Sprintf("an applier opens %v connections besides parallel workers",
+		applierExtraConns))
+
+	if cpuCount > 0 && r.ParallelWorkers > cpuCount*workersPerCPU {
+		r.ParallelWorkers = cpuCount * workersPerCPU
+		r.Reasons = append(r.Reasons, fmt.Sprintf("limited to %v workers per CPU on %v CPUs",
+			workersPerCPU, cpuCount))
+	}
+	if r.ParallelWorkers < 1 {
+		r.ParallelWorkers = 1
+		r.Reasons = append(r.Reasons, "not enough connections are available. using a single worker")
+	}
+
+	r.MaxOpenConns = applierExtraConns + r.ParallelWorkers
+	if budget < r.MaxOpenConns {
+		r.MaxOpenConns = budget
+		if r.MaxOpenConns < r.ParallelWorkers+1 {
+			r.MaxOpenConns = r.ParallelWorkers + 1
+		}
+		r.Reasons = append(r.Reasons, fmt.Sprintf("MaxOpenConns is limited to %v by available connections",
+			r.MaxOpenConns))
+	}
 	return r
 }
 
+// QueryParallelWorkersSuggestion queries max_connections and current usage of the server
+// and calls SuggestParallelWorkers.
+func QueryParallelWorkersSuggestion(db usql.QueryAble, logger g.LoggerType, cpuCount int) (
+	r ParallelWorkersSuggestion, err error) {
+
+	sysVars := GetSomeSysVars(db, logger)
+	if sysVars.Err != nil {
+		return r, sysVars.Err
+	}
+	used, err := GetUsedConnections(db)
+	if err != nil {
+		return r, err
+	}
+	return SuggestParallelWorkers(sysVars.MaxConnections, used, cpuCount), nil
+}
+
 func ShowCreateTable(db usql.QueryAble, databaseName, tableName string) (statement string, err error) {
 	var dummy, createTableStatement string
 	query := fmt.Sprintf(`show create table %s.%s`, umconf.EscapeName(databaseName), umconf.EscapeName(tableName))
@@ -199,6 +531,153 @@ func MySQL57CollationReplaceWorkaround(sql string) string {
 	return re.ReplaceAllString(sql, "${1}utf8mb4_general_ci")
 }
 
+// MySQL allows expression defaults, which are the only way to give a default to
+// TEXT/BLOB/JSON/GEOMETRY columns, since 8.0.13.
+const expressionDefaultMinVersion = 80013
+
+func TextBlobDefaultSupported(versionDigit int) bool {
+	return versionDigit >= expressionDefaultMinVersion
+}
+
+func isTextBlobType(tp byte) bool {
+	switch tp {
+	case parsermysql.TypeTinyBlob, parsermysql.TypeBlob, parsermysql.TypeMediumBlob, parsermysql.TypeLongBlob,
+		parsermysql.TypeJSON, parsermysql.TypeGeometry:
+		return true
+	default:
+		return false
+	}
+}
+
+func stripTextBlobDefault(col *ast.ColumnDef) bool {
+	if col.Tp == nil || !isTextBlobType(col.Tp.Tp) {
+		return false
+	}
+	stripped := false
+	options := col.Options[:0]
+	for _, opt := range col.Options {
+		if opt.Tp == ast.ColumnOptionDefaultValue {
+			// DEFAULT NULL is allowed by older versions
+			if v, ok := opt.Expr.(ast.ValueExpr); !ok || v.GetValue() != nil {
+				stripped = true
+				continue
+			}
+		}
+		options = append(options, opt)
+	}
+	col.Options = options
+	return stripped
+}
+
+var expressionDefaultRegexp = regexp.MustCompile(`(?i)^\s+DEFAULT\s*\(`)
+
+// stripExpressionDefaults removes `DEFAULT (expr)` clauses textually, as the parser does not support them.
+// Returns names of the affected columns, assuming the column name is the last quoted identifier
+// before the clause.
+func stripExpressionDefaults(query string) (string, []string) {
+	var buf strings.Builder
+	var columns []string
+	lastIdent := ""
+	for i := 0; i < len(query); {
+		switch c := query[i]; c {
+		case '`', '\'', '"':
+			j := i + 1
+			for ; j < len(query); j++ {
+				if query[j] == '\\' && c != '`' {
+					j++
+				} else if query[j] == c {
+					if j+1 < len(query) && query[j+1] == c { // escaped by doubling
+						j++
+					} else {
+						break
+					}
+				}
+			}
+			if j >= len(query) {
+				j = len(query) - 1
+			}
+			if c == '`' {
+				lastIdent = query[i+1 : j]
+			}
+			buf.WriteString(query[i : j+1])
+			i = j + 1
+			continue
+		}
+
+		if loc := expressionDefaultRegexp.FindStringIndex(query[i:]); loc != nil {
+			// find the matching ')'
+			depth := 0
+			j := i + loc[1] - 1
+			for ; j < len(query); j++ {
+				if query[j] == '(' {
+					depth++
+				} else if query[j] == ')' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				} else if query[j] == '\'' || query[j] == '"' {
+					q := query[j]
+					for j++; j < len(query) && query[j] != q; j++ {
+						if query[j] == '\\' {
+							j++
+						}
+					}
+				}
+			}
+			if j < len(query) {
+				columns = append(columns, lastIdent)
+				i = j + 1
+				continue
+			}
+		}
+		buf.WriteByte(query[i])
+		i++
+	}
+	return buf.String(), columns
+}
+
+// StripTextBlobDefaults removes defaults of TEXT/BLOB/JSON/GEOMETRY columns and expression defaults
+// in CREATE TABLE or ALTER TABLE, which targets before 8.0.13 reject.
+// The query is returned unchanged if there is no such default.
+// Also returns the names of columns whose defaults are removed.
+func StripTextBlobDefaults(query string) (string, []string, error) {
+	query, stripped := stripExpressionDefaults(query)
+
+	stmt, err := parser.New().ParseOneStmt(query, "", "")
+	if err != nil {
+		if len(stripped) > 0 {
+			return query, stripped, nil
+		}
+		return "", nil, err
+	}
+
+	var cols []*ast.ColumnDef
+	switch stmt := stmt.(type) {
+	case *ast.CreateTableStmt:
+		cols = stmt.Cols
+	case *ast.AlterTableStmt:
+		for _, spec := range stmt.Specs {
+			cols = append(cols, spec.NewColumns...)
+		}
+	}
+
+	nExpr := len(stripped)
+	for _, col := range cols {
+		if stripTextBlobDefault(col) {
+			stripped = append(stripped, col.Name.Name.O)
+		}
+	}
+	if len(stripped) == nExpr {
+		return query, stripped, nil
+	}
+	r, err := ParserRestore(stmt)
+	if err != nil {
+		return "", nil, err
+	}
+	return r, stripped, nil
+}
+
 func StringInterval(intervals gomysql.IntervalSlice) string {
 	buf := new(bytes.Buffer)
 
@@ -230,6 +709,11 @@ func ApplyColumnTypes(db usql.QueryAble, databaseName, tableName string, columns
 				columnsList.SetUnsigned(columnName)
 			}
 		}
+		if strings.Contains(columnType, "zerofill") {
+			for _, columnsList := range columnsLists {
+				columnsList.GetColumn(columnName).IsZerofill = true
+			}
+		}
 		if strings.Contains(columnType, "mediumint") {
 			for _, columnsList := range columnsLists {
 				columnsList.GetColumn(columnName).Type = umconf.MediumIntColumnType
@@ -321,6 +805,22 @@ func ApplyColumnTypes(db usql.QueryAble, databaseName, tableName string, columns
 				columnsList.GetColumn(columnName).Type = umconf.BitColumnType
 			}
 		}
+		if collation := m.GetString("COLLATION_NAME"); collation != "" {
+			for _, columnsList := range columnsLists {
+				if col := columnsList.GetColumn(columnName); col != nil {
+					col.Collation = collation
+				}
+			}
+		}
+		// SRS_ID exists since MySQL 8.0
+		if srid := m.GetNullInt64("SRS_ID"); srid.Valid {
+			v := uint32(srid.Int64)
+			for _, columnsList := range columnsLists {
+				if col := columnsList.GetColumn(columnName); col != nil {
+					col.SRID = &v
+				}
+			}
+		}
 		if strings.HasPrefix(columnType, "int") {
 			for _, columnsList := range columnsLists {
 				columnsList.GetColumn(columnName).Type = umconf.IntColumnType
@@ -470,6 +970,9 @@ func GetTableColumnsSqle(sqleContext *sqle.Context, schema string,
 		if parsermysql.HasUnsignedFlag(col.Tp.Flag) {
 			newColumn.IsUnsigned = true
 		}
+		if parsermysql.HasZerofillFlag(col.Tp.Flag) {
+			newColumn.IsZerofill = true
+		}
 
 		newColumn.ColumnType = col.Tp.String()
 
@@ -582,6 +1085,10 @@ func GetTableColumnsSqle(sqleContext *sqle.Context, schema string,
 			case ast.ColumnOptionReference:
 			}
 		}
+		if newColumn.IsPk() {
+			// MySQL makes primary key columns NOT NULL implicitly.
+			newColumn.Nullable = false
+		}
 
 		columns = append(columns, newColumn)
 	}
@@ -605,6 +1112,137 @@ func GetTableColumnsSqle(sqleContext *sqle.Context, schema string,
 	return r, fkParents, nil
 }
 
+// IsTableEmpty tells whether a table has no rows. A non-existing table is empty.
+// See TargetEmptyCheck for the strategies.
+func IsTableEmpty(db usql.QueryAble, databaseName, tableName string, strategy string) (bool, error) {
+	switch strategy {
+	case common.TargetEmptyCheckApproximate:
+		var tableRows gosql.NullInt64
+		err := db.QueryRow(`select TABLE_ROWS from information_schema.TABLES
+where TABLE_SCHEMA = ? and TABLE_NAME = ?`, databaseName, tableName).Scan(&tableRows)
+		if err == gosql.ErrNoRows {
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+		if tableRows.Int64 == 0 {
+			return true, nil
+		}
+		// the estimation might be stale. confirm it.
+	case common.TargetEmptyCheckExact:
+	default:
+		return false, fmt.Errorf("unknown TargetEmptyCheck %v", strategy)
+	}
+
+	var one int
+	err := db.QueryRow(fmt.Sprintf("select 1 from %v.%v limit 1",
+		umconf.EscapeName(databaseName), umconf.EscapeName(tableName))).Scan(&one)
+	if err == gosql.ErrNoRows {
+		return true, nil
+	} else if usql.IsNoSuchTableError(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// GetTableEngine returns the storage engine of a table, or "" if the table does not exist.
+func GetTableEngine(db usql.QueryAble, databaseName, tableName string) (string, error) {
+	var engine gosql.NullString
+	err := db.QueryRow(`select ENGINE from information_schema.TABLES
+where TABLE_SCHEMA = ? and TABLE_NAME = ?`, databaseName, tableName).Scan(&engine)
+	if err == gosql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return engine.String, nil
+}
+
+// SchemaExists tells whether the schema (database) exists.
+func SchemaExists(db usql.QueryAble, schema string) (bool, error) {
+	var n int
+	err := db.QueryRow(`select count(*) from information_schema.SCHEMATA where SCHEMA_NAME = ?`, schema).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// IsTransactionalEngine tells whether a storage engine supports transactions.
+// Foreign keys are supported only by transactional engines.
+func IsTransactionalEngine(engine string) bool {
+	switch strings.ToLower(engine) {
+	case "innodb", "ndbcluster", "ndb", "tokudb", "rocksdb":
+		return true
+	default:
+		return false
+	}
+}
+
+const VarExplicitDefaultsForTimestamp = "explicit_defaults_for_timestamp"
+
+// ParseOnOff parses the value of a boolean system variable, as SHOW VARIABLES or SELECT @@var returns.
+func ParseOnOff(value string) (bool, error) {
+	switch strings.ToUpper(value) {
+	case "ON", "1", "TRUE":
+		return true, nil
+	case "OFF", "0", "FALSE":
+		return false, nil
+	default:
+		return false, fmt.Errorf("bad boolean value %v", value)
+	}
+}
+
+// TimeSettings are server settings affecting how TIMESTAMP/DATETIME values are stored.
+type TimeSettings struct {
+	ExplicitDefaultsForTimestamp bool
+	// named time zones (e.g. 'Asia/Shanghai') work only if the time zone tables are loaded
+	HasTimeZoneTables bool
+}
+
+func GetTimeSettings(db usql.QueryAble) (*TimeSettings, error) {
+	r := &TimeSettings{}
+	err := db.QueryRow("select @@explicit_defaults_for_timestamp").Scan(&r.ExplicitDefaultsForTimestamp)
+	if err != nil {
+		return nil, fmt.Errorf("explicit_defaults_for_timestamp: %v", err)
+	}
+	var n int
+	err = db.QueryRow("select count(*) from mysql.time_zone_name").Scan(&n)
+	if err != nil {
+		// no privilege or no table. named time zones cannot be used anyway.
+		n = 0
+	}
+	r.HasTimeZoneTables = n > 0
+	return r, nil
+}
+
+// CompareTimeSettings returns warnings on differences of TimeSettings which affect applying
+// TIMESTAMP/DATETIME values.
+func CompareTimeSettings(src, dst *TimeSettings) (warnings []string) {
+	if src.ExplicitDefaultsForTimestamp != dst.ExplicitDefaultsForTimestamp {
+		warnings = append(warnings, fmt.Sprintf("explicit_defaults_for_timestamp differs (source %v, target %v)."+
+			" TIMESTAMP columns might get different defaults and NULL handling on the target",
+			src.ExplicitDefaultsForTimestamp, dst.ExplicitDefaultsForTimestamp))
+	}
+	if src.HasTimeZoneTables && !dst.HasTimeZoneTables {
+		warnings = append(warnings, "time zone tables are loaded on the source but not on the target."+
+			" named time zones cannot be used to convert TIMESTAMP values on the target")
+	}
+	return warnings
+}
+
+func hasStatisticsIsVisible(db usql.QueryAble) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+WHERE TABLE_SCHEMA = 'information_schema' AND TABLE_NAME = 'STATISTICS' AND COLUMN_NAME = 'IS_VISIBLE'`).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
 func GetCandidateUniqueKeys(logger g.LoggerType, db usql.QueryAble, databaseName, tableName string,
 	columns *common.ColumnList) (uniqueKeys []*common.UniqueKey, err error) {
 
@@ -616,21 +1254,32 @@ func GetCandidateUniqueKeys(logger g.LoggerType, db usql.QueryAble, databaseName
 	| val1       | val1,val2    |                 0 |            0 |
 	+------------+--------------+-------------------+--------------+
 	*/
-	query := `
-SELECT UNIQUES.INDEX_NAME, UNIQUES.COLUMN_NAMES, LOCATE('auto_increment', EXTRA) > 0 as is_auto_increment, has_nullable
+	// STATISTICS.IS_VISIBLE exists since MySQL 8.0
+	isInvisibleExpr := "0"
+	hasIsVisible, err := hasStatisticsIsVisible(db)
+	if err != nil {
+		return nil, err
+	}
+	if hasIsVisible {
+		isInvisibleExpr = "SUM(IS_VISIBLE='NO') > 0"
+	}
+	query := fmt.Sprintf(`
+SELECT UNIQUES.INDEX_NAME, UNIQUES.COLUMN_NAMES, LOCATE('auto_increment', EXTRA) > 0 as is_auto_increment, has_nullable,
+       is_invisible
 FROM INFORMATION_SCHEMA.COLUMNS
      INNER JOIN
      (SELECT TABLE_SCHEMA, TABLE_NAME, INDEX_NAME,
              GROUP_CONCAT(COLUMN_NAME ORDER BY SEQ_IN_INDEX ASC) AS COLUMN_NAMES,
              SUBSTRING_INDEX(GROUP_CONCAT(COLUMN_NAME ORDER BY SEQ_IN_INDEX ASC), ',', 1) AS FIRST_COLUMN_NAME,
-             SUM(NULLABLE='YES') > 0 AS has_nullable
+             SUM(NULLABLE='YES') > 0 AS has_nullable,
+             %v AS is_invisible
       FROM INFORMATION_SCHEMA.STATISTICS
       WHERE NON_UNIQUE=0 AND TABLE_SCHEMA = ? AND TABLE_NAME = ?
       GROUP BY TABLE_SCHEMA,TABLE_NAME,INDEX_NAME) AS UNIQUES
      ON (COLUMNS.TABLE_SCHEMA = UNIQUES.TABLE_SCHEMA
          AND COLUMNS.TABLE_NAME = UNIQUES.TABLE_NAME
          AND COLUMNS.COLUMN_NAME = UNIQUES.FIRST_COLUMN_NAME)
-WHERE COLUMNS.TABLE_SCHEMA = ? AND COLUMNS.TABLE_NAME = ?`
+WHERE COLUMNS.TABLE_SCHEMA = ? AND COLUMNS.TABLE_NAME = ?`, isInvisibleExpr)
 	/*query := `
 	    SELECT
 	      COLUMNS.TABLE_SCHEMA,
@@ -697,6 +1346,7 @@ WHERE COLUMNS.TABLE_SCHEMA = ? AND COLUMNS.TABLE_NAME = ?`
 			Columns:         *columns,
 			HasNullable:     m.GetBool("has_nullable"),
 			IsAutoIncrement: m.GetBool("is_auto_increment"),
+			IsInvisible:     m.GetBool("is_invisible"),
 			LastMaxVals:     make([]string, len(columns.Columns)),
 		}
 		uniqueKeys = append(uniqueKeys, uniqueKey)
@@ -705,6 +1355,16 @@ WHERE COLUMNS.TABLE_SCHEMA = ? AND COLUMNS.TABLE_NAME = ?`
 	if err != nil {
 		return uniqueKeys, err
 	}
+	// An invisible key is still maintained and correct for chunking, but prefer a visible one.
+	sort.SliceStable(uniqueKeys, func(i, j int) bool {
+		return !uniqueKeys[i].IsInvisible && uniqueKeys[j].IsInvisible
+	})
+	for _, uk := range uniqueKeys {
+		if uk.IsInvisible {
+			logger.Info("deprioritized invisible unique key", "schema", databaseName, "table", tableName,
+				"name", uk.Name)
+		}
+	}
 	logger.Debug("Potential unique keys.", "schema", databaseName, "table", tableName, "uniqueKeys", uniqueKeys)
 	return uniqueKeys, nil
 }
@@ -724,6 +1384,470 @@ func RenameCreateSchemaAddINE(createSchema string, newSchema string) (string, er
 
 	return ParserRestore(stmt)
 }
+
+type ForeignKey struct {
+	Name       string
+	Columns    []string
+	RefSchema  string
+	RefTable   string
+	RefColumns []string
+}
+
+// GetForeignKeys returns the foreign keys defined on the table.
+func GetForeignKeys(db usql.QueryAble, databaseName, tableName string) ([]*ForeignKey, error) {
+	query := `select CONSTRAINT_NAME, COLUMN_NAME, REFERENCED_TABLE_SCHEMA, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+		from information_schema.KEY_COLUMN_USAGE
+		where TABLE_SCHEMA = ? and TABLE_NAME = ? and REFERENCED_TABLE_NAME is not null
+		order by CONSTRAINT_NAME, ORDINAL_POSITION`
+	var fks []*ForeignKey
+	err := usql.QueryRowsMap(db, query, func(m usql.RowMap) error {
+		name := m.GetString("CONSTRAINT_NAME")
+		if len(fks) == 0 || fks[len(fks)-1].Name != name {
+			fks = append(fks, &ForeignKey{
+				Name:      name,
+				RefSchema: m.GetString("REFERENCED_TABLE_SCHEMA"),
+				RefTable:  m.GetString("REFERENCED_TABLE_NAME"),
+			})
+		}
+		fk := fks[len(fks)-1]
+		fk.Columns = append(fk.Columns, m.GetString("COLUMN_NAME"))
+		fk.RefColumns = append(fk.RefColumns, m.GetString("REFERENCED_COLUMN_NAME"))
+		return nil
+	}, databaseName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	return fks, nil
+}
+
+// ForeignKeyParentsOfDDL returns tables referenced by foreign keys of a CREATE TABLE, or added by
+// an ALTER TABLE. Tables without a schema are in currentSchema. Other statements have no parent.
+func ForeignKeyParentsOfDDL(query string, currentSchema string) ([]common.SchemaTable, error) {
+	var constraints []*ast.Constraint
+	stmt, err := sqle.ParseCreateTableStmt("mysql", query)
+	if err == nil {
+		constraints = stmt.Constraints
+	} else {
+		alterStmt, err := parser.New().ParseOneStmt(query, "", "")
+		if err != nil {
+			return nil, err
+		}
+		alter, ok := alterStmt.(*ast.AlterTableStmt)
+		if !ok {
+			return nil, nil
+		}
+		for _, spec := range alter.Specs {
+			if spec.Tp == ast.AlterTableAddConstraint && spec.Constraint != nil {
+				constraints = append(constraints, spec.Constraint)
+			}
+		}
+	}
+
+	var parents []common.SchemaTable
+	for _, cons := range constraints {
+		if cons.Tp != ast.ConstraintForeignKey || cons.Refer == nil || cons.Refer.Table == nil {
+			continue
+		}
+		parents = append(parents, common.SchemaTable{
+			Schema: g.StringElse(cons.Refer.Table.Schema.O, currentSchema),
+			Table:  cons.Refer.Table.Name.O,
+		})
+	}
+	return parents, nil
+}
+
+// buildOrphanRowsFromWhere builds `from ... where ...` matching child rows whose parent does not exist.
+func buildOrphanRowsFromWhere(databaseName, tableName string, fk *ForeignKey) string {
+	var on, where []string
+	for i := range fk.Columns {
+		on = append(on, fmt.Sprintf("c.%s = p.%s",
+			umconf.EscapeName(fk.Columns[i]), umconf.EscapeName(fk.RefColumns[i])))
+		where = append(where, fmt.Sprintf("c.%s is not null", umconf.EscapeName(fk.Columns[i])))
+	}
+	where = append(where, fmt.Sprintf("p.%s is null", umconf.EscapeName(fk.RefColumns[0])))
+	return fmt.Sprintf("from %s.%s c left join %s.%s p on %s where %s",
+		umconf.EscapeName(databaseName), umconf.EscapeName(tableName),
+		umconf.EscapeName(fk.RefSchema), umconf.EscapeName(fk.RefTable),
+		strings.Join(on, " and "), strings.Join(where, " and "))
+}
+
+// CountOrphanRows counts rows of the table referencing a non-existing parent row by `fk`.
+func CountOrphanRows(db usql.QueryAble, databaseName, tableName string, fk *ForeignKey) (n int64, err error) {
+	query := "select count(*) " + buildOrphanRowsFromWhere(databaseName, tableName, fk)
+	err = db.QueryRow(query).Scan(&n)
+	return n, err
+}
+
+// DeleteOrphanRows deletes rows of the table referencing a non-existing parent row by `fk`.
+func DeleteOrphanRows(db usql.QueryAble, databaseName, tableName string, fk *ForeignKey) (int64, error) {
+	query := "delete c " + buildOrphanRowsFromWhere(databaseName, tableName, fk)
+	r, err := db.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
+
+// TableLimits are the max number of columns and secondary indexes of an InnoDB table.
+type TableLimits struct {
+	MaxColumns int
+	MaxIndexes int
+	// innodb_page_size of the target. 0 for unknown, skipping the in-page row size check.
+	InnodbPageSize int
+}
+
+// GetTableLimits returns the known limits of a MySQL version. See common.MysqlVersionInDigit.
+const (
+	FlavorMySQL   = "mysql"
+	FlavorMariaDB = "mariadb"
+)
+
+// DetectFlavor tells MySQL or MariaDB from @@version, e.g. "10.5.12-MariaDB-log".
+func DetectFlavor(version string) string {
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		return FlavorMariaDB
+	}
+	return FlavorMySQL
+}
+
+// MySQLVersion is a parsed @@version, comparable across flavors.
+type MySQLVersion struct {
+	Major  int
+	Minor  int
+	Patch  int
+	Flavor string
+}
+
+var mysqlVersionRegexp = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)`)
+
+// ParseMySQLVersion parses @@version, e.g. "5.7.30-log", "8.0.23-14" (Percona) or "10.5.12-MariaDB-log".
+// The "5.5.5-" prefix added by MariaDB for replication compatibility is skipped.
+func ParseMySQLVersion(version string) (MySQLVersion, error) {
+	v := MySQLVersion{Flavor: DetectFlavor(version)}
+	s := strings.TrimSpace(version)
+	if v.Flavor == FlavorMariaDB {
+		s = strings.TrimPrefix(s, "5.5.5-")
+	}
+	ss := mysqlVersionRegexp.FindStringSubmatch(s)
+	if len(ss) != 4 {
+		return v, fmt.Errorf("bad format of MySQL version %v", version)
+	}
+	var err error
+	for i, p := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		if *p, err = strconv.Atoi(ss[i+1]); err != nil {
+			return v, fmt.Errorf("bad format of MySQL version %v", version)
+		}
+	}
+	return v, nil
+}
+
+// AtLeast returns true if the version is major.minor.patch or later, regardless of the flavor.
+func (v MySQLVersion) AtLeast(major, minor, patch int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
+
+// Digit returns the version in digits. See common.MysqlVersionInDigit.
+func (v MySQLVersion) Digit() int {
+	return v.Major*10000 + v.Minor*100 + v.Patch
+}
+
+func (v MySQLVersion) String() string {
+	return fmt.Sprintf("%v %v.%v.%v", v.Flavor, v.Major, v.Minor, v.Patch)
+}
+
+// ForceSingleWorker returns true if transactions cannot be applied in parallel on the target.
+// MySQL 5.6 has no logical clock for parallel apply.
+func (v MySQLVersion) ForceSingleWorker() bool {
+	return v.Flavor == FlavorMySQL && !v.AtLeast(5, 7, 0)
+}
+
+func GetTableLimits(mysqlVersionDigit int) TableLimits {
+	if mysqlVersionDigit < 50609 {
+		return TableLimits{MaxColumns: 1000, MaxIndexes: 64}
+	}
+	return TableLimits{MaxColumns: 1017, MaxIndexes: 64}
+}
+
+// CheckCreateTableLimits returns an error if the table created by `createTable` exceeds the limits.
+// Statements other than CREATE TABLE are ignored.
+func CheckCreateTableLimits(createTable string, limits TableLimits) error {
+	stmt, err := sqle.ParseCreateTableStmt("mysql", createTable)
+	if err != nil {
+		return nil
+	}
+
+	nIndexes := 0
+	for _, col := range stmt.Cols {
+		for _, option := range col.Options {
+			if option.Tp == ast.ColumnOptionUniqKey {
+				nIndexes += 1
+			}
+		}
+	}
+	for _, constraint := range stmt.Constraints {
+		switch constraint.Tp {
+		case ast.ConstraintKey, ast.ConstraintIndex, ast.ConstraintUniq, ast.ConstraintUniqKey,
+			ast.ConstraintUniqIndex, ast.ConstraintFulltext:
+			nIndexes += 1
+		}
+	}
+
+	tableName := fmt.Sprintf("%s.%s", stmt.Table.Schema.O, stmt.Table.Name.O)
+	if limits.MaxColumns > 0 && len(stmt.Cols) > limits.MaxColumns {
+		return fmt.Errorf("table %v has %v columns, exceeding the limit %v of the target",
+			tableName, len(stmt.Cols), limits.MaxColumns)
+	}
+	if limits.MaxIndexes > 0 && nIndexes > limits.MaxIndexes {
+		return fmt.Errorf("table %v has %v secondary indexes, exceeding the limit %v of the target",
+			tableName, nIndexes, limits.MaxIndexes)
+	}
+	return nil
+}
+
+const (
+	// max row size of MySQL, excluding BLOB/TEXT contents
+	maxRowSize = 65535
+	// a row is near the limit if its size exceeds this percentage of the limit
+	rowSizeWarnPercent = 90
+	// in-page bytes of a column which might be stored off-page
+	externFieldInPageSize = 40
+)
+
+// MaxInnodbRecordSize returns the max size of a record in an InnoDB page. About half of the page.
+func MaxInnodbRecordSize(innodbPageSize int) int {
+	r := innodbPageSize/2 - 66
+	if r > 16383 {
+		r = 16383
+	}
+	return r
+}
+
+func decimalStorageSize(digits int) int {
+	leftover := []int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+	return digits/9*4 + leftover[digits%9]
+}
+
+// columnStorageSize returns the max bytes of a column value, and whether the column is
+// of variable length (so it might be stored off-page by InnoDB).
+func columnStorageSize(col *ast.ColumnDef, defaultMaxlen int) (size int, variable bool) {
+	tp := col.Tp
+	maxlen := defaultMaxlen
+	if tp.Charset != "" {
+		if cs, err := charset.GetCharsetInfo(tp.Charset); err == nil {
+			maxlen = cs.Maxlen
+		}
+	}
+	flen := tp.Flen
+	if flen < 0 {
+		flen = 1
+	}
+	fsp := tp.Decimal
+	if fsp < 0 {
+		fsp = 0
+	}
+
+	switch tp.Tp {
+	case parsermysql.TypeTiny:
+		return 1, false
+	case parsermysql.TypeShort:
+		return 2, false
+	case parsermysql.TypeInt24:
+		return 3, false
+	case parsermysql.TypeLong, parsermysql.TypeFloat:
+		return 4, false
+	case parsermysql.TypeLonglong, parsermysql.TypeDouble:
+		return 8, false
+	case parsermysql.TypeNewDecimal:
+		if tp.Flen < 0 {
+			flen = 10
+		}
+		return decimalStorageSize(flen-fsp) + decimalStorageSize(fsp), false
+	case parsermysql.TypeYear:
+		return 1, false
+	case parsermysql.TypeDate:
+		return 3, false
+	case parsermysql.TypeDuration:
+		return 3 + (fsp+1)/2, false
+	case parsermysql.TypeDatetime:
+		return 5 + (fsp+1)/2, false
+	case parsermysql.TypeTimestamp:
+		return 4 + (fsp+1)/2, false
+	case parsermysql.TypeBit:
+		return (flen + 7) / 8, false
+	case parsermysql.TypeEnum:
+		if len(tp.Elems) > 255 {
+			return 2, false
+		}
+		return 1, false
+	case parsermysql.TypeSet:
+		n := (len(tp.Elems) + 7) / 8
+		if n > 4 {
+			n = 8
+		}
+		return n, false
+	case parsermysql.TypeString: // char, binary
+		if parsermysql.HasBinaryFlag(tp.Flag) || tp.Charset == charset.CharsetBin {
+			return flen, false
+		}
+		return flen * maxlen, maxlen > 1
+	case parsermysql.TypeVarchar, parsermysql.TypeVarString:
+		if parsermysql.HasBinaryFlag(tp.Flag) || tp.Charset == charset.CharsetBin {
+			maxlen = 1
+		}
+		size = flen * maxlen
+		if size > 255 {
+			return size + 2, true
+		}
+		return size + 1, true
+	case parsermysql.TypeTinyBlob:
+		return 9, true
+	case parsermysql.TypeBlob:
+		return 10, true
+	case parsermysql.TypeMediumBlob:
+		return 11, true
+	default: // longblob, json, geometry
+		return 12, true
+	}
+}
+
+// EstimateRowSize estimates the max size of a row of the table, counted by MySQL (excluding BLOB/TEXT
+// contents) and in an InnoDB page (variable-length columns might be stored off-page).
+func EstimateRowSize(stmt *ast.CreateTableStmt) (rowSize int, inPageSize int) {
+	defaultMaxlen := 4 // utf8mb4
+	for _, option := range stmt.Options {
+		if option.Tp == ast.TableOptionCharset {
+			if cs, err := charset.GetCharsetInfo(option.StrValue); err == nil {
+				defaultMaxlen = cs.Maxlen
+			}
+		}
+	}
+
+	// record header and null bitmap
+	inPageSize = 5 + (len(stmt.Cols)+7)/8
+	for _, col := range stmt.Cols {
+		size, variable := columnStorageSize(col, defaultMaxlen)
+		rowSize += size
+		if variable && size > 255 {
+			inPageSize += externFieldInPageSize
+		} else {
+			inPageSize += size
+		}
+	}
+	return rowSize, inPageSize
+}
+
+// CheckRowSize returns warnings if a row of the table created by `createTable` is near or over the
+// row size limit of MySQL or the InnoDB page of the target. Statements other than CREATE TABLE are ignored.
+func CheckRowSize(createTable string, limits TableLimits) (warnings []string) {
+	stmt, err := sqle.ParseCreateTableStmt("mysql", createTable)
+	if err != nil {
+		return nil
+	}
+	tableName := fmt.Sprintf("%s.%s", stmt.Table.Schema.O, stmt.Table.Name.O)
+	rowSize, inPageSize := EstimateRowSize(stmt)
+
+	check := func(size int, limit int, what string) {
+		if size*100 >= limit*rowSizeWarnPercent {
+			warnings = append(warnings, fmt.Sprintf("estimated row size %v of table %v is near or over the %v %v",
+				size, tableName, what, limit))
+		}
+	}
+	check(rowSize, maxRowSize, "row size limit")
+	if limits.InnodbPageSize > 0 {
+		check(inPageSize, MaxInnodbRecordSize(limits.InnodbPageSize),
+			fmt.Sprintf("record size limit of innodb_page_size %v", limits.InnodbPageSize))
+	}
+	return warnings
+}
+
+type schemaRenameVisitor struct {
+	schemaRenameMap map[string]string
+}
+
+func (v *schemaRenameVisitor) rename(schema string) string {
+	if newSchema, ok := v.schemaRenameMap[schema]; ok {
+		return newSchema
+	}
+	return schema
+}
+
+func (v *schemaRenameVisitor) Enter(in ast.Node) (ast.Node, bool) {
+	switch n := in.(type) {
+	case *ast.TableName:
+		if n.Schema.O != "" {
+			n.Schema = model.NewCIStr(v.rename(n.Schema.O))
+		}
+	case *ast.CreateDatabaseStmt:
+		n.Name = v.rename(n.Name)
+	case *ast.DropDatabaseStmt:
+		n.Name = v.rename(n.Name)
+	case *ast.AlterDatabaseStmt:
+		n.Name = v.rename(n.Name)
+	case *ast.UseStmt:
+		n.DBName = v.rename(n.DBName)
+	}
+	return in, false
+}
+
+func (v *schemaRenameVisitor) Leave(in ast.Node) (ast.Node, bool) {
+	return in, true
+}
+
+// RenameSchemaInQuery replaces schemas in `query` according to schemaRenameMap.
+// Unqualified table names are kept as is. The current schema should be renamed by the caller.
+func RenameSchemaInQuery(query string, schemaRenameMap map[string]string) (string, error) {
+	if len(schemaRenameMap) == 0 || query == "" {
+		return query, nil
+	}
+	stmt, err := parser.New().ParseOneStmt(query, "", "")
+	if err != nil {
+		return "", err
+	}
+	stmt.Accept(&schemaRenameVisitor{schemaRenameMap: schemaRenameMap})
+	return ParserRestore(stmt)
+}
+
+// MakeDDLIdempotent adds IF NOT EXISTS to CREATE DATABASE/TABLE and IF EXISTS to DROP DATABASE/TABLE,
+// so that the DDL can be replayed. Other statements are returned unchanged.
+// (MySQL does not support IF [NOT] EXISTS for indexes.)
+func MakeDDLIdempotent(query string) (string, error) {
+	stmt, err := parser.New().ParseOneStmt(query, "", "")
+	if err != nil {
+		return "", err
+	}
+	switch stmt := stmt.(type) {
+	case *ast.CreateDatabaseStmt:
+		if stmt.IfNotExists {
+			return query, nil
+		}
+		stmt.IfNotExists = true
+	case *ast.CreateTableStmt:
+		if stmt.IfNotExists {
+			return query, nil
+		}
+		stmt.IfNotExists = true
+	case *ast.DropDatabaseStmt:
+		if stmt.IfExists {
+			return query, nil
+		}
+		stmt.IfExists = true
+	case *ast.DropTableStmt:
+		if stmt.IfExists {
+			return query, nil
+		}
+		stmt.IfExists = true
+	default:
+		return query, nil
+	}
+	return ParserRestore(stmt)
+}
+
 func ParserRestore(stmt ast.Node) (string, error) {
 	buf := bytes.NewBuffer(nil)
 	err := stmt.Restore(parserformat.NewRestoreCtx(common.ParserRestoreFlag, buf))
@@ -770,3 +1894,28 @@ func RenameCreateTable(createTable string, newSchema string, newTable string, co
 
 	return buf.String(), nil
 }
+
+// GeometrySRID returns the SRID of a geometry value in the MySQL internal format,
+// which is a 4-byte little-endian SRID followed by the WKB.
+func GeometrySRID(value []byte) (uint32, bool) {
+	if len(value) < 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(value), true
+}
+
+// CheckGeometrySRID returns an error if a geometry value does not match the SRID constraint of the column.
+func CheckGeometrySRID(column *umconf.Column, value []byte) error {
+	if column.SRID == nil {
+		return nil
+	}
+	srid, ok := GeometrySRID(value)
+	if !ok {
+		return fmt.Errorf("bad geometry value of length %v for column %v", len(value), column.RawName)
+	}
+	if srid != *column.SRID {
+		return fmt.Errorf("geometry value with SRID %v cannot be written to column %v, which is constrained to SRID %v",
+			srid, column.RawName, *column.SRID)
+	}
+	return nil
+}
@@ -7,16 +7,21 @@
 package base
 
 import (
+	"bytes"
 	gosql "database/sql"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	sqle "github.com/actiontech/dtle/driver/mysql/sqle/inspector"
 	"github.com/pingcap/tidb/parser"
 
 	"github.com/actiontech/dtle/driver/common"
+	umconf "github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+	"github.com/hashicorp/go-hclog"
 
 	gomysql "github.com/go-mysql-org/go-mysql/mysql"
 	test "github.com/outbrain/golib/tests"
@@ -390,3 +395,414 @@ func TestMySQL57CollationReplaceWorkaround(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckColumnTypeCompatibility(t *testing.T) {
+	newTable := func(columnType string) *common.Table {
+		table := common.NewTable("db1", "tb1")
+		table.OriginalTableColumns = common.NewColumnList([]umconf.Column{
+			{RawName: "id", ColumnType: "int(11)"},
+			{RawName: "c1", ColumnType: columnType},
+		})
+		return table
+	}
+	target := common.NewColumnList([]umconf.Column{
+		{RawName: "id", ColumnType: "bigint(20)"},
+		{RawName: "c1", ColumnType: "varchar(20)"},
+	})
+
+	tests := []struct {
+		name              string
+		srcType           string
+		allowIncompatible bool
+		wantErr           bool
+		// expected in the log. empty for no warning.
+		wantWarn string
+	}{
+		{"widening", "varchar(10)", false, false, ""},
+		{"narrowing", "varchar(50)", false, false, "target column type is narrower than source"},
+		{"incompatible", "datetime", false, true, ""},
+		{"incompatible-allowed", "datetime", true, false, "target column types are incompatible with source"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logBuf bytes.Buffer
+			logger := hclog.New(&hclog.LoggerOptions{Output: &logBuf})
+			err := CheckColumnTypeCompatibility(logger, newTable(tt.srcType), target, tt.allowIncompatible)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckColumnTypeCompatibility() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantWarn == "" {
+				if strings.Contains(logBuf.String(), "[WARN]") {
+					t.Errorf("expect no warning, got %q", logBuf.String())
+				}
+			} else if !strings.Contains(logBuf.String(), tt.wantWarn) ||
+				!strings.Contains(logBuf.String(), "c1") {
+				t.Errorf("expect a warning %q on c1, got %q", tt.wantWarn, logBuf.String())
+			}
+		})
+	}
+}
+
+func TestCheckKeyCollations(t *testing.T) {
+	table := common.NewTable("db1", "tb1")
+	table.UseUniqueKey = &common.UniqueKey{
+		Name: "PRIMARY",
+		Columns: *common.NewColumnList([]umconf.Column{
+			{RawName: "code", Collation: "utf8mb4_bin"},
+			{RawName: "id"},
+		}),
+	}
+	target := common.NewColumnList([]umconf.Column{
+		{RawName: "code", Collation: "utf8mb4_general_ci"},
+		{RawName: "id"},
+	})
+
+	var buf strings.Builder
+	logger := hclog.New(&hclog.LoggerOptions{Output: &buf})
+	got := CheckKeyCollations(logger, table, target)
+	want := []KeyCollationMismatch{{
+		Column:       "code",
+		SrcCollation: "utf8mb4_bin",
+		DstCollation: "utf8mb4_general_ci",
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckKeyCollations() = %v, want %v", got, want)
+	}
+	if !strings.Contains(buf.String(), "duplicate-key error 1062") ||
+		!strings.Contains(buf.String(), "column=code") {
+		t.Errorf("expect a warning on column code. got %q", buf.String())
+	}
+
+	// the same strictness or a stricter target is fine
+	target.GetColumn("code").Collation = "utf8mb4_0900_as_cs"
+	if got := CheckKeyCollations(logger, table, target); len(got) != 0 {
+		t.Errorf("unexpected mismatches %v", got)
+	}
+	table.UseUniqueKey.Columns.GetColumn("code").Collation = "utf8mb4_unicode_ci"
+	target.GetColumn("code").Collation = "utf8mb4_general_ci"
+	if got := CheckKeyCollations(logger, table, target); len(got) != 0 {
+		t.Errorf("unexpected mismatches %v", got)
+	}
+}
+
+func TestGetAutoIncrementCapacity(t *testing.T) {
+	table := common.NewTable("db1", "tb1")
+	table.OriginalTableColumns = common.NewColumnList([]umconf.Column{
+		{RawName: "id", ColumnType: "bigint(20)", AutoIncrement: true},
+		{RawName: "c1", ColumnType: "varchar(20)"},
+	})
+	table.AutoIncrement = 4000000001
+	target := common.NewColumnList([]umconf.Column{
+		{RawName: "id", ColumnType: "int(11)"},
+		{RawName: "c1", ColumnType: "varchar(20)"},
+	})
+
+	c, ok := GetAutoIncrementCapacity(table, target)
+	if !ok {
+		t.Fatal("expect the AUTO_INCREMENT column to be found")
+	}
+	if c.Column != "id" || c.Value != 4000000000 || c.Max != 2147483647 || !c.Overflows() {
+		t.Errorf("expect an overflow of a target INT column, got %+v", c)
+	}
+
+	target.GetColumn("id").ColumnType = "int(10) unsigned"
+	c, _ = GetAutoIncrementCapacity(table, target)
+	if c.Max != 4294967295 || c.Overflows() || !c.Near() {
+		t.Errorf("expect a value near the max of INT UNSIGNED, got %+v", c)
+	}
+
+	target.GetColumn("id").ColumnType = "bigint(20) unsigned"
+	c, _ = GetAutoIncrementCapacity(table, target)
+	if c.Overflows() || c.Near() {
+		t.Errorf("expect BIGINT UNSIGNED to hold the value, got %+v", c)
+	}
+
+	table.AutoIncrement = 0
+	if _, ok := GetAutoIncrementCapacity(table, target); ok {
+		t.Error("expect nothing to check without AUTO_INCREMENT")
+	}
+}
+
+func TestCheckRowSize(t *testing.T) {
+	buildCreateTable := func(nCol int, colType string, charset string) string {
+		cols := []string{"id int primary key"}
+		for i := 0; i < nCol; i++ {
+			cols = append(cols, fmt.Sprintf("c%d %s", i, colType))
+		}
+		return fmt.Sprintf("create table a.t (%s) default charset=%s", strings.Join(cols, ", "), charset)
+	}
+
+	tests := []struct {
+		name        string
+		createTable string
+		limits      TableLimits
+		wantWarning string
+	}{
+		{"narrow table", buildCreateTable(10, "varchar(80)", "utf8mb4"),
+			TableLimits{InnodbPageSize: 16384}, ""},
+		{"many varchars near 65535", buildCreateTable(190, "varchar(80)", "utf8mb4"),
+			TableLimits{}, "row size limit 65535"},
+		{"many varchars over 65535", buildCreateTable(300, "varchar(80)", "utf8mb4"),
+			TableLimits{}, "row size limit 65535"},
+		{"small page size", buildCreateTable(40, "varchar(100)", "latin1"),
+			TableLimits{InnodbPageSize: 4096}, "innodb_page_size 4096"},
+		{"default page size", buildCreateTable(40, "varchar(100)", "latin1"),
+			TableLimits{InnodbPageSize: 16384}, ""},
+		{"not create table", "alter table a.t add column c int", TableLimits{InnodbPageSize: 4096}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := CheckRowSize(tt.createTable, tt.limits)
+			if tt.wantWarning == "" {
+				if len(warnings) != 0 {
+					t.Errorf("unexpected warnings %v", warnings)
+				}
+				return
+			}
+			found := false
+			for _, w := range warnings {
+				if strings.Contains(w, tt.wantWarning) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("warnings %v, want %q", warnings, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestGetCandidateUniqueKeysPreferVisible(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("COLUMN_NAME = 'IS_VISIBLE'").
+		WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	mock.ExpectQuery("SUM\\(IS_VISIBLE='NO'\\) > 0 AS is_invisible").
+		WillReturnRows(sqlmock.NewRows([]string{"INDEX_NAME", "COLUMN_NAMES", "is_auto_increment", "has_nullable", "is_invisible"}).
+			AddRow("uk_invisible", "a", 0, 0, 1).
+			AddRow("uk_visible", "b", 0, 0, 0))
+
+	columns := common.NewColumnList([]umconf.Column{{RawName: "a"}, {RawName: "b"}})
+	uks, err := GetCandidateUniqueKeys(hclog.NewNullLogger(), db, "db1", "t1", columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uks) != 2 {
+		t.Fatalf("got %v keys, expect 2", len(uks))
+	}
+	if uks[0].Name != "uk_visible" || uks[0].IsInvisible {
+		t.Errorf("first candidate %v, expect the visible uk_visible", uks[0].Name)
+	}
+	if uks[1].Name != "uk_invisible" || !uks[1].IsInvisible {
+		t.Errorf("second candidate %v, expect the invisible uk_invisible", uks[1].Name)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIsTableEmpty(t *testing.T) {
+	tests := []struct {
+		name      string
+		strategy  string
+		tableRows interface{} // nil for a non-existing table
+		selectOne bool        // whether the table is read
+		hasRow    bool
+		want      bool
+	}{
+		{"approximate empty", common.TargetEmptyCheckApproximate, 0, false, false, true},
+		{"approximate stale", common.TargetEmptyCheckApproximate, 10, true, false, true},
+		{"approximate non-empty", common.TargetEmptyCheckApproximate, 10, true, true, false},
+		{"approximate non-existing", common.TargetEmptyCheckApproximate, nil, false, false, true},
+		{"exact empty", common.TargetEmptyCheckExact, nil, true, false, true},
+		{"exact non-empty", common.TargetEmptyCheckExact, nil, true, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			if tt.strategy == common.TargetEmptyCheckApproximate {
+				rows := sqlmock.NewRows([]string{"TABLE_ROWS"})
+				if tt.tableRows != nil {
+					rows.AddRow(tt.tableRows)
+				}
+				mock.ExpectQuery("select TABLE_ROWS from information_schema.TABLES").
+					WithArgs("db1", "t1").WillReturnRows(rows)
+			}
+			if tt.selectOne {
+				rows := sqlmock.NewRows([]string{"1"})
+				if tt.hasRow {
+					rows.AddRow(1)
+				}
+				mock.ExpectQuery("select 1 from `db1`.`t1` limit 1").WillReturnRows(rows)
+			}
+
+			got, err := IsTableEmpty(db, "db1", "t1", tt.strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("IsTableEmpty() = %v, want %v", got, tt.want)
+			}
+			// no unexpected queries, e.g. no scan on an empty table with the approximate strategy
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCompareTimeSettings(t *testing.T) {
+	getTimeSettings := func(explicitDefaults int, nTimeZones int) *TimeSettings {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		mock.ExpectQuery("select @@explicit_defaults_for_timestamp").
+			WillReturnRows(sqlmock.NewRows([]string{"@@explicit_defaults_for_timestamp"}).AddRow(explicitDefaults))
+		if nTimeZones < 0 {
+			mock.ExpectQuery("select count").WillReturnError(fmt.Errorf("Table 'mysql.time_zone_name' doesn't exist"))
+		} else {
+			mock.ExpectQuery("select count").WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(nTimeZones))
+		}
+		r, err := GetTimeSettings(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	src := getTimeSettings(1, 1800)
+	if !src.ExplicitDefaultsForTimestamp || !src.HasTimeZoneTables {
+		t.Fatalf("unexpected source settings %+v", src)
+	}
+	if warnings := CompareTimeSettings(src, getTimeSettings(1, 1800)); len(warnings) != 0 {
+		t.Errorf("expect no warning for the same settings, got %v", warnings)
+	}
+
+	warnings := CompareTimeSettings(src, getTimeSettings(0, -1))
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "explicit_defaults_for_timestamp") ||
+		!strings.Contains(warnings[1], "time zone tables") {
+		t.Errorf("expect warnings on both settings, got %v", warnings)
+	}
+}
+
+func TestCheckGeometrySRID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectQuery("information_schema.columns").WithArgs("db1", "t1").WillReturnRows(
+		sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "SRS_ID"}).
+			AddRow("id", "int(11)", nil).
+			AddRow("g", "point", "4326"))
+	columns := common.NewColumnList([]umconf.Column{{RawName: "id"}, {RawName: "g"}})
+	if err := ApplyColumnTypes(db, "db1", "t1", columns); err != nil {
+		t.Fatal(err)
+	}
+	if columns.GetColumn("id").SRID != nil {
+		t.Errorf("expect no SRID constraint on id")
+	}
+	g := columns.GetColumn("g")
+	if g.SRID == nil || *g.SRID != 4326 {
+		t.Fatalf("expect SRID 4326 on g, got %v", g.SRID)
+	}
+
+	// POINT(1 2) in the internal format: SRID, then WKB
+	wkb := []byte{0x01, 0x01, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 0, 0, 0, 0, 0, 0, 0, 0x40}
+	value := append([]byte{0xe6, 0x10, 0, 0}, wkb...)
+	if srid, ok := GeometrySRID(value); !ok || srid != 4326 {
+		t.Errorf("GeometrySRID %v %v, expect 4326", srid, ok)
+	}
+	if err := CheckGeometrySRID(g, value); err != nil {
+		t.Errorf("expect no error for a matching SRID, got %v", err)
+	}
+	err = CheckGeometrySRID(g, append([]byte{0, 0, 0, 0}, wkb...))
+	if err == nil || !strings.Contains(err.Error(), "SRID 0") {
+		t.Errorf("expect an error for SRID 0, got %v", err)
+	}
+	if err := CheckGeometrySRID(g, []byte{1}); err == nil {
+		t.Errorf("expect an error for a bad value")
+	}
+	if err := CheckGeometrySRID(columns.GetColumn("id"), []byte{1}); err != nil {
+		t.Errorf("expect no check without an SRID constraint, got %v", err)
+	}
+}
+
+func TestMakeDDLIdempotent(t *testing.T) {
+	cases := []struct {
+		query  string
+		expect string
+	}{
+		{"create table a.t1 (id int)", "CREATE TABLE IF NOT EXISTS `a`.`t1` (`id` INT)"},
+		{"drop table a.t1, a.t2", "DROP TABLE IF EXISTS `a`.`t1`, `a`.`t2`"},
+		{"create database a", "CREATE DATABASE IF NOT EXISTS `a`"},
+		{"drop database a", "DROP DATABASE IF EXISTS `a`"},
+		// unchanged
+		{"create table if not exists a.t1 (id int)", "create table if not exists a.t1 (id int)"},
+		{"drop table if exists a.t1", "drop table if exists a.t1"},
+		{"alter table a.t1 add column c2 int", "alter table a.t1 add column c2 int"},
+	}
+	for _, c := range cases {
+		r, err := MakeDDLIdempotent(c.query)
+		if err != nil {
+			t.Fatalf("%v: %v", c.query, err)
+		}
+		if r != c.expect {
+			t.Errorf("%v: got %v, expect %v", c.query, r, c.expect)
+		}
+	}
+	if _, err := MakeDDLIdempotent("not a ddl"); err == nil {
+		t.Errorf("expect error on a bad query")
+	}
+}
+
+func TestParseMySQLVersion(t *testing.T) {
+	tests := []struct {
+		version           string
+		want              MySQLVersion
+		forceSingleWorker bool
+	}{
+		{"5.6.51-log", MySQLVersion{5, 6, 51, FlavorMySQL}, true},
+		{"5.7.30", MySQLVersion{5, 7, 30, FlavorMySQL}, false},
+		{"8.0.23-14", MySQLVersion{8, 0, 23, FlavorMySQL}, false},
+		{"10.5.12-MariaDB-log", MySQLVersion{10, 5, 12, FlavorMariaDB}, false},
+		{"5.5.5-10.6.4-MariaDB-1:10.6.4+maria~focal", MySQLVersion{10, 6, 4, FlavorMariaDB}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := ParseMySQLVersion(tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if got.ForceSingleWorker() != tt.forceSingleWorker {
+				t.Errorf("ForceSingleWorker %v, want %v", got.ForceSingleWorker(), tt.forceSingleWorker)
+			}
+		})
+	}
+
+	if _, err := ParseMySQLVersion("unknown"); err == nil {
+		t.Errorf("expect an error on a bad version")
+	}
+
+	v := MySQLVersion{Major: 8, Minor: 0, Patch: 23}
+	if !v.AtLeast(5, 7, 30) || !v.AtLeast(8, 0, 23) || v.AtLeast(8, 0, 24) || v.AtLeast(10, 0, 0) {
+		t.Errorf("unexpected AtLeast of %v", v)
+	}
+	if v.Digit() != 80023 {
+		t.Errorf("Digit %v, want 80023", v.Digit())
+	}
+}
@@ -8,6 +8,7 @@ package binlog
 
 import (
 	"bytes"
+	"crypto/tls"
 	gosql "database/sql"
 	"encoding/binary"
 	gmclient "github.com/go-mysql-org/go-mysql/client"
@@ -105,6 +106,12 @@ type BinlogReader struct {
 	CurrentGtidSetMutex sync.RWMutex
 
 	BigTxCount int32
+
+	// saves DDL of FK parents for PrefetchDDLDependencies. nil to disable.
+	SaveTableDDL func(schema string, table string, ddl string) error
+
+	// table id => the last TABLE_MAP_EVENT. for PARTIAL_UPDATE_ROWS_EVENT.
+	tableMaps map[uint64]*replication.TableMapEvent
 }
 
 type SqlFilter struct {
@@ -239,13 +246,25 @@ func NewBinlogReader(
 	if binlogReader.mysqlContext.BinlogRelay {
 		// init when connecting
 	} else {
+		// go-mysql reconnects with this password. An expired token fails the reconnection
+		// and the job restarts with a new one.
+		// Note go-mysql does not support mysql_clear_password.
+		password, err := cfg.SrcConnectionConfig.GetPassword()
+		if err != nil {
+			return nil, err
+		}
+		var tlsConfig *tls.Config
+		if cfg.SrcConnectionConfig.AuthTokenCommand != "" {
+			tlsConfig = &tls.Config{InsecureSkipVerify: true}
+		}
 		binlogSyncerConfig := replication.BinlogSyncerConfig{
 			ServerID:       uint32(binlogReader.serverId),
 			Flavor:         "mysql",
 			Host:           cfg.SrcConnectionConfig.Host,
 			Port:           uint16(cfg.SrcConnectionConfig.Port),
 			User:           cfg.SrcConnectionConfig.User,
-			Password:       cfg.SrcConnectionConfig.Password,
+			Password:       password,
+			TLSConfig:      tlsConfig,
 			RawModeEnabled: false,
 			UseDecimal:     true, // my mod: use string instead of Decimal if UseDecimal = true
 
@@ -289,11 +308,15 @@ func (b *BinlogReader) ConnectBinlogStreamer(coordinates common.MySQLCoordinates
 		"file", coordinates.LogFile, "pos", coordinates.LogPos, "gtid", coordinates.GtidSet)
 
 	if b.mysqlContext.BinlogRelay {
+		password, err := b.mysqlContext.SrcConnectionConfig.GetPassword()
+		if err != nil {
+			return err
+		}
 		dbConfig := dmconfig.DBConfig{
 			Host:     b.mysqlContext.SrcConnectionConfig.Host,
 			Port:     b.mysqlContext.SrcConnectionConfig.Port,
 			User:     b.mysqlContext.SrcConnectionConfig.User,
-			Password: b.mysqlContext.SrcConnectionConfig.Password,
+			Password: password,
 		}
 
 		relayConfig := &dmrelay.Config{
@@ -487,6 +510,19 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 		b.sendEntry(entriesChannel)
 
 		b.handleEventGSet(evt.GSet)
+	case replication.TABLE_MAP_EVENT:
+		if b.tableMaps == nil {
+			b.tableMaps = make(map[uint64]*replication.TableMapEvent)
+		}
+		evt := ev.Event.(*replication.TableMapEvent)
+		b.tableMaps[evt.TableID] = evt
+	case common.PartialUpdateRowsEvent:
+		evt := ev.Event.(*replication.GenericEvent)
+		rowsEvent, err := decodePartialUpdateRows(evt.Data, b.tableMaps)
+		if err != nil {
+			return errors.Wrapf(err, "PARTIAL_UPDATE_ROWS_EVENT pos %v", ev.Header.LogPos)
+		}
+		return b.handleRowsEvent(ev, rowsEvent, entriesChannel)
 	default:
 		if rowsEvent, ok := ev.Event.(*replication.RowsEvent); ok {
 			return b.handleRowsEvent(ev, rowsEvent, entriesChannel)
@@ -630,6 +666,7 @@ func (b *BinlogReader) handleQueryEvent(ev *replication.BinlogEvent,
 				if err != nil {
 					return err
 				}
+				b.saveFKParentsDDL(realSchema, tableName)
 			case *ast.DropTableStmt:
 				if realAst.IsView {
 					// do nothing
@@ -659,6 +696,9 @@ func (b *BinlogReader) handleQueryEvent(ev *replication.BinlogEvent,
 						newTableName = spec.NewTable.Name.String()
 					case ast.AlterTableAddConstraint, ast.AlterTableDropForeignKey:
 						b.removeFKChild(realSchema, fromTable.TableName)
+						if spec.Tp == ast.AlterTableAddConstraint {
+							b.saveFKParentsDDL(realSchema, tableName)
+						}
 					default:
 						// do nothing
 					}
@@ -1630,6 +1670,8 @@ func (b *BinlogReader) GetQueueMem() int64 {
 
 func (b *BinlogReader) sqleExecDDL(currentSchema string, ast ast.Node) {
 	if b.maybeSqleContext != nil {
+		b.maybeSqleContext.Lock()
+		defer b.maybeSqleContext.Unlock()
 		b.maybeSqleContext.LoadSchemas(nil)
 		if currentSchema != "" {
 			b.maybeSqleContext.UseSchema(currentSchema)
@@ -1640,6 +1682,8 @@ func (b *BinlogReader) sqleExecDDL(currentSchema string, ast ast.Node) {
 
 func (b *BinlogReader) sqleAfterCreateSchema(schema string) {
 	if b.maybeSqleContext != nil {
+		b.maybeSqleContext.Lock()
+		defer b.maybeSqleContext.Unlock()
 		b.maybeSqleContext.LoadTables(schema, nil)
 	}
 }
@@ -1865,6 +1909,9 @@ func (b *BinlogReader) handleRowsEvent(ev *replication.BinlogEvent, rowsEvent *r
 	if table != nil {
 		dmlEvent.FKParent = len(table.FKChildren) > 0
 	}
+	if ev.Header.EventType == common.PartialUpdateRowsEvent {
+		dmlEvent.DtleFlags |= common.DtleFlagPartialJSON
+	}
 	dmlEvent.Flags = make([]byte, 2)
 	binary.LittleEndian.PutUint16(dmlEvent.Flags, rowsEvent.Flags)
 	dmlEvent.LogPos = int64(ev.Header.LogPos - ev.Header.EventSize)
@@ -2073,3 +2120,31 @@ func (b *BinlogReader) addFKChildren(currentSchema string, fkParents []*ast.Tabl
 		tableContext.FKChildren[childST] = struct{}{}
 	}
 }
+
+// saveFKParentsDDL saves DDL of tables referenced by foreign keys of the table with SaveTableDDL.
+// Errors are logged only. The dest task will fail on the DDL as without PrefetchDDLDependencies.
+func (b *BinlogReader) saveFKParentsDDL(schema string, table string) {
+	if b.SaveTableDDL == nil {
+		return
+	}
+	fks, err := base.GetForeignKeys(b.db, schema, table)
+	if err != nil {
+		b.logger.Warn("cannot get foreign keys to save DDL of FK parents", "schema", schema, "table", table, "err", err)
+		return
+	}
+	saved := make(map[common.SchemaTable]struct{})
+	for _, fk := range fks {
+		st := common.SchemaTable{Schema: fk.RefSchema, Table: fk.RefTable}
+		if _, ok := saved[st]; ok {
+			continue
+		}
+		saved[st] = struct{}{}
+		ddl, err := base.ShowCreateTable(b.db, fk.RefSchema, fk.RefTable)
+		if err == nil {
+			err = b.SaveTableDDL(fk.RefSchema, fk.RefTable, ddl)
+		}
+		if err != nil {
+			b.logger.Warn("cannot save DDL of a FK parent", "schema", fk.RefSchema, "table", fk.RefTable, "err", err)
+		}
+	}
+}
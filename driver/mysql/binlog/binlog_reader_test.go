@@ -1,10 +1,15 @@
 package binlog
 
 import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/actiontech/dtle/driver/common"
 	"github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
 	hclog "github.com/hashicorp/go-hclog"
 )
 
@@ -1350,3 +1355,73 @@ func Test_isExpandSyntaxQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestDecodePartialUpdateRows(t *testing.T) {
+	// id int, j json, v varchar(10)
+	table := &replication.TableMapEvent{
+		TableID:     100,
+		Schema:      []byte("a"),
+		Table:       []byte("t1"),
+		ColumnCount: 3,
+		ColumnType:  []byte{gomysql.MYSQL_TYPE_LONG, gomysql.MYSQL_TYPE_JSON, gomysql.MYSQL_TYPE_VARCHAR},
+		ColumnMeta:  []uint16{0, 4, 40},
+		NullBitmap:  []byte{0x06},
+	}
+	jsonValue := func(doc []byte) []byte {
+		bs := make([]byte, 4)
+		binary.LittleEndian.PutUint32(bs, uint32(len(doc)))
+		return append(bs, doc...)
+	}
+	// [1, "x"]
+	fullDoc := jsonValue(jsonbArray([][]byte{{jsonbInt16, 1, 0}, {jsonbString, 1, 'x'}}))
+	row := func(id byte, j []byte, v string) []byte {
+		bs := append([]byte{0x00, id, 0, 0, 0}, j...)
+		return append(append(bs, byte(len(v))), v...)
+	}
+
+	data := []byte{100, 0, 0, 0, 0, 0, 0x01, 0x00, 0x02, 0x00, 3, 0x07, 0x07}
+	// partial
+	data = append(data, row(1, fullDoc, "a")...)
+	data = append(data, 1, 0x01)
+	data = append(data, row(1, jsonValue([]byte{
+		0, 4, '$', '[', '0', ']', 3, jsonbInt16, 2, 0, // replace
+		2, 4, '$', '[', '1', ']', // remove
+		1, 4, '$', '[', '1', ']', 3, jsonbString, 1, 'y', // insert
+	}), "b")...)
+	// full
+	data = append(data, row(2, fullDoc, "c")...)
+	data = append(data, 0)
+	data = append(data, row(2, fullDoc, "d")...)
+
+	rowsEvent, err := decodePartialUpdateRows(data, map[uint64]*replication.TableMapEvent{100: table})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rowsEvent.Table != table || len(rowsEvent.Rows) != 4 {
+		t.Fatalf("unexpected rows event %v", rowsEvent)
+	}
+	expected := [][]string{{"1", `[1,"x"]`, "a"}, {"1", "", "b"}, {"2", `[1,"x"]`, "c"}, {"2", `[1,"x"]`, "d"}}
+	for i := range expected {
+		actual := []string{fmt.Sprintf("%v", rowsEvent.Rows[i][0]),
+			fmt.Sprintf("%s", rowsEvent.Rows[i][1]), fmt.Sprintf("%s", rowsEvent.Rows[i][2])}
+		if i == 1 {
+			actual[1] = "" // checked below
+		}
+		if !reflect.DeepEqual(actual, expected[i]) {
+			t.Errorf("row %v: expect %v got %v", i, expected[i], actual)
+		}
+	}
+
+	diffs, ok, err := common.DecodeJSONDiffs(rowsEvent.Rows[1][1])
+	if err != nil || !ok {
+		t.Fatalf("expect diffs. got %v %v", rowsEvent.Rows[1][1], err)
+	}
+	expectedDiffs := []common.JSONDiff{
+		{Op: common.JSONDiffReplace, Path: "$[0]", Value: "2"},
+		{Op: common.JSONDiffRemove, Path: "$[1]"},
+		{Op: common.JSONDiffInsert, Path: "$[1]", Value: `"y"`},
+	}
+	if !reflect.DeepEqual(diffs, expectedDiffs) {
+		t.Errorf("expect diffs %v got %v", expectedDiffs, diffs)
+	}
+}
@@ -0,0 +1,416 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/actiontech/dtle/driver/common"
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// PARTIAL_UPDATE_ROWS_EVENT is an UPDATE_ROWS_EVENTv2 with, before each after image,
+// value_options and a bitmap of the JSON columns whose after value is a Json_diff_vector.
+// See Rows_log_event and Json_diff_vector::write_binary of MySQL.
+//
+// go-mysql does not know the event. It is rewritten to an UPDATE_ROWS_EVENTv2, where
+// each diff vector is replaced with a JSON array [[op, path, value], ...] embedding
+// the binary diff values, and decoded by go-mysql. The array is then converted
+// to common.JSONDiff.
+
+const (
+	// value_options PARTIAL_JSON_UPDATES
+	partialJSONUpdates = 1
+	// PARTIAL_UPDATE_ROWS_EVENT is written by MySQL 8.0 only, with 6-byte table id.
+	partialEventTableIDSize = 6
+
+	jsonbLargeArray byte = 0x03
+	jsonbLiteral    byte = 0x04
+	jsonbInt16      byte = 0x05
+	jsonbUint16     byte = 0x06
+	jsonbInt32      byte = 0x07
+	jsonbUint32     byte = 0x08
+	jsonbString     byte = 0x0c
+)
+
+// decodePartialUpdateRows decodes the body (without header and checksum) of a PARTIAL_UPDATE_ROWS_EVENT.
+// The JSON diffs in the result are encoded by common.EncodeJSONDiffs.
+func decodePartialUpdateRows(data []byte, tableMaps map[uint64]*replication.TableMapEvent) (
+	rowsEvent *replication.RowsEvent, err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("bad PARTIAL_UPDATE_ROWS_EVENT: %v", r)
+		}
+	}()
+
+	tableID := gomysql.FixedLengthInt(data[0:partialEventTableIDSize])
+	table, ok := tableMaps[tableID]
+	if !ok {
+		return nil, fmt.Errorf("PARTIAL_UPDATE_ROWS_EVENT: no table map for table id %v", tableID)
+	}
+
+	pos := partialEventTableIDSize + 2                 // flags
+	pos += int(binary.LittleEndian.Uint16(data[pos:])) // extra data, including the length
+	columnCount, _, n := gomysql.LengthEncodedInt(data[pos:])
+	pos += n
+	if columnCount != table.ColumnCount {
+		return nil, fmt.Errorf("PARTIAL_UPDATE_ROWS_EVENT: column count %v differs from table map %v",
+			columnCount, table.ColumnCount)
+	}
+	bitmapSize := (int(columnCount) + 7) / 8
+	bitmapBefore := data[pos : pos+bitmapSize]
+	pos += bitmapSize
+	bitmapAfter := data[pos : pos+bitmapSize]
+	pos += bitmapSize
+
+	body := append([]byte{}, data[:pos]...)
+	// row index => columns with diffs
+	partialValues := map[int]map[int]bool{}
+
+	for iRow := 0; pos < len(data); iRow += 2 {
+		n, err = rowImageLen(data[pos:], table, bitmapBefore)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, data[pos:pos+n]...)
+		pos += n
+
+		valueOptions, _, n := gomysql.LengthEncodedInt(data[pos:])
+		pos += n
+		var partialBits []byte
+		if valueOptions&partialJSONUpdates != 0 {
+			nJSON := 0
+			for _, tp := range table.ColumnType {
+				if tp == gomysql.MYSQL_TYPE_JSON {
+					nJSON++
+				}
+			}
+			partialBits = data[pos : pos+(nJSON+7)/8]
+			pos += len(partialBits)
+		}
+
+		nullBitmap := data[pos : pos+nullBitmapSize(bitmapAfter, int(columnCount))]
+		body = append(body, nullBitmap...)
+		pos += len(nullBitmap)
+
+		iNull, iJSON := 0, 0
+		for i := 0; i < int(columnCount); i++ {
+			// every JSON column has a partial bit, whether it is in the image or not.
+			isPartial := false
+			if table.ColumnType[i] == gomysql.MYSQL_TYPE_JSON {
+				isPartial = partialBits != nil && isBitSet(partialBits, iJSON)
+				iJSON++
+			}
+			if !isBitSet(bitmapAfter, i) {
+				continue
+			}
+			isNull := isBitSet(nullBitmap, iNull)
+			iNull++
+			if isNull {
+				continue
+			}
+
+			n, err = columnValueLen(data[pos:], table.ColumnType[i], table.ColumnMeta[i])
+			if err != nil {
+				return nil, err
+			}
+			if isPartial {
+				lenSize := int(table.ColumnMeta[i])
+				array, err := jsonDiffsToBinaryArray(data[pos+lenSize : pos+n])
+				if err != nil {
+					return nil, err
+				}
+				lenBs := make([]byte, 8)
+				binary.LittleEndian.PutUint64(lenBs, uint64(len(array)))
+				body = append(body, lenBs[:lenSize]...)
+				body = append(body, array...)
+				if partialValues[iRow+1] == nil {
+					partialValues[iRow+1] = map[int]bool{}
+				}
+				partialValues[iRow+1][i] = true
+			} else {
+				body = append(body, data[pos:pos+n]...)
+			}
+			pos += n
+		}
+	}
+
+	parser := replication.NewBinlogParser()
+	// the same as the BinlogSyncerConfig
+	parser.SetUseDecimal(true)
+	parser.SetParseTime(false)
+	parser.SetTimestampStringLocation(time.UTC)
+	for _, ev := range [][]byte{
+		newEventData(replication.FORMAT_DESCRIPTION_EVENT, formatDescriptionBody()),
+		newEventData(replication.TABLE_MAP_EVENT, tableMapBody(table)),
+	} {
+		if _, err := parser.Parse(ev); err != nil {
+			return nil, err
+		}
+	}
+	ev, err := parser.Parse(newEventData(replication.UPDATE_ROWS_EVENTv2, body))
+	if err != nil {
+		return nil, err
+	}
+	rowsEvent = ev.Event.(*replication.RowsEvent)
+	rowsEvent.Table = table
+
+	for iRow, columns := range partialValues {
+		for iCol := range columns {
+			rowsEvent.Rows[iRow][iCol], err = binaryArrayToJSONDiffs(rowsEvent.Rows[iRow][iCol])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rowsEvent, nil
+}
+
+func isBitSet(bitmap []byte, i int) bool {
+	return bitmap[i>>3]&(1<<(uint(i)&7)) > 0
+}
+
+func nullBitmapSize(columnBitmap []byte, columnCount int) int {
+	n := 0
+	for i := 0; i < columnCount; i++ {
+		if isBitSet(columnBitmap, i) {
+			n++
+		}
+	}
+	return (n + 7) / 8
+}
+
+func rowImageLen(data []byte, table *replication.TableMapEvent, columnBitmap []byte) (int, error) {
+	nullBitmap := data[:nullBitmapSize(columnBitmap, int(table.ColumnCount))]
+	pos := len(nullBitmap)
+	iNull := 0
+	for i := 0; i < int(table.ColumnCount); i++ {
+		if !isBitSet(columnBitmap, i) {
+			continue
+		}
+		isNull := isBitSet(nullBitmap, iNull)
+		iNull++
+		if isNull {
+			continue
+		}
+		n, err := columnValueLen(data[pos:], table.ColumnType[i], table.ColumnMeta[i])
+		if err != nil {
+			return 0, err
+		}
+		pos += n
+	}
+	return pos, nil
+}
+
+// columnValueLen is the length of a value in a row image. See RowsEvent.decodeValue of go-mysql.
+func columnValueLen(data []byte, tp byte, meta uint16) (int, error) {
+	length := 0
+	if tp == gomysql.MYSQL_TYPE_STRING {
+		if meta >= 256 {
+			b0 := uint8(meta >> 8)
+			b1 := uint8(meta & 0xFF)
+			if b0&0x30 != 0x30 {
+				length = int(uint16(b1) | (uint16((b0&0x30)^0x30) << 4))
+				tp = b0 | 0x30
+			} else {
+				length = int(meta & 0xFF)
+				tp = b0
+			}
+		} else {
+			length = int(meta)
+		}
+	}
+
+	switch tp {
+	case gomysql.MYSQL_TYPE_NULL:
+		return 0, nil
+	case gomysql.MYSQL_TYPE_TINY, gomysql.MYSQL_TYPE_YEAR:
+		return 1, nil
+	case gomysql.MYSQL_TYPE_SHORT:
+		return 2, nil
+	case gomysql.MYSQL_TYPE_INT24, gomysql.MYSQL_TYPE_TIME, gomysql.MYSQL_TYPE_DATE:
+		return 3, nil
+	case gomysql.MYSQL_TYPE_LONG, gomysql.MYSQL_TYPE_FLOAT, gomysql.MYSQL_TYPE_TIMESTAMP:
+		return 4, nil
+	case gomysql.MYSQL_TYPE_LONGLONG, gomysql.MYSQL_TYPE_DOUBLE, gomysql.MYSQL_TYPE_DATETIME:
+		return 8, nil
+	case gomysql.MYSQL_TYPE_NEWDECIMAL:
+		compressedBytes := []int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+		precision, decimals := int(meta>>8), int(meta&0xFF)
+		integral := precision - decimals
+		return integral/9*4 + compressedBytes[integral%9] + decimals/9*4 + compressedBytes[decimals%9], nil
+	case gomysql.MYSQL_TYPE_BIT:
+		nbits := ((meta >> 8) * 8) + (meta & 0xFF)
+		return int(nbits+7) / 8, nil
+	case gomysql.MYSQL_TYPE_TIMESTAMP2:
+		return int(4 + (meta+1)/2), nil
+	case gomysql.MYSQL_TYPE_DATETIME2:
+		return int(5 + (meta+1)/2), nil
+	case gomysql.MYSQL_TYPE_TIME2:
+		return int(3 + (meta+1)/2), nil
+	case gomysql.MYSQL_TYPE_ENUM, gomysql.MYSQL_TYPE_SET:
+		return int(meta & 0xFF), nil
+	case gomysql.MYSQL_TYPE_BLOB, gomysql.MYSQL_TYPE_GEOMETRY, gomysql.MYSQL_TYPE_JSON:
+		return int(meta) + int(gomysql.FixedLengthInt(data[:meta])), nil
+	case gomysql.MYSQL_TYPE_VARCHAR, gomysql.MYSQL_TYPE_VAR_STRING:
+		length = int(meta)
+		fallthrough
+	case gomysql.MYSQL_TYPE_STRING:
+		if length < 256 {
+			return 1 + int(data[0]), nil
+		}
+		return 2 + int(binary.LittleEndian.Uint16(data)), nil
+	default:
+		return 0, fmt.Errorf("unsupported column type %v in PARTIAL_UPDATE_ROWS_EVENT", tp)
+	}
+}
+
+// jsonDiffsToBinaryArray converts a binary Json_diff_vector (without the length)
+// to a binary JSON array [[op, path, value], ...], with value absent for removal.
+func jsonDiffsToBinaryArray(data []byte) ([]byte, error) {
+	var diffs [][]byte
+	for pos := 0; pos < len(data); {
+		op := data[pos]
+		pos += 1
+		if op > byte(common.JSONDiffRemove) {
+			return nil, fmt.Errorf("bad JSON diff operation %v", op)
+		}
+		pathLen, _, n := gomysql.LengthEncodedInt(data[pos:])
+		pos += n
+		path := data[pos : pos+int(pathLen)]
+		pos += int(pathLen)
+
+		elems := [][]byte{
+			{jsonbInt16, op, 0},
+			append([]byte{jsonbString}, appendJSONBVariableLength(nil, len(path))...),
+		}
+		elems[1] = append(elems[1], path...)
+		if common.JSONDiffOp(op) != common.JSONDiffRemove {
+			valueLen, _, n := gomysql.LengthEncodedInt(data[pos:])
+			pos += n
+			elems = append(elems, data[pos:pos+int(valueLen)])
+			pos += int(valueLen)
+		}
+		diffs = append(diffs, jsonbArray(elems))
+	}
+	return jsonbArray(diffs), nil
+}
+
+// jsonbArray makes a large binary JSON array of values, each of which starts with its type.
+func jsonbArray(values [][]byte) []byte {
+	const entrySize = 5
+	headerSize := 8 + len(values)*entrySize
+	payload := make([]byte, headerSize)
+	binary.LittleEndian.PutUint32(payload[0:], uint32(len(values)))
+	for i, value := range values {
+		entry := payload[8+i*entrySize:]
+		entry[0] = value[0]
+		switch value[0] {
+		case jsonbLiteral, jsonbInt16, jsonbUint16, jsonbInt32, jsonbUint32:
+			copy(entry[1:entrySize], value[1:])
+		default:
+			binary.LittleEndian.PutUint32(entry[1:], uint32(len(payload)))
+			payload = append(payload, value[1:]...)
+		}
+	}
+	binary.LittleEndian.PutUint32(payload[4:], uint32(len(payload)))
+	return append([]byte{jsonbLargeArray}, payload...)
+}
+
+func appendJSONBVariableLength(bs []byte, n int) []byte {
+	for n >= 0x80 {
+		bs = append(bs, byte(n&0x7F)|0x80)
+		n >>= 7
+	}
+	return append(bs, byte(n))
+}
+
+// binaryArrayToJSONDiffs converts the array decoded by go-mysql, in JSON text.
+func binaryArrayToJSONDiffs(value interface{}) (string, error) {
+	var bs []byte
+	switch v := value.(type) {
+	case []byte:
+		bs = v
+	case string:
+		bs = []byte(v)
+	default:
+		return "", fmt.Errorf("bad partial JSON value type %T", value)
+	}
+	var array [][]json.RawMessage
+	if err := json.Unmarshal(bs, &array); err != nil {
+		return "", err
+	}
+	diffs := make([]common.JSONDiff, len(array))
+	for i, elems := range array {
+		if len(elems) < 2 {
+			return "", fmt.Errorf("bad partial JSON value %s", bs)
+		}
+		if err := json.Unmarshal(elems[0], &diffs[i].Op); err != nil {
+			return "", err
+		}
+		if err := json.Unmarshal(elems[1], &diffs[i].Path); err != nil {
+			return "", err
+		}
+		if len(elems) > 2 {
+			diffs[i].Value = string(elems[2])
+		}
+	}
+	return common.EncodeJSONDiffs(diffs)
+}
+
+func newEventData(eventType replication.EventType, body []byte) []byte {
+	data := make([]byte, replication.EventHeaderSize, replication.EventHeaderSize+len(body))
+	data[4] = byte(eventType)
+	binary.LittleEndian.PutUint32(data[9:], uint32(replication.EventHeaderSize+len(body)))
+	return append(data, body...)
+}
+
+// formatDescriptionBody is of a MySQL 8.0 with checksum off.
+func formatDescriptionBody() []byte {
+	body := make([]byte, 2+50+4)
+	binary.LittleEndian.PutUint16(body, 4)
+	copy(body[2:], "8.0.0")
+	body = append(body, byte(replication.EventHeaderSize))
+	postHeaderLengths := make([]byte, 40)
+	postHeaderLengths[replication.TABLE_MAP_EVENT-1] = 8
+	postHeaderLengths[replication.UPDATE_ROWS_EVENTv2-1] = 10
+	body = append(body, postHeaderLengths...)
+	return append(body, replication.BINLOG_CHECKSUM_ALG_OFF, 0, 0, 0, 0)
+}
+
+// tableMapBody encodes a TableMapEvent without the optional metadata.
+func tableMapBody(table *replication.TableMapEvent) []byte {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint64(body, table.TableID)
+	binary.LittleEndian.PutUint16(body[6:], table.Flags)
+	body = append(body, byte(len(table.Schema)))
+	body = append(append(body, table.Schema...), 0)
+	body = append(body, byte(len(table.Table)))
+	body = append(append(body, table.Table...), 0)
+	body = append(body, gomysql.PutLengthEncodedInt(table.ColumnCount)...)
+	body = append(body, table.ColumnType...)
+
+	var meta []byte
+	for i, tp := range table.ColumnType {
+		m := table.ColumnMeta[i]
+		switch tp {
+		case gomysql.MYSQL_TYPE_STRING, gomysql.MYSQL_TYPE_NEWDECIMAL:
+			meta = append(meta, byte(m>>8), byte(m))
+		case gomysql.MYSQL_TYPE_VAR_STRING, gomysql.MYSQL_TYPE_VARCHAR, gomysql.MYSQL_TYPE_BIT:
+			meta = append(meta, byte(m), byte(m>>8))
+		case gomysql.MYSQL_TYPE_BLOB, gomysql.MYSQL_TYPE_DOUBLE, gomysql.MYSQL_TYPE_FLOAT,
+			gomysql.MYSQL_TYPE_GEOMETRY, gomysql.MYSQL_TYPE_JSON,
+			gomysql.MYSQL_TYPE_TIME2, gomysql.MYSQL_TYPE_DATETIME2, gomysql.MYSQL_TYPE_TIMESTAMP2:
+			meta = append(meta, byte(m))
+		}
+	}
+	body = append(body, gomysql.PutLengthEncodedString(meta)...)
+	nullBitmap := table.NullBitmap
+	if len(nullBitmap) == 0 {
+		nullBitmap = make([]byte, (table.ColumnCount+7)/8)
+	}
+	return append(body, nullBitmap...)
+}
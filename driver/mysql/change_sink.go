@@ -0,0 +1,118 @@
+package mysql
+
+import (
+	"fmt"
+
+	"github.com/actiontech/dtle/driver/common"
+)
+
+const (
+	ChangeOpInsert = "insert"
+	ChangeOpUpdate = "update"
+	ChangeOpDelete = "delete"
+)
+
+// ChangeSink receives incremental row changes instead of the target, e.g. to pipe them to a queue or a webhook.
+// Without a sink, rows are written to the target with batched and prepared SQL statements.
+//
+// DDL and executed GTIDs still go to the target. A transaction failing to apply is applied again,
+// so a sink might receive a row more than once.
+type ChangeSink interface {
+	// ApplyRow receives a row change. op is one of ChangeOpInsert, ChangeOpUpdate and ChangeOpDelete.
+	// before is nil for insert and after is nil for delete. A nil value is NULL.
+	ApplyRow(op, schema, table string, before, after map[string]*string) error
+}
+
+// applyEventToSink sends rows of a DML event to the sink. Returns the number of rows.
+func applyEventToSink(sink ChangeSink, event *common.DataEvent, tableItem *common.ApplierTableItem) (int, error) {
+	var columnNames []string
+	if tableItem != nil {
+		columnNames = tableItem.ColumnMapTo
+		if len(columnNames) == 0 && tableItem.Columns != nil {
+			columnNames = tableItem.Columns.Names()
+		}
+	}
+	toMap := func(row []interface{}) (map[string]*string, error) {
+		if len(row) == 0 {
+			return nil, nil
+		}
+		if len(row) > len(columnNames) {
+			return nil, fmt.Errorf("unknown columns of %v.%v. got %v values, %v columns",
+				event.DatabaseName, event.TableName, len(row), len(columnNames))
+		}
+		m := make(map[string]*string, len(row))
+		for i, v := range row {
+			m[columnNames[i]] = sinkValue(v)
+		}
+		return m, nil
+	}
+
+	switch event.DML {
+	case common.InsertDML, common.DeleteDML:
+		op := ChangeOpInsert
+		if event.DML == common.DeleteDML {
+			op = ChangeOpDelete
+		}
+		for _, row := range event.Rows {
+			m, err := toMap(row)
+			if err != nil {
+				return 0, err
+			}
+			var before, after map[string]*string
+			if op == ChangeOpInsert {
+				after = m
+			} else {
+				before = m
+			}
+			if err := sink.ApplyRow(op, event.DatabaseName, event.TableName, before, after); err != nil {
+				return 0, err
+			}
+		}
+		return len(event.Rows), nil
+	case common.UpdateDML:
+		if len(event.Rows)%2 != 0 {
+			return 0, fmt.Errorf("bad update event. row number is not 2N %v", len(event.Rows))
+		}
+		for i := 0; i < len(event.Rows); i += 2 {
+			before, err := toMap(event.Rows[i])
+			if err != nil {
+				return 0, err
+			}
+			after, err := toMap(event.Rows[i+1])
+			if err != nil {
+				return 0, err
+			}
+			// an update might be recorded as an insert or a delete (Oracle)
+			op := ChangeOpUpdate
+			switch {
+			case before == nil && after == nil:
+				return 0, fmt.Errorf("bad update event. both rows are empty")
+			case before == nil:
+				op = ChangeOpInsert
+			case after == nil:
+				op = ChangeOpDelete
+			}
+			if err := sink.ApplyRow(op, event.DatabaseName, event.TableName, before, after); err != nil {
+				return 0, err
+			}
+		}
+		return len(event.Rows) / 2, nil
+	default:
+		return 0, fmt.Errorf("unknown DML type %v", event.DML)
+	}
+}
+
+func sinkValue(v interface{}) *string {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		s = fmt.Sprint(v)
+	}
+	return &s
+}
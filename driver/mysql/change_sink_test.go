@@ -0,0 +1,91 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+)
+
+type memChangeRecord struct {
+	op, schema, table string
+	before, after     map[string]string
+}
+
+type memChangeSink struct {
+	records []memChangeRecord
+}
+
+func (s *memChangeSink) ApplyRow(op, schema, table string, before, after map[string]*string) error {
+	deref := func(m map[string]*string) map[string]string {
+		if m == nil {
+			return nil
+		}
+		r := make(map[string]string, len(m))
+		for k, v := range m {
+			if v == nil {
+				r[k] = "NULL"
+			} else {
+				r[k] = *v
+			}
+		}
+		return r
+	}
+	s.records = append(s.records, memChangeRecord{op, schema, table, deref(before), deref(after)})
+	return nil
+}
+
+func TestApplyBinlogEventChangeSink(t *testing.T) {
+	a, mock := newTestApplierIncr(t)
+	sink := &memChangeSink{}
+	a.changeSink = sink
+
+	tableItem := common.NewApplierTableItem(1)
+	tableItem.Columns = common.NewColumnList([]mysqlconfig.Column{
+		{RawName: "id", EscapedName: "`id`", Key: "PRI"}, {RawName: "c", EscapedName: "`c`"}})
+
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 14, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.InsertDML, DatabaseName: "a", TableName: "t1",
+				Rows: [][]interface{}{{int64(1), "x"}, {int64(2), nil}}},
+			{DML: common.UpdateDML, DatabaseName: "a", TableName: "t1",
+				Rows: [][]interface{}{{int64(1), "x"}, {int64(1), []byte("y")}}},
+			{DML: common.DeleteDML, DatabaseName: "a", TableName: "t1",
+				Rows: [][]interface{}{{int64(2), nil}}},
+		},
+		Final: true,
+	}
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	// rows are not written to the target
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	entryCtx := &common.EntryContext{Entry: entry,
+		TableItems: []*common.ApplierTableItem{tableItem, tableItem, tableItem}}
+	if err := a.ApplyBinlogEvent(0, entryCtx); err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if entryCtx.Rows != 4 {
+		t.Errorf("Rows = %v, want 4", entryCtx.Rows)
+	}
+
+	expected := []memChangeRecord{
+		{ChangeOpInsert, "a", "t1", nil, map[string]string{"id": "1", "c": "x"}},
+		{ChangeOpInsert, "a", "t1", nil, map[string]string{"id": "2", "c": "NULL"}},
+		{ChangeOpUpdate, "a", "t1", map[string]string{"id": "1", "c": "x"}, map[string]string{"id": "1", "c": "y"}},
+		{ChangeOpDelete, "a", "t1", map[string]string{"id": "2", "c": "NULL"}, nil},
+	}
+	if !reflect.DeepEqual(sink.records, expected) {
+		t.Errorf("got %v\nwant %v", sink.records, expected)
+	}
+}
@@ -0,0 +1,93 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+)
+
+// columnCharsets are character sets of values of configured columns, which might differ from
+// what the source declares (e.g. a latin1 column storing GBK bytes). Values are converted to
+// UTF-8 before being written, and the target converts them to the character set of the column.
+type columnCharsets map[common.SchemaTable]map[string]string
+
+// newColumnCharsets returns nil if no column is configured.
+// Keys of m are "schema.table.column" of the target.
+func newColumnCharsets(m map[string]string) (columnCharsets, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	r := make(columnCharsets)
+	for k, charset := range m {
+		ss := strings.Split(k, ".")
+		if len(ss) != 3 || ss[0] == "" || ss[1] == "" || ss[2] == "" {
+			return nil, fmt.Errorf("bad ColumnCharsets item %v. expect schema.table.column", k)
+		}
+		charset = strings.ToLower(charset)
+		if !mysqlconfig.IsConvertibleCharset(charset) {
+			return nil, fmt.Errorf("ColumnCharsets: unsupported character set %v for %v", charset, k)
+		}
+		st := common.SchemaTable{Schema: ss[0], Table: ss[1]}
+		if r[st] == nil {
+			r[st] = make(map[string]string)
+		}
+		r[st][strings.ToLower(ss[2])] = charset
+	}
+	return r, nil
+}
+
+// indexes returns the character sets by positions of the columns in a row whose columns are
+// `columnNames`. The columns must be character columns of the target which can hold the values.
+func (c columnCharsets) indexes(schema, table string, columnNames []string,
+	targetColumns *common.ColumnList) (map[int]string, error) {
+
+	columns, ok := c[common.SchemaTable{Schema: schema, Table: table}]
+	if !ok {
+		return nil, nil
+	}
+	r := make(map[int]string)
+	for i, name := range columnNames {
+		charset, ok := columns[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		column := targetColumns.GetColumn(name)
+		if column == nil || column.Charset == "" || column.Charset == "binary" {
+			return nil, fmt.Errorf("ColumnCharsets: %v.%v.%v is not a character column of the target",
+				schema, table, name)
+		}
+		switch column.Charset {
+		case "utf8", "utf8mb3", "utf8mb4", charset:
+		default:
+			return nil, fmt.Errorf("ColumnCharsets: %v.%v.%v of character set %v cannot hold values of %v",
+				schema, table, name, column.Charset, charset)
+		}
+		r[i] = charset
+	}
+	return r, nil
+}
+
+// convertRowValues returns a copy of rows (of full copy) with values at the positions converted
+// from their character sets to UTF-8. The rows are not modified, so that the entry can be applied
+// again on retrying.
+func convertRowValues(rows [][]*[]byte, charsets map[int]string) ([][]*[]byte, error) {
+	r := make([][]*[]byte, len(rows))
+	for i, row := range rows {
+		newRow := make([]*[]byte, len(row))
+		copy(newRow, row)
+		for j, charset := range charsets {
+			if j < len(newRow) && newRow[j] != nil {
+				s, err := mysqlconfig.ConvertToUTF8(string(*newRow[j]), charset)
+				if err != nil {
+					return nil, fmt.Errorf("converting a value from %v: %v", charset, err)
+				}
+				v := []byte(s)
+				newRow[j] = &v
+			}
+		}
+		r[i] = newRow
+	}
+	return r, nil
+}
@@ -0,0 +1,97 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/actiontech/dtle/driver/common"
+	umconf "github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+)
+
+func TestNewColumnCharsets(t *testing.T) {
+	if c, err := newColumnCharsets(nil); c != nil || err != nil {
+		t.Errorf("expect nil for no column, got %v %v", c, err)
+	}
+	if _, err := newColumnCharsets(map[string]string{"db1.t1": "latin1"}); err == nil {
+		t.Errorf("expect error on a bad column name")
+	}
+	if _, err := newColumnCharsets(map[string]string{"db1.t1.c1": "no_such_charset"}); err == nil {
+		t.Errorf("expect error on an unsupported charset")
+	}
+	c, err := newColumnCharsets(map[string]string{"db1.t1.C1": "LATIN1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if charset := c[common.SchemaTable{Schema: "db1", Table: "t1"}]["c1"]; charset != "latin1" {
+		t.Errorf("unexpected charset %v", charset)
+	}
+}
+
+func TestApplyEventQueriesColumnCharsets(t *testing.T) {
+	newEntry := func() *common.DumpEntry {
+		srcTable := common.NewTable("db1", "t1")
+		srcTable.OriginalTableColumns = common.NewColumnList([]umconf.Column{
+			{RawName: "id", ColumnType: "int(11)"},
+			{RawName: "name", ColumnType: "varchar(32)"},
+		})
+		tableBs, err := common.EncodeTable(srcTable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id1, id2, name := []byte("1"), []byte("2"), []byte("caf\xe9 \xbd") // "café ½" in latin1
+		return &common.DumpEntry{
+			TableSchema: "db1",
+			TableName:   "t1",
+			ColumnTypes: []string{"int(11)", "varchar(32)"},
+			ValuesX:     [][]*[]byte{{&id1, &name}, {&id2, nil}},
+			Table:       tableBs,
+		}
+	}
+	expectTargetColumns := func(mock sqlmock.Sqlmock, charset string) {
+		mock.ExpectQuery("show columns from `db1`.`t1`").WillReturnRows(
+			sqlmock.NewRows([]string{"Field", "Type", "Null", "Key", "Default", "Extra"}).
+				AddRow("id", "int(11)", "NO", "PRI", nil, "").
+				AddRow("name", "varchar(32)", "YES", "", nil, ""))
+		mock.ExpectQuery("select * from information_schema.columns where table_schema=? and table_name=?").
+			WithArgs("db1", "t1").WillReturnRows(
+			sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "DATETIME_PRECISION", "CHARACTER_SET_NAME"}).
+				AddRow("id", "int(11)", nil, nil).
+				AddRow("name", "varchar(32)", nil, charset))
+	}
+
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+	var err error
+	a.columnCharsets, err = newColumnCharsets(map[string]string{"db1.t1.name": "latin1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := newEntry()
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectTargetColumns(mock, "utf8mb4")
+	mock.ExpectExec("replace into `db1`.`t1`  values ('1','café ½'),('2',NULL)").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	// the entry is kept as is for retrying
+	if string(*entry.ValuesX[0][1]) != "caf\xe9 \xbd" {
+		t.Errorf("entry is modified")
+	}
+
+	// the target column cannot hold the characters
+	a, mock = newTestApplier(t, &common.MySQLDriverConfig{})
+	a.columnCharsets, _ = newColumnCharsets(map[string]string{"db1.t1.name": "gbk"})
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectTargetColumns(mock, "latin1")
+	err = a.ApplyEventQueries(a.db, newEntry())
+	if err == nil || !strings.Contains(err.Error(), "cannot hold") {
+		t.Errorf("expect error on the target charset, got %v", err)
+	}
+}
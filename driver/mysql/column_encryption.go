@@ -0,0 +1,162 @@
+package mysql
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"strings"
+
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+)
+
+// columnEncryptor encrypts values of configured columns before they are written to the target.
+// The result is the same as MySQL `AES_ENCRYPT(value, key)` with the default block_encryption_mode
+// (aes-128-ecb), so the application can read it with `AES_DECRYPT(column, key)`.
+// The encryption is deterministic: equal values give equal ciphertexts.
+// Target columns should be VARBINARY or BLOB.
+type columnEncryptor struct {
+	block   cipher.Block
+	columns map[common.SchemaTable]map[string]struct{}
+}
+
+// newColumnEncryptor returns nil if no column is to be encrypted.
+// columns are "schema.table.column" of the target.
+func newColumnEncryptor(key string, columns []string) (*columnEncryptor, error) {
+	if len(columns) == 0 {
+		return nil, nil
+	}
+	if key == "" {
+		return nil, fmt.Errorf("ColumnEncryptionKey is required for EncryptColumns")
+	}
+
+	// MySQL folds the key into 16 bytes by XOR.
+	realKey := make([]byte, 16)
+	for i := 0; i < len(key); i++ {
+		realKey[i%16] ^= key[i]
+	}
+	block, err := aes.NewCipher(realKey)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &columnEncryptor{
+		block:   block,
+		columns: make(map[common.SchemaTable]map[string]struct{}),
+	}
+	for _, c := range columns {
+		ss := strings.Split(c, ".")
+		if len(ss) != 3 || ss[0] == "" || ss[1] == "" || ss[2] == "" {
+			return nil, fmt.Errorf("bad EncryptColumns item %v. expect schema.table.column", c)
+		}
+		st := common.SchemaTable{Schema: ss[0], Table: ss[1]}
+		if e.columns[st] == nil {
+			e.columns[st] = make(map[string]struct{})
+		}
+		e.columns[st][strings.ToLower(ss[2])] = struct{}{}
+	}
+	return e, nil
+}
+
+// hasTable returns whether any column of the table is to be encrypted.
+func (e *columnEncryptor) hasTable(schema, table string) bool {
+	if e == nil {
+		return false
+	}
+	_, ok := e.columns[common.SchemaTable{Schema: schema, Table: table}]
+	return ok
+}
+
+// indexes returns the positions of the columns to be encrypted in a row whose columns are `columnNames`.
+func (e *columnEncryptor) indexes(schema, table string, columnNames []string) (r []int) {
+	if e == nil {
+		return nil
+	}
+	columns, ok := e.columns[common.SchemaTable{Schema: schema, Table: table}]
+	if !ok {
+		return nil
+	}
+	for i, name := range columnNames {
+		if _, ok := columns[strings.ToLower(name)]; ok {
+			r = append(r, i)
+		}
+	}
+	return r
+}
+
+// excludeColumns returns columns of the table without those to be encrypted.
+func (e *columnEncryptor) excludeColumns(schema, table string, columns *common.ColumnList) *common.ColumnList {
+	if !e.hasTable(schema, table) || columns == nil {
+		return columns
+	}
+	encrypted := e.columns[common.SchemaTable{Schema: schema, Table: table}]
+	var r []mysqlconfig.Column
+	for _, c := range columns.ColumnList() {
+		if _, ok := encrypted[strings.ToLower(c.RawName)]; !ok {
+			r = append(r, c)
+		}
+	}
+	return common.NewColumnList(r)
+}
+
+// encrypt pads the value with PKCS7 and encrypts it with AES in ECB mode.
+func (e *columnEncryptor) encrypt(value []byte) []byte {
+	bs := e.block.BlockSize()
+	nPad := bs - len(value)%bs
+	r := make([]byte, len(value)+nPad)
+	copy(r, value)
+	for i := len(value); i < len(r); i++ {
+		r[i] = byte(nPad)
+	}
+	for i := 0; i < len(r); i += bs {
+		e.block.Encrypt(r[i:i+bs], r[i:i+bs])
+	}
+	return r
+}
+
+// encryptRowValues returns a copy of rows (of full copy) with values at `indexes` encrypted.
+// NULLs are kept. The rows are not modified, so that the entry can be applied again on retrying.
+func (e *columnEncryptor) encryptRowValues(rows [][]*[]byte, indexes []int) [][]*[]byte {
+	r := make([][]*[]byte, len(rows))
+	for i, row := range rows {
+		newRow := make([]*[]byte, len(row))
+		copy(newRow, row)
+		for _, j := range indexes {
+			if j < len(newRow) && newRow[j] != nil {
+				v := e.encrypt(*newRow[j])
+				newRow[j] = &v
+			}
+		}
+		r[i] = newRow
+	}
+	return r
+}
+
+// encryptRowArgs is encryptRowValues for rows of incremental DML events.
+func (e *columnEncryptor) encryptRowArgs(rows [][]interface{}, indexes []int) [][]interface{} {
+	r := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		if len(row) == 0 { // the absent image of an update
+			r[i] = row
+			continue
+		}
+		newRow := make([]interface{}, len(row))
+		copy(newRow, row)
+		for _, j := range indexes {
+			if j >= len(newRow) {
+				continue
+			}
+			switch v := newRow[j].(type) {
+			case nil:
+			case []byte:
+				newRow[j] = e.encrypt(v)
+			case string:
+				newRow[j] = e.encrypt([]byte(v))
+			default:
+				newRow[j] = e.encrypt([]byte(fmt.Sprintf("%v", v)))
+			}
+		}
+		r[i] = newRow
+	}
+	return r
+}
@@ -0,0 +1,218 @@
+package mysql
+
+import (
+	"bytes"
+	"crypto/aes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/actiontech/dtle/driver/common"
+	umconf "github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+	"github.com/actiontech/dtle/driver/mysql/sql"
+	"github.com/go-sql-driver/mysql"
+)
+
+// aesDecrypt is MySQL AES_DECRYPT(value, key) with the default block_encryption_mode, as the application does.
+func aesDecrypt(t *testing.T, value []byte, key string) []byte {
+	realKey := make([]byte, 16)
+	for i := 0; i < len(key); i++ {
+		realKey[i%16] ^= key[i]
+	}
+	block, err := aes.NewCipher(realKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(value) == 0 || len(value)%aes.BlockSize != 0 {
+		t.Fatalf("bad length of encrypted value %v", len(value))
+	}
+	r := make([]byte, len(value))
+	for i := 0; i < len(value); i += aes.BlockSize {
+		block.Decrypt(r[i:i+aes.BlockSize], value[i:i+aes.BlockSize])
+	}
+	nPad := int(r[len(r)-1])
+	if nPad == 0 || nPad > aes.BlockSize {
+		t.Fatalf("bad padding %v", nPad)
+	}
+	return r[:len(r)-nPad]
+}
+
+func TestColumnEncryptor(t *testing.T) {
+	if e, err := newColumnEncryptor("", nil); e != nil || err != nil {
+		t.Errorf("expect no encryptor, got %v %v", e, err)
+	}
+	if _, err := newColumnEncryptor("", []string{"db1.t1.c1"}); err == nil {
+		t.Errorf("expect error for an empty key")
+	}
+	if _, err := newColumnEncryptor("k", []string{"db1.t1"}); err == nil {
+		t.Errorf("expect error for a bad column")
+	}
+
+	key := "a key longer than sixteen bytes"
+	e, err := newColumnEncryptor(key, []string{"db1.t1.secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexes := e.indexes("db1", "t1", []string{"id", "SECRET"})
+	if len(indexes) != 1 || indexes[0] != 1 {
+		t.Fatalf("indexes %v, expect [1]", indexes)
+	}
+	if e.indexes("db1", "t2", []string{"id", "secret"}) != nil {
+		t.Errorf("expect no index for another table")
+	}
+
+	for _, plain := range []string{"", "0123456789abcdef", "card 4111-1111-1111-1111"} {
+		encrypted := e.encrypt([]byte(plain))
+		if bytes.Contains(encrypted, []byte(plain)) && plain != "" {
+			t.Errorf("encrypted value of %q contains the plaintext", plain)
+		}
+		if decrypted := aesDecrypt(t, encrypted, key); string(decrypted) != plain {
+			t.Errorf("decrypted %q, expect %q", decrypted, plain)
+		}
+	}
+
+	rows := [][]interface{}{{1, "s1"}, {2, nil}, {3, []byte("s3")}, {}}
+	encrypted := e.encryptRowArgs(rows, indexes)
+	if rows[0][1] != "s1" {
+		t.Errorf("rows are modified")
+	}
+	if encrypted[1][1] != nil || len(encrypted[3]) != 0 {
+		t.Errorf("expect NULL and an absent image to be kept, got %v", encrypted)
+	}
+	if v := aesDecrypt(t, encrypted[0][1].([]byte), key); string(v) != "s1" {
+		t.Errorf("decrypted %q, expect s1", v)
+	}
+	if v := aesDecrypt(t, encrypted[2][1].([]byte), key); string(v) != "s3" {
+		t.Errorf("decrypted %q, expect s3", v)
+	}
+}
+
+func TestApplyEventQueriesEncryptColumns(t *testing.T) {
+	key := "k1"
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{})
+	var err error
+	a.columnEncryptor, err = newColumnEncryptor(key, []string{"db1.t1.secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srcTable := common.NewTable("db1", "t1")
+	srcTable.OriginalTableColumns = common.NewColumnList([]umconf.Column{
+		{RawName: "id", ColumnType: "int(11)"},
+		{RawName: "secret", ColumnType: "varchar(32)"},
+	})
+	tableBs, err := common.EncodeTable(srcTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id1, id2, secret := []byte("1"), []byte("2"), []byte("plain's")
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ColumnTypes: []string{"int(11)", "varchar(32)"},
+		ValuesX:     [][]*[]byte{{&id1, &secret}, {&id2, nil}},
+		Table:       tableBs,
+	}
+
+	encrypted := a.columnEncryptor.encrypt(secret)
+	mock.ExpectBegin()
+	mock.ExpectExec(querySetFKChecksOff).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("show columns from `db1`.`t1`").WillReturnRows(
+		sqlmock.NewRows([]string{"Field", "Type", "Null", "Key", "Default", "Extra"}).
+			AddRow("id", "int(11)", "NO", "PRI", nil, "").
+			AddRow("secret", "varbinary(64)", "YES", "", nil, ""))
+	mock.ExpectQuery("select * from information_schema.columns where table_schema=? and table_name=?").
+		WithArgs("db1", "t1").WillReturnRows(
+		sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "DATETIME_PRECISION"}).
+			AddRow("id", "int(11)", nil).
+			AddRow("secret", "varbinary(64)", nil))
+	mock.ExpectExec(fmt.Sprintf("replace into `db1`.`t1`  values ('1',X'%X'),('2',NULL)", encrypted)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted, secret) {
+		t.Errorf("plaintext is written to the target")
+	}
+	if v := aesDecrypt(t, encrypted, key); !bytes.Equal(v, secret) {
+		t.Errorf("decrypted %q, expect %q", v, secret)
+	}
+	// the entry is kept as is for retrying
+	if string(*entry.ValuesX[0][1]) != string(secret) || entry.ColumnTypes[1] != "varchar(32)" {
+		t.Errorf("entry is modified")
+	}
+}
+
+func TestApplyEventQueriesEncryptColumnsOutputFile(t *testing.T) {
+	key := "k1"
+	a, mock := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		OutputMode:          common.OutputModeFile,
+		OutputFile:          filepath.Join(t.TempDir(), "out.sql"),
+		SkipIncrementalCopy: true,
+		EncryptColumns:      []string{"db1.t1.secret"},
+	}})
+	if err := a.initOutputFile(); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	a.columnEncryptor, err = newColumnEncryptor(key, a.mysqlContext.EncryptColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srcTable := common.NewTable("db1", "t1")
+	srcTable.OriginalTableColumns = common.NewColumnList([]umconf.Column{
+		{RawName: "id", ColumnType: "int(11)"},
+		{RawName: "secret", ColumnType: "varchar(32)"},
+	})
+	tableBs, err := common.EncodeTable(srcTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id1, secret := []byte("1"), []byte("plaintext-secret")
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		TbSQL:       []string{"CREATE TABLE `db1`.`t1` (`id` INT, `secret` VARBINARY(64))"},
+		ColumnTypes: []string{"int(11)", "varchar(32)"},
+		ValuesX:     [][]*[]byte{{&id1, &secret}},
+		Table:       tableBs,
+	}
+
+	// the target table is only created by the file. columns are taken from the source.
+	mock.ExpectBegin()
+	mock.ExpectQuery("show columns from `db1`.`t1`").
+		WillReturnError(&mysql.MySQLError{Number: sql.ErrNoSuchTable, Message: "Table 'db1.t1' doesn't exist"})
+	mock.ExpectQuery("select * from information_schema.columns where table_schema=? and table_name=?").
+		WithArgs("db1", "t1").WillReturnRows(
+		sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "DATETIME_PRECISION"}))
+	mock.ExpectRollback()
+	if err := a.ApplyEventQueries(a.db, entry); err != nil {
+		t.Fatalf("ApplyEventQueries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.outputFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := ioutil.ReadFile(a.mysqlContext.OutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(bs, secret) {
+		t.Errorf("plaintext is written to the file:\n%s", bs)
+	}
+	encrypted := fmt.Sprintf("replace into `db1`.`t1`  values ('1',X'%X');", a.columnEncryptor.encrypt(secret))
+	if !bytes.Contains(bs, []byte(encrypted)) {
+		t.Errorf("expect %v in the file:\n%s", encrypted, bs)
+	}
+}
@@ -0,0 +1,185 @@
+package mysql
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/actiontech/dtle/driver/mysql/base"
+	"github.com/pkg/errors"
+)
+
+// tablesInCopyOrder returns the tables of full copy in the order of TableCopyOrder.
+// Row counts (Table.Counter) should have been estimated for size orders.
+func (e *Extractor) tablesInCopyOrder() ([]*common.TableContext, error) {
+	var tables []*common.TableContext
+	for _, db := range e.replicateDoDb {
+		for _, tbCtx := range db.TableMap {
+			tables = append(tables, tbCtx)
+		}
+	}
+
+	var fkParents map[common.SchemaTable][]common.SchemaTable
+	if e.mysqlContext.TableCopyOrder == common.TableCopyOrderFKTopology {
+		fkParents = make(map[common.SchemaTable][]common.SchemaTable)
+		for _, tbCtx := range tables {
+			tb := tbCtx.Table
+			fks, err := base.GetForeignKeys(e.db, tb.TableSchema, tb.TableName)
+			if err != nil {
+				return nil, errors.Wrapf(err, "GetForeignKeys %v.%v", tb.TableSchema, tb.TableName)
+			}
+			st := common.SchemaTable{Schema: tb.TableSchema, Table: tb.TableName}
+			for _, fk := range fks {
+				fkParents[st] = append(fkParents[st], common.SchemaTable{Schema: fk.RefSchema, Table: fk.RefTable})
+			}
+		}
+	}
+
+	r, err := orderTablesForCopy(tables, e.mysqlContext.TableCopyOrder, e.mysqlContext.ReplicateDoDb, fkParents)
+	if err != nil {
+		return nil, err
+	}
+	if e.mysqlContext.TableCopyOrder != "" {
+		var names []string
+		for _, tbCtx := range r {
+			names = append(names, fmt.Sprintf("%v.%v", tbCtx.Table.TableSchema, tbCtx.Table.TableName))
+		}
+		e.logger.Info("table copy order", "order", e.mysqlContext.TableCopyOrder, "tables", names)
+	}
+	return r, nil
+}
+
+// orderTablesForCopy sorts tables by `order`. An empty order keeps the tables as they are.
+// Tables are sorted by name where the order does not tell.
+func orderTablesForCopy(tables []*common.TableContext, order string, doDbs []*common.DataSource,
+	fkParents map[common.SchemaTable][]common.SchemaTable) ([]*common.TableContext, error) {
+
+	if order == "" {
+		return tables, nil
+	}
+
+	r := make([]*common.TableContext, len(tables))
+	copy(r, tables)
+	sort.Slice(r, func(i, j int) bool {
+		return tableLess(r[i].Table, r[j].Table)
+	})
+
+	switch order {
+	case common.TableCopyOrderConfig:
+		positions := configTablePositions(doDbs)
+		position := func(tb *common.Table) int {
+			if p, ok := positions[common.SchemaTable{Schema: tb.TableSchema, Table: tb.TableName}]; ok {
+				return p
+			}
+			if p, ok := positions[common.SchemaTable{Schema: tb.TableSchema}]; ok {
+				return p
+			}
+			return len(positions)
+		}
+		sort.SliceStable(r, func(i, j int) bool {
+			return position(r[i].Table) < position(r[j].Table)
+		})
+	case common.TableCopyOrderSizeAsc:
+		sort.SliceStable(r, func(i, j int) bool {
+			return r[i].Table.Counter < r[j].Table.Counter
+		})
+	case common.TableCopyOrderSizeDesc:
+		sort.SliceStable(r, func(i, j int) bool {
+			return r[i].Table.Counter > r[j].Table.Counter
+		})
+	case common.TableCopyOrderFKTopology:
+		r = sortTablesByFK(r, fkParents)
+	default:
+		return nil, fmt.Errorf("unknown TableCopyOrder %v", order)
+	}
+	return r, nil
+}
+
+func tableLess(a, b *common.Table) bool {
+	if a.TableSchema != b.TableSchema {
+		return a.TableSchema < b.TableSchema
+	}
+	return a.TableName < b.TableName
+}
+
+// configTablePositions numbers tables in the order of ReplicateDoDb.
+// Other tables of a schema (e.g. matched by a regex) are numbered as {Schema: schema},
+// following the listed tables of the schema.
+func configTablePositions(doDbs []*common.DataSource) map[common.SchemaTable]int {
+	r := make(map[common.SchemaTable]int)
+	for _, doDb := range doDbs {
+		for _, doTb := range doDb.Tables {
+			st := common.SchemaTable{Schema: doDb.TableSchema, Table: doTb.TableName}
+			if _, ok := r[st]; !ok && doTb.TableName != "" {
+				r[st] = len(r)
+			}
+		}
+		st := common.SchemaTable{Schema: doDb.TableSchema}
+		if _, ok := r[st]; !ok {
+			r[st] = len(r)
+		}
+	}
+	return r
+}
+
+// sortTablesByFK puts parent tables before their children. References to tables not copied
+// and self-references are ignored. Tables in a reference cycle are put last, by name.
+func sortTablesByFK(tables []*common.TableContext, fkParents map[common.SchemaTable][]common.SchemaTable) []*common.TableContext {
+	key := func(tbCtx *common.TableContext) common.SchemaTable {
+		return common.SchemaTable{Schema: tbCtx.Table.TableSchema, Table: tbCtx.Table.TableName}
+	}
+	copying := make(map[common.SchemaTable]bool, len(tables))
+	for _, tbCtx := range tables {
+		copying[key(tbCtx)] = true
+	}
+
+	// number of parents not yet ordered
+	nParents := make(map[common.SchemaTable]int, len(tables))
+	for _, tbCtx := range tables {
+		st := key(tbCtx)
+		seen := map[common.SchemaTable]bool{}
+		for _, parent := range fkParents[st] {
+			if parent != st && copying[parent] && !seen[parent] {
+				seen[parent] = true
+				nParents[st]++
+			}
+		}
+	}
+
+	r := make([]*common.TableContext, 0, len(tables))
+	done := make(map[common.SchemaTable]bool, len(tables))
+	for len(r) < len(tables) {
+		progressed := false
+		// tables are sorted by name. pick the first ready ones in each pass.
+		for _, tbCtx := range tables {
+			st := key(tbCtx)
+			if done[st] || nParents[st] > 0 {
+				continue
+			}
+			done[st] = true
+			r = append(r, tbCtx)
+			progressed = true
+			for _, child := range tables {
+				cst := key(child)
+				if done[cst] {
+					continue
+				}
+				for _, parent := range fkParents[cst] {
+					if parent == st {
+						nParents[cst]--
+						break
+					}
+				}
+			}
+		}
+		if !progressed {
+			for _, tbCtx := range tables {
+				if !done[key(tbCtx)] {
+					r = append(r, tbCtx)
+				}
+			}
+			break
+		}
+	}
+	return r
+}
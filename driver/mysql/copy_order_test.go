@@ -0,0 +1,78 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/driver/common"
+)
+
+func TestOrderTablesForCopy(t *testing.T) {
+	newTable := func(schema, table string, rows int64) *common.TableContext {
+		tb := common.NewTable(schema, table)
+		tb.Counter = rows
+		return &common.TableContext{Table: tb}
+	}
+	names := func(tables []*common.TableContext) (r []string) {
+		for _, tbCtx := range tables {
+			r = append(r, tbCtx.Table.TableSchema+"."+tbCtx.Table.TableName)
+		}
+		return r
+	}
+	tables := []*common.TableContext{
+		newTable("db1", "order_items", 1000),
+		newTable("db1", "orders", 100),
+		newTable("db1", "customers", 10),
+		newTable("db2", "logs", 50),
+		newTable("db1", "categories", 5),
+	}
+	st := func(schema, table string) common.SchemaTable {
+		return common.SchemaTable{Schema: schema, Table: table}
+	}
+	fkParents := map[common.SchemaTable][]common.SchemaTable{
+		st("db1", "order_items"): {st("db1", "orders"), st("db1", "order_items"), st("db0", "products")},
+		st("db1", "orders"):      {st("db1", "customers")},
+		st("db1", "categories"):  {st("db1", "categories")},
+	}
+
+	r, err := orderTablesForCopy(tables, common.TableCopyOrderFKTopology, nil, fkParents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	position := map[string]int{}
+	for i, name := range names(r) {
+		position[name] = i
+	}
+	if len(r) != len(tables) {
+		t.Fatalf("got %v, expect all tables", names(r))
+	}
+	if !(position["db1.customers"] < position["db1.orders"] && position["db1.orders"] < position["db1.order_items"]) {
+		t.Errorf("parents should precede children, got %v", names(r))
+	}
+
+	r, err = orderTablesForCopy(tables, common.TableCopyOrderSizeAsc, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"db1.categories", "db1.customers", "db2.logs", "db1.orders", "db1.order_items"}
+	if !reflect.DeepEqual(names(r), expect) {
+		t.Errorf("size_asc got %v, expect %v", names(r), expect)
+	}
+
+	doDbs := []*common.DataSource{
+		{TableSchema: "db2"},
+		{TableSchema: "db1", Tables: []*common.Table{{TableName: "orders"}, {TableName: "customers"}}},
+	}
+	r, err = orderTablesForCopy(tables, common.TableCopyOrderConfig, doDbs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = []string{"db2.logs", "db1.orders", "db1.customers", "db1.categories", "db1.order_items"}
+	if !reflect.DeepEqual(names(r), expect) {
+		t.Errorf("config_order got %v, expect %v", names(r), expect)
+	}
+
+	if _, err = orderTablesForCopy(tables, "bad", nil, nil); err == nil {
+		t.Errorf("expect error for an unknown order")
+	}
+}
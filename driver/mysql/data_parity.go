@@ -0,0 +1,136 @@
+package mysql
+
+import (
+	"sync"
+
+	"github.com/actiontech/dtle/driver/common"
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// dataParity estimates how much of the source is on the target and verified, as
+// Stats.DataParityPct. It is only kept with VerifyChunkChecksum. The percentage is the product of:
+//   - checksum coverage: rows of full copy chunks passing the checksum, relative to RowsEstimate.
+//     Rows of a table are not counted while its last chunk mismatched the checksum.
+//   - GTID coverage: transactions of the target GTID set (the stop condition of the job) executed
+//     on the target. Without a target GTID set, applied transactions relative to DeltaEstimate.
+type dataParity struct {
+	mu     sync.Mutex
+	tables map[common.SchemaTable]*dataParityTable
+}
+
+type dataParityTable struct {
+	verifiedRows int64
+	mismatched   bool
+}
+
+func newDataParity() *dataParity {
+	return &dataParity{
+		tables: make(map[common.SchemaTable]*dataParityTable),
+	}
+}
+
+func (p *dataParity) getTable(schema, table string) *dataParityTable {
+	st := common.SchemaTable{Schema: schema, Table: table}
+	item, ok := p.tables[st]
+	if !ok {
+		item = &dataParityTable{}
+		p.tables[st] = item
+	}
+	return item
+}
+
+func (p *dataParity) chunkVerified(schema, table string, nRows int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	item := p.getTable(schema, table)
+	item.verifiedRows += nRows
+	item.mismatched = false
+}
+
+func (p *dataParity) chunkMismatched(schema, table string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.getTable(schema, table).mismatched = true
+}
+
+// checksumCoverage returns the fraction (0 to 1) of rows verified by checksum.
+func (p *dataParity) checksumCoverage(rowsEstimate int64) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var verified int64
+	mismatched := false
+	for _, item := range p.tables {
+		if item.mismatched {
+			mismatched = true
+			continue
+		}
+		verified += item.verifiedRows
+	}
+	if rowsEstimate <= 0 {
+		// nothing to copy
+		if mismatched {
+			return 0
+		}
+		return 1
+	}
+	return capFraction(float64(verified) / float64(rowsEstimate))
+}
+
+// pct returns the parity percentage, with gtidCoverage from gtidSetCoverage or txCoverage.
+func (p *dataParity) pct(rowsEstimate int64, gtidCoverage float64) float64 {
+	return 100.0 * p.checksumCoverage(rowsEstimate) * gtidCoverage
+}
+
+// gtidSetCoverage returns the fraction of transactions of target contained in executed.
+func gtidSetCoverage(executed *gomysql.MysqlGTIDSet, target *gomysql.MysqlGTIDSet) float64 {
+	var total, covered int64
+	for sid, targetSet := range target.Sets {
+		var executedSet *gomysql.UUIDSet
+		if executed != nil {
+			executedSet = executed.Sets[sid]
+		}
+		for _, t := range targetSet.Intervals {
+			total += t.Stop - t.Start
+			if executedSet == nil {
+				continue
+			}
+			for _, e := range executedSet.Intervals {
+				start, stop := t.Start, t.Stop
+				if e.Start > start {
+					start = e.Start
+				}
+				if e.Stop < stop {
+					stop = e.Stop
+				}
+				if stop > start {
+					covered += stop - start
+				}
+			}
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return capFraction(float64(covered) / float64(total))
+}
+
+// txCoverage returns the fraction of applied transactions relative to the estimate.
+func txCoverage(applied int64, estimate int64) float64 {
+	if estimate <= 0 {
+		return 1
+	}
+	return capFraction(float64(applied) / float64(estimate))
+}
+
+func capFraction(f float64) float64 {
+	if f > 1 {
+		return 1
+	}
+	return f
+}
@@ -0,0 +1,77 @@
+package mysql
+
+import (
+	"testing"
+
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestDataParity(t *testing.T) {
+	const rowsEstimate = 300
+	p := newDataParity()
+	var last float64
+	rise := func(what string) {
+		pct := p.pct(rowsEstimate, 1)
+		if pct <= last {
+			t.Fatalf("%v: expect parity to rise from %v, got %v", what, last, pct)
+		}
+		last = pct
+	}
+
+	if pct := p.pct(rowsEstimate, 1); pct != 0 {
+		t.Fatalf("expect 0 before any verification, got %v", pct)
+	}
+	p.chunkVerified("a", "t1", 100)
+	rise("a.t1 verified")
+	p.chunkVerified("a", "t2", 100)
+	rise("a.t2 verified")
+
+	p.chunkMismatched("a", "t2")
+	if pct := p.pct(rowsEstimate, 1); pct >= last {
+		t.Fatalf("expect a checksum mismatch to lower parity from %v, got %v", last, pct)
+	}
+	// the chunk is sent again and verified
+	p.chunkVerified("a", "t2", 0)
+	if pct := p.pct(rowsEstimate, 1); pct != last {
+		t.Fatalf("expect parity %v after the chunk is resent, got %v", last, pct)
+	}
+	p.chunkVerified("a", "t3", 100)
+	rise("a.t3 verified")
+	if last != 100 {
+		t.Fatalf("expect 100 after all rows verified, got %v", last)
+	}
+
+	if pct := p.pct(rowsEstimate, 0.5); pct != 50 {
+		t.Errorf("expect GTID coverage to scale parity, got %v", pct)
+	}
+	// no-op without VerifyChunkChecksum
+	(*dataParity)(nil).chunkVerified("a", "t1", 1)
+}
+
+func TestGtidSetCoverage(t *testing.T) {
+	parse := func(s string) *gomysql.MysqlGTIDSet {
+		gs, err := gomysql.ParseMysqlGTIDSet(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return gs.(*gomysql.MysqlGTIDSet)
+	}
+	target := parse("7b2a3a4e-1c1d-11ee-8b2f-0242ac120002:1-100,8c3b4b5f-1c1d-11ee-8b2f-0242ac120003:1-100")
+	tests := []struct {
+		executed string
+		want     float64
+	}{
+		{"", 0},
+		{"7b2a3a4e-1c1d-11ee-8b2f-0242ac120002:1-100", 0.5},
+		{"7b2a3a4e-1c1d-11ee-8b2f-0242ac120002:1-200,8c3b4b5f-1c1d-11ee-8b2f-0242ac120003:51-100", 0.75},
+		{"7b2a3a4e-1c1d-11ee-8b2f-0242ac120002:1-100,8c3b4b5f-1c1d-11ee-8b2f-0242ac120003:1-100", 1},
+	}
+	for _, tt := range tests {
+		if got := gtidSetCoverage(parse(tt.executed), target); got != tt.want {
+			t.Errorf("gtidSetCoverage(%v) = %v, want %v", tt.executed, got, tt.want)
+		}
+	}
+	if got := txCoverage(30, 120); got != 0.25 {
+		t.Errorf("txCoverage = %v, want 0.25", got)
+	}
+}
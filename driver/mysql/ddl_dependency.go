@@ -0,0 +1,93 @@
+package mysql
+
+import (
+	"fmt"
+
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/actiontech/dtle/driver/mysql/base"
+	"github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+	"github.com/actiontech/dtle/g"
+)
+
+// maxDDLDependencyDepth bounds the chain of FK parents created for a DDL.
+const maxDDLDependencyDepth = 16
+
+// createMissingFKParents creates tables referenced by foreign keys of the DDL if they do not exist
+// on the target, with DDL saved by the source (see PrefetchDDLDependencies). Parents of a parent
+// are created first. Each table is visited once, so cyclic references end.
+// Foreign key checks are off while creating them, and the current schema is restored after.
+func (a *ApplierIncr) createMissingFKParents(currentSchema string, query string,
+	execQuery func(query string) error) error {
+
+	visited := make(map[common.SchemaTable]struct{})
+	created := 0
+	var resolve func(schema string, query string, depth int) error
+	resolve = func(schema string, query string, depth int) error {
+		parents, err := base.ForeignKeyParentsOfDDL(query, schema)
+		if err != nil {
+			a.logger.Debug("cannot parse DDL for FK parents", "err", err, "query", g.StrLim(query, 256))
+			return nil
+		}
+		for _, parent := range parents {
+			if _, ok := visited[parent]; ok {
+				continue
+			}
+			visited[parent] = struct{}{}
+			if depth >= maxDDLDependencyDepth {
+				return fmt.Errorf("FK parents nested too deep at %v.%v", parent.Schema, parent.Table)
+			}
+
+			engine, err := base.GetTableEngine(a.db, parent.Schema, parent.Table)
+			if err != nil {
+				return err
+			}
+			if engine != "" {
+				continue // exists
+			}
+			ddl, ok, err := a.storeManager.GetTableDDL(a.subject, parent.Schema, parent.Table)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				a.logger.Warn("a FK parent is missing on the target and its DDL is not saved",
+					"schema", parent.Schema, "table", parent.Table)
+				continue
+			}
+			if err := resolve(parent.Schema, ddl, depth+1); err != nil {
+				return err
+			}
+
+			if created == 0 && !a.mysqlContext.KeepForeignKeyChecks {
+				if err := execQuery(querySetFKChecksOff); err != nil {
+					return err
+				}
+			}
+			created += 1
+			a.logger.Info("creating a missing FK parent", "schema", parent.Schema, "table", parent.Table)
+			escapedSchema := mysqlconfig.EscapeName(parent.Schema)
+			for _, q := range []string{"CREATE SCHEMA IF NOT EXISTS " + escapedSchema, "USE " + escapedSchema, ddl} {
+				if err := execQuery(q); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := resolve(currentSchema, query, 0); err != nil {
+		return err
+	}
+	if created > 0 {
+		if a.toggleFKChecks() {
+			if err := execQuery(querySetFKChecksOn); err != nil {
+				return err
+			}
+		}
+		if currentSchema != "" {
+			if err := execQuery("USE " + mysqlconfig.EscapeName(currentSchema)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package mysql
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestApplyBinlogEventCreateMissingFKParents(t *testing.T) {
+	const parentDDL = "CREATE TABLE `parent` (`id` INT PRIMARY KEY, `gid` INT, " +
+		"FOREIGN KEY (`gid`) REFERENCES `b`.`grand` (`id`))"
+	// references back to a.parent. the cycle should end.
+	const grandDDL = "CREATE TABLE `grand` (`id` INT PRIMARY KEY, `pid` INT, " +
+		"FOREIGN KEY (`pid`) REFERENCES `a`.`parent` (`id`))"
+	const childDDL = "CREATE TABLE `child` (`id` INT, `pid` INT, `oid` INT, " +
+		"FOREIGN KEY (`pid`) REFERENCES `parent` (`id`), FOREIGN KEY (`oid`) REFERENCES `other` (`id`))"
+
+	s := common.NewMemStore(map[string][]byte{
+		"dtle/job1/TableDDL/a/parent": []byte(parentDDL),
+		"dtle/job1/TableDDL/b/grand":  []byte(grandDDL),
+	})
+	sm := common.NewMemStoreManager(s, hclog.NewNullLogger())
+
+	a, mock := newTestApplierIncr(t)
+	a.subject = "job1"
+	a.tableItems = make(mapSchemaTableItems)
+	a.storeManager = sm
+	a.mysqlContext.PrefetchDDLDependencies = true
+	a.mysqlContext.ForeignKeyChecks = true
+	db, targetMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	a.db = db
+
+	queryEngine := regexp.QuoteMeta("select ENGINE from information_schema.TABLES")
+	noTable := func() *sqlmock.Rows { return sqlmock.NewRows([]string{"ENGINE"}) }
+	targetMock.ExpectQuery(queryEngine).WithArgs("a", "parent").WillReturnRows(noTable())
+	targetMock.ExpectQuery(queryEngine).WithArgs("b", "grand").WillReturnRows(noTable())
+	targetMock.ExpectQuery(queryEngine).WithArgs("a", "other").
+		WillReturnRows(sqlmock.NewRows([]string{"ENGINE"}).AddRow("InnoDB"))
+
+	entry := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{GNO: 19, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.NotDML, CurrentSchema: "a", DatabaseName: "a", TableName: "child", Query: childDDL},
+		},
+		Final: true,
+	}
+	executed := make(chan int64, 1)
+	go func() {
+		executed <- <-a.mtsManager.chExecuted
+	}()
+	expectExec := func(query string) {
+		mock.ExpectExec("^" + regexp.QuoteMeta(query) + "$").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	expectExec("USE `a`")
+	// the parent of the parent first
+	expectExec(querySetFKChecksOff)
+	expectExec("CREATE SCHEMA IF NOT EXISTS `b`")
+	expectExec("USE `b`")
+	expectExec(grandDDL)
+	expectExec("CREATE SCHEMA IF NOT EXISTS `a`")
+	expectExec("USE `a`")
+	expectExec(parentDDL)
+	expectExec(querySetFKChecksOn)
+	expectExec("USE `a`")
+	expectExec(childDDL)
+	expectExec("commit")
+
+	err = a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry, TableItems: []*common.ApplierTableItem{nil}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,65 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ddlLimiter limits the number of DDL operations running at once on a target.
+// It is shared by tasks of the same target in a dtle process.
+type ddlLimiter struct {
+	sem    chan struct{}
+	active int64
+}
+
+var (
+	ddlLimitersMu sync.Mutex
+	ddlLimiters   = map[string]*ddlLimiter{}
+)
+
+// getDDLLimiter returns the limiter shared by tasks writing to `target` with the same limit.
+// It returns nil (no limit) if maxConcurrentDDL <= 0.
+func getDDLLimiter(target string, maxConcurrentDDL int) *ddlLimiter {
+	if maxConcurrentDDL <= 0 {
+		return nil
+	}
+	key := fmt.Sprintf("%v/%v", target, maxConcurrentDDL)
+
+	ddlLimitersMu.Lock()
+	defer ddlLimitersMu.Unlock()
+	l, ok := ddlLimiters[key]
+	if !ok {
+		l = &ddlLimiter{sem: make(chan struct{}, maxConcurrentDDL)}
+		ddlLimiters[key] = l
+	}
+	return l
+}
+
+// Do runs the DDL operation `f` after other DDL operations beyond the limit are done.
+// A nil limiter runs `f` directly.
+func (l *ddlLimiter) Do(ctx context.Context, f func() error) error {
+	if l == nil {
+		return f()
+	}
+	select {
+	case l.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	atomic.AddInt64(&l.active, 1)
+	defer func() {
+		atomic.AddInt64(&l.active, -1)
+		<-l.sem
+	}()
+	return f()
+}
+
+// Active returns the number of DDL operations running.
+func (l *ddlLimiter) Active() int64 {
+	if l == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&l.active)
+}
@@ -0,0 +1,88 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDDLLimiter(t *testing.T) {
+	// two jobs writing to the same target share the limiter
+	l1 := getDDLLimiter("127.0.0.1:3306", 2)
+	l2 := getDDLLimiter("127.0.0.1:3306", 2)
+	if l1 != l2 {
+		t.Fatalf("expect a shared limiter for the same target")
+	}
+	if getDDLLimiter("127.0.0.1:3306", 0) != nil {
+		t.Errorf("expect no limiter for MaxConcurrentDDL 0")
+	}
+
+	var running, maxRunning int64
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var built []string
+	for i := 0; i < 6; i++ {
+		l := l1
+		if i%2 == 1 {
+			l = l2
+		}
+		table := fmt.Sprintf("t%v", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := l.Do(context.Background(), func() error {
+				n := atomic.AddInt64(&running, 1)
+				for {
+					m := atomic.LoadInt64(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt64(&maxRunning, m, n) {
+						break
+					}
+				}
+				if active := l.Active(); active > 2 {
+					t.Errorf("active DDL %v exceeds the limit", active)
+				}
+				time.Sleep(20 * time.Millisecond) // building an index
+				atomic.AddInt64(&running, -1)
+
+				mu.Lock()
+				built = append(built, table)
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxRunning > 2 {
+		t.Errorf("%v DDL ran at once, expect at most 2", maxRunning)
+	}
+	if len(built) != 6 {
+		t.Errorf("%v tables built, expect 6", len(built))
+	}
+	if l1.Active() != 0 {
+		t.Errorf("active DDL %v after all done", l1.Active())
+	}
+
+	// waiting DDL is canceled with the context
+	l := getDDLLimiter("127.0.0.1:3307", 1)
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	go l.Do(context.Background(), func() error {
+		close(blocked)
+		<-release
+		return nil
+	})
+	<-blocked
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Do(ctx, func() error { return nil }); err == nil {
+		t.Errorf("expect the waiting DDL to be canceled")
+	}
+	close(release)
+}
@@ -24,6 +24,11 @@ import (
 	usql "github.com/actiontech/dtle/driver/mysql/sql"
 )
 
+// net_write_timeout of the session scanning chunks with streaming. The result set of a chunk
+// stays open while ResultsChannel is full, e.g. on a slow target, and no keepalive can be sent
+// on the session meanwhile.
+const streamingNetWriteTimeoutSec = 86400
+
 type dumper struct {
 	*common.Dumper
 	EscapedTableSchema string
@@ -37,6 +42,10 @@ type dumper struct {
 
 	sentTableDef   bool
 	dumpEntryLimit int
+	// send an entry as soon as it reaches dumpEntryLimit, without holding the whole chunk.
+	streaming bool
+	// types of columns in a dumped row
+	columnTypes []string
 }
 
 func NewDumper(ctx context.Context, db usql.QueryAble, table *common.Table, chunkSize int64,
@@ -50,6 +59,8 @@ func NewDumper(ctx context.Context, db usql.QueryAble, table *common.Table, chun
 		false,
 		false,
 		dumpEntryLimit,
+		false,
+		nil,
 	}
 	dumper.PrepareForDumping = dumper.prepareForDumping
 	dumper.GetChunkData = dumper.getChunkData
@@ -89,6 +100,18 @@ func (d *dumper) prepareForDumping() error {
 		d.Columns = "*"
 	}
 
+	d.columnTypes = make([]string, len(d.Table.OriginalTableColumns.Columns))
+	for i := range d.Table.OriginalTableColumns.Columns {
+		d.columnTypes[i] = d.Table.OriginalTableColumns.Columns[i].ColumnType
+	}
+	if len(d.Table.ColumnMap) > 0 {
+		mapped := make([]string, len(d.Table.ColumnMap))
+		for i, fromIdx := range d.Table.ColumnMap {
+			mapped[i] = d.columnTypes[fromIdx]
+		}
+		d.columnTypes = mapped
+	}
+
 	return nil
 }
 
@@ -186,6 +209,7 @@ func (d *dumper) getChunkData() (nRows int64, err error) {
 		d.Logger.Error("error at select chunk", "query", query)
 		return 0, errors.Wrap(err, "select chunk")
 	}
+	defer rows.Close()
 
 	columns, err := rows.Columns()
 	if err != nil {
@@ -201,6 +225,7 @@ func (d *dumper) getChunkData() (nRows int64, err error) {
 			TableSchema: g.StringElse(d.Table.TableSchemaRename, d.TableSchema),
 			TableName:   g.StringElse(d.Table.TableRename, d.TableName),
 			ColumnMapTo: d.Table.ColumnMapTo,
+			ColumnTypes: d.columnTypes,
 			ValuesX:     valuesX,
 		}
 
@@ -247,6 +272,12 @@ func (d *dumper) getChunkData() (nRows int64, err error) {
 				//d.logger.Debug("*** memory", "memory", atomic.LoadInt64(d.memory))
 				keepGoing = false
 			case <-timer.C:
+				if d.streaming {
+					// the result set of the chunk is still open. the conn cannot be used.
+					// see streamingNetWriteTimeoutSec.
+					d.Logger.Debug("resultsChannel full. waiting")
+					continue
+				}
 				d.Logger.Debug("resultsChannel full. waiting and ping conn")
 				var dummy int
 				errPing := d.db.QueryRow("select 1").Scan(&dummy)
@@ -280,17 +311,25 @@ func (d *dumper) getChunkData() (nRows int64, err error) {
 
 		valuesX = append(valuesX, rowValuesRaw)
 		entrySize += getRowSize(rowValuesRaw)
+		nRows += 1
 
 		if !hasRow || entrySize >= d.dumpEntryLimit {
 			d.Logger.Debug("reach dumpEntryLimit.", "size", entrySize, "point", len(valuesX))
-			splitPoints = append(splitPoints, len(valuesX))
+			if d.streaming {
+				err = handleEntry(valuesX, !hasRow)
+				if err != nil {
+					return 0, err
+				}
+				valuesX = nil
+			} else {
+				splitPoints = append(splitPoints, len(valuesX))
+			}
 			entrySize = 0
 		}
 	}
 	if err = rows.Err(); err != nil {
 		return 0, err
 	}
-	nRows = int64(len(valuesX))
 
 	for i := 1; i < len(splitPoints); i++ {
 		err = handleEntry(valuesX[splitPoints[i-1]:splitPoints[i]], i == len(splitPoints)-1)
@@ -0,0 +1,115 @@
+package mysql
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/actiontech/dtle/driver/common"
+	umconf "github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestDumperStreaming(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const nRows = 100
+	const rowSize = 10
+	const dumpEntryLimit = 5 * rowSize
+	rows := sqlmock.NewRows([]string{"c1"})
+	for i := 0; i < nRows; i++ {
+		rows.AddRow([]byte("0123456789"))
+	}
+	mock.ExpectQuery("SELECT \\* FROM `db1`.`t1`").WillReturnRows(rows)
+
+	table := common.NewTable("db1", "t1")
+	table.OriginalTableColumns = common.NewColumnList([]umconf.Column{{RawName: "c1"}})
+	memory := new(int64)
+	d := NewDumper(context.Background(), db, table, nRows, hclog.NewNullLogger(), memory, dumpEntryLimit)
+	d.streaming = true
+	if err := d.PrepareForDumping(); err != nil {
+		t.Fatal(err)
+	}
+	d.ResultsChannel = make(chan *common.DumpEntry) // the consumer receives one entry at a time
+
+	type result struct {
+		n   int64
+		err error
+	}
+	resultCh := make(chan result)
+	go func() {
+		n, err := d.getChunkData()
+		close(d.ResultsChannel)
+		resultCh <- result{n, err}
+	}()
+
+	nEntries := 0
+	totalRows := 0
+	var peakMemory int64
+	for entry := range d.ResultsChannel {
+		nEntries++
+		totalRows += len(entry.ValuesX)
+		if m := atomic.LoadInt64(memory); m > peakMemory {
+			peakMemory = m
+		}
+		atomic.AddInt64(memory, -int64(entry.Size()))
+		for i := range entry.ValuesX {
+			if got := string(*entry.ValuesX[i][0]); got != "0123456789" {
+				t.Fatalf("unexpected value %v", got)
+			}
+		}
+	}
+	r := <-resultCh
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.n != nRows || totalRows != nRows {
+		t.Fatalf("rows: returned %v, received %v, want %v", r.n, totalRows, nRows)
+	}
+	if want := nRows * rowSize / dumpEntryLimit; nEntries != want {
+		t.Fatalf("entries: got %v, want %v", nEntries, want)
+	}
+	// an entry is sent before scanning the rest of the chunk
+	if peakMemory > 2*dumpEntryLimit+256 {
+		t.Fatalf("peak memory %v exceeds limit", peakMemory)
+	}
+}
+
+func TestWaitFullApplyMemory(t *testing.T) {
+	a, _ := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		FullApplyMemoryLimit: 100,
+	}})
+	a.memory1 = new(int64)
+	a.shutdownCh = make(chan struct{})
+	*a.memory1 = 200
+
+	done := make(chan bool)
+	go func() {
+		done <- a.waitFullApplyMemory()
+	}()
+	select {
+	case <-done:
+		t.Fatal("should wait while memory exceeds the limit")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	atomic.StoreInt64(a.memory1, 50)
+	if !<-done {
+		t.Fatal("expect true after memory is released")
+	}
+
+	atomic.StoreInt64(a.memory1, 200)
+	go func() {
+		done <- a.waitFullApplyMemory()
+	}()
+	close(a.shutdownCh)
+	if <-done {
+		t.Fatal("expect false on shutdown")
+	}
+}
@@ -0,0 +1,166 @@
+package mysql
+
+import (
+	"fmt"
+
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+)
+
+// encodingCheck checks values of a table against the character sets of the target columns,
+// handling characters the target cannot store according to OnEncodingError.
+type encodingCheck struct {
+	policy string
+	schema string
+	table  string
+	// by positions of the columns in a row
+	charsets map[int]string
+	names    map[int]string
+}
+
+func validateOnEncodingError(policy string) error {
+	switch policy {
+	case "", common.OnEncodingErrorFail, common.OnEncodingErrorReplaceChar, common.OnEncodingErrorSkipColumn:
+		return nil
+	default:
+		return fmt.Errorf("unknown OnEncodingError %v", policy)
+	}
+}
+
+// newEncodingCheck returns nil if OnEncodingError is not set or all columns of the target can
+// store any character. `columnNames` are columns of a row.
+func newEncodingCheck(policy string, schema, table string, columnNames []string,
+	targetColumns *common.ColumnList) *encodingCheck {
+
+	if policy == "" || targetColumns == nil {
+		return nil
+	}
+	c := &encodingCheck{
+		policy:   policy,
+		schema:   schema,
+		table:    table,
+		charsets: make(map[int]string),
+		names:    make(map[int]string),
+	}
+	for i, name := range columnNames {
+		column := targetColumns.GetColumn(name)
+		if column == nil || !mysqlconfig.HasLimitedRepertoire(column.Charset) {
+			continue
+		}
+		c.charsets[i] = column.Charset
+		c.names[i] = name
+	}
+	if len(c.charsets) == 0 {
+		return nil
+	}
+	return c
+}
+
+// fixValue returns the value to be written for the value at position i. ok is false for NULL.
+func (c *encodingCheck) fixValue(i int, s string) (r string, ok bool, err error) {
+	charset := c.charsets[i]
+	if mysqlconfig.IsRepresentable(s, charset) {
+		return s, true, nil
+	}
+	switch c.policy {
+	case common.OnEncodingErrorReplaceChar:
+		return mysqlconfig.ReplaceUnrepresentable(s, charset), true, nil
+	case common.OnEncodingErrorSkipColumn:
+		return "", false, nil
+	default:
+		return "", false, fmt.Errorf("a value of %v.%v.%v cannot be stored in character set %v of the target",
+			c.schema, c.table, c.names[i], charset)
+	}
+}
+
+// fixRowValues returns rows (of full copy) with the values fixed. Rows are copied on changes,
+// so that the entry can be applied again on retrying.
+func (c *encodingCheck) fixRowValues(rows [][]*[]byte) ([][]*[]byte, error) {
+	var r [][]*[]byte
+	for i, row := range rows {
+		var newRow []*[]byte
+		for j := range c.charsets {
+			if j >= len(row) || row[j] == nil {
+				continue
+			}
+			s := string(*row[j])
+			fixed, ok, err := c.fixValue(j, s)
+			if err != nil {
+				return nil, err
+			}
+			if ok && fixed == s {
+				continue
+			}
+			if newRow == nil {
+				newRow = make([]*[]byte, len(row))
+				copy(newRow, row)
+			}
+			if ok {
+				v := []byte(fixed)
+				newRow[j] = &v
+			} else {
+				newRow[j] = nil
+			}
+		}
+		if newRow != nil {
+			if r == nil {
+				r = make([][]*[]byte, len(rows))
+				copy(r, rows)
+			}
+			r[i] = newRow
+		}
+	}
+	if r == nil {
+		return rows, nil
+	}
+	return r, nil
+}
+
+// fixRowArgs is fixRowValues for rows of an incr event. Values might be string or []byte.
+func (c *encodingCheck) fixRowArgs(rows [][]interface{}) ([][]interface{}, error) {
+	var r [][]interface{}
+	for i, row := range rows {
+		var newRow []interface{}
+		for j := range c.charsets {
+			if j >= len(row) {
+				continue
+			}
+			var s string
+			switch v := row[j].(type) {
+			case string:
+				s = v
+			case []byte:
+				s = string(v)
+			default:
+				continue
+			}
+			fixed, ok, err := c.fixValue(j, s)
+			if err != nil {
+				return nil, err
+			}
+			if ok && fixed == s {
+				continue
+			}
+			if newRow == nil {
+				newRow = make([]interface{}, len(row))
+				copy(newRow, row)
+			}
+			if ok {
+				newRow[j] = fixed
+			} else {
+				newRow[j] = nil
+			}
+		}
+		if newRow != nil {
+			if r == nil {
+				r = make([][]interface{}, len(rows))
+				copy(r, rows)
+			}
+			r[i] = newRow
+		}
+	}
+	if r == nil {
+		return rows, nil
+	}
+	return r, nil
+}
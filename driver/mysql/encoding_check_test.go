@@ -0,0 +1,105 @@
+package mysql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/actiontech/dtle/driver/common"
+	umconf "github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+)
+
+func TestEncodingCheck(t *testing.T) {
+	targetColumns := common.NewColumnList([]umconf.Column{
+		{RawName: "id"},
+		{RawName: "name", Charset: "utf8mb3"},
+		{RawName: "note", Charset: "utf8mb4"},
+		{RawName: "data", Charset: "binary"},
+	})
+	columnNames := targetColumns.Names()
+
+	if c := newEncodingCheck("", "a", "t1", columnNames, targetColumns); c != nil {
+		t.Fatal("expect no check without OnEncodingError")
+	}
+	utf8mb4Only := common.NewColumnList([]umconf.Column{{RawName: "id"}, {RawName: "note", Charset: "utf8mb4"}})
+	if c := newEncodingCheck(common.OnEncodingErrorFail, "a", "t1", utf8mb4Only.Names(), utf8mb4Only); c != nil {
+		t.Fatal("expect no check for columns storing any character")
+	}
+	if err := validateOnEncodingError("truncate"); err == nil {
+		t.Error("expect an error on an unknown OnEncodingError")
+	}
+
+	bs := func(s string) *[]byte {
+		b := []byte(s)
+		return &b
+	}
+	newRows := func() [][]*[]byte {
+		return [][]*[]byte{
+			{bs("1"), bs("plain é 中"), bs("x😀"), bs("\xf0\x9f\x98\x80")},
+			{bs("2"), bs("smile 😀!"), bs("x😀"), bs("\xf0\x9f\x98\x80")},
+		}
+	}
+	newArgs := func() [][]interface{} {
+		return [][]interface{}{
+			{int64(1), "plain é 中", "x😀", []byte("\xf0\x9f\x98\x80")},
+			{int64(2), []byte("smile 😀!"), "x😀", []byte("\xf0\x9f\x98\x80")},
+		}
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		c := newEncodingCheck(common.OnEncodingErrorFail, "a", "t1", columnNames, targetColumns)
+		_, err := c.fixRowValues(newRows())
+		if err == nil || !strings.Contains(err.Error(), "a.t1.name") || !strings.Contains(err.Error(), "utf8mb3") {
+			t.Errorf("unexpected error %v", err)
+		}
+		if _, err := c.fixRowArgs(newArgs()); err == nil {
+			t.Error("expect an error on incr rows")
+		}
+	})
+
+	t.Run("replace_char", func(t *testing.T) {
+		c := newEncodingCheck(common.OnEncodingErrorReplaceChar, "a", "t1", columnNames, targetColumns)
+		rows := newRows()
+		fixed, err := c.fixRowValues(rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(*fixed[1][1]) != "smile ?!" || string(*fixed[0][1]) != "plain é 中" || string(*fixed[1][2]) != "x😀" {
+			t.Errorf("unexpected values %q %q %q", *fixed[1][1], *fixed[0][1], *fixed[1][2])
+		}
+		if string(*rows[1][1]) != "smile 😀!" {
+			t.Errorf("rows of the entry are modified")
+		}
+		args, err := c.fixRowArgs(newArgs())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if args[1][1] != "smile ?!" || !reflect.DeepEqual(args[0], newArgs()[0]) {
+			t.Errorf("unexpected args %q", args)
+		}
+	})
+
+	t.Run("skip_column", func(t *testing.T) {
+		c := newEncodingCheck(common.OnEncodingErrorSkipColumn, "a", "t1", columnNames, targetColumns)
+		fixed, err := c.fixRowValues(newRows())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fixed[1][1] != nil || fixed[0][1] == nil || string(*fixed[1][0]) != "2" {
+			t.Errorf("expect only the value of name in row 2 to be NULL. got %v", fixed)
+		}
+		args, err := c.fixRowArgs(newArgs())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if args[1][1] != nil || args[1][2] != "x😀" {
+			t.Errorf("unexpected args %q", args)
+		}
+	})
+
+	// latin1 cannot store CJK characters
+	if umconf.IsRepresentable("中", "latin1") || !umconf.IsRepresentable("café", "latin1") ||
+		umconf.ReplaceUnrepresentable("café 中", "latin1") != "café ?" {
+		t.Error("unexpected latin1 check")
+	}
+}
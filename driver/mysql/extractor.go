@@ -18,6 +18,7 @@ import (
 	"github.com/actiontech/dtle/driver/mysql/mysqlconfig"
 	"github.com/actiontech/dtle/driver/mysql/sql"
 	"github.com/cznic/mathutil"
+	"github.com/hashicorp/nomad/drivers/shared/eventer"
 	"github.com/hashicorp/nomad/plugins/drivers"
 
 	"github.com/actiontech/dtle/g"
@@ -40,6 +41,9 @@ import (
 	"github.com/hashicorp/go-hclog"
 )
 
+// max times to send a full copy chunk whose checksum mismatches on the target
+const maxChunkResend = 3
+
 // Extractor is the main schema extract flow manager.
 type Extractor struct {
 	execCtx      *common.ExecContext
@@ -78,6 +82,8 @@ type Extractor struct {
 
 	sendByTimeoutCounter  int
 	sendBySizeFullCounter int
+	// incremental entries grouped but not sent yet
+	entryGroup common.EntryGroup
 
 	natsConn *gonats.Conn
 	waitCh   chan *drivers.ExitResult
@@ -108,9 +114,15 @@ type Extractor struct {
 	wg         sync.WaitGroup
 	targetGtid string
 	RevApplier *Applier
+	// tables excluded for failing validation. see SkipInvalidTables
+	skippedTables []string
+
+	event      *eventer.Eventer
+	taskConfig *drivers.TaskConfig
 }
 
-func NewExtractor(execCtx *common.ExecContext, cfg *common.MySQLDriverConfig, logger g.LoggerType, storeManager *common.StoreManager, waitCh chan *drivers.ExitResult, ctx context.Context) (*Extractor, error) {
+func NewExtractor(execCtx *common.ExecContext, cfg *common.MySQLDriverConfig, logger g.LoggerType, storeManager *common.StoreManager, waitCh chan *drivers.ExitResult,
+	event *eventer.Eventer, taskConfig *drivers.TaskConfig, ctx context.Context) (*Extractor, error) {
 	logger.Info("NewExtractor", "job", execCtx.Subject)
 
 	e := &Extractor{
@@ -131,6 +143,11 @@ func NewExtractor(execCtx *common.ExecContext, cfg *common.MySQLDriverConfig, lo
 		memory1:         new(int64),
 		memory2:         new(int64),
 		replicateDoDb:   map[string]*common.SchemaContext{},
+		event:           event,
+		taskConfig:      taskConfig,
+	}
+	if cfg.SrcConnectionConfig != nil {
+		cfg.SrcConnectionConfig.InitAuthProvider()
 	}
 	e.dataChannel = make(chan *common.EntryContext, cfg.ReplChanBufferSize*4)
 	e.timestampCtx = NewTimestampContext(e.shutdownCh, e.logger, func() bool {
@@ -171,7 +188,11 @@ func (e *Extractor) Run() {
 	}
 
 	if e.mysqlContext.WaitOnJob != "" {
-		jobStatus, err := e.storeManager.GetJobStatus(e.subject)
+		var jobStatus string
+		err := e.storeManager.Retry("GetJobStatus", e.shutdownCh, func() (err error) {
+			jobStatus, err = e.storeManager.GetJobStatus(e.subject)
+			return err
+		})
 		if err != nil {
 			e.onError(common.TaskStateDead, err)
 			return
@@ -194,6 +215,11 @@ func (e *Extractor) Run() {
 		e.logger.Info("after WaitOnJob", "job2", e.mysqlContext.WaitOnJob, "firstWait", firstWait)
 	}
 
+	err = e.storeManager.PutProtocolInfo(e.subject, "src")
+	if err != nil {
+		e.onError(common.TaskStateDead, errors.Wrap(err, "PutProtocolInfo"))
+		return
+	}
 	// PutConfig before WatchNats
 	err = e.storeManager.PutConfig(e.subject, e.mysqlContext)
 	if err != nil {
@@ -208,6 +234,17 @@ func (e *Extractor) Run() {
 		e.onError(common.TaskStateDead, errors.Wrap(err, "SrcWatchNats"))
 		return
 	}
+	// the dest task has put its ProtocolInfo before NatsAddr
+	if e.mysqlContext.ValidateProtocolVersion {
+		if err = e.storeManager.CheckPeerProtocol(e.subject, "dest"); err != nil {
+			e.onError(common.TaskStateDead, err)
+			return
+		}
+	}
+	if err = e.storeManager.CheckPeerCodec(e.subject, "dest", e.mysqlContext.MessageCodec); err != nil {
+		e.onError(common.TaskStateDead, err)
+		return
+	}
 
 	if e.RevApplier != nil {
 		e.RevApplier.fwdExtractor = e
@@ -382,7 +419,7 @@ func (e *Extractor) initiateInspector() (err error) {
 
 func (e *Extractor) inspectTables() (err error) {
 	// Creates a MYSQL Dump based on the options supplied through the dumper.
-	dbsExisted, err := sql.ShowDatabases(e.db)
+	dbsExisted, err := sql.ShowDatabases(e.db, false)
 	if err != nil {
 		return err
 	}
@@ -455,9 +492,9 @@ func (e *Extractor) inspectTables() (err error) {
 				for _, doTb := range tbsFiltered {
 					doTb.TableSchema = doDb.TableSchema
 					doTb.TableSchemaRename = doDb.TableSchemaRename
-					if err := e.inspector.ValidateOriginalTable(doDb.TableSchema, doTb.TableName, doTb); err != nil {
-						e.logger.Warn("ValidateOriginalTable error", "err", err,
-							"schema", doDb.TableSchema, "table", doTb.TableName)
+					if ok, err := e.validateOriginalTable(doDb.TableSchema, doTb.TableName, doTb); err != nil {
+						return err
+					} else if !ok {
 						continue
 					}
 					err = schemaCtx.AddTable(doTb)
@@ -494,8 +531,9 @@ func (e *Extractor) inspectTables() (err error) {
 							newTable.TableName = table.TableName
 							match := reg.FindStringSubmatchIndex(table.TableName)
 							newTable.TableRename = string(reg.ExpandString(nil, tableRenameRegex, table.TableName, match))
-							if err := e.inspector.ValidateOriginalTable(doDb.TableSchema, table.TableName, newTable); err != nil {
-								e.logger.Warn("ValidateOriginalTable error", "TableSchema", doDb.TableSchema, "TableName", doTb.TableName, "err", err)
+							if ok, err := e.validateOriginalTable(doDb.TableSchema, table.TableName, newTable); err != nil {
+								return err
+							} else if !ok {
 								continue
 							}
 							err = schemaCtx.AddTable(newTable)
@@ -512,8 +550,9 @@ func (e *Extractor) inspectTables() (err error) {
 							if existedTable.TableName != doTb.TableName {
 								continue
 							}
-							if err := e.inspector.ValidateOriginalTable(doDb.TableSchema, doTb.TableName, doTb); err != nil {
-								e.logger.Warn("ValidateOriginalTable error", "TableSchema", doDb.TableSchema, "TableName", doTb.TableName, "err", err)
+							if ok, err := e.validateOriginalTable(doDb.TableSchema, doTb.TableName, doTb); err != nil {
+								return err
+							} else if !ok {
 								continue
 							}
 							newTable := &common.Table{}
@@ -548,8 +587,9 @@ func (e *Extractor) inspectTables() (err error) {
 				if len(e.mysqlContext.ReplicateIgnoreDb) > 0 && common.IgnoreTbByReplicateIgnoreDb(e.mysqlContext.ReplicateIgnoreDb, dbName, tb.TableName) {
 					continue
 				}
-				if err := e.inspector.ValidateOriginalTable(dbName, tb.TableName, tb); err != nil {
-					e.logger.Warn("ValidateOriginalTable error", "TableSchema", dbName, "TableName", tb.TableName, "err", err)
+				if ok, err := e.validateOriginalTable(dbName, tb.TableName, tb); err != nil {
+					return err
+				} else if !ok {
 					continue
 				}
 
@@ -564,6 +604,42 @@ func (e *Extractor) inspectTables() (err error) {
 	return nil
 }
 
+// validateOriginalTable returns false if the table fails validation and is skipped (SkipInvalidTables).
+func (e *Extractor) validateOriginalTable(schemaName, tableName string, table *common.Table) (bool, error) {
+	nWarnings := len(e.inspector.Warnings())
+	err := e.inspector.ValidateOriginalTable(schemaName, tableName, table)
+	e.sendValidationWarnings(e.inspector.Warnings()[nWarnings:])
+	if err == nil {
+		return true, nil
+	}
+	if !e.mysqlContext.SkipInvalidTables {
+		return false, errors.Wrapf(err, "ValidateOriginalTable %v.%v", schemaName, tableName)
+	}
+	e.logger.Warn("ValidateOriginalTable error. skipping the table", "TableSchema", schemaName,
+		"TableName", tableName, "err", err)
+	e.skippedTables = append(e.skippedTables, fmt.Sprintf("%v.%v: %v", schemaName, tableName, err))
+	return false, nil
+}
+
+// sendValidationWarnings sends each warning of ValidateOriginalTable as a task event.
+func (e *Extractor) sendValidationWarnings(warnings []string) {
+	if e.event == nil || e.taskConfig == nil {
+		return
+	}
+	for _, w := range warnings {
+		err := e.event.EmitEvent(&drivers.TaskEvent{
+			TaskID:    e.taskConfig.ID,
+			TaskName:  e.taskConfig.Name,
+			AllocID:   e.taskConfig.AllocID,
+			Timestamp: time.Now(),
+			Message:   "validation warning: " + w,
+		})
+		if err != nil {
+			e.logger.Error("error at sending task event", "err", err, "warning", w)
+		}
+	}
+}
+
 // readTableColumns reads table columns on applier
 func (e *Extractor) readTableColumns() (err error) {
 	e.logger.Info("Examining table structure on extractor")
@@ -715,8 +791,7 @@ func (e *Extractor) initiateStreaming() error {
 
 //--EventsStreamer--
 func (e *Extractor) initDBConnections() (err error) {
-	eventsStreamerUri := e.mysqlContext.SrcConnectionConfig.GetDBUri()
-	if e.db, err = sql.CreateDB(eventsStreamerUri); err != nil {
+	if e.db, err = sql.CreateDBWithConfig(e.mysqlContext.SrcConnectionConfig, ""); err != nil {
 		return err
 	}
 
@@ -743,9 +818,11 @@ func (e *Extractor) initDBConnections() (err error) {
 			}
 		}
 		// https://github.com/go-sql-driver/mysql#system-variables
-		dumpUri := fmt.Sprintf("%s&%s='REPEATABLE-READ'", e.mysqlContext.SrcConnectionConfig.GetDBUri(),
-			getTxIsolationVarName(e.mysqlVersionDigit))
-		if e.singletonDB, err = sql.CreateDB(dumpUri); err != nil {
+		txIsolation := fmt.Sprintf("%s='REPEATABLE-READ'", getTxIsolationVarName(e.mysqlVersionDigit))
+		if e.mysqlContext.StreamDumpEntry {
+			txIsolation += fmt.Sprintf("&net_write_timeout=%d", streamingNetWriteTimeoutSec)
+		}
+		if e.singletonDB, err = sql.CreateDBWithConfig(e.mysqlContext.SrcConnectionConfig, txIsolation); err != nil {
 			return err
 		}
 	}
@@ -758,6 +835,22 @@ func (e *Extractor) getSchemaTablesAndMeta() error {
 		return err
 	}
 
+	e.sqleContext.Lock()
+	err := e.loadSqleContext()
+	e.sqleContext.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := e.readTableColumns(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// loadSqleContext loads definitions of the replicated tables into sqleContext.
+// The caller holds the lock of sqleContext.
+func (e *Extractor) loadSqleContext() error {
 	for _, db := range e.replicateDoDb {
 		e.sqleContext.AddSchema(db.TableSchema)
 		e.sqleContext.LoadTables(db.TableSchema, nil)
@@ -795,10 +888,6 @@ func (e *Extractor) getSchemaTablesAndMeta() error {
 			}
 		}
 	}
-
-	if err := e.readTableColumns(); err != nil {
-		return err
-	}
 	return nil
 }
 
@@ -813,6 +902,11 @@ func (e *Extractor) initBinlogReader(binlogCoordinates *common.MySQLCoordinates)
 	}
 
 	e.binlogReader = binlogReader
+	if e.mysqlContext.PrefetchDDLDependencies {
+		binlogReader.SaveTableDDL = func(schema string, table string, ddl string) error {
+			return e.storeManager.PutTableDDL(e.subject, schema, table, ddl)
+		}
+	}
 
 	go func() {
 		err = binlogReader.ConnectBinlogStreamer(*binlogCoordinates)
@@ -877,9 +971,11 @@ func (e *Extractor) CountTableRows(table *common.Table) (int64, error) {
 	return rowsEstimate, nil
 }
 
-// Read the MySQL charset-related system variables.
+// Read the MySQL charset-related system variables, and explicit_defaults_for_timestamp which
+// affects definitions of TIMESTAMP columns.
 func (e *Extractor) readMySqlCharsetSystemVariables() error {
-	query := `show variables where Variable_name IN ('character_set_server','collation_server')`
+	query := `show variables where Variable_name IN ('character_set_server','collation_server',` +
+		`'explicit_defaults_for_timestamp')`
 	rows, err := e.db.Query(query)
 	if err != nil {
 		return err
@@ -925,7 +1021,8 @@ type TimestampContext struct {
 	TimestampCh    chan uint32
 	logger         g.LoggerType
 	emptyQueueFunc func() bool
-	delay          int64
+	// source timestamp (unix seconds) of the last handled event. 0 if all events are handled. atomic.
+	lastTimestamp int64
 }
 
 func NewTimestampContext(stopCh chan struct{}, logger g.LoggerType, emptyQueueFunc func() bool) *TimestampContext {
@@ -937,9 +1034,20 @@ func NewTimestampContext(stopCh chan struct{}, logger g.LoggerType, emptyQueueFu
 		TimestampCh: make(chan uint32, 16),
 	}
 }
+// GetDelay returns seconds since the source timestamp of the last handled event. It keeps growing
+// while no more event is handled, until the queue is found empty.
 func (tsc *TimestampContext) GetDelay() (d int64) {
-	tsc.logger.Debug("TimestampContext.GetDelay", "delay", tsc.delay)
-	return tsc.delay
+	d = tsc.getDelayAt(time.Now())
+	tsc.logger.Debug("TimestampContext.GetDelay", "delay", d)
+	return d
+}
+
+func (tsc *TimestampContext) getDelayAt(now time.Time) int64 {
+	ts := atomic.LoadInt64(&tsc.lastTimestamp)
+	if ts == 0 {
+		return 0
+	}
+	return now.Unix() - ts
 }
 
 func (tsc *TimestampContext) Handle() {
@@ -953,15 +1061,15 @@ func (tsc *TimestampContext) Handle() {
 			return
 		case ts := <-tsc.TimestampCh:
 			tsc.logger.Debug("TimestampContext.Handle: got", "timestamp", ts)
-			tsc.delay = time.Now().Unix() - int64(ts)
+			atomic.StoreInt64(&tsc.lastTimestamp, int64(ts))
 			hasTs = true
 		case <-t.C:
 			if hasTs {
 				hasTs = false
-			} else if tsc.delay != 0 {
+			} else if atomic.LoadInt64(&tsc.lastTimestamp) != 0 {
 				if tsc.emptyQueueFunc() {
 					tsc.logger.Debug("delay: resetting timestamp")
-					tsc.delay = 0
+					atomic.StoreInt64(&tsc.lastTimestamp, 0)
 				}
 			}
 		}
@@ -978,7 +1086,7 @@ func (e *Extractor) StreamEvents() error {
 			e.logger.Debug("StreamEvents goroutine exited")
 		}()
 		entries := common.DataEntries{}
-		entriesSize := 0
+		group := &e.entryGroup
 		sendEntriesAndClear := func() error {
 			var gno int64 = 0
 			if len(entries.Entries) > 0 {
@@ -989,7 +1097,7 @@ func (e *Extractor) StreamEvents() error {
 				}
 			}
 
-			txMsg, err := common.Encode(&entries)
+			txMsg, err := common.EncodeWith(e.mysqlContext.MessageCodec, &entries)
 			if err != nil {
 				return err
 			}
@@ -1003,7 +1111,7 @@ func (e *Extractor) StreamEvents() error {
 			}
 			e.logger.Debug("publish.after", "gno", gno, "n", len(entries.Entries))
 			entries.Entries = nil
-			entriesSize = 0
+			group.Reset()
 
 			return nil
 		}
@@ -1019,11 +1127,11 @@ func (e *Extractor) StreamEvents() error {
 				binlogEntry := entryCtx.Entry
 				atomic.AddUint64(&e.extractorQueryCount, uint64(len(binlogEntry.Events)))
 				entries.Entries = append(entries.Entries, binlogEntry)
-				entriesSize += entryCtx.OriginalSize
+				group.Add(entryCtx)
 
-				if entriesSize >= e.mysqlContext.GroupMaxSize {
-					e.logger.Debug("incr. send by GroupLimit",
-						"entriesSize", entriesSize,
+				if limit := group.Full(&e.mysqlContext.DtleTaskConfig); limit != "" {
+					e.logger.Debug("incr. send by GroupLimit", "limit", limit,
+						"entriesSize", group.Size, "rows", group.Rows(), "bytes", group.Bytes(),
 						"groupMaxSize", e.mysqlContext.GroupMaxSize,
 						"Entries.len", len(entries.Entries))
 
@@ -1043,7 +1151,7 @@ func (e *Extractor) StreamEvents() error {
 			case <-timer.C:
 				nEntries := len(entries.Entries)
 				if nEntries > 0 {
-					e.logger.Debug("incr. send by timeout.", "entriesSize", entriesSize,
+					e.logger.Debug("incr. send by timeout.", "entriesSize", group.Size,
 						"timeout", e.mysqlContext.GroupTimeout)
 					e.sendByTimeoutCounter += 1
 					err := sendEntriesAndClear()
@@ -1072,6 +1180,12 @@ func (e *Extractor) StreamEvents() error {
 // exiting as soon as it returns with non-error.
 // gno: only for logging
 func (e *Extractor) publish(subject string, data []byte, gno int64) (err error) {
+	_, err = e.publishWithReply(subject, data, gno)
+	return err
+}
+
+// publishWithReply is publish, returning the reply to the last segment.
+func (e *Extractor) publishWithReply(subject string, data []byte, gno int64) (reply []byte, err error) {
 	lenData := len(data)
 
 	// lenData < NatsMaxMsg: 1 msg
@@ -1101,14 +1215,15 @@ func (e *Extractor) publish(subject string, data []byte, gno int64) (err error)
 		}
 
 		e.logger.Debug("publish", "subject", subject, "gno", gno, "partLen", len(part), "iSeg", iSeg)
-		_, err := e.natsConn.Request(subject, part, 24*time.Hour)
+		msg, err := e.natsConn.Request(subject, part, 24*time.Hour)
 		if err != nil {
 			e.logger.Error("unexpected error on publish", "err", err,
 				"subject", subject, "gno", gno, "partLen", len(part), "iSeg", iSeg)
-			return err
+			return nil, err
 		}
+		reply = msg.Data
 	}
-	return nil
+	return reply, nil
 }
 
 func (e *Extractor) testStub1() {
@@ -1380,42 +1495,48 @@ func (e *Extractor) mysqlDump() (retErr error) {
 	e.logger.Info("Step: scanning contents of x tables", "n", step, "x", e.tableCount)
 	startScan := g.CurrentTimeMillis()
 	counter := 0
-	for _, db := range e.replicateDoDb {
-		for _, tbCtx := range db.TableMap {
-			t := tbCtx.Table
-			counter++
-			// Obtain a record maker for this table, which knows about the schema ...
-			// Choose how we create statements based on the # of rows ...
-			e.logger.Info("Step n: - scanning table (i of N tables)",
-				"n", step, "schema", t.TableSchema, "table", t.TableName, "i", counter, "N", e.tableCount)
-
-			d := NewDumper(e.ctx, tx, t, e.mysqlContext.ChunkSize, e.logger.ResetNamed("dumper"), e.memory1,
-				e.mysqlContext.DumpEntryLimit)
-			if err := d.Dump(); err != nil {
-				return errors.Wrapf(err, "d.Dump %v.%v", t.TableSchema, t.TableName)
-			}
-			e.dumpers = append(e.dumpers, d)
-			// Scan the rows in the table ...
-			for entry := range d.ResultsChannel {
-				memSize := int64(entry.Size())
-				if !d.sentTableDef {
-					tableBs, err := common.EncodeTable(d.Table)
-					if err != nil {
-						return errors.Wrap(err, "full copy: EncodeTable")
-					} else {
-						entry.Table = tableBs
-						d.sentTableDef = true
-					}
-				}
-				if err = e.encodeAndSendDumpEntry(entry); err != nil {
-					return errors.Wrap(err, "encodeAndSendDumpEntry. dump")
+	tables, err := e.tablesInCopyOrder()
+	if err != nil {
+		return err
+	}
+	for _, tbCtx := range tables {
+		t := tbCtx.Table
+		counter++
+		// Obtain a record maker for this table, which knows about the schema ...
+		// Choose how we create statements based on the # of rows ...
+		e.logger.Info("Step n: - scanning table (i of N tables)",
+			"n", step, "schema", t.TableSchema, "table", t.TableName, "i", counter, "N", e.tableCount)
+
+		d := NewDumper(e.ctx, tx, t, e.mysqlContext.ChunkSize, e.logger.ResetNamed("dumper"), e.memory1,
+			e.mysqlContext.DumpEntryLimit)
+		d.streaming = e.mysqlContext.StreamDumpEntry
+		if err := d.Dump(); err != nil {
+			return errors.Wrapf(err, "d.Dump %v.%v", t.TableSchema, t.TableName)
+		}
+		e.dumpers = append(e.dumpers, d)
+		// Scan the rows in the table ...
+		for entry := range d.ResultsChannel {
+			memSize := int64(entry.Size())
+			if !d.sentTableDef {
+				tableBs, err := common.EncodeTable(d.Table)
+				if err != nil {
+					return errors.Wrap(err, "full copy: EncodeTable")
+				} else {
+					entry.Table = tableBs
+					d.sentTableDef = true
 				}
-				atomic.AddInt64(&e.TotalRowsCopied, int64(len(entry.ValuesX)))
-				atomic.AddInt64(d.Memory, -memSize)
 			}
-			if d.Err != nil {
-				return errors.Wrap(err, "d.Err")
+			if e.mysqlContext.VerifyChunkChecksum {
+				entry.Checksum = entry.ComputeChecksum()
 			}
+			if err = e.encodeAndSendDumpEntry(entry); err != nil {
+				return errors.Wrap(err, "encodeAndSendDumpEntry. dump")
+			}
+			atomic.AddInt64(&e.TotalRowsCopied, int64(len(entry.ValuesX)))
+			atomic.AddInt64(d.Memory, -memSize)
+		}
+		if d.Err != nil {
+			return errors.Wrap(err, "d.Err")
 		}
 	}
 	step++
@@ -1430,23 +1551,38 @@ func (e *Extractor) mysqlDump() (retErr error) {
 	return nil
 }
 func (e *Extractor) encodeAndSendDumpEntry(entry *common.DumpEntry) error {
-	bs, err := entry.Marshal(nil)
+	txMsg, err := common.EncodeWith(e.mysqlContext.MessageCodec, entry)
 	if err != nil {
-		return err
-	}
-	e.logger.Debug("encodeAndSendDumpEntry. after Marshal", "size", len(bs))
-	txMsg, err := common.Compress(bs)
-	if err != nil {
-		return errors.Wrap(err, "common.Compress")
+		return errors.Wrap(err, "common.EncodeWith")
 	}
-	e.logger.Debug("encodeAndSendDumpEntry. after Compress", "size", len(txMsg))
-	if err := e.publish(fmt.Sprintf("%s_full", e.subject), txMsg, 0); err != nil {
-		return err
+	e.logger.Debug("encodeAndSendDumpEntry. after Encode", "size", len(txMsg))
+	for i := 0; ; i++ {
+		reply, err := e.publishWithReply(fmt.Sprintf("%s_full", e.subject), txMsg, 0)
+		if err != nil {
+			return err
+		}
+		if string(reply) != common.FullChunkChecksumMismatch {
+			break
+		}
+		if i+1 >= maxChunkResend {
+			return fmt.Errorf("checksum mismatch for chunk of %v.%v after %v attempts",
+				entry.TableSchema, entry.TableName, maxChunkResend)
+		}
+		e.logger.Warn("checksum mismatch on the target. sending the chunk again",
+			"schema", entry.TableSchema, "table", entry.TableName, "attempt", i+1)
 	}
 	e.mysqlContext.Stage = common.StageSendingData
 	return nil
 }
 
+// DumpSchemaCache renders the table definitions cached for parsing the binlog, by "schema.table".
+func (e *Extractor) DumpSchemaCache() map[string]string {
+	if e.sqleContext == nil {
+		return nil
+	}
+	return e.sqleContext.DumpSchemaCache()
+}
+
 func (e *Extractor) Stats() (*common.TaskStatistics, error) {
 	totalRowsCopied := atomic.LoadInt64(&e.TotalRowsCopied)
 	rowsEstimate := atomic.LoadInt64(&e.mysqlContext.RowsEstimate)
@@ -1513,6 +1649,12 @@ func (e *Extractor) Stats() (*common.TaskStatistics, error) {
 		HandledQueryCount: common.QueryCount{
 			ExtractedQueryCount: &e.extractorQueryCount,
 		},
+		SkippedTables:  e.skippedTables,
+		OpenGroupRows:  e.entryGroup.Rows(),
+		OpenGroupBytes: e.entryGroup.Bytes(),
+	}
+	if e.inspector != nil {
+		taskResUsage.ValidationWarnings = e.inspector.Warnings()
 	}
 	if e.natsConn != nil {
 		taskResUsage.MsgStat = e.natsConn.Statistics
@@ -1611,7 +1753,7 @@ func (e *Extractor) Shutdown() error {
 }
 
 func (e *Extractor) sendFullComplete() (err error) {
-	dumpMsg, err := common.Encode(&common.DumpStatResult{
+	dumpMsg, err := common.EncodeWith(e.mysqlContext.MessageCodec, &common.DumpStatResult{
 		Coord:      e.initialBinlogCoordinates,
 		TableSpecs: e.tableSpecs,
 	})
@@ -0,0 +1,224 @@
+package mysql
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/actiontech/dtle/driver/common"
+	hclog "github.com/hashicorp/go-hclog"
+	gonats "github.com/nats-io/go-nats"
+	gnatsd "github.com/nats-io/nats-server/v2/server"
+)
+
+func TestValidateOriginalTableSkipInvalidTables(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cfg := &common.MySQLDriverConfig{}
+	cfg.SkipInvalidTables = true
+	cfg.RequireUniqueKey = true
+	e := &Extractor{
+		logger:       hclog.NewNullLogger(),
+		mysqlContext: cfg,
+		inspector:    &Inspector{logger: hclog.NewNullLogger(), db: db, mysqlContext: cfg},
+	}
+
+	expectTable := func(table string, hasPK bool) {
+		mock.ExpectQuery("show table status").
+			WillReturnRows(sqlmock.NewRows([]string{"Name", "Comment"}).AddRow(table, ""))
+		mock.ExpectQuery("show columns").
+			WillReturnRows(sqlmock.NewRows([]string{"Field", "Type", "Key", "Null", "Default"}).
+				AddRow("id", "int(11)", "PRI", "NO", nil).
+				AddRow("c", "varchar(10)", "", "YES", nil))
+		mock.ExpectQuery("COLUMN_NAME = 'IS_VISIBLE'").
+			WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+		uks := sqlmock.NewRows([]string{"INDEX_NAME", "COLUMN_NAMES", "is_auto_increment", "has_nullable", "is_invisible"})
+		if hasPK {
+			uks.AddRow("PRIMARY", "id", 0, 0, 0)
+		}
+		mock.ExpectQuery("SELECT UNIQUES.INDEX_NAME").WillReturnRows(uks)
+		if hasPK {
+			mock.ExpectQuery("information_schema.columns").
+				WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE"}).
+					AddRow("id", "int(11)").
+					AddRow("c", "varchar(10)"))
+		}
+	}
+
+	expectTable("t1", true)
+	expectTable("t2", false)
+	expectTable("t3", true)
+
+	var migrated []string
+	for _, name := range []string{"t1", "t2", "t3"} {
+		table := common.NewTable("a", name)
+		ok, err := e.validateOriginalTable("a", name, table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			migrated = append(migrated, name)
+		}
+	}
+
+	if strings.Join(migrated, ",") != "t1,t3" {
+		t.Errorf("migrated tables %v, expect t1,t3", migrated)
+	}
+	if len(e.skippedTables) != 1 || !strings.HasPrefix(e.skippedTables[0], "a.t2:") {
+		t.Errorf("skipped tables %v, expect a.t2", e.skippedTables)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// without SkipInvalidTables the job fails
+	cfg.SkipInvalidTables = false
+	expectTable("t2", false)
+	if _, err := e.validateOriginalTable("a", "t2", common.NewTable("a", "t2")); err == nil {
+		t.Errorf("expect error without SkipInvalidTables")
+	}
+}
+
+func TestEncodeAndSendDumpEntryChecksumMismatch(t *testing.T) {
+	s, err := gnatsd.NewServer(&gnatsd.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	defer s.Shutdown()
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+	connect := func() *gonats.Conn {
+		nc, err := gonats.Connect(s.ClientURL())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(nc.Close)
+		return nc
+	}
+	srcConn, proxyConn, destConn := connect(), connect(), connect()
+
+	cfg := &common.MySQLDriverConfig{}
+	cfg.VerifyChunkChecksum = true
+	a, _ := newTestApplier(t, cfg)
+	a.subject = "dest1"
+	a.natsConn = destConn
+	a.shutdownCh = make(chan struct{})
+	defer close(a.shutdownCh)
+	a.rowCopyComplete = make(chan struct{})
+	a.fullBytesQueue = make(chan []byte, 4)
+	a.memory1, a.memory2 = new(int64), new(int64)
+	if err := a.subscribeNats(); err != nil {
+		t.Fatal(err)
+	}
+	// subscriptions are done on the server before other connections publish
+	if err := destConn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// between the tasks, the first delivery of the chunk is tampered
+	var nTry int32
+	_, err = proxyConn.Subscribe("src1_full", func(m *gonats.Msg) {
+		bs := m.Data
+		if atomic.AddInt32(&nTry, 1) == 1 {
+			entry := &common.DumpEntry{}
+			if err := common.Decode(bs, entry); err != nil {
+				t.Error(err)
+			}
+			*entry.ValuesX[0][1] = []byte("tampered")
+			if bs, err = common.Encode(entry); err != nil {
+				t.Error(err)
+			}
+		}
+		reply, err := proxyConn.Request("dest1_full", bs, 10*time.Second)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_ = proxyConn.Publish(m.Reply, reply.Data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proxyConn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Extractor{
+		logger:       hclog.NewNullLogger(),
+		mysqlContext: cfg,
+		subject:      "src1",
+		natsConn:     srcConn,
+	}
+	value := func(s string) *[]byte {
+		bs := []byte(s)
+		return &bs
+	}
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ValuesX:     [][]*[]byte{{value("1"), value("a")}, {value("2"), nil}},
+	}
+	entry.Checksum = entry.ComputeChecksum()
+	if err := e.encodeAndSendDumpEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&nTry); n != 2 {
+		t.Errorf("expect the chunk to be sent again, got %v tries", n)
+	}
+	if n := len(a.fullBytesQueue); n != 1 {
+		t.Fatalf("expect only the verified chunk queued, got %v", n)
+	}
+	got := &common.DumpEntry{}
+	if err := common.Decode(<-a.fullBytesQueue, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(*got.ValuesX[0][1]) != "a" || got.ValuesX[1][1] != nil {
+		t.Errorf("unexpected values %v", got.ValuesX)
+	}
+}
+
+func TestTimestampContextDelay(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	tsc := NewTimestampContext(stopCh, hclog.NewNullLogger(), func() bool { return false })
+	go tsc.Handle()
+	if d := tsc.GetDelay(); d != 0 {
+		t.Errorf("expect no delay before any event. got %v", d)
+	}
+
+	ts := time.Now().Add(-30 * time.Second)
+	tsc.TimestampCh <- uint32(ts.Unix())
+	for i := 0; tsc.GetDelay() == 0; i++ {
+		if i == 100 {
+			t.Fatal("timestamp not handled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if d := tsc.getDelayAt(ts.Add(30 * time.Second)); d != 30 {
+		t.Errorf("expect a delay of 30s. got %v", d)
+	}
+	// grows while no more event is applied
+	if d := tsc.getDelayAt(ts.Add(40 * time.Second)); d != 40 {
+		t.Errorf("expect a delay of 40s. got %v", d)
+	}
+
+	a, _ := newTestApplier(t, &common.MySQLDriverConfig{})
+	a.memory1, a.memory2 = new(int64), new(int64)
+	a.ai = &ApplierIncr{timestampCtx: tsc}
+	stats, err := a.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.DelayCount.Time < 30 || stats.DelayCount.Time > 60 {
+		t.Errorf("unexpected delay in stats %v", stats.DelayCount.Time)
+	}
+}
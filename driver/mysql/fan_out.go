@@ -0,0 +1,190 @@
+package mysql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/actiontech/dtle/driver/common"
+)
+
+// fanOutEntry replaces DML events of FanOutTables with events of the target tables, each with
+// the rows routed to it. The events stay in the transaction of the entry.
+func (a *ApplierIncr) fanOutEntry(entry *common.DataEntry) error {
+	if len(a.mysqlContext.FanOutTables) == 0 {
+		return nil
+	}
+	var events []common.DataEvent
+	for i := range entry.Events {
+		event := &entry.Events[i]
+		policy := a.mysqlContext.FanOutTables[fmt.Sprintf("%v.%v", event.DatabaseName, event.TableName)]
+		if event.DML == common.NotDML || policy == nil {
+			events = append(events, *event)
+			continue
+		}
+		columnIndex, err := a.fanOutColumnIndex(policy)
+		if err != nil {
+			return fmt.Errorf("FanOutTables %v.%v: %v", event.DatabaseName, event.TableName, err)
+		}
+		fanned, err := fanOutEvent(event, policy, columnIndex)
+		if err != nil {
+			return fmt.Errorf("FanOutTables %v.%v: %v", event.DatabaseName, event.TableName, err)
+		}
+		events = append(events, fanned...)
+	}
+	entry.Events = events
+	return nil
+}
+
+// fanOutColumnIndex returns the index of the routing column, in the columns of a target table.
+func (a *ApplierIncr) fanOutColumnIndex(policy *common.FanOutPolicy) (int, error) {
+	targets := fanOutTargets(policy)
+	if len(targets) == 0 {
+		return 0, fmt.Errorf("no target table")
+	}
+	schema, table, err := splitSchemaTable(targets[0])
+	if err != nil {
+		return 0, err
+	}
+	tableItem, err := a.loadTableItem(schema, table)
+	if err != nil {
+		return 0, err
+	}
+	columnNames := tableItem.ColumnMapTo
+	if len(columnNames) == 0 {
+		columnNames = tableItem.Columns.Names()
+	}
+	for i, name := range columnNames {
+		if strings.EqualFold(name, policy.Column) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("routing column %v not found in %v", policy.Column, targets[0])
+}
+
+// fanOutTargets returns all target tables of the policy, sorted.
+func fanOutTargets(policy *common.FanOutPolicy) []string {
+	set := make(map[string]struct{})
+	for _, targets := range policy.Routes {
+		for _, target := range targets {
+			set[target] = struct{}{}
+		}
+	}
+	for _, target := range policy.Default {
+		set[target] = struct{}{}
+	}
+	r := make([]string, 0, len(set))
+	for target := range set {
+		r = append(r, target)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func splitSchemaTable(s string) (schema string, table string, err error) {
+	ss := strings.SplitN(s, ".", 2)
+	if len(ss) != 2 || ss[0] == "" || ss[1] == "" {
+		return "", "", fmt.Errorf("bad target table %v. expect schema.table", s)
+	}
+	return ss[0], ss[1], nil
+}
+
+// fanOutRowTargets returns the target tables of a row. A NULL value matches no route.
+func fanOutRowTargets(policy *common.FanOutPolicy, row []interface{}, columnIndex int) ([]string, error) {
+	if columnIndex >= len(row) {
+		return nil, fmt.Errorf("routing column %v is not in the row", policy.Column)
+	}
+	var value string
+	switch v := row[columnIndex].(type) {
+	case nil:
+		return policy.Default, nil
+	case []byte:
+		value = string(v)
+	default:
+		value = fmt.Sprint(v)
+	}
+	if targets, ok := policy.Routes[value]; ok {
+		return targets, nil
+	}
+	return policy.Default, nil
+}
+
+// fanOutEvent splits a DML event into events of the target tables, in the order of the first row
+// routed to each. An update changing the target of a row is applied as a delete on the old target
+// and an insert on the new one.
+func fanOutEvent(event *common.DataEvent, policy *common.FanOutPolicy, columnIndex int) ([]common.DataEvent, error) {
+	var order []string
+	rowsOf := make(map[string][][]interface{})
+	add := func(target string, rows ...[]interface{}) {
+		if _, ok := rowsOf[target]; !ok {
+			order = append(order, target)
+		}
+		rowsOf[target] = append(rowsOf[target], rows...)
+	}
+
+	if event.DML == common.UpdateDML {
+		if len(event.Rows)%2 != 0 {
+			return nil, fmt.Errorf("bad update event. row number is not 2N %v", len(event.Rows))
+		}
+		for i := 0; i < len(event.Rows); i += 2 {
+			rowBefore, rowAfter := event.Rows[i], event.Rows[i+1]
+			var beforeTargets, afterTargets []string
+			var err error
+			if len(rowBefore) > 0 {
+				if beforeTargets, err = fanOutRowTargets(policy, rowBefore, columnIndex); err != nil {
+					return nil, err
+				}
+			}
+			if len(rowAfter) > 0 {
+				if afterTargets, err = fanOutRowTargets(policy, rowAfter, columnIndex); err != nil {
+					return nil, err
+				}
+			}
+			for _, target := range beforeTargets {
+				if containsString(afterTargets, target) {
+					add(target, rowBefore, rowAfter)
+				} else {
+					add(target, rowBefore, nil) // delete
+				}
+			}
+			for _, target := range afterTargets {
+				if !containsString(beforeTargets, target) {
+					add(target, nil, rowAfter) // insert
+				}
+			}
+		}
+	} else {
+		for _, row := range event.Rows {
+			targets, err := fanOutRowTargets(policy, row, columnIndex)
+			if err != nil {
+				return nil, err
+			}
+			for _, target := range targets {
+				add(target, row)
+			}
+		}
+	}
+
+	r := make([]common.DataEvent, 0, len(order))
+	for _, target := range order {
+		schema, table, err := splitSchemaTable(target)
+		if err != nil {
+			return nil, err
+		}
+		fanned := *event
+		fanned.DatabaseName = schema
+		fanned.TableName = table
+		fanned.Rows = rowsOf[target]
+		r = append(r, fanned)
+	}
+	return r, nil
+}
+
+func containsString(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
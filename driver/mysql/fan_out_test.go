@@ -0,0 +1,82 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/driver/common"
+	umconf "github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+)
+
+func TestFanOutEntry(t *testing.T) {
+	a, _ := newTestApplierIncr(t)
+	a.tableItems = make(mapSchemaTableItems)
+	a.mysqlContext.FanOutTables = map[string]*common.FanOutPolicy{
+		"a.orders": {
+			Column: "tenant_id",
+			Routes: map[string][]string{
+				"1": {"t1.orders"},
+				"2": {"t2.orders"},
+			},
+		},
+	}
+	// columns are got from the first target table
+	columns := common.NewColumnList([]umconf.Column{{RawName: "id"}, {RawName: "tenant_id"}, {RawName: "amount"}})
+	a.getTableItem("t0", "orders").Columns = columns
+	a.getTableItem("t1", "orders").Columns = columns
+
+	row := func(id int64, tenant interface{}) []interface{} {
+		return []interface{}{id, tenant, "9.99"}
+	}
+	entry := &common.DataEntry{
+		Events: []common.DataEvent{
+			{DML: common.NotDML, Query: "create table a.x (id int)"},
+			{DML: common.InsertDML, DatabaseName: "a", TableName: "orders",
+				Rows: [][]interface{}{row(1, int64(1)), row(2, []byte("2")), row(3, int64(1)), row(4, int64(3)), row(5, nil)}},
+			// the tenant of row 1 is changed. row 3 is updated in place.
+			{DML: common.UpdateDML, DatabaseName: "a", TableName: "orders",
+				Rows: [][]interface{}{row(1, int64(1)), row(1, int64(2)), row(3, int64(1)), row(3, int64(1))}},
+			{DML: common.DeleteDML, DatabaseName: "a", TableName: "orders", Rows: [][]interface{}{row(2, int64(2))}},
+			{DML: common.InsertDML, DatabaseName: "a", TableName: "others", Rows: [][]interface{}{row(6, int64(1))}},
+		},
+	}
+	if err := a.fanOutEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []common.DataEvent{
+		{DML: common.NotDML, Query: "create table a.x (id int)"},
+		// row 4 and 5 match no route
+		{DML: common.InsertDML, DatabaseName: "t1", TableName: "orders",
+			Rows: [][]interface{}{row(1, int64(1)), row(3, int64(1))}},
+		{DML: common.InsertDML, DatabaseName: "t2", TableName: "orders",
+			Rows: [][]interface{}{row(2, []byte("2"))}},
+		{DML: common.UpdateDML, DatabaseName: "t1", TableName: "orders",
+			Rows: [][]interface{}{row(1, int64(1)), nil, row(3, int64(1)), row(3, int64(1))}},
+		{DML: common.UpdateDML, DatabaseName: "t2", TableName: "orders",
+			Rows: [][]interface{}{nil, row(1, int64(2))}},
+		{DML: common.DeleteDML, DatabaseName: "t2", TableName: "orders", Rows: [][]interface{}{row(2, int64(2))}},
+		{DML: common.InsertDML, DatabaseName: "a", TableName: "others", Rows: [][]interface{}{row(6, int64(1))}},
+	}
+	if !reflect.DeepEqual(entry.Events, want) {
+		t.Errorf("got %v\nwant %v", entry.Events, want)
+	}
+
+	// rows matching no route go to Default
+	a.mysqlContext.FanOutTables["a.orders"].Default = []string{"t0.orders"}
+	entry.Events = []common.DataEvent{{DML: common.InsertDML, DatabaseName: "a", TableName: "orders",
+		Rows: [][]interface{}{row(4, int64(3)), row(5, nil)}}}
+	if err := a.fanOutEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+	if len(entry.Events) != 1 || entry.Events[0].DatabaseName != "t0" || len(entry.Events[0].Rows) != 2 {
+		t.Errorf("expect rows routed to the default target. got %v", entry.Events)
+	}
+
+	a.mysqlContext.FanOutTables["a.orders"].Column = "nosuchcolumn"
+	entry.Events = []common.DataEvent{{DML: common.InsertDML, DatabaseName: "a", TableName: "orders",
+		Rows: [][]interface{}{row(4, int64(3))}}}
+	if err := a.fanOutEntry(entry); err == nil {
+		t.Errorf("expect an error on a missing routing column")
+	}
+}
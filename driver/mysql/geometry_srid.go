@@ -0,0 +1,68 @@
+package mysql
+
+import (
+	"fmt"
+
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/actiontech/dtle/driver/mysql/base"
+	umconf "github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+)
+
+// sridColumns returns the target columns with an SRID constraint, by their positions in a row
+// whose columns are `columnNames`. nil if there is none.
+func sridColumns(columns *common.ColumnList, columnNames []string) (r map[int]*umconf.Column) {
+	if columns == nil {
+		return nil
+	}
+	for i, name := range columnNames {
+		col := columns.GetColumn(name)
+		if col == nil || col.SRID == nil {
+			continue
+		}
+		if r == nil {
+			r = make(map[int]*umconf.Column)
+		}
+		r[i] = col
+	}
+	return r
+}
+
+// checkRowValuesSRID checks geometry values of full copy rows against SRID constraints of the target.
+// Values are written as they are, so the SRID of the source is kept.
+func checkRowValuesSRID(schema, table string, rows [][]*[]byte, columns map[int]*umconf.Column) error {
+	for _, row := range rows {
+		for i, col := range columns {
+			if i >= len(row) || row[i] == nil {
+				continue
+			}
+			if err := base.CheckGeometrySRID(col, *row[i]); err != nil {
+				return fmt.Errorf("%v.%v: %v", schema, table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkRowArgsSRID is checkRowValuesSRID for rows of incremental DML events.
+func checkRowArgsSRID(schema, table string, rows [][]interface{}, columns map[int]*umconf.Column) error {
+	for _, row := range rows {
+		for i, col := range columns {
+			if i >= len(row) {
+				continue
+			}
+			var value []byte
+			switch v := row[i].(type) {
+			case []byte:
+				value = v
+			case string:
+				value = []byte(v)
+			default: // NULL
+				continue
+			}
+			if err := base.CheckGeometrySRID(col, value); err != nil {
+				return fmt.Errorf("%v.%v: %v", schema, table, err)
+			}
+		}
+	}
+	return nil
+}
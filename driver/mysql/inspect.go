@@ -10,6 +10,7 @@ import (
 	gosql "database/sql"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/actiontech/dtle/g"
@@ -31,6 +32,10 @@ type Inspector struct {
 	logger       g.LoggerType
 	db           *gosql.DB
 	mysqlContext *common.MySQLDriverConfig
+
+	// warnings of ValidateOriginalTable. "schema.table: warning"
+	warnings     []string
+	warningsLock sync.Mutex
 }
 
 func NewInspector(ctx *common.MySQLDriverConfig, logger g.LoggerType) *Inspector {
@@ -47,8 +52,7 @@ func (i *Inspector) Close() {
 }
 
 func (i *Inspector) InitDB() (err error) {
-	inspectorUri := i.mysqlContext.SrcConnectionConfig.GetDBUri()
-	if i.db, err = usql.CreateDB(inspectorUri); err != nil {
+	if i.db, err = usql.CreateDBWithConfig(i.mysqlContext.SrcConnectionConfig, ""); err != nil {
 		return err
 	}
 	return nil
@@ -90,7 +94,7 @@ func (i *Inspector) ValidateOriginalTable(databaseName, tableName string, table
 	// this should be set event if there is an error (#177)
 	i.logger.Info("ValidateOriginalTable", "where", table.GetWhere())
 
-	if err := i.validateTable(databaseName, tableName); err != nil {
+	if table.TableEngine, table.AutoIncrement, err = i.validateTable(databaseName, tableName); err != nil {
 		return err
 	}
 
@@ -109,22 +113,53 @@ func (i *Inspector) ValidateOriginalTable(databaseName, tableName string, table
 	i.logger.Debug("table has unique keys", "schema", table.TableSchema, "table", table.TableName,
 		"n_unique_keys", len(uniqueKeys))
 
+	i.chooseUniqueKey(table, uniqueKeys, func(uk *common.UniqueKey) {
+		ubase.ApplyColumnTypes(i.db, table.TableSchema, table.TableName, &uk.Columns)
+	})
+	if table.UseUniqueKey == nil && i.mysqlContext.RequireUniqueKey {
+		return fmt.Errorf("no valid unique key found on %v.%v", databaseName, tableName)
+	}
+	// endregion
+
+	/*if err := i.validateTableTriggers(databaseName, tableName); err != nil {
+		return err
+	}*/
+
+	// region validate 'where'
+	whereCtx, err := common.NewWhereCtx(table.GetWhere(), table)
+	if err != nil {
+		i.logger.Error("Error parsing where", "where", table.GetWhere(), "err", err)
+		return err
+	}
+	i.warnWhereOnMappedOutColumns(table, whereCtx)
+	// TODO the err cause only a WARN
+	// TODO name escaping
+	// endregion
+
+	return nil
+}
+
+// chooseUniqueKey sets table.UseUniqueKey to the primary key or the first valid unique key.
+// applyColumnTypes is called on a key before it is checked.
+func (i *Inspector) chooseUniqueKey(table *common.Table, uniqueKeys []*common.UniqueKey,
+	applyColumnTypes func(uk *common.UniqueKey)) {
+
 	for _, uk := range uniqueKeys {
 		i.logger.Debug("a unique key", "uk", uk.String())
 
-		ubase.ApplyColumnTypes(i.db, table.TableSchema, table.TableName, &uk.Columns)
+		applyColumnTypes(uk)
 
 		uniqueKeyIsValid := true
 
 		for _, column := range uk.Columns.Columns {
 			switch column.Type {
 			case umconf.FloatColumnType:
-				i.logger.Warn("Will not use the unique key due to FLOAT data type", "name", uk.Name)
+				i.addWarning(table, "Will not use the unique key due to FLOAT data type", "name", uk.Name)
 				uniqueKeyIsValid = false
 			case umconf.JSONColumnType:
 				// Noteworthy that at this time MySQL does not allow JSON indexing anyhow, but this code
 				// will remain in place to potentially handle the future case where JSON is supported in indexes.
-				i.logger.Warn("Will not use the unique key due to JSON data type", "name", uk.Name)
+				i.addWarning(table, "Will not use the unique key due to JSON data type", "name", uk.Name)
 				uniqueKeyIsValid = false
 			default:
 				// do nothing
@@ -132,12 +167,12 @@ func (i *Inspector) ValidateOriginalTable(databaseName, tableName string, table
 		}
 
 		if uk.HasNullable {
-			i.logger.Warn("Will not use the unique key due to having nullable", "name", uk.Name)
+			i.addWarning(table, "Will not use the unique key due to having nullable", "name", uk.Name)
 			uniqueKeyIsValid = false
 		}
 
 		if !uk.IsPrimary() && "FULL" != i.mysqlContext.BinlogRowImage {
-			i.logger.Warn("Will not use the unique key due to not primary when binlog row image is FULL",
+			i.addWarning(table, "Will not use the unique key due to not primary when binlog row image is FULL",
 				"name", uk.Name)
 			uniqueKeyIsValid = false
 		}
@@ -153,29 +188,77 @@ func (i *Inspector) ValidateOriginalTable(databaseName, tableName string, table
 		}
 	}
 	if table.UseUniqueKey == nil {
-		i.logger.Warn("No valid unique key found. It will be slow on large table.",
-			"schema", table.TableSchema, "table", table.TableName, "nKey", len(uniqueKeys))
+		if !i.mysqlContext.RequireUniqueKey {
+			i.addWarning(table, "No valid unique key found. It will be slow on large table.",
+				"nKey", len(uniqueKeys))
+		}
 	} else {
 		i.logger.Info("chosen unique key",
-			"schema", table.TableSchema, "table", table.TableName, "uk", table.UseUniqueKey.String())
+			"schema", table.TableSchema, "table", table.TableName, "uk", table.UseUniqueKey.String(),
+			"invisible", table.UseUniqueKey.IsInvisible)
 	}
-	// endregion
+}
 
-	/*if err := i.validateTableTriggers(databaseName, tableName); err != nil {
-		return err
-	}*/
+// addWarning logs a warning of validating the table and keeps it for Warnings.
+func (i *Inspector) addWarning(table *common.Table, msg string, keyvals ...interface{}) {
+	i.logger.Warn(msg, append([]interface{}{"schema", table.TableSchema, "table", table.TableName}, keyvals...)...)
 
-	// region validate 'where'
-	_, err = common.NewWhereCtx(table.GetWhere(), table)
-	if err != nil {
-		i.logger.Error("Error parsing where", "where", table.GetWhere(), "err", err)
-		return err
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%v.%v: %v", table.TableSchema, table.TableName, msg)
+	for j := 0; j+1 < len(keyvals); j += 2 {
+		fmt.Fprintf(&sb, " %v=%v", keyvals[j], keyvals[j+1])
 	}
-	// TODO the err cause only a WARN
-	// TODO name escaping
-	// endregion
+	warning := sb.String()
 
-	return nil
+	i.warningsLock.Lock()
+	defer i.warningsLock.Unlock()
+	for _, w := range i.warnings {
+		if w == warning { // the table is validated again
+			return
+		}
+	}
+	i.warnings = append(i.warnings, warning)
+}
+
+// Warnings returns the warnings of ValidateOriginalTable so far.
+func (i *Inspector) Warnings() []string {
+	i.warningsLock.Lock()
+	defer i.warningsLock.Unlock()
+	return append([]string(nil), i.warnings...)
+}
+
+// warnWhereOnMappedOutColumns warns if 'where' references columns not in ColumnMapFrom. The filter is
+// evaluated on the source, but the target does not have the columns, so the result cannot be checked
+// or filtered again on the target (e.g. with ApplyRowFilters).
+func (i *Inspector) warnWhereOnMappedOutColumns(table *common.Table, whereCtx *common.WhereContext) {
+	if columns := whereColumnsMappedOut(table, whereCtx); len(columns) > 0 {
+		i.addWarning(table, "'where' references columns excluded by ColumnMapFrom",
+			"where", table.GetWhere(), "columns", columns)
+	}
+}
+
+// whereColumnsMappedOut returns columns referenced by 'where' but not in ColumnMap, in the order of the table.
+func whereColumnsMappedOut(table *common.Table, whereCtx *common.WhereContext) []string {
+	if len(table.ColumnMap) == 0 || whereCtx == nil {
+		return nil
+	}
+	mapped := make(map[int]struct{}, len(table.ColumnMap))
+	for _, idx := range table.ColumnMap {
+		mapped[idx] = struct{}{}
+	}
+	var r []string
+	for i, column := range table.OriginalTableColumns.ColumnList() {
+		if _, ok := mapped[i]; ok {
+			continue
+		}
+		for _, idx := range whereCtx.FieldsMap {
+			if idx == i {
+				r = append(r, column.RawName)
+				break
+			}
+		}
+	}
+	return r
 }
 
 func (i *Inspector) InspectTableColumnsAndUniqueKeys(databaseName, tableName string) (
@@ -202,39 +285,12 @@ func (i *Inspector) ValidateGrants() error {
 		return nil
 	}
 
-	query := `show grants for current_user()`
-	foundAll := false
-	foundSuper := false
-	foundReplicationClient := false
-	foundReplicationSlave := false
-	foundDBAll := false
-
-	err := usql.QueryRowsMap(i.db, query, func(rowMap usql.RowMap) error {
-		for _, grantData := range rowMap {
-			grant := grantData.String
-			if strings.Contains(grant, `GRANT ALL PRIVILEGES ON`) {
-				foundAll = true
-			}
-			if strings.Contains(grant, `SUPER`) {
-				foundSuper = true
-			}
-			if strings.Contains(grant, `REPLICATION CLIENT`) {
-				foundReplicationClient = true
-			}
-			if strings.Contains(grant, `REPLICATION SLAVE`) {
-				foundReplicationSlave = true
-			}
-			if ubase.StringContainsAll(grant, `SELECT`) {
-				foundDBAll = true
-			}
-		}
-		return nil
-	})
+	r, err := ubase.CheckExtractorGrants(i.db, i.logger)
 	if err != nil {
 		return err
 	}
 
-	if foundAll {
+	if r.Has(ubase.PrivilegeAll) {
 		i.logger.Info("User has ALL privileges")
 		return nil
 	}
@@ -247,18 +303,12 @@ func (i *Inspector) ValidateGrants() error {
 		}
 	}
 
-	if foundSuper && foundReplicationSlave && foundDBAll {
-		i.logger.Info("User has SUPER, REPLICATION SLAVE privileges, and has SELECT privileges")
-		return nil
-	}
-	if foundReplicationClient && foundReplicationSlave && foundDBAll {
-		i.logger.Info("User has REPLICATION CLIENT, REPLICATION SLAVE privileges, and has SELECT privileges")
+	if r.Sufficient() {
+		i.logger.Info("User has sufficient privileges", "privileges", r.Present)
 		return nil
 	}
-	i.logger.Debug("Privileges", "Super", foundSuper, "ReplicationClient", foundReplicationClient,
-		"ReplicationSlave", foundReplicationSlave, "All", foundAll, "DBAll", foundDBAll)
-	return fmt.Errorf("user has insufficient privileges for extractor." +
-		" Needed: SELECT , REPLICATION CLIENT, REPLICATION SLAVE and ALL on *.*")
+	return fmt.Errorf("user has insufficient privileges for extractor. missing: %v."+
+		" Needed: SELECT , REPLICATION CLIENT, REPLICATION SLAVE and ALL on *.*", strings.Join(r.Missing, ", "))
 }
 
 func (i *Inspector) ValidateGTIDMode() error {
@@ -309,6 +359,10 @@ func (i *Inspector) ValidateConnection() error {
 	}
 }
 
+func (i *Inspector) GetTimeSettings() (*ubase.TimeSettings, error) {
+	return ubase.GetTimeSettings(i.db)
+}
+
 func (i *Inspector) ValidateServerId() error {
 	query := `SELECT @@SERVER_ID`
 	var serverID string
@@ -322,13 +376,16 @@ func (i *Inspector) ValidateServerId() error {
 	return nil
 }
 
-func (i *Inspector) validateTable(databaseName, tableName string) error {
+// validateTable returns the storage engine of the table.
+func (i *Inspector) validateTable(databaseName, tableName string) (string, uint64, error) {
 	query := fmt.Sprintf(`show table status from %s like '%s'`, umconf.EscapeName(databaseName), tableName)
 
 	tableFound := false
-	//tableEngine := ""
+	tableEngine := ""
+	var autoIncrement uint64
 	err := usql.QueryRowsMap(i.db, query, func(rowMap usql.RowMap) error {
-		//tableEngine = rowMap.GetString("Engine")
+		tableEngine = rowMap.GetString("Engine")
+		autoIncrement = rowMap.GetUint64("Auto_increment") // NULL for none
 		if rowMap.GetString("Comment") == "VIEW" {
 			return fmt.Errorf("%s.%s is a VIEW, not a real table. Bailing out", umconf.EscapeName(databaseName), umconf.EscapeName(tableName))
 		}
@@ -337,13 +394,13 @@ func (i *Inspector) validateTable(databaseName, tableName string) error {
 		return nil
 	})
 	if err != nil {
-		return err
+		return "", 0, err
 	}
 	if !tableFound {
-		return fmt.Errorf("Cannot find table %s.%s!", umconf.EscapeName(databaseName), umconf.EscapeName(tableName))
+		return "", 0, fmt.Errorf("Cannot find table %s.%s!", umconf.EscapeName(databaseName), umconf.EscapeName(tableName))
 	}
 
-	return nil
+	return tableEngine, autoIncrement, nil
 }
 
 // validateTableTriggers makes sure no triggers exist on the migrated table
@@ -372,3 +429,9 @@ func (i *Inspector) validateTableTriggers(databaseName, tableName string) error
 	}
 	return nil
 }
+
+// SuggestParallelWorkers suggests ParallelWorkers and MaxOpenConns for applying to this server.
+// cpuCount <= 0 means unknown.
+func (i *Inspector) SuggestParallelWorkers(cpuCount int) (r ubase.ParallelWorkersSuggestion, err error) {
+	return ubase.QueryParallelWorkersSuggestion(i.db, i.logger, cpuCount)
+}
@@ -0,0 +1,149 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/drivers/shared/eventer"
+	"github.com/hashicorp/nomad/plugins/drivers"
+)
+
+func TestWarnWhereOnMappedOutColumns(t *testing.T) {
+	newTable := func(where string, columnMapFrom []string) (*common.Table, *common.WhereContext) {
+		table := common.NewTable("db1", "t1")
+		table.Where = where
+		table.OriginalTableColumns = common.NewColumnList([]mysqlconfig.Column{
+			{RawName: "id"}, {RawName: "status"}, {RawName: "secret"}})
+		table.ColumnMapFrom = columnMapFrom
+		var err error
+		table.ColumnMap, err = mysqlconfig.BuildColumnMapIndex(columnMapFrom, table.OriginalTableColumns.Ordinals)
+		if err != nil {
+			t.Fatal(err)
+		}
+		whereCtx, err := common.NewWhereCtx(where, table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return table, whereCtx
+	}
+
+	for _, c := range []struct {
+		where         string
+		columnMapFrom []string
+		expected      []string
+	}{
+		{"status = 1", []string{"id", "secret"}, []string{"status"}},
+		{"secret > 0 and status = 1 and id > 10", []string{"id"}, []string{"status", "secret"}},
+		{"status = 1", []string{"id", "status"}, nil},
+		{"status = 1", nil, nil},
+		{"true", []string{"id"}, nil},
+	} {
+		table, whereCtx := newTable(c.where, c.columnMapFrom)
+		if got := whereColumnsMappedOut(table, whereCtx); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("where %v, ColumnMapFrom %v: got %v, want %v", c.where, c.columnMapFrom, got, c.expected)
+		}
+	}
+
+	var buf bytes.Buffer
+	i := NewInspector(&common.MySQLDriverConfig{}, hclog.New(&hclog.LoggerOptions{Output: &buf}))
+	i.warnWhereOnMappedOutColumns(newTable("status = 1", []string{"id"}))
+	if log := buf.String(); !strings.Contains(log, "[WARN]") || !strings.Contains(log, "excluded by ColumnMapFrom") ||
+		!strings.Contains(log, "status") {
+		t.Errorf("expect a warning. got %q", log)
+	}
+	buf.Reset()
+	i.warnWhereOnMappedOutColumns(newTable("status = 1", []string{"id", "status"}))
+	if buf.Len() != 0 {
+		t.Errorf("expect no warning. got %q", buf.String())
+	}
+}
+
+func TestValidationWarnings(t *testing.T) {
+	i := NewInspector(&common.MySQLDriverConfig{BinlogRowImage: "FULL"}, hclog.NewNullLogger())
+	table := common.NewTable("db1", "t1")
+	table.Where = "status = 1"
+	table.OriginalTableColumns = common.NewColumnList([]mysqlconfig.Column{
+		{RawName: "id"}, {RawName: "status"}, {RawName: "f"}, {RawName: "j"}})
+	table.ColumnMapFrom = []string{"id", "f", "j"}
+	var err error
+	table.ColumnMap, err = mysqlconfig.BuildColumnMapIndex(table.ColumnMapFrom, table.OriginalTableColumns.Ordinals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uniqueKeys := []*common.UniqueKey{
+		{Name: "PRIMARY", Columns: *common.NewColumnList([]mysqlconfig.Column{{RawName: "f"}})},
+		{Name: "uk_j", Columns: *common.NewColumnList([]mysqlconfig.Column{{RawName: "j"}})},
+		{Name: "uk_status", Columns: *common.NewColumnList([]mysqlconfig.Column{{RawName: "status"}}), HasNullable: true},
+	}
+	applyColumnTypes := func(uk *common.UniqueKey) {
+		for j := range uk.Columns.Columns {
+			switch uk.Columns.Columns[j].RawName {
+			case "f":
+				uk.Columns.Columns[j].Type = mysqlconfig.FloatColumnType
+			case "j":
+				uk.Columns.Columns[j].Type = mysqlconfig.JSONColumnType
+			}
+		}
+	}
+	validate := func() {
+		i.chooseUniqueKey(table, uniqueKeys, applyColumnTypes)
+		whereCtx, err := common.NewWhereCtx(table.Where, table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		i.warnWhereOnMappedOutColumns(table, whereCtx)
+	}
+	validate()
+	if table.UseUniqueKey != nil {
+		t.Errorf("expect no valid unique key. got %v", table.UseUniqueKey.Name)
+	}
+	expected := []string{
+		"db1.t1: Will not use the unique key due to FLOAT data type name=PRIMARY",
+		"db1.t1: Will not use the unique key due to JSON data type name=uk_j",
+		"db1.t1: Will not use the unique key due to having nullable name=uk_status",
+		"db1.t1: No valid unique key found. It will be slow on large table. nKey=3",
+		"db1.t1: 'where' references columns excluded by ColumnMapFrom where=status = 1 columns=[status]",
+	}
+	if got := i.Warnings(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got warnings\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+	// validating the table again does not repeat the warnings
+	validate()
+	if got := i.Warnings(); len(got) != len(expected) {
+		t.Errorf("got %v warnings after validating again, want %v", len(got), len(expected))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ev := eventer.NewEventer(ctx, hclog.NewNullLogger())
+	consumer, err := ev.TaskEvents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the eventer waits for the consumer to receive each event
+	events := make(chan *drivers.TaskEvent, len(expected))
+	go func() {
+		for event := range consumer {
+			events <- event
+		}
+	}()
+	e := &Extractor{inspector: i, event: ev, taskConfig: &drivers.TaskConfig{ID: "task1"}, logger: hclog.NewNullLogger()}
+	e.sendValidationWarnings(i.Warnings())
+	for _, w := range expected {
+		select {
+		case event := <-events:
+			if event.Message != "validation warning: "+w || event.TaskID != "task1" {
+				t.Errorf("got event %q of %v, want %q", event.Message, event.TaskID, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event of %q", w)
+		}
+	}
+}
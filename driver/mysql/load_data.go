@@ -0,0 +1,166 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	gosql "database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/actiontech/dtle/driver/common"
+	umconf "github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+	"github.com/actiontech/dtle/driver/mysql/sql"
+	"github.com/actiontech/dtle/g"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// loadDataNull is the NULL of LOAD DATA with `ESCAPED BY '\\'`.
+const loadDataNull = `\N`
+
+var loadDataReaderSeq int64
+
+// nextLoadDataReaderName returns a unique name to register the reader of a LOAD DATA statement with.
+func nextLoadDataReaderName() string {
+	return fmt.Sprintf("dtle_load_data_%d", atomic.AddInt64(&loadDataReaderSeq, 1))
+}
+
+func validateLoadDataInsert(cfg *common.MySQLDriverConfig) error {
+	if !cfg.LoadDataInsert {
+		return nil
+	}
+	if cfg.FullCopyConflictMode == common.FullCopyConflictModeUpsert {
+		return fmt.Errorf("LoadDataInsert does not support FullCopyConflictMode upsert")
+	}
+	if cfg.LoadDataNullSentinel == "" {
+		return fmt.Errorf("LoadDataNullSentinel must not be empty")
+	}
+	return nil
+}
+
+// writeLoadDataField writes the value escaped for `FIELDS TERMINATED BY '\t' ESCAPED BY '\\'
+// LINES TERMINATED BY '\n'`. A backslash is doubled, so a literal `\N` is not read as NULL.
+func writeLoadDataField(buf *bytes.Buffer, value []byte) {
+	for _, b := range value {
+		switch b {
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case 0:
+			buf.WriteString(`\0`)
+		default:
+			buf.WriteByte(b)
+		}
+	}
+}
+
+// buildLoadData builds a `LOAD DATA LOCAL INFILE` statement of FullCopyConflictMode reading the rows
+// from the reader registered as readerName, and the data of the rows.
+//
+// NULL is written as nullSentinel. `\N` is recognized by LOAD DATA itself. Another sentinel is turned
+// into NULL with NULLIF, which cannot tell it from a literal value, so a row having it as a value fails.
+// Values are loaded into user variables, as BIT values are written in hex and converted by SET.
+func buildLoadData(ctx context.Context, schema string, table string, columns []string, mode string,
+	rows [][]*[]byte, columnTypes []string, nullSentinel string, readerName string) (query string, data []byte, err error) {
+
+	var modifier string
+	switch mode {
+	case "", common.FullCopyConflictModeReplace:
+		modifier = "REPLACE"
+	case common.FullCopyConflictModeInsertIgnore:
+		modifier = "IGNORE"
+	default:
+		return "", nil, fmt.Errorf("LoadDataInsert does not support FullCopyConflictMode %v", mode)
+	}
+	if len(columns) == 0 {
+		return "", nil, fmt.Errorf("LoadDataInsert: unknown columns of %v.%v", schema, table)
+	}
+	isBit := func(j int) bool {
+		return j < len(columnTypes) && strings.HasPrefix(strings.ToLower(columnTypes[j]), "bit")
+	}
+
+	var buf bytes.Buffer
+	for i := range rows {
+		if err := checkCanceled(ctx, i); err != nil {
+			return "", nil, err
+		}
+		if len(rows[i]) != len(columns) {
+			return "", nil, fmt.Errorf("LoadDataInsert: %v.%v has %v columns. got %v values",
+				schema, table, len(columns), len(rows[i]))
+		}
+		for j, colData := range rows[i] {
+			if j > 0 {
+				buf.WriteByte('\t')
+			}
+			switch {
+			case colData == nil:
+				if nullSentinel == loadDataNull {
+					buf.WriteString(loadDataNull)
+				} else {
+					writeLoadDataField(&buf, []byte(nullSentinel))
+				}
+			case nullSentinel != loadDataNull && string(*colData) == nullSentinel:
+				return "", nil, fmt.Errorf("LoadDataInsert: a value of %v.%v.%v equals LoadDataNullSentinel",
+					schema, table, columns[j])
+			case isBit(j):
+				buf.WriteString(hex.EncodeToString(*colData))
+			default:
+				writeLoadDataField(&buf, *colData)
+			}
+		}
+		buf.WriteByte('\n')
+	}
+
+	var vars, sets bytes.Buffer
+	for j, column := range umconf.EscapeNameSlice(columns) {
+		if j > 0 {
+			vars.WriteByte(',')
+			sets.WriteString(", ")
+		}
+		v := fmt.Sprintf("@c%d", j)
+		vars.WriteString(v)
+		if nullSentinel != loadDataNull {
+			v = fmt.Sprintf("NULLIF(%s, '%s')", v, sql.EscapeValue(nullSentinel))
+		}
+		if isBit(j) {
+			v = fmt.Sprintf("CAST(CONV(%s, 16, 10) AS UNSIGNED)", v)
+		}
+		sets.WriteString(column)
+		sets.WriteString(" = ")
+		sets.WriteString(v)
+	}
+	query = fmt.Sprintf("LOAD DATA LOCAL INFILE 'Reader::%s' %s INTO TABLE %s.%s CHARACTER SET binary"+
+		" FIELDS TERMINATED BY '\\t' ESCAPED BY '\\\\' LINES TERMINATED BY '\\n' (%s) SET %s",
+		readerName, modifier, umconf.EscapeName(schema), umconf.EscapeName(table), vars.String(), sets.String())
+	return query, buf.Bytes(), nil
+}
+
+// loadDataRows writes the rows with a LOAD DATA statement in the tx.
+func (a *Applier) loadDataRows(ctx context.Context, tx *gosql.Tx, schema string, table string, columns []string, rows [][]*[]byte,
+	columnTypes []string) error {
+
+	name := nextLoadDataReaderName()
+	query, data, err := buildLoadData(ctx, schema, table, columns, a.mysqlContext.FullCopyConflictMode, rows,
+		columnTypes, a.mysqlContext.LoadDataNullSentinel, name)
+	if err != nil {
+		return err
+	}
+	mysql.RegisterReaderHandler(name, func() io.Reader {
+		return bytes.NewReader(data)
+	})
+	defer mysql.DeregisterReaderHandler(name)
+
+	a.logger.Debug("ApplyEventQueries. exec", "query", g.StrLim(query, 256), "bytes", len(data))
+	if _, err := tx.ExecContext(ctx, prefixSqlComment(a.mysqlContext.SqlCommentPrefix, query)); err != nil {
+		return errors.Wrapf(err, "LOAD DATA. rows %v", len(rows))
+	}
+	return nil
+}
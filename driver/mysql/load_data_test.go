@@ -0,0 +1,108 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/driver/common"
+)
+
+// readLoadData reads rows written for `FIELDS TERMINATED BY '\t' ESCAPED BY '\\' LINES TERMINATED BY '\n'`
+// as LOAD DATA does, then applies NULLIF(value, nullSentinel) of a custom sentinel. nil is NULL.
+func readLoadData(t *testing.T, data []byte, nullSentinel string) [][]*string {
+	var rows [][]*string
+	for _, line := range bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) {
+		var row []*string
+		for _, field := range bytes.Split(line, []byte("\t")) {
+			if string(field) == loadDataNull {
+				row = append(row, nil)
+				continue
+			}
+			var value []byte
+			for i := 0; i < len(field); i++ {
+				if field[i] != '\\' {
+					value = append(value, field[i])
+					continue
+				}
+				i++
+				if i == len(field) {
+					t.Fatalf("dangling escape in %q", field)
+				}
+				switch field[i] {
+				case 't':
+					value = append(value, '\t')
+				case 'n':
+					value = append(value, '\n')
+				case 'r':
+					value = append(value, '\r')
+				case '0':
+					value = append(value, 0)
+				default:
+					value = append(value, field[i])
+				}
+			}
+			s := string(value)
+			if nullSentinel != loadDataNull && s == nullSentinel {
+				row = append(row, nil)
+				continue
+			}
+			row = append(row, &s)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestBuildLoadDataNull(t *testing.T) {
+	bs := func(s string) *[]byte {
+		b := []byte(s)
+		return &b
+	}
+	str := func(s string) *string {
+		return &s
+	}
+	rows := [][]*[]byte{
+		{bs("1"), nil, bs(`\N`)},
+		{bs("2"), bs("a\tb\nc\\"), bs(`\\N`)},
+	}
+	expected := [][]*string{
+		{str("1"), nil, str(`\N`)},
+		{str("2"), str("a\tb\nc\\"), str(`\\N`)},
+	}
+	columns := []string{"id", "c1", "c2"}
+
+	for _, sentinel := range []string{loadDataNull, "<null>"} {
+		query, data, err := buildLoadData(context.Background(), "db1", "t1", columns, common.FullCopyConflictModeReplace,
+			rows, nil, sentinel, "r1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readLoadData(t, data, sentinel); !reflect.DeepEqual(got, expected) {
+			t.Errorf("sentinel %v: unexpected rows read from %q", sentinel, data)
+		}
+		expectedQuery := "LOAD DATA LOCAL INFILE 'Reader::r1' REPLACE INTO TABLE `db1`.`t1` CHARACTER SET binary" +
+			" FIELDS TERMINATED BY '\\t' ESCAPED BY '\\\\' LINES TERMINATED BY '\\n' (@c0,@c1,@c2)" +
+			" SET `id` = @c0, `c1` = @c1, `c2` = @c2"
+		if sentinel != loadDataNull {
+			expectedQuery = "LOAD DATA LOCAL INFILE 'Reader::r1' REPLACE INTO TABLE `db1`.`t1` CHARACTER SET binary" +
+				" FIELDS TERMINATED BY '\\t' ESCAPED BY '\\\\' LINES TERMINATED BY '\\n' (@c0,@c1,@c2)" +
+				" SET `id` = NULLIF(@c0, '<null>'), `c1` = NULLIF(@c1, '<null>'), `c2` = NULLIF(@c2, '<null>')"
+		}
+		if query != expectedQuery {
+			t.Errorf("sentinel %v: query\n%v\nwant\n%v", sentinel, query, expectedQuery)
+		}
+	}
+
+	// a value equal to a custom sentinel would be loaded as NULL
+	_, _, err := buildLoadData(context.Background(), "db1", "t1", columns, common.FullCopyConflictModeReplace,
+		[][]*[]byte{{bs("1"), bs("<null>"), nil}}, nil, "<null>", "r1")
+	if err == nil {
+		t.Error("expect an error on a value equal to the sentinel")
+	}
+	_, _, err = buildLoadData(context.Background(), "db1", "t1", columns, common.FullCopyConflictModeUpsert, rows, nil, loadDataNull, "r1")
+	if err == nil {
+		t.Error("expect an error on upsert")
+	}
+}
@@ -0,0 +1,84 @@
+package mysqlconfig
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthProvider supplies the password used when a connection is (re)established.
+type AuthProvider interface {
+	GetPassword() (string, error)
+}
+
+// StaticPasswordProvider always returns the same password.
+type StaticPasswordProvider struct {
+	Password string
+}
+
+func (p *StaticPasswordProvider) GetPassword() (string, error) {
+	return p.Password, nil
+}
+
+// TokenProvider fetches a short-lived token, e.g. AWS RDS IAM or Azure AD.
+type TokenProvider interface {
+	FetchToken() (token string, expiry time.Time, err error)
+}
+
+// TokenAuthProvider caches the token of a TokenProvider and fetches a new one
+// `refreshBefore` ahead of its expiry.
+type TokenAuthProvider struct {
+	provider      TokenProvider
+	refreshBefore time.Duration
+	now           func() time.Time
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func NewTokenAuthProvider(provider TokenProvider, refreshBefore time.Duration) *TokenAuthProvider {
+	return &TokenAuthProvider{
+		provider:      provider,
+		refreshBefore: refreshBefore,
+		now:           time.Now,
+	}
+}
+
+func (p *TokenAuthProvider) GetPassword() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token == "" || !p.now().Add(p.refreshBefore).Before(p.expiry) {
+		token, expiry, err := p.provider.FetchToken()
+		if err != nil {
+			return "", err
+		}
+		p.token, p.expiry = token, expiry
+	}
+	return p.token, nil
+}
+
+// CommandTokenProvider runs a shell command and takes its trimmed stdout as the token,
+// e.g. `aws rds generate-db-auth-token ...`. The token is taken as valid for TTL.
+type CommandTokenProvider struct {
+	Command string
+	TTL     time.Duration
+}
+
+func (p *CommandTokenProvider) FetchToken() (string, time.Time, error) {
+	out, err := exec.Command("sh", "-c", p.Command).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", time.Time{}, fmt.Errorf("AuthTokenCommand failed: %v. stderr: %s", err, exitErr.Stderr)
+		}
+		return "", time.Time{}, fmt.Errorf("AuthTokenCommand failed: %v", err)
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", time.Time{}, fmt.Errorf("AuthTokenCommand returned an empty token")
+	}
+	return token, time.Now().Add(p.TTL), nil
+}
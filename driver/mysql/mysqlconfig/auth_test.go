@@ -0,0 +1,103 @@
+package mysqlconfig
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeTokenProvider struct {
+	nFetch int
+	ttl    time.Duration
+	now    *time.Time
+}
+
+func (p *fakeTokenProvider) FetchToken() (string, time.Time, error) {
+	p.nFetch++
+	return fmt.Sprintf("token%d", p.nFetch), p.now.Add(p.ttl), nil
+}
+
+func TestTokenAuthProvider(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := &fakeTokenProvider{ttl: 15 * time.Minute, now: &now}
+	provider := NewTokenAuthProvider(fake, time.Minute)
+	provider.now = func() time.Time { return now }
+
+	c := &ConnectionConfig{Host: "127.0.0.1", Port: 3306, User: "u1", Password: "ignored", AuthProvider: provider}
+
+	uri, err := c.GetDBUriWithAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(uri, "u1:token1@tcp(127.0.0.1:3306)/") {
+		t.Fatalf("unexpected uri %v", uri)
+	}
+
+	// still valid. reuse the token.
+	now = now.Add(10 * time.Minute)
+	if _, err = c.GetDBUriWithAuth(); err != nil {
+		t.Fatal(err)
+	}
+	if fake.nFetch != 1 {
+		t.Fatalf("nFetch = %v, want 1", fake.nFetch)
+	}
+
+	// within refreshBefore of expiry. refresh it.
+	now = now.Add(4*time.Minute + 30*time.Second)
+	uri, err = c.GetDBUriWithAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.nFetch != 2 || !strings.HasPrefix(uri, "u1:token2@") {
+		t.Fatalf("expect refreshed token. nFetch %v uri %v", fake.nFetch, uri)
+	}
+}
+
+func TestStaticPasswordProvider(t *testing.T) {
+	c := &ConnectionConfig{Host: "127.0.0.1", Port: 3306, User: "u1", Password: "p1"}
+	uri, err := c.GetDBUriWithAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.AuthProvider = &StaticPasswordProvider{Password: "p1"}
+	uri2, err := c.GetDBUriWithAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri != uri2 || uri != c.GetDBUri() {
+		t.Fatalf("uri differs: %v %v", uri, uri2)
+	}
+}
+
+func TestInitAuthProviderWithCommand(t *testing.T) {
+	c := &ConnectionConfig{Host: "127.0.0.1", Port: 3306, User: "u1", Password: "ignored",
+		AuthTokenCommand: "echo ' token1 '"}
+	c.InitAuthProvider()
+	if c.AuthProvider == nil {
+		t.Fatal("AuthProvider is not set")
+	}
+
+	password, err := c.GetPassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password != "token1" {
+		t.Fatalf("unexpected password %q", password)
+	}
+
+	uri, err := c.GetDBUriWithAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(uri, "u1:token1@tcp(127.0.0.1:3306)/") ||
+		!strings.Contains(uri, "tls=skip-verify&allowCleartextPasswords=true") {
+		t.Fatalf("unexpected uri %v", uri)
+	}
+
+	c2 := &ConnectionConfig{AuthTokenCommand: "exit 1"}
+	c2.InitAuthProvider()
+	if _, err = c2.GetPassword(); err == nil {
+		t.Fatal("expect an error from a failing command")
+	}
+}
@@ -0,0 +1,338 @@
+package mysqlconfig
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ColumnTypeCompatibility classifies how a value of a source column fits into a target column.
+type ColumnTypeCompatibility int
+
+const (
+	ColumnTypeIdentical ColumnTypeCompatibility = iota
+	// every source value fits into the target column
+	ColumnTypeWidening
+	// some source values might be truncated or out of range on the target
+	ColumnTypeNarrowing
+	// the column types are of different kinds
+	ColumnTypeIncompatible
+)
+
+func (c ColumnTypeCompatibility) String() string {
+	switch c {
+	case ColumnTypeIdentical:
+		return "identical"
+	case ColumnTypeWidening:
+		return "widening"
+	case ColumnTypeNarrowing:
+		return "narrowing"
+	default:
+		return "incompatible"
+	}
+}
+
+type columnTypeFamily int
+
+const (
+	familyUnknown columnTypeFamily = iota
+	familyInteger
+	familyFloat
+	familyDecimal
+	familyBit
+	familyString
+	familyBinary
+	familyTemporal
+	familyJSON
+	familyEnum
+	familySet
+)
+
+// capacity of integer types in bytes, string/binary types in characters/bytes.
+var columnTypeCapacity = map[string]uint64{
+	"tinyint":    1,
+	"smallint":   2,
+	"mediumint":  3,
+	"int":        4,
+	"integer":    4,
+	"bigint":     8,
+	"float":      4,
+	"double":     8,
+	"real":       8,
+	"tinytext":   255,
+	"text":       65535,
+	"mediumtext": 16777215,
+	"longtext":   4294967295,
+	"tinyblob":   255,
+	"blob":       65535,
+	"mediumblob": 16777215,
+	"longblob":   4294967295,
+}
+
+// args end at the last ')', as values of enum/set might contain ')'. Only attributes like
+// unsigned follow them.
+var columnTypeDefRegexp = regexp.MustCompile(`(?i)^\s*([a-z]+(?: precision)?)\s*(?:\((.*)\))?(.*)$`)
+
+type columnTypeDef struct {
+	name     string
+	family   columnTypeFamily
+	args     []string
+	unsigned bool
+}
+
+func parseColumnTypeDef(column *Column) columnTypeDef {
+	r := columnTypeDef{unsigned: column.IsUnsigned}
+	if m := columnTypeDefRegexp.FindStringSubmatch(column.ColumnType); m != nil {
+		r.name = strings.ToLower(m[1])
+		if m[2] != "" {
+			if r.name == "enum" || r.name == "set" {
+				// members keep their case
+				r.args = parseQuotedList(m[2])
+			} else {
+				r.args = strings.Split(m[2], ",")
+				for i := range r.args {
+					r.args[i] = strings.TrimSpace(r.args[i])
+				}
+			}
+		}
+		if strings.Contains(strings.ToLower(m[3]), "unsigned") {
+			r.unsigned = true
+		}
+	}
+	switch r.name {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		r.family = familyInteger
+	case "float", "double", "real", "double precision":
+		r.family = familyFloat
+	case "decimal", "numeric", "dec", "fixed":
+		r.family = familyDecimal
+	case "bit":
+		r.family = familyBit
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext":
+		r.family = familyString
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		r.family = familyBinary
+	case "date", "datetime", "timestamp", "time", "year":
+		r.family = familyTemporal
+	case "json":
+		r.family = familyJSON
+	case "enum":
+		r.family = familyEnum
+	case "set":
+		r.family = familySet
+	default:
+		r.family = columnTypeFamilyFromType(column.Type)
+	}
+	return r
+}
+
+// parseQuotedList parses the quoted members of enum/set. A quote in a member is doubled,
+// or escaped by a backslash.
+func parseQuotedList(s string) (r []string) {
+	var member strings.Builder
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case !inQuote:
+			if c == '\'' {
+				inQuote = true
+				member.Reset()
+			}
+		case c == '\\' && i+1 < len(s):
+			i++
+			member.WriteByte(s[i])
+		case c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+			member.WriteByte(c)
+		case c == '\'':
+			inQuote = false
+			r = append(r, member.String())
+		default:
+			member.WriteByte(c)
+		}
+	}
+	return r
+}
+
+func columnTypeFamilyFromType(t ColumnType) columnTypeFamily {
+	switch t {
+	case TinyintColumnType, SmallintColumnType, MediumIntColumnType, IntColumnType, BigIntColumnType:
+		return familyInteger
+	case FloatColumnType, DoubleColumnType:
+		return familyFloat
+	case DecimalColumnType:
+		return familyDecimal
+	case BitColumnType:
+		return familyBit
+	case CharColumnType, VarcharColumnType, TextColumnType, TinytextColumnType:
+		return familyString
+	case BinaryColumnType, VarbinaryColumnType, BlobColumnType:
+		return familyBinary
+	case DateColumnType, DateTimeColumnType, TimestampColumnType, TimeColumnType, YearColumnType:
+		return familyTemporal
+	case JSONColumnType:
+		return familyJSON
+	case EnumColumnType:
+		return familyEnum
+	case SetColumnType:
+		return familySet
+	default:
+		return familyUnknown
+	}
+}
+
+func (d *columnTypeDef) arg(i int, def uint64) uint64 {
+	if i < len(d.args) {
+		if n, err := strconv.ParseUint(d.args[i], 10, 64); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// length returns the max number of characters (or bytes) of a string/binary column.
+func (d *columnTypeDef) length() uint64 {
+	if c, ok := columnTypeCapacity[d.name]; ok {
+		return c
+	}
+	return d.arg(0, 1)
+}
+
+func compareCapacity(src, dst uint64) ColumnTypeCompatibility {
+	switch {
+	case src == dst:
+		return ColumnTypeIdentical
+	case src < dst:
+		return ColumnTypeWidening
+	default:
+		return ColumnTypeNarrowing
+	}
+}
+
+// CompareColumnType classifies writing values of column `src` into column `dst`.
+// Both columns should have `ColumnType` (e.g. "varchar(50)") set.
+func CompareColumnType(src, dst *Column) ColumnTypeCompatibility {
+	s := parseColumnTypeDef(src)
+	d := parseColumnTypeDef(dst)
+
+	if s.family == familyUnknown || d.family == familyUnknown {
+		if strings.EqualFold(src.ColumnType, dst.ColumnType) && src.Type == dst.Type {
+			return ColumnTypeIdentical
+		}
+		return ColumnTypeIncompatible
+	}
+
+	if s.family != d.family {
+		switch {
+		case s.family == familyInteger && (d.family == familyDecimal || d.family == familyFloat):
+			return ColumnTypeWidening
+		case (s.family == familyFloat || s.family == familyDecimal) && d.family == familyInteger:
+			return ColumnTypeNarrowing
+		case s.family == familyFloat && d.family == familyDecimal,
+			s.family == familyDecimal && d.family == familyFloat:
+			return ColumnTypeNarrowing
+		case s.family == familyJSON && d.family == familyString:
+			return compareCapacity(columnTypeCapacity["longtext"], d.length())
+		case (s.family == familyEnum || s.family == familySet) && d.family == familyString:
+			return ColumnTypeWidening
+		default:
+			return ColumnTypeIncompatible
+		}
+	}
+
+	switch s.family {
+	case familyInteger:
+		r := compareCapacity(columnTypeCapacity[s.name], columnTypeCapacity[d.name])
+		if s.unsigned == d.unsigned {
+			return r
+		}
+		if s.unsigned && !d.unsigned && r == ColumnTypeWidening {
+			// e.g. int unsigned -> bigint
+			return ColumnTypeWidening
+		}
+		return ColumnTypeNarrowing
+	case familyFloat:
+		r := compareCapacity(columnTypeCapacity[s.name], columnTypeCapacity[d.name])
+		if r == ColumnTypeIdentical && s.unsigned != d.unsigned {
+			return ColumnTypeNarrowing
+		}
+		return r
+	case familyDecimal:
+		sp, ss := s.arg(0, 10), s.arg(1, 0)
+		dp, ds := d.arg(0, 10), d.arg(1, 0)
+		switch {
+		case sp == dp && ss == ds && s.unsigned == d.unsigned:
+			return ColumnTypeIdentical
+		case dp-ds >= sp-ss && ds >= ss && (!d.unsigned || s.unsigned):
+			return ColumnTypeWidening
+		default:
+			return ColumnTypeNarrowing
+		}
+	case familyBit:
+		return compareCapacity(s.arg(0, 1), d.arg(0, 1))
+	case familyString, familyBinary:
+		r := compareCapacity(s.length(), d.length())
+		if r == ColumnTypeIdentical && s.name != d.name {
+			// e.g. char(10) -> varchar(10)
+			return ColumnTypeWidening
+		}
+		return r
+	case familyTemporal:
+		if s.name == d.name {
+			return compareCapacity(s.arg(0, 0), d.arg(0, 0))
+		}
+		if (s.name == "time") != (d.name == "time") || (s.name == "year") != (d.name == "year") {
+			return ColumnTypeIncompatible
+		}
+		// only DATETIME holds all values of other types. TIMESTAMP is limited to 1970-2038.
+		if d.name == "datetime" && s.arg(0, 0) <= d.arg(0, 0) {
+			return ColumnTypeWidening
+		}
+		return ColumnTypeNarrowing
+	case familyEnum, familySet:
+		if len(s.args) == len(d.args) && strings.Join(s.args, ",") == strings.Join(d.args, ",") {
+			return ColumnTypeIdentical
+		}
+		dMembers := make(map[string]struct{}, len(d.args))
+		for _, m := range d.args {
+			dMembers[m] = struct{}{}
+		}
+		for _, m := range s.args {
+			if _, ok := dMembers[m]; !ok {
+				return ColumnTypeNarrowing
+			}
+		}
+		return ColumnTypeWidening
+	default: // familyJSON
+		return ColumnTypeIdentical
+	}
+}
+
+// IntegerMax returns the max value of an integer column, signed or unsigned.
+// ok is false if the column is not an integer.
+func IntegerMax(column *Column) (max uint64, ok bool) {
+	d := parseColumnTypeDef(column)
+	capacity := columnTypeCapacity[d.name]
+	if d.family != familyInteger || capacity == 0 {
+		return 0, false
+	}
+	if !d.unsigned {
+		return 1<<(8*capacity-1) - 1, true
+	}
+	if capacity == 8 {
+		return math.MaxUint64, true
+	}
+	return 1<<(8*capacity) - 1, true
+}
+
+// IntegerSignedMax returns the max value of a signed integer column.
+// ok is false if the column is not a signed integer.
+func IntegerSignedMax(column *Column) (max uint64, ok bool) {
+	d := parseColumnTypeDef(column)
+	if d.family != familyInteger || d.unsigned {
+		return 0, false
+	}
+	return 1<<(8*columnTypeCapacity[d.name]-1) - 1, true
+}
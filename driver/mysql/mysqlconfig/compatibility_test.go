@@ -0,0 +1,44 @@
+package mysqlconfig
+
+import (
+	"testing"
+)
+
+func TestCompareColumnType(t *testing.T) {
+	tests := []struct {
+		src  string
+		dst  string
+		want ColumnTypeCompatibility
+	}{
+		{"int(11)", "int(11)", ColumnTypeIdentical},
+		{"int(11)", "bigint(20)", ColumnTypeWidening},
+		{"int(10) unsigned", "bigint(20)", ColumnTypeWidening},
+		{"int(11)", "int(10) unsigned", ColumnTypeNarrowing},
+		{"bigint(20)", "int(11)", ColumnTypeNarrowing},
+		{"varchar(50)", "varchar(20)", ColumnTypeNarrowing},
+		{"varchar(20)", "text", ColumnTypeWidening},
+		{"decimal(10,2)", "decimal(12,4)", ColumnTypeWidening},
+		{"decimal(10,2)", "decimal(10,4)", ColumnTypeNarrowing},
+		{"datetime(3)", "datetime", ColumnTypeNarrowing},
+		{"date", "datetime", ColumnTypeWidening},
+		{"timestamp", "datetime", ColumnTypeWidening},
+		{"date", "timestamp", ColumnTypeNarrowing},
+		{"datetime", "timestamp", ColumnTypeNarrowing},
+		{"enum('a)','b,c')", "enum('a)','b,c')", ColumnTypeIdentical},
+		{"enum('a)','b,c')", "enum('a)','b','c')", ColumnTypeNarrowing},
+		{"set('it''s','x')", "set('it\\'s','x','y')", ColumnTypeWidening},
+		{"enum('a','b')", "enum('A','B')", ColumnTypeNarrowing},
+		{"INT(10) UNSIGNED", "bigint(20)", ColumnTypeWidening},
+		{"enum('a','b')", "enum('a','b','c')", ColumnTypeWidening},
+		{"varchar(20)", "int(11)", ColumnTypeIncompatible},
+		{"blob", "text", ColumnTypeIncompatible},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src+"->"+tt.dst, func(t *testing.T) {
+			got := CompareColumnType(&Column{ColumnType: tt.src}, &Column{ColumnType: tt.dst})
+			if got != tt.want {
+				t.Errorf("CompareColumnType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -9,6 +9,8 @@ package mysqlconfig
 import (
 	"fmt"
 	"net/url"
+	"strings"
+	"time"
 )
 
 // insert TIMESTAMP in UTC
@@ -21,18 +23,100 @@ type ConnectionConfig struct {
 	User     string
 	Password string
 	Charset  string
+	// If set, Password is ignored and the trimmed output of the command is used as the
+	// password. It is run again before AuthTokenTTLSec (default 900) runs out. Meant for
+	// cloud tokens (e.g. AWS RDS IAM), which are sent in clear text over TLS.
+	AuthTokenCommand string
+	AuthTokenTTLSec  int
+	// If set, Password is ignored and the password is got on every new connection.
+	// Set by InitAuthProvider.
+	AuthProvider AuthProvider `codec:"-" json:"-"`
+	// Reject connections to a read-only server, e.g. when connecting through a
+	// read/write splitting layer which might route to a replica.
+	RequirePrimary bool
+}
+
+const DefaultAuthTokenTTLSec = 900
+
+// InitAuthProvider sets AuthProvider according to AuthTokenCommand. It must be called
+// before connecting.
+func (c *ConnectionConfig) InitAuthProvider() {
+	if c.AuthTokenCommand == "" || c.AuthProvider != nil {
+		return
+	}
+	ttlSec := c.AuthTokenTTLSec
+	if ttlSec <= 0 {
+		ttlSec = DefaultAuthTokenTTLSec
+	}
+	ttl := time.Duration(ttlSec) * time.Second
+	c.AuthProvider = NewTokenAuthProvider(&CommandTokenProvider{Command: c.AuthTokenCommand, TTL: ttl}, ttl/5)
+}
+
+// GetPassword returns the password from AuthProvider if any, or Password.
+func (c *ConnectionConfig) GetPassword() (string, error) {
+	if c.AuthProvider == nil {
+		return c.Password, nil
+	}
+	return c.AuthProvider.GetPassword()
 }
 
 func (c *ConnectionConfig) GetDBUri() string {
+	return c.buildDBUri(c.Password)
+}
+
+// GetDBUriWithAuth is like GetDBUri but gets the password from AuthProvider if any.
+func (c *ConnectionConfig) GetDBUriWithAuth() (string, error) {
+	if c.AuthProvider == nil {
+		return c.GetDBUri(), nil
+	}
+	password, err := c.GetPassword()
+	if err != nil {
+		return "", err
+	}
+	return c.buildDBUri(password), nil
+}
+
+func (c *ConnectionConfig) buildDBUri(password string) string {
 	if c.Charset == "" {
 		c.Charset = "utf8mb4"
 	}
 
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=5s&tls=false&autocommit=true&charset=%v&%v&%v&%v",
-		c.User, c.Password, c.Host, c.Port, c.Charset, utcTimeZoneQueryStr,
+	tlsQueryStr := "tls=false"
+	if c.AuthTokenCommand != "" {
+		// tokens are sent in clear text and must be protected by TLS.
+		tlsQueryStr = "tls=skip-verify&allowCleartextPasswords=true"
+	}
+
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=5s&%v&autocommit=true&charset=%v&%v&%v&%v",
+		c.User, password, c.Host, c.Port, tlsQueryStr, c.Charset, utcTimeZoneQueryStr,
 		"multiStatements=true", "maxAllowedPacket=0")
 }
 
 func (c *ConnectionConfig) GetAddr() string {
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
 }
+
+// NormalizeCharset lowercases a charset name and maps the alias utf8 to utf8mb3.
+func NormalizeCharset(charset string) string {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if charset == "utf8" {
+		return "utf8mb3"
+	}
+	return charset
+}
+
+// NegotiateCharset returns the connection charset to keep all characters of the endpoints.
+// It is utf8mb4 if the configured charset or any of the server charsets is utf8mb4 or utf8mb3,
+// which is a subset of utf8mb4. Otherwise the configured charset is kept.
+func NegotiateCharset(connCharset string, serverCharsets ...string) string {
+	if connCharset == "" {
+		connCharset = "utf8mb4"
+	}
+	for _, charset := range append([]string{connCharset}, serverCharsets...) {
+		switch NormalizeCharset(charset) {
+		case "utf8mb4", "utf8mb3":
+			return "utf8mb4"
+		}
+	}
+	return connCharset
+}
@@ -0,0 +1,25 @@
+package mysqlconfig
+
+import "testing"
+
+func TestNegotiateCharset(t *testing.T) {
+	tests := []struct {
+		connCharset    string
+		serverCharsets []string
+		want           string
+	}{
+		{"", nil, "utf8mb4"},
+		{"utf8mb4", []string{"latin1", "latin1"}, "utf8mb4"},
+		{"utf8", []string{"utf8mb3", "utf8mb4"}, "utf8mb4"},
+		{"utf8", []string{"utf8mb4", "latin1"}, "utf8mb4"},
+		{"latin1", []string{"latin1", "utf8mb4"}, "utf8mb4"},
+		{"latin1", []string{"UTF8", "latin1"}, "utf8mb4"},
+		{"latin1", []string{"latin1", "latin1"}, "latin1"},
+		{"gbk", []string{"", "gbk"}, "gbk"},
+	}
+	for _, tt := range tests {
+		if got := NegotiateCharset(tt.connCharset, tt.serverCharsets...); got != tt.want {
+			t.Errorf("NegotiateCharset(%v, %v) = %v, want %v", tt.connCharset, tt.serverCharsets, got, tt.want)
+		}
+	}
+}
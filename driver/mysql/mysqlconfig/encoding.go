@@ -15,6 +15,8 @@ import (
 	"golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/encoding/unicode/utf32"
 	"golang.org/x/text/transform"
+	"strings"
+	"unicode/utf8"
 )
 
 var charsetEncodingMap = map[string]encoding.Encoding{
@@ -29,6 +31,88 @@ var charsetEncodingMap = map[string]encoding.Encoding{
 	//"binary": encoding.Nop, // will cause extra conversion
 }
 
+// IsConvertibleCharset tells whether ConvertToUTF8 knows the charset.
+func IsConvertibleCharset(charset string) bool {
+	_, ok := charsetEncodingMap[charset]
+	return ok
+}
+
+// runeChecker returns a function telling whether a character can be stored in a column of the
+// charset, or nil if any character can be, including for unknown charsets.
+func runeChecker(charset string) func(r rune) bool {
+	switch charset {
+	case "utf8", "utf8mb3":
+		return func(r rune) bool {
+			return r <= 0xFFFF
+		}
+	case "", "binary", "utf8mb4", "utf16", "utf16le", "utf32", "gb18030":
+		return nil
+	}
+	enc, ok := charsetEncodingMap[charset]
+	if !ok {
+		return nil
+	}
+	return func(r rune) bool {
+		_, err := enc.NewEncoder().String(string(r))
+		return err == nil
+	}
+}
+
+// HasLimitedRepertoire tells whether some characters cannot be stored in a column of the charset,
+// as far as IsRepresentable knows.
+func HasLimitedRepertoire(charset string) bool {
+	return runeChecker(charset) != nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// IsRepresentable tells whether the UTF-8 string can be stored in a column of the charset.
+// Unknown charsets are taken as able to store any character.
+func IsRepresentable(s string, charset string) bool {
+	if isASCII(s) {
+		return true
+	}
+	check := runeChecker(charset)
+	if check == nil {
+		return true
+	}
+	for _, r := range s {
+		if !check(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReplaceUnrepresentable replaces characters of the UTF-8 string which cannot be stored in a column
+// of the charset with '?', as MySQL does on conversion.
+func ReplaceUnrepresentable(s string, charset string) string {
+	if isASCII(s) {
+		return s
+	}
+	check := runeChecker(charset)
+	if check == nil {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if check(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
 // return original string and error if charset is not recognized
 func ConvertToUTF8(s string, charset string) (string, error) {
 	enc, ok := charsetEncodingMap[charset]
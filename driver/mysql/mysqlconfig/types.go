@@ -64,11 +64,12 @@ type TimezoneConvertion struct {
 
 type Column struct {
 	// Every time you set this, you must also set `EscapedName`.
-	RawName            string
-	EscapedName        string
-	IsUnsigned         bool
-	Charset            string
-	Type               ColumnType
+	RawName     string
+	EscapedName string
+	IsUnsigned  bool
+	IsZerofill  bool
+	Charset     string
+	Type        ColumnType
 	// Default is currently only used for kafka and limited to basic types.
 	Default            interface{}
 	ColumnType         string
@@ -77,6 +78,14 @@ type Column struct {
 	Nullable           bool
 	Precision          int // for decimal, time or datetime
 	Scale              int // for decimal
+	// SRID constraint of a geometry column. nil for none.
+	SRID *uint32
+	// INVISIBLE column (MySQL 8.0.23+). Only set by base.GetTableColumns.
+	Invisible bool
+	// AUTO_INCREMENT column. Only set by base.GetTableColumns.
+	AutoIncrement bool
+	// collation of a character column. Only set by base.ApplyColumnTypes.
+	Collation string
 	// somehow ugly. A better solution might be MetaInfo with subtypes
 }
 
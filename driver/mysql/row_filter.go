@@ -0,0 +1,185 @@
+package mysql
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/actiontech/dtle/driver/common"
+	umconf "github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+)
+
+// rowFilter drops rows not matching an expression of ApplyRowFilters on the dest.
+// The expression has the syntax of Where of ReplicateDoDb, on target column names.
+type rowFilter struct {
+	table *common.TableContext
+	// target columns the filter is built with
+	targetColumns *common.ColumnList
+}
+
+// newRowFilter returns nil if no filter is configured for the table. A row has columns `columnNames`
+// of the target.
+func newRowFilter(filters map[string]string, schema, table string, columnNames []string,
+	targetColumns *common.ColumnList) (*rowFilter, error) {
+
+	where, ok := filters[fmt.Sprintf("%v.%v", schema, table)]
+	if !ok || where == "" {
+		return nil, nil
+	}
+	columns := make([]umconf.Column, len(columnNames))
+	for i, name := range columnNames {
+		column := targetColumns.GetColumn(name)
+		if column == nil {
+			return nil, fmt.Errorf("ApplyRowFilters: column %v not found on target table %v.%v", name, schema, table)
+		}
+		columns[i] = *column
+	}
+	t := common.NewTable(schema, table)
+	t.Where = where
+	t.OriginalTableColumns = common.NewColumnList(columns)
+	tableCtx, err := common.NewTableContext(t)
+	if err != nil {
+		return nil, fmt.Errorf("ApplyRowFilters: %v", err)
+	}
+	return &rowFilter{table: tableCtx, targetColumns: targetColumns}, nil
+}
+
+// match evaluates the expression with a row, whose values are of full copy ([]byte) or incr (native).
+func (f *rowFilter) match(row []interface{}) (bool, error) {
+	columns := f.table.Table.OriginalTableColumns.ColumnList()
+	values := make([]interface{}, len(row))
+	for _, idx := range f.table.WhereCtx.FieldsMap {
+		if idx < len(row) && idx < len(columns) {
+			values[idx] = rowFilterValue(&columns[idx], row[idx])
+		}
+	}
+	return f.table.WhereTrue(values)
+}
+
+// matchImage is match, except that an absent image of an update does not match.
+func (f *rowFilter) matchImage(row []interface{}) (bool, error) {
+	if len(row) == 0 {
+		return false, nil
+	}
+	return f.match(row)
+}
+
+// filterRowValues returns the full copy rows matching the expression.
+func (f *rowFilter) filterRowValues(rows [][]*[]byte) ([][]*[]byte, error) {
+	r := rows[:0]
+	row := make([]interface{}, 0)
+	for _, values := range rows {
+		row = row[:0]
+		for _, v := range values {
+			if v == nil {
+				row = append(row, nil)
+			} else {
+				row = append(row, *v)
+			}
+		}
+		ok, err := f.match(row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			r = append(r, values)
+		}
+	}
+	return r, nil
+}
+
+// filterEventRows returns the rows of an incr DML event to be applied. Inserted and deleted rows
+// are matched. An update is matched with both images: a row moving out of the filter is applied
+// as a delete of the before image, and a row moving into it as an insert of the after image,
+// by leaving the other image absent.
+func (f *rowFilter) filterEventRows(event *common.DataEvent) ([][]interface{}, error) {
+	var r [][]interface{}
+	switch event.DML {
+	case common.UpdateDML:
+		for i := 0; i+1 < len(event.Rows); i += 2 {
+			before, after := event.Rows[i], event.Rows[i+1]
+			beforeOk, err := f.matchImage(before)
+			if err != nil {
+				return nil, err
+			}
+			afterOk, err := f.matchImage(after)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case beforeOk && afterOk:
+				r = append(r, before, after)
+			case beforeOk:
+				r = append(r, before, nil)
+			case afterOk:
+				r = append(r, nil, after)
+			}
+		}
+	default:
+		for _, row := range event.Rows {
+			ok, err := f.match(row)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				r = append(r, row)
+			}
+		}
+	}
+	return r, nil
+}
+
+// rowFilterValue converts a value by the type of the column, so that numbers compare as numbers.
+// Values of TextColumnType are []byte as WhereTrue expects. Other character values are strings.
+func rowFilterValue(column *umconf.Column, value interface{}) interface{} {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+		return float64(v)
+	case float32:
+		return float64(v)
+	default:
+		return value
+	}
+
+	switch column.Type {
+	case umconf.TinyintColumnType, umconf.SmallintColumnType, umconf.MediumIntColumnType,
+		umconf.IntColumnType, umconf.BigIntColumnType, umconf.YearColumnType:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case umconf.DecimalColumnType, umconf.FloatColumnType, umconf.DoubleColumnType:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case umconf.TextColumnType:
+		return []byte(s)
+	}
+	return s
+}
@@ -0,0 +1,99 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/driver/common"
+	umconf "github.com/actiontech/dtle/driver/mysql/mysqlconfig"
+)
+
+func TestRowFilter(t *testing.T) {
+	targetColumns := common.NewColumnList([]umconf.Column{
+		{RawName: "id", Type: umconf.IntColumnType},
+		{RawName: "balance", Type: umconf.DecimalColumnType},
+		{RawName: "status", Type: umconf.VarcharColumnType},
+	})
+	filters := map[string]string{"a.accounts": "balance >= 100 AND status = 'active'"}
+
+	f, err := newRowFilter(filters, "a", "t2", targetColumns.Names(), targetColumns)
+	if err != nil || f != nil {
+		t.Fatalf("expect no filter for an unconfigured table. %v %v", f, err)
+	}
+	_, err = newRowFilter(map[string]string{"a.accounts": "nosuchcolumn > 1"}, "a", "accounts",
+		targetColumns.Names(), targetColumns)
+	if err == nil {
+		t.Fatal("expect an error on an unknown column")
+	}
+
+	f, err = newRowFilter(filters, "a", "accounts", targetColumns.Names(), targetColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// full copy. "50" > "100" as strings, but not as numbers.
+	bs := func(s string) *[]byte {
+		b := []byte(s)
+		return &b
+	}
+	rows := [][]*[]byte{
+		{bs("1"), bs("50"), bs("active")},
+		{bs("2"), bs("150.5"), bs("active")},
+		{bs("3"), bs("1000"), bs("closed")},
+		{bs("4"), nil, bs("active")},
+		{bs("5"), bs("100"), bs("active")},
+	}
+	got, err := f.filterRowValues(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, row := range got {
+		ids = append(ids, string(*row[0]))
+	}
+	if !reflect.DeepEqual(ids, []string{"2", "5"}) {
+		t.Errorf("unexpected rows kept: %v", ids)
+	}
+
+	// incr
+	event := &common.DataEvent{DML: common.InsertDML, Rows: [][]interface{}{
+		{int32(1), "99.99", "active"},
+		{int32(2), "100.00", "active"},
+	}}
+	rowArgs, err := f.filterEventRows(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rowArgs) != 1 || rowArgs[0][0] != int32(2) {
+		t.Errorf("unexpected inserted rows kept: %v", rowArgs)
+	}
+
+	event = &common.DataEvent{DML: common.UpdateDML, Rows: [][]interface{}{
+		{int32(1), "200", "active"}, {int32(1), "20", "active"},
+		{int32(2), "20", "active"}, {int32(2), "200", "active"},
+	}}
+	rowArgs, err = f.filterEventRows(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// row 1 moves out of the filter: deleted. row 2 moves into it: inserted.
+	expected := [][]interface{}{
+		{int32(1), "200", "active"}, nil,
+		nil, {int32(2), "200", "active"},
+	}
+	if !reflect.DeepEqual(rowArgs, expected) {
+		t.Errorf("unexpected update rows. got %v, want %v", rowArgs, expected)
+	}
+
+	event = &common.DataEvent{DML: common.UpdateDML, Rows: [][]interface{}{
+		{int32(1), "200", "active"}, {int32(1), "300", "active"},
+		{int32(2), "20", "active"}, {int32(2), "30", "active"},
+	}}
+	rowArgs, err = f.filterEventRows(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rowArgs) != 2 || rowArgs[0][0] != int32(1) || rowArgs[1][1] != "300" {
+		t.Errorf("expect the update within the filter kept, got %v", rowArgs)
+	}
+}
@@ -0,0 +1,451 @@
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sqle "github.com/actiontech/dtle/driver/mysql/sqle/inspector"
+	"github.com/pingcap/tidb/parser/ast"
+	parsermysql "github.com/pingcap/tidb/parser/mysql"
+	"github.com/pingcap/tidb/parser/opcode"
+)
+
+// DeadLetterSink receives rows which are not applied to the target.
+type DeadLetterSink interface {
+	Put(schema string, table string, row []*[]byte, reason string) error
+}
+
+type deadLetterRecord struct {
+	Time   time.Time
+	Schema string
+	Table  string
+	Row    []*string
+	Reason string
+}
+
+// fileDeadLetterSink appends rows as json lines to a file.
+type fileDeadLetterSink struct {
+	mutex    sync.Mutex
+	fileName string
+}
+
+func newFileDeadLetterSink(stateDir string, subject string) *fileDeadLetterSink {
+	return &fileDeadLetterSink{
+		fileName: path.Join(stateDir, fmt.Sprintf("dead_letter_%v.log", subject)),
+	}
+}
+
+func (s *fileDeadLetterSink) Put(schema string, table string, row []*[]byte, reason string) error {
+	record := deadLetterRecord{
+		Time:   time.Now(),
+		Schema: schema,
+		Table:  table,
+		Row:    make([]*string, len(row)),
+		Reason: reason,
+	}
+	for i := range row {
+		if row[i] != nil {
+			v := string(*row[i])
+			record.Row[i] = &v
+		}
+	}
+	bs, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f, err := os.OpenFile(s.fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(bs, '\n'))
+	return err
+}
+
+// rowValidator checks full copy rows against ENUM/SET domains and CHECK constraints of the target table.
+// Only simple CHECK expressions (comparison, AND/OR/NOT, IN, BETWEEN) are evaluated. Others are ignored.
+// Strings are compared with the collation of the column. A comparison which cannot be evaluated
+// faithfully with the collation (see compareStrings) is ignored.
+type rowValidator struct {
+	// lower-case column name => index in a row
+	columnIndex map[string]int
+	enums       map[int][]string
+	sets        map[int][]string
+	checks      []*ast.Constraint
+	// index in a row => lower-case collation of the column. "" for the server default.
+	collations map[int]string
+}
+
+// newRowValidator builds a validator from the CREATE TABLE statement of the target table.
+// columnNames are the columns of a row. Columns of the statement are used if empty.
+func newRowValidator(createTable string, columnNames []string) (*rowValidator, error) {
+	stmt, err := sqle.ParseCreateTableStmt("mysql", createTable)
+	if err != nil {
+		return nil, err
+	}
+	v := &rowValidator{
+		columnIndex: make(map[string]int),
+		enums:       make(map[int][]string),
+		sets:        make(map[int][]string),
+		collations:  make(map[int]string),
+	}
+	if len(columnNames) == 0 {
+		for _, col := range stmt.Cols {
+			columnNames = append(columnNames, col.Name.Name.O)
+		}
+	}
+	for i, name := range columnNames {
+		v.columnIndex[strings.ToLower(name)] = i
+	}
+
+	var tableCharset, tableCollation string
+	for _, option := range stmt.Options {
+		switch option.Tp {
+		case ast.TableOptionCharset:
+			tableCharset = option.StrValue
+		case ast.TableOptionCollate:
+			tableCollation = option.StrValue
+		}
+	}
+	for _, col := range stmt.Cols {
+		idx, ok := v.columnIndex[col.Name.Name.L]
+		if !ok {
+			continue
+		}
+		v.collations[idx] = columnCollation(col, tableCharset, tableCollation)
+		switch col.Tp.Tp {
+		case parsermysql.TypeEnum:
+			v.enums[idx] = col.Tp.Elems
+		case parsermysql.TypeSet:
+			v.sets[idx] = col.Tp.Elems
+		}
+		for _, option := range col.Options {
+			if option.Tp == ast.ColumnOptionCheck && option.Enforced {
+				v.checks = append(v.checks, &ast.Constraint{Name: col.Name.Name.O, Expr: option.Expr, Enforced: true})
+			}
+		}
+	}
+	for _, constraint := range stmt.Constraints {
+		if constraint.Tp == ast.ConstraintCheck && constraint.Enforced {
+			v.checks = append(v.checks, constraint)
+		}
+	}
+	return v, nil
+}
+
+// columnCollation returns the lower-case collation of the column, by the column or the table.
+// The collation of a charset is returned as "<charset>_general_ci", which is case-insensitive as
+// all default collations except binary.
+func columnCollation(col *ast.ColumnDef, tableCharset, tableCollation string) string {
+	collation, charset := col.Tp.Collate, col.Tp.Charset
+	for _, option := range col.Options {
+		if option.Tp == ast.ColumnOptionCollate {
+			collation = option.StrValue
+		}
+	}
+	if parsermysql.HasBinaryFlag(col.Tp.Flag) && collation == "" && charset != "binary" {
+		// e.g. CHAR(10) BINARY
+		return "_bin"
+	}
+	if collation == "" && charset == "" {
+		collation, charset = tableCollation, tableCharset
+	}
+	switch {
+	case collation != "":
+		return strings.ToLower(collation)
+	case strings.EqualFold(charset, "binary"):
+		return "binary"
+	case charset != "":
+		return strings.ToLower(charset) + "_general_ci"
+	default:
+		return ""
+	}
+}
+
+func containsFold(elems []string, s string) bool {
+	for _, e := range elems {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate returns the reason if the row violates the table definition, or "" if it is valid.
+func (v *rowValidator) validate(row []*[]byte) string {
+	for idx, elems := range v.enums {
+		if idx < len(row) && row[idx] != nil && !containsFold(elems, string(*row[idx])) {
+			return fmt.Sprintf("value %q is not in enum %v", string(*row[idx]), elems)
+		}
+	}
+	for idx, elems := range v.sets {
+		if idx < len(row) && row[idx] != nil && len(*row[idx]) > 0 {
+			for _, member := range strings.Split(string(*row[idx]), ",") {
+				if !containsFold(elems, member) {
+					return fmt.Sprintf("value %q is not in set %v", member, elems)
+				}
+			}
+		}
+	}
+	for _, check := range v.checks {
+		r := v.eval(check.Expr, row)
+		if r.known && !r.null && !r.isTrue() {
+			return fmt.Sprintf("check constraint %v is violated", check.Name)
+		}
+	}
+	return ""
+}
+
+type evalResult struct {
+	known bool // false if the expression is not supported
+	null  bool
+	value string
+	// lower-case collation of a column value. "" for others.
+	collation string
+	column    bool
+}
+
+func (r evalResult) isTrue() bool {
+	f, err := strconv.ParseFloat(r.value, 64)
+	return err == nil && f != 0
+}
+
+func boolResult(b bool) evalResult {
+	if b {
+		return evalResult{known: true, value: "1"}
+	}
+	return evalResult{known: true, value: "0"}
+}
+
+// compareValues compares numerically if both are numbers, otherwise as strings with the collation
+// of the column value. ok is false if the result is unknown.
+func compareValues(a, b evalResult) (c int, ok bool) {
+	fa, errA := strconv.ParseFloat(a.value, 64)
+	fb, errB := strconv.ParseFloat(b.value, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+	collation := a.collation
+	if !a.column {
+		collation = b.collation
+	}
+	return compareStrings(a.value, b.value, collation)
+}
+
+// equalValues is compareValues(a, b) == 0. Equality is known for more strings than order.
+func equalValues(a, b evalResult) (equal bool, ok bool) {
+	c, ok := compareValues(a, b)
+	if ok {
+		return c == 0, true
+	}
+	if isASCII(a.value) && isASCII(b.value) && !hasTrailingSpace(a.value) && !hasTrailingSpace(b.value) {
+		collation := a.collation
+		if !a.column {
+			collation = b.collation
+		}
+		if isCaseSensitiveCollation(collation) {
+			return a.value == b.value, true
+		}
+		return strings.EqualFold(a.value, b.value), true
+	}
+	return false, false
+}
+
+// compareStrings compares strings with the collation, or returns ok=false if it cannot be done
+// faithfully: binary collations compare bytes. Others only ASCII strings without trailing spaces
+// (PAD SPACE), and, if case-insensitive (including the server default ""), only letters and digits,
+// whose order is the same in all collations.
+func compareStrings(a, b string, collation string) (c int, ok bool) {
+	if collation == "binary" {
+		return strings.Compare(a, b), true
+	}
+	if !isASCII(a) || !isASCII(b) || hasTrailingSpace(a) || hasTrailingSpace(b) {
+		return 0, false
+	}
+	if isCaseSensitiveCollation(collation) {
+		return strings.Compare(a, b), true
+	}
+	if !isAlphanumeric(a) || !isAlphanumeric(b) {
+		return 0, false
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b)), true
+}
+
+func isCaseSensitiveCollation(collation string) bool {
+	return collation == "binary" || strings.HasSuffix(collation, "_bin") || strings.HasSuffix(collation, "_cs")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanumeric(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func hasTrailingSpace(s string) bool {
+	return strings.HasSuffix(s, " ")
+}
+
+func (v *rowValidator) eval(expr ast.ExprNode, row []*[]byte) evalResult {
+	switch e := expr.(type) {
+	case *ast.ParenthesesExpr:
+		return v.eval(e.Expr, row)
+	case *ast.ColumnNameExpr:
+		idx, ok := v.columnIndex[e.Name.Name.L]
+		if !ok || idx >= len(row) {
+			return evalResult{}
+		}
+		if row[idx] == nil {
+			return evalResult{known: true, null: true}
+		}
+		return evalResult{known: true, value: string(*row[idx]), collation: v.collations[idx], column: true}
+	case ast.ValueExpr:
+		switch val := e.GetValue().(type) {
+		case nil:
+			return evalResult{known: true, null: true}
+		case string:
+			return evalResult{known: true, value: val}
+		case fmt.Stringer:
+			return evalResult{known: true, value: val.String()}
+		default:
+			return evalResult{known: true, value: fmt.Sprintf("%v", val)}
+		}
+	case *ast.UnaryOperationExpr:
+		if e.Op != opcode.Not && e.Op != opcode.Not2 {
+			return evalResult{}
+		}
+		r := v.eval(e.V, row)
+		if !r.known || r.null {
+			return r
+		}
+		return boolResult(!r.isTrue())
+	case *ast.BinaryOperationExpr:
+		l := v.eval(e.L, row)
+		r := v.eval(e.R, row)
+		if !l.known || !r.known {
+			return evalResult{}
+		}
+		switch e.Op {
+		case opcode.LogicAnd:
+			if (!l.null && !l.isTrue()) || (!r.null && !r.isTrue()) {
+				return boolResult(false)
+			}
+			if l.null || r.null {
+				return evalResult{known: true, null: true}
+			}
+			return boolResult(true)
+		case opcode.LogicOr:
+			if (!l.null && l.isTrue()) || (!r.null && r.isTrue()) {
+				return boolResult(true)
+			}
+			if l.null || r.null {
+				return evalResult{known: true, null: true}
+			}
+			return boolResult(false)
+		}
+		if l.null || r.null {
+			return evalResult{known: true, null: true}
+		}
+		switch e.Op {
+		case opcode.EQ, opcode.NE:
+			equal, ok := equalValues(l, r)
+			if !ok {
+				return evalResult{}
+			}
+			return boolResult(equal == (e.Op == opcode.EQ))
+		}
+		c, ok := compareValues(l, r)
+		if !ok {
+			return evalResult{}
+		}
+		switch e.Op {
+		case opcode.LT:
+			return boolResult(c < 0)
+		case opcode.LE:
+			return boolResult(c <= 0)
+		case opcode.GT:
+			return boolResult(c > 0)
+		case opcode.GE:
+			return boolResult(c >= 0)
+		default:
+			return evalResult{}
+		}
+	case *ast.BetweenExpr:
+		x, low, high := v.eval(e.Expr, row), v.eval(e.Left, row), v.eval(e.Right, row)
+		if !x.known || !low.known || !high.known {
+			return evalResult{}
+		}
+		if x.null || low.null || high.null {
+			return evalResult{known: true, null: true}
+		}
+		cLow, okLow := compareValues(x, low)
+		cHigh, okHigh := compareValues(x, high)
+		if !okLow || !okHigh {
+			return evalResult{}
+		}
+		in := cLow >= 0 && cHigh <= 0
+		return boolResult(in != e.Not)
+	case *ast.PatternInExpr:
+		if e.Sel != nil {
+			return evalResult{}
+		}
+		x := v.eval(e.Expr, row)
+		if !x.known || x.null {
+			return x
+		}
+		found := false
+		for _, item := range e.List {
+			r := v.eval(item, row)
+			if !r.known {
+				return evalResult{}
+			}
+			if r.null {
+				continue
+			}
+			equal, ok := equalValues(x, r)
+			if !ok {
+				return evalResult{}
+			}
+			if equal {
+				found = true
+			}
+		}
+		return boolResult(found != e.Not)
+	case *ast.IsNullExpr:
+		x := v.eval(e.Expr, row)
+		if !x.known {
+			return x
+		}
+		return boolResult(x.null != e.Not)
+	default:
+		return evalResult{}
+	}
+}
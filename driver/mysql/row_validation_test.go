@@ -0,0 +1,45 @@
+package mysql
+
+import (
+	"testing"
+)
+
+func TestRowValidatorCollation(t *testing.T) {
+	newRow := func(vals ...string) []*[]byte {
+		row := make([]*[]byte, len(vals))
+		for i := range vals {
+			bs := []byte(vals[i])
+			row[i] = &bs
+		}
+		return row
+	}
+	cases := []struct {
+		createTable string
+		value       string
+		valid       bool
+	}{
+		// case-insensitive by default
+		{"CREATE TABLE `t1` (`s` varchar(10), CONSTRAINT `c1` CHECK (`s` = 'active'))", "Active", true},
+		{"CREATE TABLE `t1` (`s` varchar(10), CONSTRAINT `c1` CHECK (`s` = 'active'))", "closed", false},
+		{"CREATE TABLE `t1` (`s` varchar(10), CONSTRAINT `c1` CHECK (`s` in ('a', 'b')))", "B", true},
+		{"CREATE TABLE `t1` (`s` varchar(10), CONSTRAINT `c1` CHECK (`s` >= 'b'))", "A", false},
+		{"CREATE TABLE `t1` (`s` varchar(10), CONSTRAINT `c1` CHECK (`s` >= 'b'))", "C", true},
+		// case-sensitive collations of the column or the table
+		{"CREATE TABLE `t1` (`s` varchar(10) COLLATE utf8mb4_bin, CONSTRAINT `c1` CHECK (`s` = 'active'))", "Active", false},
+		{"CREATE TABLE `t1` (`s` varchar(10), CONSTRAINT `c1` CHECK (`s` = 'active')) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_as_cs", "Active", false},
+		{"CREATE TABLE `t1` (`s` varbinary(10), CONSTRAINT `c1` CHECK (`s` = 'active'))", "Active", false},
+		// not evaluated faithfully. assumed valid.
+		{"CREATE TABLE `t1` (`s` varchar(10), CONSTRAINT `c1` CHECK (`s` = 'cafe'))", "café", true},
+		{"CREATE TABLE `t1` (`s` varchar(10), CONSTRAINT `c1` CHECK (`s` < 'a_'))", "a-", true},
+	}
+	for i, c := range cases {
+		v, err := newRowValidator(c.createTable, nil)
+		if err != nil {
+			t.Fatalf("case %v: %v", i, err)
+		}
+		reason := v.validate(newRow(c.value))
+		if (reason == "") != c.valid {
+			t.Errorf("case %v: %q valid %v, reason %q", i, c.value, c.valid, reason)
+		}
+	}
+}
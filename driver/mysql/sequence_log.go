@@ -0,0 +1,106 @@
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/pkg/errors"
+)
+
+// sequenceLogRecord is a line of SequenceLogFile, for an event applied by incremental replication.
+type sequenceLogRecord struct {
+	// in the order of applying, from 1 for each opening of the file
+	Seq  int64  `json:"seq"`
+	Gtid string `json:"gtid"`
+	// DDL, INSERT, UPDATE or DELETE
+	Type   string `json:"type"`
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// the statement for DDL
+	Query string `json:"query,omitempty"`
+	// the number of rows for DML
+	Rows int `json:"rows,omitempty"`
+}
+
+// sequenceLog appends a record of each applied event to SequenceLogFile, as JSON lines.
+// Events of an entry are recorded together after the entry is applied, so records of
+// transactions applied in parallel are not interleaved.
+type sequenceLog struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+	seq  int64
+}
+
+// newSequenceLog returns nil if path is empty.
+func newSequenceLog(path string) (*sequenceLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, errors.Wrap(err, "open SequenceLogFile")
+	}
+	return &sequenceLog{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func sequenceLogType(dml int8) string {
+	switch dml {
+	case common.InsertDML:
+		return "INSERT"
+	case common.UpdateDML:
+		return "UPDATE"
+	case common.DeleteDML:
+		return "DELETE"
+	default:
+		return "DDL"
+	}
+}
+
+// recordEntry appends records of all events of the entry. It is a no-op on a nil sequenceLog.
+func (l *sequenceLog) recordEntry(entry *common.DataEntry) error {
+	if l == nil {
+		return nil
+	}
+	gtid := fmt.Sprintf("%v:%v", entry.Coordinates.GetSidStr(), entry.Coordinates.GetGNO())
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range entry.Events {
+		event := &entry.Events[i]
+		record := sequenceLogRecord{
+			Gtid:   gtid,
+			Type:   sequenceLogType(event.DML),
+			Schema: event.DatabaseName,
+			Table:  event.TableName,
+		}
+		if event.DML == common.NotDML {
+			record.Query = event.Query
+			if record.Schema == "" {
+				record.Schema = event.CurrentSchema
+			}
+		} else if event.DML == common.UpdateDML {
+			record.Rows = len(event.Rows) / 2
+		} else {
+			record.Rows = len(event.Rows)
+		}
+		l.seq += 1
+		record.Seq = l.seq
+		if err := l.enc.Encode(&record); err != nil {
+			return errors.Wrap(err, "write SequenceLogFile")
+		}
+	}
+	return nil
+}
+
+func (l *sequenceLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
@@ -0,0 +1,112 @@
+package mysql
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/actiontech/dtle/driver/common"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestSequenceLog(t *testing.T) {
+	if l, err := newSequenceLog(""); l != nil || err != nil {
+		t.Fatalf("expect no log without a path. got %v %v", l, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "seq.log")
+	a, mock := newTestApplierIncr(t)
+	a.tableItems = make(mapSchemaTableItems)
+	var err error
+	a.sequenceLog, err = newSequenceLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sid := uuid.FromStringOrNil("7b2a3a4e-1c1d-11ee-8b2f-0242ac120002")
+	ddl := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{SID: sid, GNO: 1, SeqenceNumber: 1},
+		Events: []common.DataEvent{
+			{DML: common.NotDML, CurrentSchema: "a", TableName: "t1", Query: "create table t1 (id int)"},
+		},
+		Final: true,
+	}
+	tx := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{SID: sid, GNO: 2, SeqenceNumber: 2, LastCommitted: 1},
+		Events: []common.DataEvent{
+			{DML: common.NotDML, Query: "update a.t1 set id = 1"},
+			{DML: common.NotDML, Query: "update a.t1 set id = 2"},
+		},
+		Final: true,
+	}
+
+	executed := make(chan struct{})
+	go func() {
+		<-a.mtsManager.chExecuted
+		<-a.mtsManager.chExecuted
+		close(executed)
+	}()
+	mock.ExpectExec(regexp.QuoteMeta("USE `a`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("create table t1 (id int)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("update a.t1 set id = 1")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("update a.t1 set id = 2")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("commit").WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, entry := range []*common.DataEntry{ddl, tx} {
+		if err := a.ApplyBinlogEvent(0, &common.EntryContext{Entry: entry}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-executed
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	dml := &common.DataEntry{
+		Coordinates: &common.MySQLCoordinateTx{SID: sid, GNO: 3},
+		Events: []common.DataEvent{
+			{DML: common.InsertDML, DatabaseName: "a", TableName: "t1", Rows: [][]interface{}{{1}, {2}}},
+			{DML: common.UpdateDML, DatabaseName: "a", TableName: "t1", Rows: [][]interface{}{{1}, {3}}},
+			{DML: common.DeleteDML, DatabaseName: "a", TableName: "t1", Rows: [][]interface{}{{2}}},
+		},
+	}
+	if err := a.sequenceLog.recordEntry(dml); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.sequenceLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	gtid := sid.String()
+	want := []sequenceLogRecord{
+		{Seq: 1, Gtid: gtid + ":1", Type: "DDL", Schema: "a", Table: "t1", Query: "create table t1 (id int)"},
+		{Seq: 2, Gtid: gtid + ":2", Type: "DDL", Query: "update a.t1 set id = 1"},
+		{Seq: 3, Gtid: gtid + ":2", Type: "DDL", Query: "update a.t1 set id = 2"},
+		{Seq: 4, Gtid: gtid + ":3", Type: "INSERT", Schema: "a", Table: "t1", Rows: 2},
+		{Seq: 5, Gtid: gtid + ":3", Type: "UPDATE", Schema: "a", Table: "t1", Rows: 1},
+		{Seq: 6, Gtid: gtid + ":3", Type: "DELETE", Schema: "a", Table: "t1", Rows: 1},
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []sequenceLogRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record sequenceLogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, record)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
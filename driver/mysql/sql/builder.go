@@ -28,8 +28,18 @@ const (
 	GreaterThanOrEqualsComparisonSign                     = ">="
 	GreaterThanComparisonSign                             = ">"
 	NotEqualsComparisonSign                               = "!="
+	NullSafeEqualsComparisonSign                          = "<=>"
 )
 
+// keyComparisonSign returns the sign to compare a key column with a value.
+// A nullable key (allowed by SkipInvalidTables) might be NULL, which `=` never matches.
+func keyComparisonSign(column *umconf.Column) ValueComparisonSign {
+	if column.IsPk() && column.Nullable {
+		return NullSafeEqualsComparisonSign
+	}
+	return EqualsComparisonSign
+}
+
 func EscapeColRawToString(col *[]byte) string {
 	if col != nil {
 		return fmt.Sprintf("'%s'", EscapeValue(string(*col)))
@@ -72,6 +82,42 @@ func EscapeValue(colValue string) string {
 	return colBuffer.String()
 }
 
+// BuildColumnLiteral renders a dumped value as a SQL literal according to its column type.
+// BIT and binary string values are rendered as b'...' and X'...' to keep the exact bytes.
+func BuildColumnLiteral(colValue []byte, columnType string) string {
+	columnType = strings.ToLower(columnType)
+	switch {
+	case strings.HasPrefix(columnType, "bit"):
+		var buf bytes.Buffer
+		buf.WriteString("b'")
+		for _, b := range colValue {
+			buf.WriteString(fmt.Sprintf("%08b", b))
+		}
+		buf.WriteByte('\'')
+		return buf.String()
+	case strings.HasPrefix(columnType, "binary"), strings.HasPrefix(columnType, "varbinary"),
+		strings.Contains(columnType, "blob"), IsGeometryType(columnType):
+		// geometry values keep the SRID in the first 4 bytes
+		return fmt.Sprintf("X'%X'", colValue)
+	default:
+		return "'" + EscapeValue(string(colValue)) + "'"
+	}
+}
+
+// IsGeometryType returns true for spatial column types, e.g. "point" or "geometry".
+func IsGeometryType(columnType string) bool {
+	if i := strings.IndexByte(columnType, ' '); i >= 0 {
+		columnType = columnType[:i] // e.g. "point srid 4326"
+	}
+	switch strings.ToLower(columnType) {
+	case "geometry", "point", "linestring", "polygon", "multipoint", "multilinestring",
+		"multipolygon", "geometrycollection", "geomcollection":
+		return true
+	default:
+		return false
+	}
+}
+
 func BuildValueComparison(columnEscaped string, value string, comparisonSign ValueComparisonSign) (result string, err error) {
 	if columnEscaped == "``" {
 		return "", fmt.Errorf("Empty column in GetValueComparison")
@@ -86,12 +132,61 @@ func BuildValueComparison(columnEscaped string, value string, comparisonSign Val
 func BuildDMLDeleteQuery(databaseName, tableName string, tableColumns *common.ColumnList, columnMapTo []string,
 	args []interface{}, stmt *gosql.Stmt) (result string, columnArgs []interface{}, hasUK bool, err error) {
 
+	comparisons, columnArgs, hasUK, err := buildRowComparisons("BuildDMLDeleteQuery", databaseName, tableName,
+		tableColumns, columnMapTo, args)
+	if err != nil {
+		return result, columnArgs, hasUK, err
+	}
+
+	if hasUK && stmt != nil {
+		result = ""
+	} else {
+		databaseName = umconf.EscapeName(databaseName)
+		tableName = umconf.EscapeName(tableName)
+		result = fmt.Sprintf(`delete from %s.%s where
+%s limit 1`, databaseName, tableName,
+			fmt.Sprintf("(%s)", strings.Join(comparisons, " and ")),
+		)
+	}
+	// hasUK: true: use saved PS to execute; false: execute a new query.
+	return result, columnArgs, hasUK, nil
+}
+
+// BuildDMLSoftDeleteQuery builds `update ... set column = value` for the row to be deleted, locating it
+// as BuildDMLDeleteQuery does. `where` is an extra predicate and can be empty.
+func BuildDMLSoftDeleteQuery(databaseName, tableName string, tableColumns *common.ColumnList, columnMapTo []string,
+	args []interface{}, column string, value string, where string,
+	stmt *gosql.Stmt) (result string, columnArgs []interface{}, hasUK bool, err error) {
+
+	comparisons, columnArgs, hasUK, err := buildRowComparisons("BuildDMLSoftDeleteQuery", databaseName, tableName,
+		tableColumns, columnMapTo, args)
+	if err != nil {
+		return result, columnArgs, hasUK, err
+	}
+	if where != "" {
+		comparisons = append(comparisons, fmt.Sprintf("(%s)", where))
+	}
+
+	if hasUK && stmt != nil {
+		result = ""
+	} else {
+		result = fmt.Sprintf(`update %s.%s set %s = %s where
+(%s) limit 1`, umconf.EscapeName(databaseName), umconf.EscapeName(tableName), umconf.EscapeName(column), value,
+			strings.Join(comparisons, " and "))
+	}
+	return result, columnArgs, hasUK, nil
+}
+
+// buildRowComparisons builds comparisons locating the row by the unique key, or by all columns
+// if the table has no unique key.
+func buildRowComparisons(funcName string, databaseName, tableName string, tableColumns *common.ColumnList,
+	columnMapTo []string, args []interface{}) (comparisons []string, columnArgs []interface{}, hasUK bool, err error) {
+
 	if !(len(args) >= tableColumns.Len() || len(args) == len(columnMapTo)) {
-		return result, columnArgs, hasUK, fmt.Errorf("BuildDMLDeleteQuery bad args count %v %v %v %v.%v",
+		return nil, nil, false, fmt.Errorf("%v bad args count %v %v %v %v.%v", funcName,
 			len(args), tableColumns.Len(), len(columnMapTo), databaseName, tableName)
 	}
 
-	comparisons := []string{}
 	uniqueKeyComparisons := []string{}
 	uniqueKeyArgs := make([]interface{}, 0)
 
@@ -99,23 +194,31 @@ func BuildDMLDeleteQuery(databaseName, tableName string, tableColumns *common.Co
 		column := getColumnWithMapTo(i, columnMapTo, tableColumns)
 
 		if column == nil {
-			g.Logger.Warn("BuildDMLDeleteQuery: unable to find column. ignoring",
+			g.Logger.Warn(funcName+": unable to find column. ignoring",
 				"columnMapTo", columnMapTo, "i", i, "len", tableColumns.Len())
 			continue
 		}
 
-		if args[i] == nil {
+		if args[i] == nil && column.IsPk() {
+			// keep the key comparison so the row is still located by the key
+			comparison, err := BuildValueComparison(column.EscapedName, "?", NullSafeEqualsComparisonSign)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			uniqueKeyArgs = append(uniqueKeyArgs, nil)
+			uniqueKeyComparisons = append(uniqueKeyComparisons, comparison)
+		} else if args[i] == nil {
 			comparison, err := BuildValueComparison(column.EscapedName, "NULL", IsEqualsComparisonSign)
 			if err != nil {
-				return result, columnArgs, hasUK, err
+				return nil, nil, false, err
 			}
 			comparisons = append(comparisons, comparison)
 		} else {
 			if column.Type == umconf.BinaryColumnType {
 				arg := column.ConvertArg(args[i])
-				comparison, err := BuildValueComparison(column.EscapedName, fmt.Sprintf("cast('%v' as %s)", arg, column.ColumnType), EqualsComparisonSign)
+				comparison, err := BuildValueComparison(column.EscapedName, fmt.Sprintf("cast('%v' as %s)", arg, column.ColumnType), keyComparisonSign(column))
 				if err != nil {
-					return result, columnArgs, hasUK, err
+					return nil, nil, false, err
 				}
 				if column.IsPk() {
 					uniqueKeyComparisons = append(uniqueKeyComparisons, comparison)
@@ -124,9 +227,9 @@ func BuildDMLDeleteQuery(databaseName, tableName string, tableColumns *common.Co
 				}
 			} else {
 				arg := column.ConvertArg(args[i])
-				comparison, err := BuildValueComparison(column.EscapedName, "?", EqualsComparisonSign)
+				comparison, err := BuildValueComparison(column.EscapedName, "?", keyComparisonSign(column))
 				if err != nil {
-					return result, columnArgs, hasUK, err
+					return nil, nil, false, err
 				}
 				if column.IsPk() {
 					uniqueKeyArgs = append(uniqueKeyArgs, arg)
@@ -143,19 +246,53 @@ func BuildDMLDeleteQuery(databaseName, tableName string, tableColumns *common.Co
 		comparisons = uniqueKeyComparisons
 		columnArgs = uniqueKeyArgs
 	}
+	return comparisons, columnArgs, hasUK, nil
+}
 
-	if hasUK && stmt != nil {
-		result = ""
-	} else {
-		databaseName = umconf.EscapeName(databaseName)
-		tableName = umconf.EscapeName(tableName)
-		result = fmt.Sprintf(`delete from %s.%s where
-%s limit 1`, databaseName, tableName,
-			fmt.Sprintf("(%s)", strings.Join(comparisons, " and ")),
-		)
+// BulkDeleteKeyIndex returns the index in a row of the single-column primary key,
+// or -1 if rows of the table cannot be deleted in bulk (composite, binary, nullable or no primary key).
+func BulkDeleteKeyIndex(tableColumns *common.ColumnList, columnMapTo []string, nArgs int) int {
+	keyIndex := -1
+	for i := 0; i < nArgs; i++ {
+		column := getColumnWithMapTo(i, columnMapTo, tableColumns)
+		if column == nil || !column.IsPk() {
+			continue
+		}
+		if keyIndex != -1 || column.Type == umconf.BinaryColumnType || column.Nullable {
+			return -1
+		}
+		keyIndex = i
 	}
-	// hasUK: true: use saved PS to execute; false: execute a new query.
-	return result, columnArgs, hasUK, nil
+	return keyIndex
+}
+
+// BuildDMLBulkDeleteQuery builds a `delete ... where key in (...)` for the rows.
+// keyIndex should be got from BulkDeleteKeyIndex.
+func BuildDMLBulkDeleteQuery(databaseName, tableName string, tableColumns *common.ColumnList, columnMapTo []string,
+	keyIndex int, rows [][]interface{}) (result string, args []interface{}, err error) {
+
+	if len(rows) == 0 {
+		return "", nil, fmt.Errorf("BuildDMLBulkDeleteQuery: rows is empty %v.%v", databaseName, tableName)
+	}
+	column := getColumnWithMapTo(keyIndex, columnMapTo, tableColumns)
+	if column == nil {
+		return "", nil, fmt.Errorf("BuildDMLBulkDeleteQuery: unable to find key column %v %v.%v",
+			keyIndex, databaseName, tableName)
+	}
+
+	placeholders := make([]string, len(rows))
+	for i, row := range rows {
+		if keyIndex >= len(row) || row[keyIndex] == nil {
+			return "", nil, fmt.Errorf("BuildDMLBulkDeleteQuery: bad key value in row %v %v.%v",
+				i, databaseName, tableName)
+		}
+		args = append(args, column.ConvertArg(row[keyIndex]))
+		placeholders[i] = "?"
+	}
+	result = fmt.Sprintf("delete from %s.%s where %s in (%s)",
+		umconf.EscapeName(databaseName), umconf.EscapeName(tableName), column.EscapedName,
+		strings.Join(placeholders, ","))
+	return result, args, nil
 }
 
 func BuildDMLInsertQuery(databaseName, tableName string, tableColumns *common.ColumnList, columnMapTo []string,
@@ -228,6 +365,26 @@ func BuildDMLInsertQuery(databaseName, tableName string, tableColumns *common.Co
 	return result, sharedArgs, nil
 }
 
+// HasZeroAutoIncrement tells whether any of the rows has 0 for an AUTO_INCREMENT column.
+// Such a value is kept only with sql_mode NO_AUTO_VALUE_ON_ZERO. Otherwise the next value is generated.
+func HasZeroAutoIncrement(tableColumns *common.ColumnList, columnMapTo []string, rows [][]interface{}) bool {
+	for _, row := range rows {
+		for i := range row {
+			column := getColumnWithMapTo(i, columnMapTo, tableColumns)
+			if column == nil || !column.AutoIncrement {
+				continue
+			}
+			switch v := row[i].(type) {
+			case int8, int16, int32, int64, int, uint8, uint16, uint32, uint64, uint:
+				if fmt.Sprint(v) == "0" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 func getColumnWithMapTo(columnIndex int, columnMapTo []string, tableColumns *common.ColumnList) *umconf.Column {
 	if len(columnMapTo) > 0 {
 		return tableColumns.GetColumn(columnMapTo[columnIndex])
@@ -237,6 +394,32 @@ func getColumnWithMapTo(columnIndex int, columnMapTo []string, tableColumns *com
 	return nil
 }
 
+// buildJSONDiffsValue returns the expression applying the diffs of a partial JSON update to the column.
+func buildJSONDiffsValue(column string, diffs []common.JSONDiff) (value string, args []interface{}, err error) {
+	value = column
+	for _, diff := range diffs {
+		switch diff.Op {
+		case common.JSONDiffReplace:
+			value = fmt.Sprintf("json_replace(%s, ?, cast(? as json))", value)
+			args = append(args, diff.Path, diff.Value)
+		case common.JSONDiffInsert:
+			if strings.HasSuffix(diff.Path, "]") {
+				// an array element. the following elements are shifted.
+				value = fmt.Sprintf("json_array_insert(%s, ?, cast(? as json))", value)
+			} else {
+				value = fmt.Sprintf("json_set(%s, ?, cast(? as json))", value)
+			}
+			args = append(args, diff.Path, diff.Value)
+		case common.JSONDiffRemove:
+			value = fmt.Sprintf("json_remove(%s, ?)", value)
+			args = append(args, diff.Path)
+		default:
+			return "", nil, fmt.Errorf("unknown JSON diff operation %v", diff.Op)
+		}
+	}
+	return value, args, nil
+}
+
 func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns *common.ColumnList, columnMapTo []string, valueArgs, whereArgs []interface{}, stmt *gosql.Stmt) (result string, sharedArgs, columnArgs []interface{}, hasUK bool, err error) {
 	//if len(valueArgs) < tableColumns.Len() {
 	//	return result, sharedArgs, columnArgs, hasUK, fmt.Errorf("value args count differs from table column count in BuildDMLUpdateQuery %v, %v",
@@ -258,10 +441,14 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns *common.Co
 	for i := range whereArgs {
 		column := getColumnWithMapTo(i, columnMapTo, tableColumns)
 
-		if valueArgs[i] == nil || valueArgs[i] == "NULL" ||
-			fmt.Sprintf("%v", valueArgs[i]) == "" {
+		diffs, isDiffs := valueArgs[i].([]common.JSONDiff)
+		switch {
+		case isDiffs:
+			// args are added with the set token
+		case valueArgs[i] == nil || valueArgs[i] == "NULL" ||
+			fmt.Sprintf("%v", valueArgs[i]) == "":
 			sharedArgs = append(sharedArgs, valueArgs[i])
-		} else {
+		default:
 			arg := column.ConvertArg(valueArgs[i])
 			sharedArgs = append(sharedArgs, arg)
 		}
@@ -272,7 +459,15 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns *common.Co
 			continue
 		}
 
-		if whereArgs[i] == nil {
+		if whereArgs[i] == nil && column.IsPk() {
+			// keep the key comparison so the row is still located by the key
+			comparison, err := BuildValueComparison(column.EscapedName, "?", NullSafeEqualsComparisonSign)
+			if err != nil {
+				return result, sharedArgs, columnArgs, hasUK, err
+			}
+			uniqueKeyArgs = append(uniqueKeyArgs, nil)
+			uniqueKeyComparisons = append(uniqueKeyComparisons, comparison)
+		} else if whereArgs[i] == nil {
 			comparison, err := BuildValueComparison(column.EscapedName, "NULL", IsEqualsComparisonSign)
 			if err != nil {
 				return result, sharedArgs, columnArgs, hasUK, err
@@ -281,7 +476,7 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns *common.Co
 		} else {
 			if column.Type == umconf.BinaryColumnType {
 				arg := column.ConvertArg(whereArgs[i])
-				comparison, err := BuildValueComparison(column.EscapedName, fmt.Sprintf("cast('%v' as %s)", arg, column.ColumnType), EqualsComparisonSign)
+				comparison, err := BuildValueComparison(column.EscapedName, fmt.Sprintf("cast('%v' as %s)", arg, column.ColumnType), keyComparisonSign(column))
 				if err != nil {
 					return result, sharedArgs, columnArgs, hasUK, err
 				}
@@ -292,7 +487,7 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns *common.Co
 				}
 			} else {
 				arg := column.ConvertArg(whereArgs[i])
-				comparison, err := BuildValueComparison(column.EscapedName, "?", EqualsComparisonSign)
+				comparison, err := BuildValueComparison(column.EscapedName, "?", keyComparisonSign(column))
 				if err != nil {
 					return result, sharedArgs, columnArgs, hasUK, err
 				}
@@ -307,7 +502,14 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns *common.Co
 		}
 
 		var setToken string
-		if column.TimezoneConversion != nil {
+		if isDiffs {
+			value, diffArgs, err := buildJSONDiffsValue(column.EscapedName, diffs)
+			if err != nil {
+				return result, sharedArgs, columnArgs, hasUK, err
+			}
+			setToken = fmt.Sprintf("%s=%s", column.EscapedName, value)
+			sharedArgs = append(sharedArgs, diffArgs...)
+		} else if column.TimezoneConversion != nil {
 			setToken = fmt.Sprintf("%s=convert_tz(?, '%s', '%s')", column.EscapedName, column.TimezoneConversion.ToTimezone, "+00:00")
 		} else {
 			setToken = fmt.Sprintf("%s=?", column.EscapedName)
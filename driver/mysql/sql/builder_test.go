@@ -921,3 +921,46 @@ func TestBuildDMLUpdateQuerySignedUnsigned(t *testing.T) {
 		test.S(t).ExpectTrue(reflect.DeepEqual(uniqueKeyArgs, []interface{}{uint8(253)}))
 	}
 }
+
+func TestBuildDMLQueryNullableKey(t *testing.T) {
+	// a unique key with a nullable column, allowed by SkipInvalidTables
+	tableColumns := common.NewColumnList([]mysqlconfig.Column{
+		{RawName: "id", EscapedName: "id", Key: "PRI"},
+		{RawName: "code", EscapedName: "code", Key: "PRI", Nullable: true},
+		{RawName: "name", EscapedName: "name", Nullable: true},
+	})
+	row := []interface{}{3, nil, "x"}
+	{
+		query, uniqueKeyArgs, hasUK, err := BuildDMLDeleteQuery("mydb", "tbl", tableColumns, []string{}, row, nil)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(hasUK)
+		expected := `
+			delete from
+				mydb.tbl
+				where
+					((id = ?) and (code <=> ?))
+				limit 1
+		`
+		test.S(t).ExpectEquals(normalizeQuery(query), normalizeQuery(expected))
+		test.S(t).ExpectTrue(reflect.DeepEqual(uniqueKeyArgs, []interface{}{3, nil}))
+	}
+	{
+		valueArgs := []interface{}{3, nil, "y"}
+		query, _, uniqueKeyArgs, hasUK, err := BuildDMLUpdateQuery("mydb", "tbl", tableColumns, []string{}, valueArgs, row, nil)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(hasUK)
+		expected := `
+			update mydb.tbl
+				set id=?, code=?, name=?
+				where
+					((id = ?) and (code <=> ?))
+				limit 1
+		`
+		test.S(t).ExpectEquals(normalizeQuery(query), normalizeQuery(expected))
+		test.S(t).ExpectTrue(reflect.DeepEqual(uniqueKeyArgs, []interface{}{3, nil}))
+	}
+	// NULL never matches `in (...)`
+	test.S(t).ExpectEquals(BulkDeleteKeyIndex(common.NewColumnList([]mysqlconfig.Column{
+		{RawName: "code", EscapedName: "code", Key: "PRI", Nullable: true},
+	}), []string{}, 1), -1)
+}
@@ -7,7 +7,12 @@
 package sql
 
 import (
+	"database/sql/driver"
+	"net"
+	"strings"
+
 	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
 )
 
 // Schema error codes.
@@ -925,3 +930,65 @@ func IgnoreExistsError(err error) bool {
 		return false
 	}
 }
+
+// IsNoSuchTableError returns true if the error is caused by a non-existing table.
+func IsNoSuchTableError(err error) bool {
+	mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError)
+	return ok && mysqlErr.Number == ErrNoSuchTable
+}
+
+// IsPacketTooLargeError returns true if a statement exceeds max_allowed_packet of the server or the client.
+func IsPacketTooLargeError(err error) bool {
+	err = errors.Cause(err)
+	if err == mysql.ErrPktTooLarge {
+		return true
+	}
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	return ok && mysqlErr.Number == ErrNetPacketTooLarge
+}
+
+// IsLockWaitTimeoutError returns true if the error is caused by innodb_lock_wait_timeout.
+func IsLockWaitTimeoutError(err error) bool {
+	mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError)
+	return ok && mysqlErr.Number == ErrLockWaitTimeout
+}
+
+// IsReadOnlyError returns true if the error is caused by writing to a read-only server.
+func IsReadOnlyError(err error) bool {
+	mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError)
+	if !ok {
+		return false
+	}
+
+	switch mysqlErr.Number {
+	case ErrReadOnlyMode:
+		return true
+	case ErrOptionPreventsStatement:
+		return strings.Contains(mysqlErr.Message, "read-only")
+	default:
+		return false
+	}
+}
+
+// IsTransientError returns true if the error might disappear on retrying,
+// e.g. lost connections, deadlocks and lock wait timeouts.
+func IsTransientError(err error) bool {
+	err = errors.Cause(err)
+	if err == driver.ErrBadConn || err == mysql.ErrInvalidConn {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	if !ok {
+		return false
+	}
+
+	switch mysqlErr.Number {
+	case ErrConCount, ErrLockWaitTimeout, ErrLockDeadlock:
+		return true
+	default:
+		return false
+	}
+}
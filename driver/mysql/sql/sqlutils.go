@@ -9,6 +9,7 @@ package sql
 import (
 	"context"
 	gosql "database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -22,7 +23,7 @@ import (
 	"github.com/actiontech/dtle/driver/mysql/mysqlconfig"
 
 	"github.com/actiontech/dtle/g"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 const (
@@ -110,6 +111,11 @@ func (this *RowMap) GetUint(key string) uint {
 	return uint(res)
 }
 
+func (this *RowMap) GetUint64(key string) uint64 {
+	res, _ := strconv.ParseUint(this.GetString(key), 10, 64)
+	return res
+}
+
 func (this *RowMap) GetUintD(key string, def uint) uint {
 	res, err := strconv.Atoi(this.GetString(key))
 	if err != nil {
@@ -135,6 +141,25 @@ func (c *Conn) SetGtidNextAutomatic(ctx context.Context) (err error) {
 	return err
 }
 
+// ParseIsolationLevel accepts both "READ COMMITTED" and "READ-COMMITTED" forms (case-insensitive).
+// An empty string means the server default.
+func ParseIsolationLevel(level string) (gosql.IsolationLevel, error) {
+	switch strings.ToUpper(strings.NewReplacer("-", " ", "_", " ").Replace(strings.TrimSpace(level))) {
+	case "":
+		return gosql.LevelDefault, nil
+	case "READ UNCOMMITTED":
+		return gosql.LevelReadUncommitted, nil
+	case "READ COMMITTED":
+		return gosql.LevelReadCommitted, nil
+	case "REPEATABLE READ":
+		return gosql.LevelRepeatableRead, nil
+	case "SERIALIZABLE":
+		return gosql.LevelSerializable, nil
+	default:
+		return gosql.LevelDefault, fmt.Errorf("unsupported transaction isolation level %v", level)
+	}
+}
+
 func CreateDB(mysql_uri string) (*gosql.DB, error) {
 	db, err := gosql.Open("mysql", mysql_uri)
 	if err != nil {
@@ -145,7 +170,100 @@ func CreateDB(mysql_uri string) (*gosql.DB, error) {
 	return db, nil
 }
 
-func CreateConns(ctx context.Context, db *gosql.DB, count int) ([]*Conn, error) {
+// authConnector builds the dsn on each new connection, so that a refreshed password is used.
+type authConnector struct {
+	config      *mysqlconfig.ConnectionConfig
+	extraParams string
+}
+
+func (c *authConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	uri, err := c.config.GetDBUriWithAuth()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetDBUriWithAuth")
+	}
+	if c.extraParams != "" {
+		uri = uri + "&" + c.extraParams
+	}
+	connector, err := mysql.MySQLDriver{}.OpenConnector(uri)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (c *authConnector) Driver() driver.Driver {
+	return mysql.MySQLDriver{}
+}
+
+// primaryConnector rejects connections to a read-only server, e.g. a replica
+// behind a read/write splitting layer. It is checked on every new connection.
+type primaryConnector struct {
+	driver.Connector
+}
+
+func (c *primaryConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckPrimary(ctx, conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// CheckPrimary returns an error if the server of the connection is read-only.
+func CheckPrimary(ctx context.Context, conn driver.Conn) error {
+	queryer, ok := conn.(driver.QueryerContext)
+	if !ok {
+		return fmt.Errorf("CheckPrimary: connection does not support query")
+	}
+	rows, err := queryer.QueryContext(ctx, "select @@read_only", nil)
+	if err != nil {
+		return errors.Wrap(err, "CheckPrimary")
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err != nil {
+		return errors.Wrap(err, "CheckPrimary")
+	}
+	var readOnly string
+	switch v := dest[0].(type) {
+	case []byte:
+		readOnly = string(v)
+	default:
+		readOnly = fmt.Sprintf("%v", v)
+	}
+	if readOnly != "0" {
+		return fmt.Errorf("the server is read-only (@@read_only = %v). it might be a replica", readOnly)
+	}
+	return nil
+}
+
+// CreateDBWithConfig is like CreateDB. If config.AuthProvider is set, the password is got
+// from it every time a connection is established. extraParams is appended to the dsn.
+// If config.RequirePrimary is set, connections to a read-only server are rejected.
+func CreateDBWithConfig(config *mysqlconfig.ConnectionConfig, extraParams string) (*gosql.DB, error) {
+	if config.AuthProvider == nil && !config.RequirePrimary {
+		uri := config.GetDBUri()
+		if extraParams != "" {
+			uri = uri + "&" + extraParams
+		}
+		return CreateDB(uri)
+	}
+	var connector driver.Connector = &authConnector{config: config, extraParams: extraParams}
+	if config.RequirePrimary {
+		connector = &primaryConnector{connector}
+	}
+	db := gosql.OpenDB(connector)
+	db.SetConnMaxLifetime(ConnMaxLifetime)
+	return db, nil
+}
+
+// CreateConns gets count connections from db. foreign_key_checks is disabled on them unless keepFKChecks.
+func CreateConns(ctx context.Context, db *gosql.DB, count int, keepFKChecks bool) ([]*Conn, error) {
 	conns := make([]*Conn, count)
 	for i := 0; i < count; i++ {
 		conn, err := db.Conn(ctx)
@@ -153,9 +271,11 @@ func CreateConns(ctx context.Context, db *gosql.DB, count int) ([]*Conn, error)
 			return nil, err
 		}
 
-		_, err = conn.ExecContext(ctx, "SET @@session.foreign_key_checks = 0")
-		if err != nil {
-			return nil, err
+		if !keepFKChecks {
+			_, err = conn.ExecContext(ctx, "SET @@session.foreign_key_checks = 0")
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		conns[i] = &Conn{
@@ -291,7 +411,8 @@ func QueryResultData(db *gosql.DB, query string, args ...interface{}) (ResultDat
 //INSERT INTO {{ .Name }} VALUES {{ .Values }};
 //UNLOCK TABLES;
 
-func ShowDatabases(db *gosql.DB) ([]string, error) {
+// ShowDatabases lists schemas. System schemas are excluded unless includeSystem is set.
+func ShowDatabases(db *gosql.DB, includeSystem bool) ([]string, error) {
 	dbs := make([]string, 0)
 
 	// Get table list
@@ -307,16 +428,41 @@ func ShowDatabases(db *gosql.DB) ([]string, error) {
 		if err := rows.Scan(&database); err != nil {
 			return dbs, err
 		}
-		switch strings.ToLower(database.String) {
-		case "sys", "mysql", "information_schema", "performance_schema", g.DtleSchemaName:
+		if !includeSystem && IsSystemSchema(database.String) {
 			continue
-		default:
-			dbs = append(dbs, database.String)
 		}
+		dbs = append(dbs, database.String)
 	}
 	return dbs, rows.Err()
 }
 
+// IsSystemSchema returns true for schemas of MySQL and dtle, which are never replicated.
+func IsSystemSchema(schema string) bool {
+	switch strings.ToLower(schema) {
+	case "sys", "mysql", "information_schema", "performance_schema", g.DtleSchemaName:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsTemporaryTable returns true for intermediate tables of ALTER TABLE (#sql-*) and
+// shadow tables of gh-ost (_t_gho, _t_ghc, _t_del) and pt-online-schema-change (_t_new, _t_old).
+func IsTemporaryTable(table string) bool {
+	if strings.HasPrefix(table, "#sql") {
+		return true
+	}
+	if !strings.HasPrefix(table, "_") {
+		return false
+	}
+	for _, suffix := range []string{"_gho", "_ghc", "_del", "_new", "_old"} {
+		if strings.HasSuffix(table, suffix) && len(table) > len(suffix)+1 {
+			return true
+		}
+	}
+	return false
+}
+
 func ShowCreateSchema(ctx context.Context, db *gosql.DB, dbName string) (r string, err error) {
 	query := fmt.Sprintf("SHOW CREATE SCHEMA IF NOT EXISTS %s", mysqlconfig.EscapeName(dbName))
 	g.Logger.Debug("ShowCreateSchema", "query", query)
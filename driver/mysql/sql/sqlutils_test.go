@@ -0,0 +1,70 @@
+package sql
+
+import (
+	"context"
+	gosql "database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+type testConnector struct {
+	drv driver.Driver
+	dsn string
+}
+
+func (c *testConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.drv.Open(c.dsn)
+}
+
+func (c *testConnector) Driver() driver.Driver {
+	return c.drv
+}
+
+func TestPrimaryConnector(t *testing.T) {
+	tests := []struct {
+		name     string
+		readOnly int
+		wantErr  bool
+	}{
+		{"primary", 0, false},
+		{"read-only replica", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.NewWithDSN("TestPrimaryConnector_" + tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+
+			mock.ExpectQuery("select @@read_only").
+				WillReturnRows(sqlmock.NewRows([]string{"@@read_only"}).AddRow(tt.readOnly))
+			if !tt.wantErr {
+				mock.ExpectExec("SET @@session.foreign_key_checks = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+
+			db := gosql.OpenDB(&primaryConnector{&testConnector{
+				drv: mockDB.Driver(),
+				dsn: "TestPrimaryConnector_" + tt.name,
+			}})
+			conns, err := CreateConns(context.Background(), db, 1, false)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expect the read-only connection to be rejected")
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(conns) != 1 {
+					t.Errorf("got %v conns, expect 1", len(conns))
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -1,7 +1,12 @@
 package inspector
 
 import (
+	"fmt"
+	"strings"
+	"sync"
+
 	"github.com/pingcap/tidb/parser/ast"
+	"github.com/pingcap/tidb/parser/format"
 	"github.com/pingcap/tidb/parser/model"
 )
 
@@ -35,6 +40,9 @@ type Context struct {
 	schemas map[string]*SchemaInfo
 	// if schemas info has collected, set true
 	schemaHasLoad bool
+
+	// held by the owner around updates, so that DumpSchemaCache can be called from another goroutine.
+	mu sync.RWMutex
 }
 
 func NewContext(parent *Context) *Context {
@@ -284,3 +292,43 @@ func (c *Context) getTableInfo(stmt *ast.TableName) (*TableInfo, bool) {
 	table := stmt.Name.String()
 	return c.GetTable(schema, table)
 }
+
+// Lock is held by the owner of the context around updating it.
+func (c *Context) Lock() {
+	c.mu.Lock()
+}
+
+func (c *Context) Unlock() {
+	c.mu.Unlock()
+}
+
+// DumpSchemaCache renders the cached CREATE TABLE of each table, keyed by "schema.table", for debugging.
+// The table merged with later ALTERs is rendered if there is one. It is safe to call while the owner
+// updates the context under Lock.
+func (c *Context) DumpSchemaCache() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r := make(map[string]string)
+	for schemaName, schema := range c.schemas {
+		if schema == nil {
+			continue
+		}
+		for tableName, info := range schema.Tables {
+			stmt := info.MergedTable
+			if stmt == nil {
+				stmt = info.OriginalTable
+			}
+			if stmt == nil {
+				continue
+			}
+			var sb strings.Builder
+			err := stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb))
+			if err != nil {
+				r[schemaName+"."+tableName] = fmt.Sprintf("/* cannot render: %v */", err)
+				continue
+			}
+			r[schemaName+"."+tableName] = sb.String()
+		}
+	}
+	return r
+}
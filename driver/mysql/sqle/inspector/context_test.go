@@ -0,0 +1,72 @@
+package inspector
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestContextDumpSchemaCache(t *testing.T) {
+	ctx := NewContext(nil)
+	ctx.LoadSchemas(nil)
+	ctx.AddSchema("db1")
+	ctx.LoadTables("db1", nil)
+	ctx.UseSchema("db1")
+	for _, sql := range []string{
+		"CREATE TABLE `t1` (`id` INT PRIMARY KEY, `c1` VARCHAR(10))",
+		"ALTER TABLE `t1` ADD COLUMN `c2` BIGINT, DROP COLUMN `c1`",
+		"CREATE TABLE `t2` (`id` INT)",
+	} {
+		stmt, err := parseOneSql("mysql", sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx.UpdateContext(stmt, "mysql")
+	}
+
+	cache := ctx.DumpSchemaCache()
+	if len(cache) != 2 {
+		t.Fatalf("expect 2 tables, got %v", cache)
+	}
+	t1 := cache["db1.t1"]
+	if !strings.Contains(t1, "`c2` BIGINT") || strings.Contains(t1, "`c1`") {
+		t.Errorf("expect db1.t1 merged with the ALTER, got %v", t1)
+	}
+	if !strings.Contains(cache["db1.t2"], "CREATE TABLE `t2`") {
+		t.Errorf("unexpected db1.t2 %v", cache["db1.t2"])
+	}
+}
+
+func TestContextDumpSchemaCacheWhileUpdating(t *testing.T) {
+	ctx := NewContext(nil)
+	ctx.LoadSchemas(nil)
+	ctx.AddSchema("db1")
+	ctx.LoadTables("db1", nil)
+	ctx.UseSchema("db1")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			stmt, err := parseOneSql("mysql", fmt.Sprintf("CREATE TABLE `t%v` (`id` INT)", i))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ctx.Lock()
+			ctx.UpdateContext(stmt, "mysql")
+			ctx.Unlock()
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		ctx.DumpSchemaCache()
+	}
+	if cache := ctx.DumpSchemaCache(); len(cache) != 100 {
+		t.Errorf("expect 100 tables, got %v", len(cache))
+	}
+}
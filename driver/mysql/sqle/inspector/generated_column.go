@@ -0,0 +1,130 @@
+package inspector
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pingcap/tidb/parser/ast"
+)
+
+// generatedColumnMinVersion is the first MySQL version with generated columns.
+const generatedColumnMinVersion = 50706
+
+// functionMinVersions is the first MySQL version (in digits, e.g. 80004 for 8.0.4) with each function.
+// Functions not listed are taken as available in all versions with generated columns.
+var functionMinVersions = map[string]int{
+	"json_array":          50708,
+	"json_array_append":   50708,
+	"json_array_insert":   50708,
+	"json_contains":       50708,
+	"json_contains_path":  50708,
+	"json_depth":          50708,
+	"json_extract":        50708,
+	"json_insert":         50708,
+	"json_keys":           50708,
+	"json_length":         50708,
+	"json_merge":          50708,
+	"json_object":         50708,
+	"json_quote":          50708,
+	"json_remove":         50708,
+	"json_replace":        50708,
+	"json_search":         50708,
+	"json_set":            50708,
+	"json_type":           50708,
+	"json_unquote":        50708,
+	"json_valid":          50708,
+	"json_merge_patch":    50722,
+	"json_merge_preserve": 50722,
+	"json_pretty":         50722,
+	"json_storage_size":   50722,
+
+	"bin_to_uuid":                   80000,
+	"is_uuid":                       80000,
+	"uuid_to_bin":                   80000,
+	"json_storage_free":             80002,
+	"icu_version":                   80004,
+	"regexp_instr":                  80004,
+	"regexp_like":                   80004,
+	"regexp_replace":                80004,
+	"regexp_substr":                 80004,
+	"statement_digest":              80004,
+	"statement_digest_text":         80004,
+	"json_overlaps":                 80017,
+	"json_schema_valid":             80017,
+	"json_schema_validation_report": 80017,
+	"json_value":                    80021,
+}
+
+// CheckGeneratedColumnFunctions returns a message for each generated column in a CREATE TABLE or
+// ALTER TABLE statement which cannot be created on a target of `targetVersion` (in digits, see
+// common.MysqlVersionInDigit), for the column itself or a function of its expression.
+// Other statements are ignored.
+func CheckGeneratedColumnFunctions(dbType string, sql string, targetVersion int) ([]string, error) {
+	stmt, err := parseOneSql(dbType, sql)
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []*ast.ColumnDef
+	switch s := stmt.(type) {
+	case *ast.CreateTableStmt:
+		columns = s.Cols
+	case *ast.AlterTableStmt:
+		for _, spec := range s.Specs {
+			switch spec.Tp {
+			case ast.AlterTableAddColumns, ast.AlterTableModifyColumn, ast.AlterTableChangeColumn:
+				columns = append(columns, spec.NewColumns...)
+			}
+		}
+	default:
+		return nil, nil
+	}
+
+	var r []string
+	for _, col := range columns {
+		for _, option := range col.Options {
+			if option.Tp != ast.ColumnOptionGenerated || option.Expr == nil {
+				continue
+			}
+			if targetVersion < generatedColumnMinVersion {
+				r = append(r, fmt.Sprintf("column %v: generated columns need MySQL %v",
+					col.Name.Name.O, versionString(generatedColumnMinVersion)))
+				continue
+			}
+			collector := &funcCollector{names: map[string]struct{}{}}
+			option.Expr.Accept(collector)
+			var names []string
+			for name := range collector.names {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if minVersion, ok := functionMinVersions[name]; ok && targetVersion < minVersion {
+					r = append(r, fmt.Sprintf("column %v: function %v needs MySQL %v",
+						col.Name.Name.O, name, versionString(minVersion)))
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+// funcCollector collects lowercase names of functions called in an expression.
+type funcCollector struct {
+	names map[string]struct{}
+}
+
+func (v *funcCollector) Enter(in ast.Node) (ast.Node, bool) {
+	if f, ok := in.(*ast.FuncCallExpr); ok {
+		v.names[f.FnName.L] = struct{}{}
+	}
+	return in, false
+}
+
+func (v *funcCollector) Leave(in ast.Node) (ast.Node, bool) {
+	return in, true
+}
+
+func versionString(digit int) string {
+	return fmt.Sprintf("%v.%v.%v", digit/10000, digit/100%100, digit%100)
+}
@@ -0,0 +1,64 @@
+package inspector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckGeneratedColumnFunctions(t *testing.T) {
+	tests := []struct {
+		name          string
+		sql           string
+		targetVersion int
+		want          []string
+	}{
+		{
+			name: "8.0 function on 5.7",
+			sql: "CREATE TABLE `t1` (`id` INT, `s` VARCHAR(32), " +
+				"`m` TINYINT AS (REGEXP_LIKE(`s`, '^a')) VIRTUAL, `j` JSON, " +
+				"`k` INT AS (JSON_LENGTH(`j`)) STORED)",
+			targetVersion: 50730,
+			want:          []string{"column m: function regexp_like needs MySQL 8.0.4"},
+		},
+		{
+			name: "8.0 function on 8.0",
+			sql: "CREATE TABLE `t1` (`s` VARCHAR(32), " +
+				"`m` TINYINT AS (REGEXP_LIKE(`s`, '^a')) VIRTUAL)",
+			targetVersion: 80023,
+		},
+		{
+			name: "nested function in alter",
+			sql: "ALTER TABLE `t1` ADD COLUMN `u` BINARY(16) " +
+				"AS (UUID_TO_BIN(CONCAT(`a`, `b`))) STORED",
+			targetVersion: 50730,
+			want:          []string{"column u: function uuid_to_bin needs MySQL 8.0.0"},
+		},
+		{
+			name:          "generated column on 5.6",
+			sql:           "CREATE TABLE `t1` (`a` INT, `b` INT AS (`a` + 1))",
+			targetVersion: 50650,
+			want:          []string{"column b: generated columns need MySQL 5.7.6"},
+		},
+		{
+			name:          "not a generated column",
+			sql:           "CREATE TABLE `t1` (`a` VARCHAR(32) DEFAULT 'x')",
+			targetVersion: 50650,
+		},
+		{
+			name:          "other statements",
+			sql:           "DROP TABLE `t1`",
+			targetVersion: 50650,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CheckGeneratedColumnFunctions("mysql", tt.sql, tt.targetVersion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
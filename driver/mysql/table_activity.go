@@ -0,0 +1,105 @@
+package mysql
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/actiontech/dtle/driver/common"
+)
+
+const (
+	tableActivityBucket     = 10 * time.Second
+	tableActivityBuckets    = 30 // a window of 5 minutes
+	tableActivityMaxTables  = 4096
+	tableActivityTopDefault = 10
+)
+
+// tableActivity counts DML events applied to each table in a sliding window, to find the tables
+// receiving most changes. Only tables of incremental replication are counted, up to
+// tableActivityMaxTables of them.
+type tableActivity struct {
+	mu     sync.Mutex
+	tables map[common.SchemaTable]*tableActivityItem
+}
+
+type tableActivityItem struct {
+	// events of each bucket. starts[i] is the unix time of bucket i.
+	counts    [tableActivityBuckets]int64
+	starts    [tableActivityBuckets]int64
+	total     int64
+	lastEvent time.Time
+}
+
+func newTableActivity() *tableActivity {
+	return &tableActivity{
+		tables: make(map[common.SchemaTable]*tableActivityItem),
+	}
+}
+
+func (t *tableActivity) add(schema, table string, nEvents int64, now time.Time) {
+	st := common.SchemaTable{Schema: schema, Table: table}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	item, ok := t.tables[st]
+	if !ok {
+		if len(t.tables) >= tableActivityMaxTables {
+			return
+		}
+		item = &tableActivityItem{}
+		t.tables[st] = item
+	}
+	start := now.Truncate(tableActivityBucket).Unix()
+	i := (start / int64(tableActivityBucket/time.Second)) % tableActivityBuckets
+	if item.starts[i] != start {
+		item.starts[i] = start
+		item.counts[i] = 0
+	}
+	item.counts[i] += nEvents
+	item.total += nEvents
+	if now.After(item.lastEvent) {
+		item.lastEvent = now
+	}
+}
+
+// top returns at most n tables with most events in the window, the most active first.
+func (t *tableActivity) top(n int, now time.Time) []common.TableActivity {
+	windowStart := now.Add(-tableActivityBucket * tableActivityBuckets).Unix()
+
+	t.mu.Lock()
+	r := make([]common.TableActivity, 0, len(t.tables))
+	for st, item := range t.tables {
+		recent := int64(0)
+		for i := range item.counts {
+			if item.starts[i] > windowStart {
+				recent += item.counts[i]
+			}
+		}
+		if recent == 0 {
+			continue
+		}
+		r = append(r, common.TableActivity{
+			Schema:        st.Schema,
+			Table:         st.Table,
+			RecentEvents:  recent,
+			TotalEvents:   item.total,
+			LastEventTime: item.lastEvent.Unix(),
+		})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].RecentEvents != r[j].RecentEvents {
+			return r[i].RecentEvents > r[j].RecentEvents
+		}
+		if r[i].Schema != r[j].Schema {
+			return r[i].Schema < r[j].Schema
+		}
+		return r[i].Table < r[j].Table
+	})
+	if len(r) > n {
+		r = r[:n]
+	}
+	return r
+}
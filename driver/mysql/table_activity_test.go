@@ -0,0 +1,51 @@
+package mysql
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTableActivity(t *testing.T) {
+	ta := newTableActivity()
+	now := time.Unix(1700000000, 0)
+
+	// a.t1 was busy long ago, a.t2 receives changes at a lower but recent rate
+	for i := 0; i < 100; i++ {
+		ta.add("a", "t1", 1, now.Add(-20*time.Minute))
+	}
+	for i := 0; i < 60; i++ {
+		ta.add("a", "t2", 1, now.Add(-time.Duration(i)*time.Second))
+	}
+	for i := 0; i < 30; i++ {
+		ta.add("a", "t1", 1, now.Add(-time.Duration(i)*2*time.Second))
+	}
+	ta.add("b", "t3", 1, now.Add(-time.Minute))
+
+	top := ta.top(2, now)
+	if len(top) != 2 {
+		t.Fatalf("got %v, expect 2 tables", top)
+	}
+	if top[0].Table != "t2" || top[0].RecentEvents != 60 {
+		t.Errorf("expect a.t2 with 60 recent events first, got %+v", top[0])
+	}
+	if top[1].Table != "t1" || top[1].RecentEvents != 30 || top[1].TotalEvents != 130 {
+		t.Errorf("expect a.t1 with 30 recent of 130 events second, got %+v", top[1])
+	}
+	if top[0].LastEventTime != now.Unix() {
+		t.Errorf("LastEventTime %v, expect %v", top[0].LastEventTime, now.Unix())
+	}
+
+	// all events leave the window
+	if top := ta.top(10, now.Add(10*time.Minute)); len(top) != 0 {
+		t.Errorf("expect no recent table, got %v", top)
+	}
+
+	// the number of tables is capped
+	for i := 0; i < tableActivityMaxTables+10; i++ {
+		ta.add("c", fmt.Sprintf("t%v", i), 1, now)
+	}
+	if len(ta.tables) != tableActivityMaxTables {
+		t.Errorf("%v tables tracked, expect at most %v", len(ta.tables), tableActivityMaxTables)
+	}
+}
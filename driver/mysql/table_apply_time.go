@@ -0,0 +1,79 @@
+package mysql
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/actiontech/dtle/driver/common"
+)
+
+// tableApplyTime accumulates the time spent applying DML events of each table, to find the tables
+// costing most. Only tables of incremental replication are counted, up to tableActivityMaxTables
+// of them. A big transaction applied with a pipe is only timed up to queueing its statements.
+type tableApplyTime struct {
+	mu     sync.Mutex
+	tables map[common.SchemaTable]*tableApplyTimeItem
+}
+
+type tableApplyTimeItem struct {
+	duration time.Duration
+	rows     int64
+}
+
+func newTableApplyTime() *tableApplyTime {
+	return &tableApplyTime{
+		tables: make(map[common.SchemaTable]*tableApplyTimeItem),
+	}
+}
+
+func (t *tableApplyTime) add(schema, table string, nRows int64, d time.Duration) {
+	st := common.SchemaTable{Schema: schema, Table: table}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	item, ok := t.tables[st]
+	if !ok {
+		if len(t.tables) >= tableActivityMaxTables {
+			return
+		}
+		item = &tableApplyTimeItem{}
+		t.tables[st] = item
+	}
+	item.duration += d
+	item.rows += nRows
+}
+
+// slowest returns at most n tables with the longest total apply time, the slowest first.
+func (t *tableApplyTime) slowest(n int) []common.TableApplyTime {
+	t.mu.Lock()
+	r := make([]common.TableApplyTime, 0, len(t.tables))
+	for st, item := range t.tables {
+		avg := int64(0)
+		if item.rows > 0 {
+			avg = item.duration.Microseconds() / item.rows
+		}
+		r = append(r, common.TableApplyTime{
+			Schema:       st.Schema,
+			Table:        st.Table,
+			ApplyTimeUs:  item.duration.Microseconds(),
+			Rows:         item.rows,
+			AvgRowTimeUs: avg,
+		})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].ApplyTimeUs != r[j].ApplyTimeUs {
+			return r[i].ApplyTimeUs > r[j].ApplyTimeUs
+		}
+		if r[i].Schema != r[j].Schema {
+			return r[i].Schema < r[j].Schema
+		}
+		return r[i].Table < r[j].Table
+	})
+	if len(r) > n {
+		r = r[:n]
+	}
+	return r
+}
@@ -0,0 +1,138 @@
+package mysql
+
+import (
+	gosql "database/sql"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/actiontech/dtle/driver/common"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+)
+
+const (
+	queryTargetThreads = "SHOW GLOBAL STATUS WHERE Variable_name IN ('Threads_running', 'Threads_connected')"
+
+	targetPressureIntervalDefault = time.Second
+)
+
+// targetStatusFn returns Threads_running and Threads_connected of the target.
+type targetStatusFn func() (threadsRunning int64, threadsConnected int64, err error)
+
+func getTargetThreads(db *gosql.DB) targetStatusFn {
+	return func() (threadsRunning int64, threadsConnected int64, err error) {
+		rows, err := db.Query(queryTargetThreads)
+		if err != nil {
+			return 0, 0, errors.Wrap(err, "show global status")
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			var value int64
+			if err := rows.Scan(&name, &value); err != nil {
+				return 0, 0, errors.Wrap(err, "show global status")
+			}
+			switch strings.ToLower(name) {
+			case "threads_running":
+				threadsRunning = value
+			case "threads_connected":
+				threadsConnected = value
+			}
+		}
+		return threadsRunning, threadsConnected, rows.Err()
+	}
+}
+
+// targetPressure polls the thread status of the target and pauses apply while it is above
+// TargetMaxThreadsRunning or TargetMaxThreadsConnected.
+type targetPressure struct {
+	logger       hclog.Logger
+	getStatus    targetStatusFn
+	interval     time.Duration
+	maxRunning   int64
+	maxConnected int64
+
+	// atomic
+	threadsRunning   int64
+	threadsConnected int64
+	throttled        int32
+}
+
+// newTargetPressure returns nil if no threshold is configured.
+func newTargetPressure(logger hclog.Logger, cfg *common.MySQLDriverConfig, getStatus targetStatusFn) *targetPressure {
+	if cfg.TargetMaxThreadsRunning <= 0 && cfg.TargetMaxThreadsConnected <= 0 {
+		return nil
+	}
+	interval := time.Duration(cfg.TargetStatusIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = targetPressureIntervalDefault
+	}
+	return &targetPressure{
+		logger:       logger,
+		getStatus:    getStatus,
+		interval:     interval,
+		maxRunning:   cfg.TargetMaxThreadsRunning,
+		maxConnected: cfg.TargetMaxThreadsConnected,
+	}
+}
+
+func (p *targetPressure) run(shutdownCh chan struct{}) {
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		p.check()
+		select {
+		case <-shutdownCh:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// check gets the status once and updates the throttle state.
+func (p *targetPressure) check() {
+	running, connected, err := p.getStatus()
+	if err != nil {
+		// keep the last state. the status might be unavailable for a while.
+		p.logger.Warn("cannot get thread status of the target", "err", err)
+		return
+	}
+	atomic.StoreInt64(&p.threadsRunning, running)
+	atomic.StoreInt64(&p.threadsConnected, connected)
+
+	over := (p.maxRunning > 0 && running > p.maxRunning) ||
+		(p.maxConnected > 0 && connected > p.maxConnected)
+	if over {
+		if atomic.CompareAndSwapInt32(&p.throttled, 0, 1) {
+			p.logger.Info("the target is under pressure. pausing apply",
+				"Threads_running", running, "Threads_connected", connected)
+		}
+	} else {
+		if atomic.CompareAndSwapInt32(&p.throttled, 1, 0) {
+			p.logger.Info("the target recovered. resuming apply",
+				"Threads_running", running, "Threads_connected", connected)
+		}
+	}
+}
+
+func (p *targetPressure) isThrottled() bool {
+	return p != nil && atomic.LoadInt32(&p.throttled) == 1
+}
+
+// wait blocks while the target is under pressure. It returns false on shutdown.
+func (p *targetPressure) wait(shutdownCh chan struct{}) bool {
+	if !p.isThrottled() {
+		return true
+	}
+	t := time.NewTicker(100 * time.Millisecond)
+	defer t.Stop()
+	for p.isThrottled() {
+		select {
+		case <-shutdownCh:
+			return false
+		case <-t.C:
+		}
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package mysql
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/driver/common"
+	hclog "github.com/hashicorp/go-hclog"
+)
+
+func TestTargetPressure(t *testing.T) {
+	cfg := &common.MySQLDriverConfig{}
+	if p := newTargetPressure(hclog.NewNullLogger(), cfg, nil); p != nil {
+		t.Fatal("expect no monitoring without a threshold")
+	}
+	if (*targetPressure)(nil).isThrottled() {
+		t.Fatal("a nil targetPressure should not throttle")
+	}
+
+	var running, connected int64 = 5, 20
+	var statusErr error
+	cfg.TargetMaxThreadsRunning = 10
+	cfg.TargetMaxThreadsConnected = 100
+	p := newTargetPressure(hclog.NewNullLogger(), cfg, func() (int64, int64, error) {
+		return atomic.LoadInt64(&running), atomic.LoadInt64(&connected), statusErr
+	})
+
+	p.check()
+	if p.isThrottled() {
+		t.Fatal("expect no throttle below the thresholds")
+	}
+
+	atomic.StoreInt64(&running, 11)
+	p.check()
+	if !p.isThrottled() {
+		t.Fatal("expect throttle above TargetMaxThreadsRunning")
+	}
+	if atomic.LoadInt64(&p.threadsRunning) != 11 {
+		t.Errorf("threadsRunning %v, expect 11", p.threadsRunning)
+	}
+
+	// the last state is kept while the status is unavailable
+	statusErr = fmt.Errorf("connection refused")
+	p.check()
+	if !p.isThrottled() {
+		t.Fatal("expect throttle kept on a status error")
+	}
+	statusErr = nil
+
+	shutdownCh := make(chan struct{})
+	waited := make(chan bool, 1)
+	go func() {
+		waited <- p.wait(shutdownCh)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("expect wait to block while throttled")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	atomic.StoreInt64(&running, 3)
+	atomic.StoreInt64(&connected, 101)
+	p.check()
+	if !p.isThrottled() {
+		t.Fatal("expect throttle above TargetMaxThreadsConnected")
+	}
+
+	atomic.StoreInt64(&connected, 50)
+	p.check()
+	if p.isThrottled() {
+		t.Fatal("expect throttle off after recovery")
+	}
+	select {
+	case ok := <-waited:
+		if !ok {
+			t.Fatal("expect wait to return true on recovery")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect wait to return after recovery")
+	}
+
+	// wait returns false on shutdown
+	atomic.StoreInt64(&running, 50)
+	p.check()
+	close(shutdownCh)
+	if p.wait(shutdownCh) {
+		t.Fatal("expect wait to return false on shutdown")
+	}
+}
@@ -0,0 +1,122 @@
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/actiontech/dtle/driver/common"
+	"github.com/actiontech/dtle/driver/mysql/base"
+	"github.com/actiontech/dtle/driver/mysql/sql"
+	"github.com/pkg/errors"
+)
+
+// txTimeoutRetries is the number of attempts to apply an entry of full copy timing out by TxTimeoutMs.
+const txTimeoutRetries = 3
+
+var errTxTimeout = errors.New("transaction exceeded TxTimeoutMs")
+
+func isTxTimeoutError(err error) bool {
+	return errors.Cause(err) == errTxTimeout
+}
+
+// txContext returns the context of applying an entry of full copy in a transaction.
+// It is canceled on shutdown, or after TxTimeoutMs if set.
+func (a *Applier) txContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := a.entryContext()
+	if a.mysqlContext.TxTimeoutMs <= 0 {
+		return ctx, cancel
+	}
+	txCtx, txCancel := context.WithTimeout(ctx, time.Duration(a.mysqlContext.TxTimeoutMs)*time.Millisecond)
+	return txCtx, func() {
+		txCancel()
+		cancel()
+	}
+}
+
+// applyDumpEntry applies the entry with ApplyEventQueries. A transaction exceeding TxTimeoutMs, or
+// rolled back by a lock wait timeout with innodb_rollback_on_timeout=ON, is applied again,
+// up to txTimeoutRetries attempts.
+func (a *Applier) applyDumpEntry(db *gosql.DB, entry *common.DumpEntry) error {
+	if a.mysqlContext.TxTimeoutMs <= 0 && !a.rollbackOnTimeout {
+		return a.ApplyEventQueries(db, entry)
+	}
+	return common.RetryWithBackoff(txTimeoutRetries, errorRetryInterval, errorRetryInterval*4, a.shutdownCh,
+		a.isTxRolledBackError, func() error {
+			err := a.ApplyEventQueries(db, entry)
+			if isTxTimeoutError(err) {
+				a.logger.Warn("transaction aborted by TxTimeoutMs", "err", err, "timeoutMs", a.mysqlContext.TxTimeoutMs)
+			} else if a.isTxRolledBackError(err) {
+				a.logger.Warn("transaction rolled back by a lock wait timeout (innodb_rollback_on_timeout=ON)",
+					"err", err)
+			}
+			return err
+		})
+}
+
+// isTxRolledBackError returns true if the whole transaction of the entry has been rolled back
+// by TxTimeoutMs or a lock wait timeout, thus can be applied again.
+func (a *Applier) isTxRolledBackError(err error) bool {
+	return isTxTimeoutError(err) || (a.rollbackOnTimeout && sql.IsLockWaitTimeoutError(err))
+}
+
+// supportsMaxExecutionTime returns true if the target has the MAX_EXECUTION_TIME optimizer hint.
+func (a *Applier) supportsMaxExecutionTime() bool {
+	return a.targetVersion.Flavor != base.FlavorMariaDB && a.targetVersion.AtLeast(5, 7, 8)
+}
+
+// withMaxExecutionTime adds a MAX_EXECUTION_TIME hint to a SELECT statement. Other statements are unchanged.
+func withMaxExecutionTime(query string, timeout time.Duration) string {
+	trimmed := strings.TrimLeft(query, " \t\r\n")
+	if len(trimmed) < len("select") || !strings.EqualFold(trimmed[:len("select")], "select") {
+		return query
+	}
+	ms := timeout.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	return fmt.Sprintf("%s /*+ MAX_EXECUTION_TIME(%d) */%s", trimmed[:len("select")], ms, trimmed[len("select"):])
+}
+
+// txQuerier runs the statements of a full copy transaction with its context.
+// With maxExecutionTime, SELECTs are limited to the time left before the deadline of the context.
+type txQuerier struct {
+	ctx              context.Context
+	tx               *gosql.Tx
+	maxExecutionTime bool
+}
+
+func (a *Applier) newTxQuerier(ctx context.Context, tx *gosql.Tx) *txQuerier {
+	_, hasDeadline := ctx.Deadline()
+	return &txQuerier{
+		ctx:              ctx,
+		tx:               tx,
+		maxExecutionTime: hasDeadline && a.supportsMaxExecutionTime(),
+	}
+}
+
+func (q *txQuerier) hint(query string) string {
+	if !q.maxExecutionTime {
+		return query
+	}
+	deadline, _ := q.ctx.Deadline()
+	return withMaxExecutionTime(query, time.Until(deadline))
+}
+
+func (q *txQuerier) Exec(query string, args ...interface{}) (gosql.Result, error) {
+	return q.tx.ExecContext(q.ctx, query, args...)
+}
+
+func (q *txQuerier) Prepare(query string) (*gosql.Stmt, error) {
+	return q.tx.PrepareContext(q.ctx, q.hint(query))
+}
+
+func (q *txQuerier) Query(query string, args ...interface{}) (*gosql.Rows, error) {
+	return q.tx.QueryContext(q.ctx, q.hint(query), args...)
+}
+
+func (q *txQuerier) QueryRow(query string, args ...interface{}) *gosql.Row {
+	return q.tx.QueryRowContext(q.ctx, q.hint(query), args...)
+}
@@ -0,0 +1,83 @@
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/actiontech/dtle/driver/common"
+)
+
+func TestApplyDumpEntryTxTimeout(t *testing.T) {
+	a, _ := newTestApplier(t, &common.MySQLDriverConfig{DtleTaskConfig: common.DtleTaskConfig{
+		TxTimeoutMs: 50,
+	}})
+	a.stubFullApplyDelay = 10 * time.Second
+
+	dsn := "TestApplyDumpEntryTxTimeout"
+	db, mock, err := sqlmock.NewWithDSN(dsn, sqlmock.QueryMatcherOption(queryMatcherIgnoreSpace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	a.db = db
+	// the connection of an aborted tx is discarded. hold another one, so the mock can be opened again.
+	keep, err := gosql.Open("sqlmock", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keep.Close()
+	keepConn, err := keep.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keepConn.Close()
+
+	for i := 0; i < txTimeoutRetries; i++ {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+	}
+
+	val := []byte("1")
+	entry := &common.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "t1",
+		ValuesX:     [][]*[]byte{{&val}},
+	}
+	start := time.Now()
+	err = a.applyDumpEntry(a.db, entry)
+	if !isTxTimeoutError(err) {
+		t.Fatalf("expect errTxTimeout. got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= a.stubFullApplyDelay {
+		t.Errorf("the tx is not aborted by TxTimeoutMs. elapsed %v", elapsed)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("the tx is not retried: %v", err)
+	}
+	if n := a.TotalRowsReplayed; n != 0 {
+		t.Errorf("TotalRowsReplayed %v of an aborted tx", n)
+	}
+}
+
+func TestWithMaxExecutionTime(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{"select 1 from `db1`.`t1` limit 1", "select /*+ MAX_EXECUTION_TIME(1500) */ 1 from `db1`.`t1` limit 1"},
+		{"\n  SELECT TABLE_ROWS from information_schema.TABLES", "SELECT /*+ MAX_EXECUTION_TIME(1500) */ TABLE_ROWS from information_schema.TABLES"},
+		{"replace into `db1`.`t1` values ('1')", "replace into `db1`.`t1` values ('1')"},
+		{"sel", "sel"},
+	}
+	for _, c := range cases {
+		if got := withMaxExecutionTime(c.query, 1500*time.Millisecond); got != c.expected {
+			t.Errorf("withMaxExecutionTime(%q) = %q, want %q", c.query, got, c.expected)
+		}
+	}
+	if got := withMaxExecutionTime("select 1", 0); got != "select /*+ MAX_EXECUTION_TIME(1) */ 1" {
+		t.Errorf("expired timeout: %q", got)
+	}
+}
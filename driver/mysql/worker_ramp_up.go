@@ -0,0 +1,71 @@
+package mysql
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// workerRampUp starts MTS workers one by one over WorkerRampUpMs, from 1 to ParallelWorkers,
+// so that a just-recovered target is not flooded by all workers at once.
+type workerRampUp struct {
+	period  time.Duration
+	workers int
+	// UnixNano when workers start. 0 before. atomic.
+	start int64
+}
+
+func newWorkerRampUp(periodMs int, workers int) *workerRampUp {
+	return &workerRampUp{
+		period:  time.Duration(periodMs) * time.Millisecond,
+		workers: workers,
+	}
+}
+
+func (r *workerRampUp) begin(now time.Time) {
+	atomic.StoreInt64(&r.start, now.UnixNano())
+}
+
+// activateAfter returns the duration since begin after which the worker applies entries.
+// Worker 0 is active at once and the last worker at the end of the period.
+func (r *workerRampUp) activateAfter(workerIndex int) time.Duration {
+	if r.period <= 0 || r.workers <= 1 || workerIndex <= 0 {
+		return 0
+	}
+	return r.period * time.Duration(workerIndex) / time.Duration(r.workers-1)
+}
+
+// effectiveWorkers returns the number of workers applying entries at the time. 0 before begin.
+func (r *workerRampUp) effectiveWorkers(now time.Time) int {
+	if r == nil {
+		return 0
+	}
+	start := atomic.LoadInt64(&r.start)
+	if start == 0 {
+		return 0
+	}
+	elapsed := now.Sub(time.Unix(0, start))
+	n := 0
+	for i := 0; i < r.workers; i++ {
+		if r.activateAfter(i) <= elapsed {
+			n += 1
+		}
+	}
+	return n
+}
+
+// wait blocks until the worker is active. Returns false on shutdown.
+func (r *workerRampUp) wait(workerIndex int, shutdownCh chan struct{}) bool {
+	activateAt := time.Unix(0, atomic.LoadInt64(&r.start)).Add(r.activateAfter(workerIndex))
+	d := time.Until(activateAt)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-shutdownCh:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
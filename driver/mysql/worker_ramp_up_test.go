@@ -0,0 +1,62 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkerRampUp(t *testing.T) {
+	r := newWorkerRampUp(4000, 5)
+	now := time.Now()
+	if n := r.effectiveWorkers(now); n != 0 {
+		t.Errorf("expect no worker before begin. got %v", n)
+	}
+	r.begin(now)
+
+	// a worker is added every second
+	prev := 0
+	for _, c := range []struct {
+		elapsed time.Duration
+		workers int
+	}{
+		{0, 1},
+		{999 * time.Millisecond, 1},
+		{time.Second, 2},
+		{2500 * time.Millisecond, 3},
+		{3 * time.Second, 4},
+		{4 * time.Second, 5},
+		{time.Hour, 5},
+	} {
+		n := r.effectiveWorkers(now.Add(c.elapsed))
+		if n != c.workers {
+			t.Errorf("after %v: expect %v workers. got %v", c.elapsed, c.workers, n)
+		}
+		if n < prev {
+			t.Errorf("after %v: workers decrease from %v to %v", c.elapsed, prev, n)
+		}
+		prev = n
+	}
+
+	// without ramp-up, all workers start at once
+	r = newWorkerRampUp(0, 5)
+	r.begin(now)
+	if n := r.effectiveWorkers(now); n != 5 {
+		t.Errorf("expect all workers without ramp-up. got %v", n)
+	}
+
+	// the last worker waits until the end of the period
+	r = newWorkerRampUp(200, 2)
+	r.begin(time.Now())
+	if !r.wait(0, make(chan struct{})) {
+		t.Error("expect worker 0 to start at once")
+	}
+	shutdownCh := make(chan struct{})
+	close(shutdownCh)
+	if r.wait(1, shutdownCh) {
+		t.Error("expect waiting to be stopped by shutdown")
+	}
+	start := time.Now()
+	if !r.wait(1, make(chan struct{})) || time.Since(start) < 100*time.Millisecond {
+		t.Error("expect worker 1 to wait for the ramp-up")
+	}
+}
@@ -78,6 +78,8 @@ type ExtractorOracle struct {
 
 	sendByTimeoutCounter  int
 	sendBySizeFullCounter int
+	// incremental entries grouped but not sent yet
+	entryGroup common.EntryGroup
 
 	natsConn *gonats.Conn
 	waitCh   chan *drivers.ExitResult
@@ -171,6 +173,10 @@ func (e *ExtractorOracle) Run() {
 		e.onError(common.TaskStateDead, errors.Wrap(err, "SrcWatchNats"))
 		return
 	}
+	if err = e.storeManager.CheckPeerCodec(e.subject, "dest", e.mysqlContext.MessageCodec); err != nil {
+		e.onError(common.TaskStateDead, err)
+		return
+	}
 	// init nats
 	e.logger.Info("initNatsPubClient")
 	e.logger.Debug("begin Connect nats server", "NatAddr", e.natsAddr)
@@ -321,6 +327,8 @@ func (e *ExtractorOracle) Stats() (*common.TaskStatistics, error) {
 		HandledTxCount: common.TxCount{
 			ExtractedTxCount: &extractedTxCount,
 		},
+		OpenGroupRows:  e.entryGroup.Rows(),
+		OpenGroupBytes: e.entryGroup.Bytes(),
 	}
 	if e.natsConn != nil {
 		taskResUsage.MsgStat = e.natsConn.Statistics
@@ -683,7 +691,7 @@ func (e *ExtractorOracle) StreamEvents() error {
 			e.logger.Debug("StreamEvents goroutine exited")
 		}()
 		entries := common.DataEntries{}
-		entriesSize := 0
+		group := &e.entryGroup
 		sendEntriesAndClear := func() error {
 			var gno int64 = 0
 			if len(entries.Entries) > 0 {
@@ -694,7 +702,7 @@ func (e *ExtractorOracle) StreamEvents() error {
 				}
 			}
 
-			txMsg, err := common.Encode(&entries)
+			txMsg, err := common.EncodeWith(e.mysqlContext.MessageCodec, &entries)
 			if err != nil {
 				return err
 			}
@@ -709,7 +717,7 @@ func (e *ExtractorOracle) StreamEvents() error {
 
 			e.logger.Debug("publish.after", "gno", gno, "n", len(entries.Entries))
 			entries.Entries = nil
-			entriesSize = 0
+			group.Reset()
 
 			return nil
 		}
@@ -725,11 +733,11 @@ func (e *ExtractorOracle) StreamEvents() error {
 				binlogEntry := entryCtx.Entry
 
 				entries.Entries = append(entries.Entries, binlogEntry)
-				entriesSize += entryCtx.OriginalSize
+				group.Add(entryCtx)
 
-				if entriesSize >= e.mysqlContext.GroupMaxSize {
-					e.logger.Debug("incr. send by GroupLimit",
-						"entriesSize", entriesSize,
+				if limit := group.Full(&e.mysqlContext.DtleTaskConfig); limit != "" {
+					e.logger.Debug("incr. send by GroupLimit", "limit", limit,
+						"entriesSize", group.Size, "rows", group.Rows(), "bytes", group.Bytes(),
 						"groupMaxSize", e.mysqlContext.GroupMaxSize,
 						"Entries.len", len(entries.Entries))
 
@@ -749,7 +757,7 @@ func (e *ExtractorOracle) StreamEvents() error {
 			case <-timer.C:
 				nEntries := len(entries.Entries)
 				if nEntries > 0 {
-					e.logger.Debug("incr. send by timeout.", "entriesSize", entriesSize,
+					e.logger.Debug("incr. send by timeout.", "entriesSize", group.Size,
 						"timeout", e.mysqlContext.GroupTimeout)
 					e.sendByTimeoutCounter += 1
 					err := sendEntriesAndClear()
@@ -834,7 +842,7 @@ func (e *ExtractorOracle) onError(state int, err error) {
 }
 
 func (e *ExtractorOracle) sendFullComplete() (err error) {
-	dumpMsg, err := common.Encode(&common.DumpStatResult{
+	dumpMsg, err := common.EncodeWith(e.mysqlContext.MessageCodec, &common.DumpStatResult{
 		Coord: e.fullCopyCoordinates,
 	})
 	if err != nil {
@@ -981,13 +989,9 @@ func (e *ExtractorOracle) oracleDump() error {
 }
 
 func (e *ExtractorOracle) encodeAndSendDumpEntry(entry *common.DumpEntry) error {
-	bs, err := entry.Marshal(nil)
-	if err != nil {
-		return err
-	}
-	txMsg, err := common.Compress(bs)
+	txMsg, err := common.EncodeWith(e.mysqlContext.MessageCodec, entry)
 	if err != nil {
-		return errors.Wrap(err, "common.Compress")
+		return errors.Wrap(err, "common.EncodeWith")
 	}
 	if err := e.publish(fmt.Sprintf("%s_full", e.subject), txMsg, 0); err != nil {
 		return err
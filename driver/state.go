@@ -84,6 +84,43 @@ func (ts *TaskStoreForApi) GetTaskStatistics(allocId, taskName string) (*common.
 	return nil, false, nil
 }
 
+// GetJobStatistics returns statistics of tasks of the job running in this process, by task name.
+func (ts *TaskStoreForApi) GetJobStatistics(jobName string) (map[string]*common.TaskStatistics, error) {
+	ts.lock.RLock()
+	defer ts.lock.RUnlock()
+
+	r := map[string]*common.TaskStatistics{}
+	for _, t := range ts.store {
+		if t.taskConfig == nil || t.taskConfig.JobName != jobName || t.runner == nil {
+			continue
+		}
+		stats, err := t.runner.Stats()
+		if nil != err {
+			return nil, fmt.Errorf("get stats of task %v failed: %v", t.taskConfig.Name, err)
+		}
+		r[t.taskConfig.Name] = stats
+	}
+	return r, nil
+}
+
+// GetJobSchemaCache returns the cached table definitions of tasks of the job running in this process, by task name.
+// Tasks without a cache are omitted.
+func (ts *TaskStoreForApi) GetJobSchemaCache(jobName string) map[string]map[string]string {
+	ts.lock.RLock()
+	defer ts.lock.RUnlock()
+
+	r := map[string]map[string]string{}
+	for _, t := range ts.store {
+		if t.taskConfig == nil || t.taskConfig.JobName != jobName {
+			continue
+		}
+		if d, ok := t.runner.(schemaCacheDumper); ok {
+			r[t.taskConfig.Name] = d.DumpSchemaCache()
+		}
+	}
+	return r
+}
+
 func (ts *TaskStoreForApi) Delete(id string) {
 	ts.lock.Lock()
 	defer ts.lock.Unlock()
@@ -3,6 +3,7 @@ module github.com/actiontech/dtle
 go 1.16
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/Shopify/sarama v1.26.4
 	github.com/actiontech/golang-live-coverage-report v0.0.0-20210902074032-43aa91afdc2c
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751
@@ -28,6 +29,7 @@ require (
 	github.com/nats-io/go-nats v1.7.2
 	github.com/nats-io/nats-server/v2 v2.7.0
 	github.com/nats-io/nats-streaming-server v0.23.2
+	github.com/nats-io/nats.go v1.13.1-0.20211122170419-d7c1d78a50fc
 	github.com/outbrain/golib v0.0.0-20180830062331-ab954725f502
 	github.com/pingcap/dm v0.0.0-00010101000000-000000000000
 	github.com/pingcap/tidb v1.1.0-beta.0.20211025024448-36e694bfc536
@@ -41,6 +43,7 @@ require (
 	github.com/swaggo/echo-swagger v1.1.0
 	github.com/swaggo/swag v1.7.0
 	github.com/thinkeridea/go-extend v1.3.2
+	github.com/vmihailenco/msgpack/v4 v4.3.12
 	golang.org/x/net v0.0.0-20211112202133-69e39bad7dc2
 	golang.org/x/text v0.3.7
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0